@@ -7,9 +7,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -18,25 +21,78 @@ import (
 )
 
 const (
-	baseURL = "ws://127.0.0.1:9001"
-	agent   = "omdient"
+	baseURL    = "ws://127.0.0.1:9001"
+	agent      = "omdient"
+	configFile = "config/fuzzingserver.json"
 )
 
 func main() {
 	initZeroLog()
+	excluded := excludedCases()
+	checkConfig(configFile, excluded)
+
 	n := getCaseCount()
 	log.Logger.Info().Int("n", n+1).Msg("case count")
 
-	// Not implemented in Omdient (so excluded in "config/fuzzingserver.json"):
-	// - 6.4.*: Fail-fast on invalid UTF-8 frames
-	// - 12.* and 13.*: WebSocket compression
 	for i := range n {
+		if id := getCaseID(i + 1); isExcluded(id, excluded) {
+			log.Logger.Info().Int("case", i+1).Str("id", id).Msg("skipping unsupported test case")
+			continue
+		}
 		runCase(i + 1)
 	}
 
 	updateReports()
 }
 
+// excludedCases returns the patterns of Autobahn test case IDs
+// which are not applicable, based on the capability flags of
+// Omdient's WebSocket client. These patterns should also appear
+// in the "exclude-cases" list in "config/fuzzingserver.json".
+func excludedCases() []string {
+	var cases []string
+	if !websocket.SupportsFailFastUTF8 {
+		cases = append(cases, "6.4.*")
+	}
+	if !websocket.SupportsCompression {
+		cases = append(cases, "12.*", "13.*")
+	}
+	return cases
+}
+
+// checkConfig ensures that the fuzzing server's configuration file
+// excludes exactly the test cases which are not applicable.
+func checkConfig(path string, excluded []string) {
+	b, err := os.ReadFile(path) //gosec:disable G304 -- hardcoded relative path
+	if err != nil {
+		log.Logger.Fatal().Err(err).Str("path", path).Msg("failed to read fuzzing server config")
+	}
+
+	cfg := struct {
+		ExcludeCases []string `json:"exclude-cases"`
+	}{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Logger.Fatal().Err(err).Str("path", path).Msg("failed to parse fuzzing server config")
+	}
+
+	got, want := slices.Sorted(slices.Values(cfg.ExcludeCases)), slices.Sorted(slices.Values(excluded))
+	if !slices.Equal(got, want) {
+		log.Logger.Fatal().Strs("config", got).Strs("want", want).
+			Msg("fuzzing server config doesn't match the capabilities of the WebSocket client")
+	}
+}
+
+// isExcluded checks whether a test case ID (e.g. "6.4.1")
+// matches any of the given patterns (e.g. "6.4.*").
+func isExcluded(id string, patterns []string) bool {
+	for _, p := range patterns {
+		if id == p || (strings.HasSuffix(p, "*") && strings.HasPrefix(id, strings.TrimSuffix(p, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
 func initZeroLog() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
 	zerolog.SetGlobalLevel(zerolog.TraceLevel)
@@ -72,6 +128,30 @@ func getCaseCount() int {
 	return n
 }
 
+// getCaseID retrieves the ID of an enabled test case (e.g. "1.1.1")
+// from the Autobahn fuzzing server, using a WebSocket request.
+func getCaseID(i int) string {
+	conn, err := dial(fmt.Sprintf("%s/getCaseInfo?case=%d", baseURL, i))
+	if err != nil {
+		log.Logger.Fatal().Err(err).Msg("dial error")
+	}
+
+	msg, ok := <-conn.IncomingMessages()
+	if !ok {
+		log.Logger.Debug().Msg("connection closed")
+		return ""
+	}
+
+	info := struct {
+		ID string `json:"id"`
+	}{}
+	if err := json.Unmarshal(msg.Data, &info); err != nil {
+		log.Logger.Fatal().Err(err).Msg("invalid test case info")
+	}
+
+	return info.ID
+}
+
 // updateReports instructs the Autobahn fuzzing server to generate/update
 // all the HTML and JSON files for all the test-case results.
 func updateReports() {
@@ -11,6 +11,8 @@ import (
 	"github.com/urfave/cli/v3"
 
 	"github.com/tzrikka/omdient/internal/thrippy"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/dispatch/kafka"
 	"github.com/tzrikka/omdient/pkg/etcd"
 	"github.com/tzrikka/omdient/pkg/http"
 	"github.com/tzrikka/xdg"
@@ -50,6 +52,8 @@ func flags() []cli.Flag {
 	fs = append(fs, http.Flags(path)...)
 	fs = append(fs, thrippy.Flags(path)...)
 	fs = append(fs, etcd.Flags(path)...)
+	fs = append(fs, dispatch.Flags(path)...)
+	fs = append(fs, kafka.Flags(path)...)
 	return fs
 }
 
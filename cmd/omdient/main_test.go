@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
+
+	"github.com/urfave/cli/v3"
 )
 
 func TestFlags(t *testing.T) {
@@ -21,3 +24,38 @@ func TestConfigDirAndFile(t *testing.T) {
 		t.Errorf("configFile() = %q, want %q", got.SourceURI(), want)
 	}
 }
+
+func TestLogLevelFlag(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		level   string
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			level: "info",
+		},
+		{
+			name:    "invalid",
+			level:   "verbose",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cli.Command{
+				Name:   "omdient",
+				Flags:  flags(),
+				Action: func(context.Context, *cli.Command) error { return nil },
+			}
+
+			err := cmd.Run(t.Context(), []string{"omdient", "--log-level", tt.level})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("cmd.Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
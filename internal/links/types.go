@@ -6,17 +6,27 @@ package links
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/url"
 )
 
 type RequestData struct {
+	LinkID      string
 	PathSuffix  string
+	RemoteAddr  string // Client address, possibly with a port number.
+	RemoteIP    net.IP // Parsed from RemoteAddr, nil if invalid.
 	Headers     http.Header
 	QueryOrForm url.Values
 	RawPayload  []byte
-	JSONPayload map[string]any
+	JSONPayload map[string]any // Numbers are [encoding/json.Number], not float64.
 	LinkSecrets map[string]string
+
+	// EncodedPayload is the request body exactly as received, if it had a
+	// "Content-Encoding" (e.g. gzip), in which case RawPayload is its decoded
+	// form. Authenticity checks may need either one, depending on whether the
+	// sender or an intermediate proxy compressed the body. Nil otherwise.
+	EncodedPayload []byte
 }
 
 type LinkData struct {
@@ -27,4 +37,38 @@ type LinkData struct {
 
 type WebhookHandlerFunc func(ctx context.Context, w http.ResponseWriter, r RequestData) int
 
+// SuffixRouter maps webhook URL path suffixes ("/webhook/{id}/{suffix}") to
+// handlers, so a single link may expose multiple webhooks, each with its own
+// behavior. An empty suffix represents requests without a suffix.
+type SuffixRouter map[string]WebhookHandlerFunc
+
+// VerifierFunc checks the authenticity of a webhook request before it reaches
+// the [WebhookHandlerFunc] of the same link template. It returns an HTTP status
+// code: [http.StatusOK] if the request is authentic, or an error status.
+type VerifierFunc func(ctx context.Context, r RequestData) int
+
 type ConnectionHandlerFunc func(ctx context.Context, data LinkData) int
+
+// ConnectionManager lets webhook handlers start and stop the stateful
+// connections of links, e.g. when a third-party service reports that an app
+// was installed or uninstalled. Both functions return an HTTP status code:
+// [http.StatusNotImplemented] if the link template doesn't support it.
+type ConnectionManager interface {
+	Connect(ctx context.Context, linkID string) int
+	Disconnect(ctx context.Context, linkID string) int
+}
+
+type connectionManagerKey struct{}
+
+// ContextWithConnectionManager returns a copy of the given context
+// which carries a [ConnectionManager], for webhook handlers.
+func ContextWithConnectionManager(ctx context.Context, m ConnectionManager) context.Context {
+	return context.WithValue(ctx, connectionManagerKey{}, m)
+}
+
+// ConnectionManagerFromContext returns the [ConnectionManager] which was
+// attached to the given context with [ContextWithConnectionManager], or nil.
+func ConnectionManagerFromContext(ctx context.Context) ConnectionManager {
+	m, _ := ctx.Value(connectionManagerKey{}).(ConnectionManager)
+	return m
+}
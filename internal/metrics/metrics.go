@@ -0,0 +1,107 @@
+// Package metrics defines Omdient's [Prometheus] metrics, which are
+// exposed by the HTTP server only if the "--metrics" flag is set.
+//
+// [Prometheus]: https://prometheus.io/docs/concepts/metric_types/
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "omdient"
+)
+
+var (
+	// WebhookRequests counts incoming HTTP webhook requests,
+	// by their Thrippy link template and response status code.
+	WebhookRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_requests_total",
+		Help:      "Number of incoming HTTP webhook requests, by link template and status code.",
+	}, []string{"template", "status_code"})
+
+	// WebhookLatency measures the processing time of
+	// link-specific webhook handlers, by their Thrippy link template.
+	WebhookLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_handler_duration_seconds",
+		Help:      "Processing time of link-specific webhook handlers, by link template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"template"})
+
+	// ConnectRequests counts requests to start stateful connections,
+	// by their Thrippy link template and response status code.
+	ConnectRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connect_requests_total",
+		Help:      "Number of requests to start stateful connections, by link template and status code.",
+	}, []string{"template", "status_code"})
+
+	// ActiveConnections tracks the number of stateful connections
+	// (e.g. Slack Socket Mode) which are currently managed by Omdient.
+	ActiveConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_connections",
+		Help:      "Number of stateful connections which are currently active.",
+	})
+
+	// WebSocketReconnections counts replacements of underlying WebSocket
+	// connections in long-running clients, whether planned or not.
+	WebSocketReconnections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_reconnections_total",
+		Help:      "Number of underlying WebSocket connection replacements in long-running clients.",
+	})
+
+	// OversizedEvents counts events which exceeded the maximum size of
+	// a dispatch destination, by the policy that was applied to them.
+	OversizedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oversized_events_total",
+		Help:      "Number of events which exceeded the maximum size of a dispatch destination, by policy.",
+	}, []string{"policy"})
+
+	// SlackAppRateLimited counts "app_rate_limited" notifications from Slack,
+	// which mean that Slack is dropping events instead of delivering them.
+	SlackAppRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slack_app_rate_limited_total",
+		Help:      "Number of Slack notifications that the app exceeded the Events API rate limit.",
+	})
+
+	// DispatchQueueDepth tracks the number of events
+	// which are waiting to be picked up by dispatch workers.
+	DispatchQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dispatch_queue_depth",
+		Help:      "Number of events which are waiting to be dispatched.",
+	})
+)
+
+// Handler registers all of Omdient's metrics in a new Prometheus
+// registry, and returns an HTTP handler which exposes them.
+func Handler() (http.Handler, error) {
+	reg := prometheus.NewRegistry()
+	cs := []prometheus.Collector{
+		WebhookRequests,
+		WebhookLatency,
+		ConnectRequests,
+		ActiveConnections,
+		WebSocketReconnections,
+		OversizedEvents,
+		SlackAppRateLimited,
+		DispatchQueueDepth,
+	}
+
+	for _, c := range cs {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}), nil
+}
@@ -0,0 +1,55 @@
+package thrippy
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// Thrippy doesn't have a batch API, so [BatchLinkData]
+	// sends concurrent requests, but with a reasonable limit.
+	maxBatchWorkers = 8
+)
+
+// LinkResult is the result of a single link lookup in [BatchLinkData].
+// If the link is not found, all of its fields are empty (like [LinkData]).
+type LinkResult struct {
+	Template string
+	Secrets  map[string]string
+	Err      error
+}
+
+// BatchLinkData returns the template names and saved secrets of multiple Thrippy
+// links, using a bounded pool of concurrent [LinkData] calls. Errors are reported
+// per link, so the caller may handle partial results. Duplicate IDs are ignored.
+func BatchLinkData(ctx context.Context, cfg Config, linkIDs []string) map[string]LinkResult {
+	ids := make(chan string)
+	results := make(map[string]LinkResult, len(linkIDs))
+	var mu sync.Mutex
+
+	var wg sync.WaitGroup
+	for range min(maxBatchWorkers, len(linkIDs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				template, secrets, err := LinkData(ctx, cfg, id)
+				mu.Lock()
+				results[id] = LinkResult{Template: template, Secrets: secrets, Err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(linkIDs))
+	for _, id := range linkIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids <- id
+		}
+	}
+	close(ids)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,80 @@
+package thrippy
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+)
+
+// batchServer is a mock Thrippy gRPC server that responds based on the link ID.
+type batchServer struct {
+	thrippypb.UnimplementedThrippyServiceServer
+}
+
+func (s *batchServer) GetLink(_ context.Context, r *thrippypb.GetLinkRequest) (*thrippypb.GetLinkResponse, error) {
+	switch id := r.GetLinkId(); id {
+	case "not_found":
+		return nil, status.Error(codes.NotFound, "link not found")
+	case "error":
+		return nil, status.Error(codes.PermissionDenied, "no access")
+	default:
+		return thrippypb.GetLinkResponse_builder{Template: proto.String("template-" + id)}.Build(), nil
+	}
+}
+
+func (s *batchServer) GetCredentials(_ context.Context, r *thrippypb.GetCredentialsRequest) (*thrippypb.GetCredentialsResponse, error) {
+	return thrippypb.GetCredentialsResponse_builder{
+		Credentials: map[string]string{"id": r.GetLinkId()},
+	}.Build(), nil
+}
+
+func TestBatchLinkData(t *testing.T) {
+	t.Cleanup(func() { _ = Close() })
+
+	_, addr := startGRPCServer(t, &batchServer{})
+	cfg := Config{Addr: addr, Creds: insecureCreds()}
+
+	ids := []string{"a", "b", "not_found", "c", "error", "a", "d", "e", "f", "g", "h", "i"}
+	got := BatchLinkData(t.Context(), cfg, ids)
+
+	if len(got) != len(ids)-1 {
+		t.Errorf("len(BatchLinkData()) = %d, want %d", len(got), len(ids)-1)
+	}
+
+	for _, id := range ids {
+		r, ok := got[id]
+		if !ok {
+			t.Errorf("BatchLinkData()[%q] is missing", id)
+			continue
+		}
+
+		switch id {
+		case "not_found":
+			if r.Template != "" || r.Secrets != nil || r.Err != nil {
+				t.Errorf("BatchLinkData()[%q] = %+v, want empty result", id, r)
+			}
+		case "error":
+			if r.Err == nil {
+				t.Errorf("BatchLinkData()[%q] error = nil, want error", id)
+			}
+		default:
+			if r.Err != nil {
+				t.Errorf("BatchLinkData()[%q] error = %v", id, r.Err)
+			}
+			if r.Template != "template-"+id || r.Secrets["id"] != id {
+				t.Errorf("BatchLinkData()[%q] = %+v, want template and secrets of %q", id, r, id)
+			}
+		}
+	}
+}
+
+func TestBatchLinkDataEmpty(t *testing.T) {
+	if got := BatchLinkData(t.Context(), Config{}, nil); len(got) != 0 {
+		t.Errorf("BatchLinkData() = %v, want empty map", got)
+	}
+}
@@ -0,0 +1,148 @@
+package thrippy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// maxNegativeTTL limits the caching duration of links which are not found
+	// (or not initialized) in Thrippy, to absorb scanning without delaying the
+	// detection of newly-created links for too long.
+	maxNegativeTTL = 10 * time.Second
+
+	// Size limits of the cache, so it can't grow without bounds. Links which are
+	// not found are limited separately, because anyone can send random link IDs.
+	maxEntries         = 10000
+	maxNegativeEntries = 1000
+)
+
+// LinkCache is a short-lived in-memory cache of Thrippy link data, to reduce the
+// number of gRPC round-trips for the same (and mostly static) link IDs. gRPC
+// errors are not cached, but links which are not found are (for a shorter TTL).
+//
+// The cache's size is bounded: expired entries are removed when they're accessed,
+// or when the cache is full. If it's still full after that, existing links evict
+// the entry which expires first, while links which are not found aren't cached.
+type LinkCache struct {
+	cfg Config
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	entries      map[string]cacheEntry
+	negatives    map[string]cacheEntry
+	maxEntries   int
+	maxNegatives int
+	mu           sync.Mutex
+
+	// For unit-testing only.
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	template string
+	secrets  map[string]string
+	expiry   time.Time
+}
+
+// NewLinkCache initializes a [LinkCache] for the given Thrippy gRPC client.
+// If the TTL is not positive, the cache is disabled, i.e. it always calls [LinkData].
+func NewLinkCache(cfg Config, ttl time.Duration) *LinkCache {
+	return &LinkCache{
+		cfg:          cfg,
+		ttl:          ttl,
+		negativeTTL:  min(ttl, maxNegativeTTL),
+		entries:      map[string]cacheEntry{},
+		negatives:    map[string]cacheEntry{},
+		maxEntries:   maxEntries,
+		maxNegatives: maxNegativeEntries,
+		now:          time.Now,
+	}
+}
+
+// LinkData returns the template name and saved secrets of the given Thrippy link,
+// from the cache if they're still fresh, or by calling [LinkData] if they're not.
+func (c *LinkCache) LinkData(ctx context.Context, linkID string) (string, map[string]string, error) {
+	if c.ttl <= 0 {
+		return LinkData(ctx, c.cfg, linkID)
+	}
+
+	now := c.now()
+	if e, ok := c.get(linkID, now); ok {
+		return e.template, e.secrets, nil
+	}
+
+	template, secrets, err := LinkData(ctx, c.cfg, linkID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	c.put(linkID, cacheEntry{template: template, secrets: secrets}, now)
+	return template, secrets, nil
+}
+
+// get returns the fresh cache entry of the given link ID, if there is one.
+// It also removes the link's expired entry, if there is one.
+func (c *LinkCache) get(linkID string, now time.Time) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range []map[string]cacheEntry{c.entries, c.negatives} {
+		if e, ok := m[linkID]; ok {
+			if now.Before(e.expiry) {
+				return e, true
+			}
+			delete(m, linkID)
+		}
+	}
+
+	return cacheEntry{}, false
+}
+
+// put adds a new cache entry for the given link ID, with the
+// TTL and size limit which match whether the link was found.
+func (c *LinkCache) put(linkID string, e cacheEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, limit, ttl := c.entries, c.maxEntries, c.ttl
+	if e.secrets == nil {
+		m, limit, ttl = c.negatives, c.maxNegatives, c.negativeTTL
+	}
+
+	if len(m) >= limit {
+		removeExpired(m, now)
+	}
+	if len(m) >= limit {
+		if e.secrets == nil {
+			return // Don't evict anything for links which are not found.
+		}
+		removeFirstExpiry(m)
+	}
+
+	e.expiry = now.Add(ttl)
+	m[linkID] = e
+}
+
+// removeExpired removes all the expired entries from the given cache map.
+func removeExpired(m map[string]cacheEntry, now time.Time) {
+	for id, e := range m {
+		if !now.Before(e.expiry) {
+			delete(m, id)
+		}
+	}
+}
+
+// removeFirstExpiry removes the entry which expires first from the given cache map.
+func removeFirstExpiry(m map[string]cacheEntry) {
+	var first string
+	var expiry time.Time
+	for id, e := range m {
+		if first == "" || e.expiry.Before(expiry) {
+			first, expiry = id, e.expiry
+		}
+	}
+	delete(m, first)
+}
@@ -0,0 +1,174 @@
+package thrippy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLinkCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		notFound     bool
+		ttl          time.Duration
+		elapsed      []time.Duration // Before each call.
+		wantCalls    int32
+		wantTemplate string
+		wantSecrets  map[string]string
+	}{
+		{
+			name:         "disabled",
+			elapsed:      []time.Duration{0, 0},
+			wantCalls:    2,
+			wantTemplate: "template",
+			wantSecrets:  map[string]string{"aaa": "111"},
+		},
+		{
+			name:         "hit",
+			ttl:          time.Minute,
+			elapsed:      []time.Duration{0, 59 * time.Second},
+			wantCalls:    1,
+			wantTemplate: "template",
+			wantSecrets:  map[string]string{"aaa": "111"},
+		},
+		{
+			name:         "expiry",
+			ttl:          time.Minute,
+			elapsed:      []time.Duration{0, time.Minute, time.Second},
+			wantCalls:    2,
+			wantTemplate: "template",
+			wantSecrets:  map[string]string{"aaa": "111"},
+		},
+		{
+			name:      "negative_hit",
+			notFound:  true,
+			ttl:       time.Minute,
+			elapsed:   []time.Duration{0, 9 * time.Second},
+			wantCalls: 1,
+		},
+		{
+			name:      "negative_expiry",
+			notFound:  true,
+			ttl:       time.Minute,
+			elapsed:   []time.Duration{0, 10 * time.Second},
+			wantCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { _ = Close() })
+
+			srv := newTestServer()
+			if tt.notFound {
+				srv.err = status.Error(codes.NotFound, "link not found")
+			}
+			_, addr := startTestServer(t, srv)
+
+			now := time.Now()
+			c := NewLinkCache(Config{Addr: addr, Creds: insecureCreds()}, tt.ttl)
+			c.now = func() time.Time { return now }
+
+			for _, d := range tt.elapsed {
+				now = now.Add(d)
+				template, secrets, err := c.LinkData(t.Context(), "link ID")
+				if err != nil {
+					t.Fatalf("LinkCache.LinkData() error = %v", err)
+				}
+				if template != tt.wantTemplate {
+					t.Errorf("LinkCache.LinkData() template = %q, want %q", template, tt.wantTemplate)
+				}
+				if !reflect.DeepEqual(secrets, tt.wantSecrets) {
+					t.Errorf("LinkCache.LinkData() secrets = %v, want %v", secrets, tt.wantSecrets)
+				}
+			}
+
+			if n := srv.linkCalls.Load(); n != tt.wantCalls {
+				t.Errorf("number of gRPC calls = %d, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLinkCacheErrorsNotCached(t *testing.T) {
+	t.Cleanup(func() { _ = Close() })
+
+	srv := newTestServer()
+	srv.err = status.Error(codes.Internal, "error")
+	_, addr := startTestServer(t, srv)
+
+	c := NewLinkCache(Config{Addr: addr, Creds: insecureCreds()}, time.Minute)
+	for range 2 {
+		if _, _, err := c.LinkData(t.Context(), "link ID"); err == nil {
+			t.Fatal("LinkCache.LinkData() error = nil, want error")
+		}
+	}
+
+	if n := srv.linkCalls.Load(); n != 2 {
+		t.Errorf("number of gRPC calls = %d, want 2", n)
+	}
+}
+
+func TestLinkCacheSizeLimits(t *testing.T) {
+	t.Cleanup(func() { _ = Close() })
+
+	srv := newTestServer()
+	_, addr := startTestServer(t, srv)
+
+	now := time.Now()
+	c := NewLinkCache(Config{Addr: addr, Creds: insecureCreds()}, time.Minute)
+	c.now = func() time.Time { return now }
+	c.maxEntries = 2
+
+	for _, id := range []string{"a", "b", "c"} {
+		if _, _, err := c.LinkData(t.Context(), id); err != nil {
+			t.Fatalf("LinkCache.LinkData(%q) error = %v", id, err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	// The entry which expires first was evicted.
+	if _, ok := c.entries["a"]; ok || len(c.entries) != 2 {
+		t.Errorf("cache entries after eviction = %v, want b and c", c.entries)
+	}
+
+	// Expired entries are removed before evicting fresh ones.
+	now = now.Add(time.Minute)
+	if _, _, err := c.LinkData(t.Context(), "d"); err != nil {
+		t.Fatalf("LinkCache.LinkData(%q) error = %v", "d", err)
+	}
+	if _, ok := c.entries["d"]; !ok || len(c.entries) != 1 {
+		t.Errorf("cache entries after expiry = %v, want only d", c.entries)
+	}
+}
+
+func TestLinkCacheNegativeSizeLimit(t *testing.T) {
+	t.Cleanup(func() { _ = Close() })
+
+	srv := newTestServer()
+	srv.err = status.Error(codes.NotFound, "link not found")
+	_, addr := startTestServer(t, srv)
+
+	c := NewLinkCache(Config{Addr: addr, Creds: insecureCreds()}, time.Minute)
+	c.maxNegatives = 2
+
+	for _, id := range []string{"a", "b", "c", "c"} {
+		if _, _, err := c.LinkData(t.Context(), id); err != nil {
+			t.Fatalf("LinkCache.LinkData(%q) error = %v", id, err)
+		}
+	}
+
+	// Links which are not found don't evict each other: the last one isn't cached.
+	if _, ok := c.negatives["c"]; ok || len(c.negatives) != 2 {
+		t.Errorf("negative cache entries = %v, want a and b", c.negatives)
+	}
+	if n := srv.linkCalls.Load(); n != 4 {
+		t.Errorf("number of gRPC calls = %d, want 4", n)
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("positive cache entries = %v, want none", c.entries)
+	}
+}
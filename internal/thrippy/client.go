@@ -10,6 +10,9 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -17,12 +20,43 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
-)
 
-const (
-	timeout = 3 * time.Second
+	"github.com/tzrikka/omdient/internal/tracing"
 )
 
+// Config contains the settings of a Thrippy gRPC client.
+type Config struct {
+	Addr  string
+	Creds credentials.TransportCredentials
+
+	// Timeout is the total deadline for each call, including retries.
+	// If it's not positive, the default is [DefaultTimeout].
+	Timeout time.Duration
+
+	// Retries is the maximum number of retries after transient gRPC errors
+	// (Unavailable and DeadlineExceeded), with an exponential Backoff.
+	Retries int
+	Backoff time.Duration
+}
+
+// NewConfig initializes a Thrippy gRPC client [Config] based on CLI flags.
+func NewConfig(cmd *cli.Command) Config {
+	return Config{
+		Addr:    cmd.String("thrippy-server-addr"),
+		Creds:   SecureCreds(cmd),
+		Timeout: cmd.Duration("thrippy-timeout"),
+		Retries: cmd.Int("thrippy-retries"),
+		Backoff: cmd.Duration("thrippy-retry-backoff"),
+	}
+}
+
+func (c Config) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
 // Connection creates a gRPC client connection to the given server address.
 // It supports both secure and insecure connections, based on the given credentials.
 func Connection(addr string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
@@ -31,24 +65,27 @@ func Connection(addr string, creds credentials.TransportCredentials) (*grpc.Clie
 
 // LinkData returns the template name and saved secrets of the given Thrippy link.
 // This function reports gRPC errors, but if the link is not found it returns nothing.
-func LinkData(ctx context.Context, grpcAddr string, creds credentials.TransportCredentials, linkID string) (string, map[string]string, error) {
-	l := zerolog.Ctx(ctx)
+func LinkData(ctx context.Context, cfg Config, linkID string) (string, map[string]string, error) {
+	ctx, span := startSpan(ctx, "thrippy.LinkData", linkID)
+	template, secrets, err := linkData(ctx, cfg, linkID)
+	tracing.End(span, err)
+	return template, secrets, err
+}
 
-	conn, err := Connection(grpcAddr, creds)
-	if err != nil {
-		l.Error().Stack().Err(err).Send()
-		return "", nil, err
-	}
-	defer conn.Close()
+func linkData(ctx context.Context, cfg Config, linkID string) (string, map[string]string, error) {
+	l := zerolog.Ctx(ctx)
 
-	c := thrippypb.NewThrippyServiceClient(conn)
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
 	defer cancel()
 
 	// Template.
-	resp1, err := c.GetLink(ctx, thrippypb.GetLinkRequest_builder{
-		LinkId: proto.String(linkID),
-	}.Build())
+	var resp1 *thrippypb.GetLinkResponse
+	err := withRetries(ctx, cfg, func(c thrippypb.ThrippyServiceClient) (err error) {
+		resp1, err = c.GetLink(ctx, thrippypb.GetLinkRequest_builder{
+			LinkId: proto.String(linkID),
+		}.Build())
+		return err
+	})
 	if err != nil {
 		if status.Code(err) != codes.NotFound {
 			l.Error().Stack().Err(err).Send()
@@ -58,9 +95,13 @@ func LinkData(ctx context.Context, grpcAddr string, creds credentials.TransportC
 	}
 
 	// Credentials.
-	resp2, err := c.GetCredentials(ctx, thrippypb.GetCredentialsRequest_builder{
-		LinkId: proto.String(linkID),
-	}.Build())
+	var resp2 *thrippypb.GetCredentialsResponse
+	err = withRetries(ctx, cfg, func(c thrippypb.ThrippyServiceClient) (err error) {
+		resp2, err = c.GetCredentials(ctx, thrippypb.GetCredentialsRequest_builder{
+			LinkId: proto.String(linkID),
+		}.Build())
+		return err
+	})
 	if err != nil {
 		l.Error().Stack().Err(err).Send()
 		return "", nil, err
@@ -71,23 +112,26 @@ func LinkData(ctx context.Context, grpcAddr string, creds credentials.TransportC
 
 // LinkTemplate returns the template name of a given Thrippy link. This function
 // reports gRPC errors, but if the link is not found it returns an empty string.
-func LinkTemplate(ctx context.Context, grpcAddr string, creds credentials.TransportCredentials, linkID string) (string, error) {
-	l := zerolog.Ctx(ctx)
+func LinkTemplate(ctx context.Context, cfg Config, linkID string) (string, error) {
+	ctx, span := startSpan(ctx, "thrippy.LinkTemplate", linkID)
+	template, err := linkTemplate(ctx, cfg, linkID)
+	tracing.End(span, err)
+	return template, err
+}
 
-	conn, err := Connection(grpcAddr, creds)
-	if err != nil {
-		l.Error().Stack().Err(err).Send()
-		return "", err
-	}
-	defer conn.Close()
+func linkTemplate(ctx context.Context, cfg Config, linkID string) (string, error) {
+	l := zerolog.Ctx(ctx)
 
-	c := thrippypb.NewThrippyServiceClient(conn)
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
 	defer cancel()
 
-	resp, err := c.GetLink(ctx, thrippypb.GetLinkRequest_builder{
-		LinkId: proto.String(linkID),
-	}.Build())
+	var resp *thrippypb.GetLinkResponse
+	err := withRetries(ctx, cfg, func(c thrippypb.ThrippyServiceClient) (err error) {
+		resp, err = c.GetLink(ctx, thrippypb.GetLinkRequest_builder{
+			LinkId: proto.String(linkID),
+		}.Build())
+		return err
+	})
 	if err != nil {
 		if status.Code(err) != codes.NotFound {
 			l.Error().Stack().Err(err).Send()
@@ -98,3 +142,54 @@ func LinkTemplate(ctx context.Context, grpcAddr string, creds credentials.Transp
 
 	return resp.GetTemplate(), nil
 }
+
+// startSpan starts a client span around Thrippy gRPC calls about a specific link.
+func startSpan(ctx context.Context, name, linkID string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc"), tracing.LinkID(linkID)))
+}
+
+// withRetries calls the given function with a (cached) Thrippy gRPC client,
+// and retries it with an exponential backoff after transient errors, until it
+// succeeds, fails with a non-retryable error, exhausts the configured number
+// of retries, or the context's deadline expires - whichever comes first.
+func withRetries(ctx context.Context, cfg Config, f func(thrippypb.ThrippyServiceClient) error) error {
+	backoff := cfg.Backoff
+	for i := 0; ; i++ {
+		conn, err := cachedConnection(cfg.Addr, cfg.Creds)
+		if err != nil {
+			return err
+		}
+
+		err = f(thrippypb.NewThrippyServiceClient(conn))
+		if err == nil {
+			return nil
+		}
+
+		reconnectIfUnavailable(conn, err)
+		if i >= cfg.Retries || !IsTransient(err) {
+			return err
+		}
+
+		zerolog.Ctx(ctx).Debug().Err(err).Int("retry", i+1).Dur("backoff", backoff).
+			Msg("retrying Thrippy gRPC call")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+// IsTransient reports whether the given error indicates that the Thrippy
+// server is temporarily unreachable or overloaded, so the call may be retried.
+func IsTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
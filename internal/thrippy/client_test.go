@@ -5,7 +5,9 @@ import (
 	"errors"
 	"net"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -20,9 +22,23 @@ type server struct {
 	linkResp  *thrippypb.GetLinkResponse
 	credsResp *thrippypb.GetCredentialsResponse
 	err       error
+
+	linkCalls atomic.Int32
+	failures  int32         // Transient errors before the first real response.
+	delay     time.Duration // Simulated slowness.
 }
 
-func (s *server) GetLink(_ context.Context, _ *thrippypb.GetLinkRequest) (*thrippypb.GetLinkResponse, error) {
+func (s *server) GetLink(ctx context.Context, _ *thrippypb.GetLinkRequest) (*thrippypb.GetLinkResponse, error) {
+	if s.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.delay):
+		}
+	}
+	if s.linkCalls.Add(1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "server restarting")
+	}
 	return s.linkResp, s.err
 }
 
@@ -89,7 +105,7 @@ func TestLinkData(t *testing.T) {
 				_ = s.Serve(lis)
 			}()
 
-			template, secrets, err := LinkData(t.Context(), lis.Addr().String(), insecureCreds(), "link ID")
+			template, secrets, err := LinkData(t.Context(), Config{Addr: lis.Addr().String(), Creds: insecureCreds()}, "link ID")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("LinkData() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -151,7 +167,7 @@ func TestLinkTemplate(t *testing.T) {
 				_ = s.Serve(lis)
 			}()
 
-			template, err := LinkTemplate(t.Context(), lis.Addr().String(), insecureCreds(), "link ID")
+			template, err := LinkTemplate(t.Context(), Config{Addr: lis.Addr().String(), Creds: insecureCreds()}, "link ID")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("LinkData() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -162,3 +178,126 @@ func TestLinkTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestLinkDataRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int32
+		respErr   error
+		retries   int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name:      "no_failures",
+			retries:   2,
+			wantCalls: 1,
+		},
+		{
+			name:      "recover_after_two_failures",
+			failures:  2,
+			retries:   2,
+			wantCalls: 3,
+		},
+		{
+			name:      "retries_exhausted",
+			failures:  3,
+			retries:   2,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "retries_disabled",
+			failures:  1,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "non_retryable_error",
+			respErr:   status.Error(codes.PermissionDenied, "no access"),
+			retries:   2,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { _ = Close() })
+
+			srv := newTestServer()
+			srv.failures = tt.failures
+			srv.err = tt.respErr
+			_, addr := startTestServer(t, srv)
+
+			cfg := Config{Addr: addr, Creds: insecureCreds(), Retries: tt.retries, Backoff: time.Millisecond}
+			template, _, err := LinkData(t.Context(), cfg, "link ID")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LinkData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && template != "template" {
+				t.Errorf("LinkData() template = %q, want %q", template, "template")
+			}
+			if n := srv.linkCalls.Load(); n != tt.wantCalls {
+				t.Errorf("number of gRPC calls = %d, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLinkTemplateRetriesDeadline(t *testing.T) {
+	t.Cleanup(func() { _ = Close() })
+
+	srv := newTestServer()
+	srv.failures = 100
+	_, addr := startTestServer(t, srv)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	cfg := Config{Addr: addr, Creds: insecureCreds(), Retries: 100, Backoff: 10 * time.Millisecond}
+	if _, err := LinkTemplate(ctx, cfg, "link ID"); err == nil {
+		t.Fatal("LinkTemplate() error = nil, want Unavailable")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("LinkTemplate() duration = %v, want less than 1s", d)
+	}
+}
+
+func TestLinkTemplateTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		wantErr bool
+	}{
+		{
+			name:  "within_timeout",
+			delay: 50 * time.Millisecond,
+		},
+		{
+			name:    "over_timeout",
+			delay:   150 * time.Millisecond,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { _ = Close() })
+
+			srv := newTestServer()
+			srv.delay = tt.delay
+			_, addr := startTestServer(t, srv)
+
+			cfg := Config{Addr: addr, Creds: insecureCreds(), Timeout: 100 * time.Millisecond, Retries: 2}
+			_, err := LinkTemplate(t.Context(), cfg, "link ID")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LinkTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && status.Code(err) != codes.DeadlineExceeded {
+				t.Errorf("LinkTemplate() error code = %v, want %v", status.Code(err), codes.DeadlineExceeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package thrippy
+
+import (
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// connKey identifies a reusable gRPC client connection.
+type connKey struct {
+	addr  string
+	creds credentials.TransportCredentials
+}
+
+var (
+	conns   = map[connKey]*grpc.ClientConn{}
+	connsMu sync.Mutex
+
+	// dial is a variable only for the purpose of unit-testing.
+	dial = Connection
+)
+
+// cachedConnection returns a lazily-initialized gRPC client connection to the
+// given server address, which is reused by all calls with the same credentials.
+func cachedConnection(addr string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
+	connsMu.Lock()
+	defer connsMu.Unlock()
+
+	k := connKey{addr: addr, creds: creds}
+	if conn, ok := conns[k]; ok {
+		return conn, nil
+	}
+
+	conn, err := dial(addr, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	conns[k] = conn
+	return conn, nil
+}
+
+// reconnectIfUnavailable asks gRPC to reconnect the given cached client connection
+// immediately, instead of waiting for its backoff, if the given error indicates that
+// the server is unavailable. The connection isn't closed or replaced, because other
+// calls may still be using it, and gRPC reconnects it automatically anyway.
+func reconnectIfUnavailable(conn *grpc.ClientConn, err error) {
+	if status.Code(err) == codes.Unavailable {
+		conn.ResetConnectBackoff()
+	}
+}
+
+// Close closes all the cached gRPC client connections. It should be
+// called when shutting down, but it's safe to keep using this package
+// afterwards: subsequent calls will simply reopen the connections.
+func Close() error {
+	connsMu.Lock()
+	defer connsMu.Unlock()
+
+	var errs []error
+	for k, conn := range conns {
+		errs = append(errs, conn.Close())
+		delete(conns, k)
+	}
+
+	return errors.Join(errs...)
+}
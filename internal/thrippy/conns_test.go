@@ -0,0 +1,193 @@
+package thrippy
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+)
+
+// newTestServer returns a mock Thrippy gRPC server with an initialized link.
+func newTestServer() *server {
+	return &server{
+		linkResp: thrippypb.GetLinkResponse_builder{
+			Template: proto.String("template"),
+		}.Build(),
+		credsResp: thrippypb.GetCredentialsResponse_builder{
+			Credentials: map[string]string{"aaa": "111"},
+		}.Build(),
+	}
+}
+
+// startTestServer starts a mock Thrippy gRPC server, and returns its address.
+func startTestServer(t testing.TB, srv *server) (*grpc.Server, string) {
+	t.Helper()
+	return startGRPCServer(t, srv)
+}
+
+// startGRPCServer starts any mock Thrippy gRPC server, and returns its address.
+func startGRPCServer(t testing.TB, srv thrippypb.ThrippyServiceServer) (*grpc.Server, string) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := grpc.NewServer()
+	thrippypb.RegisterThrippyServiceServer(s, srv)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	t.Cleanup(s.Stop)
+	return s, lis.Addr().String()
+}
+
+// countDials replaces [dial] with a wrapper that counts its calls.
+func countDials(t testing.TB) *atomic.Int32 {
+	t.Helper()
+
+	n := new(atomic.Int32)
+	orig := dial
+	dial = func(addr string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
+		n.Add(1)
+		return orig(addr, creds)
+	}
+
+	t.Cleanup(func() {
+		dial = orig
+		_ = Close()
+	})
+	return n
+}
+
+func TestCachedConnectionReuse(t *testing.T) {
+	dials := countDials(t)
+	_, addr := startTestServer(t, newTestServer())
+	cfg := Config{Addr: addr, Creds: insecureCreds()}
+
+	for range 3 {
+		if _, _, err := LinkData(t.Context(), cfg, "link ID"); err != nil {
+			t.Fatalf("LinkData() error = %v", err)
+		}
+		if _, err := LinkTemplate(t.Context(), cfg, "link ID"); err != nil {
+			t.Fatalf("LinkTemplate() error = %v", err)
+		}
+	}
+
+	if n := dials.Load(); n != 1 {
+		t.Errorf("number of dials = %d, want 1", n)
+	}
+
+	if err := Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := LinkTemplate(t.Context(), cfg, "link ID"); err != nil {
+		t.Fatalf("LinkTemplate() after Close() error = %v", err)
+	}
+	if n := dials.Load(); n != 2 {
+		t.Errorf("number of dials after Close() = %d, want 2", n)
+	}
+}
+
+func TestCachedConnectionUnavailable(t *testing.T) {
+	dials := countDials(t)
+	s, addr := startTestServer(t, newTestServer())
+	cfg := Config{Addr: addr, Creds: insecureCreds()}
+
+	if _, err := LinkTemplate(t.Context(), cfg, "link ID"); err != nil {
+		t.Fatalf("LinkTemplate() error = %v", err)
+	}
+
+	s.Stop()
+	if _, err := LinkTemplate(t.Context(), cfg, "link ID"); err == nil {
+		t.Fatal("LinkTemplate() error = nil, want Unavailable")
+	}
+
+	// Restart the server on the same address: gRPC reconnects the cached connection.
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("failed to listen on the same address again: %v", err)
+	}
+	s = grpc.NewServer()
+	thrippypb.RegisterThrippyServiceServer(s, newTestServer())
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	cfg.Retries, cfg.Backoff = 10, 50*time.Millisecond
+	if _, err := LinkTemplate(t.Context(), cfg, "link ID"); err != nil {
+		t.Fatalf("LinkTemplate() after restart error = %v", err)
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("number of dials = %d, want 1", n)
+	}
+}
+
+// unavailableServer fails all calls as unavailable, except those
+// for the link ID "slow", which succeed after a short delay.
+type unavailableServer struct {
+	thrippypb.UnimplementedThrippyServiceServer
+}
+
+func (unavailableServer) GetLink(_ context.Context, r *thrippypb.GetLinkRequest) (*thrippypb.GetLinkResponse, error) {
+	if r.GetLinkId() != "slow" {
+		return nil, status.Error(codes.Unavailable, "overloaded")
+	}
+	time.Sleep(300 * time.Millisecond)
+	return thrippypb.GetLinkResponse_builder{Template: proto.String("template")}.Build(), nil
+}
+
+func TestCachedConnectionUnavailableDuringOtherCalls(t *testing.T) {
+	countDials(t)
+	_, addr := startGRPCServer(t, unavailableServer{})
+	cfg := Config{Addr: addr, Creds: insecureCreds()}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := LinkTemplate(t.Context(), cfg, "slow")
+		errs <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond) // Let the slow call start.
+	if _, err := LinkTemplate(t.Context(), cfg, "fast"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("LinkTemplate() error = %v, want Unavailable", err)
+	}
+
+	if err := <-errs; err != nil {
+		t.Errorf("in-flight LinkTemplate() error = %v, want nil", err)
+	}
+}
+
+func BenchmarkLinkData(b *testing.B) {
+	_, addr := startTestServer(b, newTestServer())
+	cfg := Config{Addr: addr, Creds: insecureCreds()}
+
+	b.Run("reused_conn", func(b *testing.B) {
+		dials := countDials(b)
+		for b.Loop() {
+			_, _, _ = LinkData(b.Context(), cfg, "link ID")
+		}
+		b.ReportMetric(float64(dials.Load())/float64(b.N), "dials/op")
+	})
+
+	b.Run("new_conn_per_call", func(b *testing.B) {
+		dials := countDials(b)
+		for b.Loop() {
+			_, _, _ = LinkData(b.Context(), cfg, "link ID")
+			_ = Close()
+		}
+		b.ReportMetric(float64(dials.Load())/float64(b.N), "dials/op")
+	})
+}
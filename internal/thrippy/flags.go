@@ -1,6 +1,9 @@
 package thrippy
 
 import (
+	"errors"
+	"time"
+
 	altsrc "github.com/urfave/cli-altsrc/v3"
 	"github.com/urfave/cli-altsrc/v3/toml"
 	"github.com/urfave/cli/v3"
@@ -8,6 +11,11 @@ import (
 
 const (
 	DefaultGRPCAddress = "localhost:14460"
+	DefaultTimeout     = 3 * time.Second
+	DefaultCacheTTL    = time.Minute
+
+	DefaultRetries      = 2
+	DefaultRetryBackoff = 100 * time.Millisecond
 )
 
 // Flags defines CLI flags to configure a Thrippy gRPC client. These flags can also
@@ -23,6 +31,44 @@ func Flags(configFilePath altsrc.StringSourcer) []cli.Flag {
 				toml.TOML("thrippy.server_address", configFilePath),
 			),
 		},
+		&cli.DurationFlag{
+			Name:  "thrippy-timeout",
+			Usage: "total deadline of each Thrippy gRPC call, including retries",
+			Value: DefaultTimeout,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_TIMEOUT"),
+				toml.TOML("thrippy.timeout", configFilePath),
+			),
+			Validator: validateTimeout,
+		},
+		&cli.IntFlag{
+			Name:  "thrippy-retries",
+			Usage: "maximum number of retries after transient Thrippy gRPC errors",
+			Value: DefaultRetries,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_RETRIES"),
+				toml.TOML("thrippy.retries", configFilePath),
+			),
+			Validator: validateRetries,
+		},
+		&cli.DurationFlag{
+			Name:  "thrippy-retry-backoff",
+			Usage: "initial delay between retries of Thrippy gRPC calls (doubled after each retry)",
+			Value: DefaultRetryBackoff,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_RETRY_BACKOFF"),
+				toml.TOML("thrippy.retry_backoff", configFilePath),
+			),
+		},
+		&cli.DurationFlag{
+			Name:  "thrippy-cache-ttl",
+			Usage: "caching duration of Thrippy link data (0 = no caching)",
+			Value: DefaultCacheTTL,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_CACHE_TTL"),
+				toml.TOML("thrippy.cache_ttl", configFilePath),
+			),
+		},
 		&cli.StringFlag{
 			Name:  "thrippy-client-cert",
 			Usage: "Thrippy gRPC client's public certificate PEM file (mTLS only)",
@@ -60,3 +106,17 @@ func Flags(configFilePath altsrc.StringSourcer) []cli.Flag {
 		},
 	}
 }
+
+func validateRetries(n int) error {
+	if n < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func validateTimeout(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("must be a positive duration")
+	}
+	return nil
+}
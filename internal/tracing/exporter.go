@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+)
+
+const (
+	tracesPath    = "/v1/traces"
+	exportTimeout = 10 * time.Second
+)
+
+// EndpointURL returns the full URL of the given OTLP/HTTP collector endpoint.
+// If it doesn't specify a scheme, HTTP is assumed. If it doesn't specify a path,
+// the default OTLP/HTTP traces path ("/v1/traces") is used.
+func EndpointURL(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid OTLP endpoint: unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", errors.New("invalid OTLP endpoint: missing host")
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = tracesPath
+	}
+
+	return u.String(), nil
+}
+
+// newExporter initializes an OTLP/HTTP span exporter for the given endpoint
+// (see [EndpointURL]). Plain HTTP endpoints are used without TLS.
+func newExporter(ctx context.Context, endpoint string) (*otlptrace.Exporter, error) {
+	u, err := EndpointURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(u), otlptracehttp.WithTimeout(exportTimeout))
+}
@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEndpointURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "host_and_port",
+			endpoint: "localhost:4318",
+			want:     "http://localhost:4318/v1/traces",
+		},
+		{
+			name:     "http_url",
+			endpoint: "http://collector:4318/",
+			want:     "http://collector:4318/v1/traces",
+		},
+		{
+			name:     "https_url_with_path",
+			endpoint: "https://collector.example.com/otlp/v1/traces",
+			want:     "https://collector.example.com/otlp/v1/traces",
+		},
+		{
+			name:     "unsupported_scheme",
+			endpoint: "grpc://localhost:4317",
+			wantErr:  true,
+		},
+		{
+			name:     "missing_host",
+			endpoint: "http://",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EndpointURL(tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EndpointURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("EndpointURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExporter(t *testing.T) {
+	var mu sync.Mutex
+	spans := map[string]*tracepb.Span{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tracesPath {
+			t.Errorf("request path = %q, want %q", r.URL.Path, tracesPath)
+		}
+
+		req := &coltracepb.ExportTraceServiceRequest{}
+		b, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(b, req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.GetResourceSpans() {
+			for _, ss := range rs.GetScopeSpans() {
+				for _, s := range ss.GetSpans() {
+					spans[s.GetName()] = s
+				}
+			}
+		}
+	}))
+	defer ts.Close()
+
+	exp, err := newExporter(t.Context(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	ctx, parent := tp.Tracer(instrumentationName).Start(t.Context(), "parent", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := tp.Tracer(instrumentationName).Start(ctx, "child")
+	End(child, errors.New("oops"))
+	parent.End()
+
+	if err := tp.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	p, c := spans["parent"], spans["child"]
+	if p == nil || c == nil {
+		t.Fatalf("exported spans = %v, want parent and child", spans)
+	}
+	if !bytes.Equal(c.GetParentSpanId(), p.GetSpanId()) {
+		t.Errorf("child span's parent = %x, want %x", c.GetParentSpanId(), p.GetSpanId())
+	}
+	if c.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR || len(c.GetEvents()) != 1 {
+		t.Errorf("child span = %v, want an error status and event", c)
+	}
+}
+
+func TestLinkID(t *testing.T) {
+	id := "dkZbuTi5FxXEGWAq2jxDdA"
+	got := LinkID(id).Value.AsString()
+
+	if got == id {
+		t.Error("LinkID() exposes the link ID")
+	}
+	if len(got) != 16 {
+		t.Errorf("LinkID() = %q, want 16 hex characters", got)
+	}
+	if other := LinkID(id + "x").Value.AsString(); other == got {
+		t.Error("LinkID() returned the same hash for different IDs")
+	}
+}
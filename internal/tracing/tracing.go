@@ -0,0 +1,78 @@
+// Package tracing defines Omdient's [OpenTelemetry] spans, which are
+// exported with OTLP only if the "--otel-endpoint" flag is set.
+//
+// [OpenTelemetry]: https://opentelemetry.io/docs/concepts/signals/traces/
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/tzrikka/omdient"
+	serviceName         = "omdient"
+)
+
+// Span attribute keys.
+const (
+	TemplateKey   = attribute.Key("omdient.link.template")
+	LinkIDKey     = attribute.Key("omdient.link.id_hash")
+	EventTypeKey  = attribute.Key("omdient.event.type")
+	StatusCodeKey = attribute.Key("http.response.status_code")
+)
+
+// Init configures the global OpenTelemetry tracer provider to export spans to
+// the given OTLP/HTTP endpoint (e.g. "http://localhost:4318"), and the global
+// propagator to extract W3C trace context from incoming requests. If the endpoint
+// is empty, tracing remains disabled. The returned function flushes and stops
+// the exporter, and must be called before the application exits.
+func Init(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := newExporter(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns Omdient's tracer from the global tracer provider.
+// It is a no-op unless tracing was enabled with [Init].
+func Tracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(instrumentationName)
+}
+
+// LinkID returns a span attribute which identifies a Thrippy link without
+// exposing its ID, because the ID is used as a secret in webhook URLs.
+func LinkID(id string) attribute.KeyValue {
+	sum := sha256.Sum256([]byte(id))
+	return LinkIDKey.String(hex.EncodeToString(sum[:8]))
+}
+
+// End records the given error (if it isn't nil) in the given span, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
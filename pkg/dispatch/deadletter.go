@@ -0,0 +1,320 @@
+package dispatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lithammer/shortuuid/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sinkTimeout = 5 * time.Second
+)
+
+// DeadLetterEntry is a record of an [Event] which could not be delivered,
+// which can be stored in a [DeadLetterSink], for inspection and replay.
+// It doesn't contain the event's typed representation, only its raw payload.
+type DeadLetterEntry struct {
+	ID         string         `json:"id"`
+	EventID    string         `json:"event_id,omitempty"`
+	LinkID     string         `json:"link_id"`
+	LinkType   string         `json:"link_type"`
+	Type       string         `json:"type,omitempty"`
+	ReceivedAt time.Time      `json:"received_at"`
+	Truncated  bool           `json:"truncated,omitempty"`
+	Payload    map[string]any `json:"payload"`
+
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"` // Number of failed deliveries so far.
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// NewDeadLetterEntry creates a [DeadLetterEntry] record with a unique ID, for
+// an [Event] which could not be delivered because of the given error.
+func NewDeadLetterEntry(e Event, err error) DeadLetterEntry {
+	return DeadLetterEntry{
+		ID:         shortuuid.New(),
+		EventID:    e.ID,
+		LinkID:     e.LinkID,
+		LinkType:   e.LinkType,
+		Type:       e.Type,
+		ReceivedAt: e.ReceivedAt,
+		Truncated:  e.Truncated,
+		Payload:    e.Payload,
+		Error:      err.Error(),
+		Attempts:   e.attempts,
+		FailedAt:   time.Now().UTC(),
+	}
+}
+
+// ParseDeadLetterEntry decodes a JSON-encoded [DeadLetterEntry]. Numbers in
+// the payload are decoded as [json.Number], like in [Event] payloads.
+func ParseDeadLetterEntry(b []byte) (DeadLetterEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var d DeadLetterEntry
+	if err := dec.Decode(&d); err != nil {
+		return DeadLetterEntry{}, fmt.Errorf("failed to decode dead letter: %w", err)
+	}
+	return d, nil
+}
+
+// Event converts a [DeadLetterEntry] back into an [Event], to replay it. If the
+// replay fails too, the new dead letter's attempt count continues this one's.
+func (d DeadLetterEntry) Event() Event {
+	return Event{
+		ID:         d.EventID,
+		LinkID:     d.LinkID,
+		LinkType:   d.LinkType,
+		Type:       d.Type,
+		ReceivedAt: d.ReceivedAt,
+		Truncated:  d.Truncated,
+		Payload:    d.Payload,
+		attempts:   d.Attempts,
+	}
+}
+
+// DeadLetterSink stores [DeadLetterEntry]s.
+type DeadLetterSink interface {
+	Put(ctx context.Context, d DeadLetterEntry) error
+}
+
+// DeadLetterStore is a [DeadLetterSink] which also allows
+// to inspect and delete the stored [DeadLetterEntry]s, to replay them.
+type DeadLetterStore interface {
+	DeadLetterSink
+	List(ctx context.Context) ([]DeadLetterEntry, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// SinkFunc returns a [DeadLetterFunc] which stores undelivered [Event]s in
+// the given [DeadLetterSink]. If that fails too, the events are logged instead.
+func SinkFunc(s DeadLetterSink) DeadLetterFunc {
+	return func(e Event, err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+		defer cancel()
+
+		if errSink := s.Put(ctx, NewDeadLetterEntry(e, err)); errSink != nil {
+			log.Err(errSink).Msg("failed to store dead letter")
+			logDeadLetter(e, err)
+		}
+	}
+}
+
+// FileSink is a [DeadLetterStore] which appends [DeadLetterEntry]s to a
+// local file, as JSON lines. It's safe for concurrent use within a
+// single process, but the file must not be shared between processes.
+//
+// Deleted entries are marked with appended tombstone lines, and the file is
+// compacted when at least half of its entries are deleted, so deleting all the
+// entries one by one (e.g. when replaying them) takes linear time overall.
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+
+	// Numbers of entry lines and tombstone lines in the file,
+	// which are unknown until the file is read for the first time.
+	entries, tombstones int
+	counted             bool
+}
+
+// tombstone marks a deleted [DeadLetterEntry] in a [FileSink]'s file.
+type tombstone struct {
+	Deleted string `json:"deleted"`
+}
+
+// tombstonePrefix distinguishes [tombstone] lines from [DeadLetterEntry] lines.
+var tombstonePrefix = []byte(`{"deleted":`)
+
+// NewFileSink initializes a [FileSink]. The file
+// is created when the first [DeadLetterEntry] is stored.
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+// Put appends a [DeadLetterEntry] to the file.
+func (s *FileSink) Put(_ context.Context, d DeadLetterEntry) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(b); err != nil {
+		return err
+	}
+	s.entries++
+	return nil
+}
+
+// List returns all the [DeadLetterEntry]s in the file, in the order they were stored.
+func (s *FileSink) List(_ context.Context) ([]DeadLetterEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+// Delete removes a [DeadLetterEntry] from the file. This is a no-op if it doesn't exist.
+func (s *FileSink) Delete(_ context.Context, id string) error {
+	b, err := json.Marshal(tombstone{Deleted: id})
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter tombstone: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.counted {
+		if _, err := s.read(); err != nil {
+			return err
+		}
+	}
+	if s.entries == 0 {
+		return nil
+	}
+
+	if err := s.append(b); err != nil {
+		return err
+	}
+	s.tombstones++
+
+	if s.tombstones*2 < s.entries {
+		return nil
+	}
+	return s.compact()
+}
+
+// append writes a single JSON line to the end of the file.
+// The caller must hold the mutex.
+func (s *FileSink) append(b []byte) error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //gosec:disable G304 -- user-specified file by design
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compact rewrites the file without deleted entries and tombstones.
+// The caller must hold the mutex.
+func (s *FileSink) compact() error {
+	ds, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, d := range ds {
+		b, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("failed to encode dead letter: %w", err)
+		}
+		buf.Write(append(b, '\n'))
+	}
+
+	// Replace the file atomically.
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	s.entries, s.tombstones = len(ds), 0
+	return nil
+}
+
+// read returns all the remaining [DeadLetterEntry]s in the file, and updates
+// the numbers of entry and tombstone lines. The caller must hold the mutex.
+func (s *FileSink) read() ([]DeadLetterEntry, error) {
+	f, err := os.Open(s.path) //gosec:disable G304 -- user-specified file by design
+	if os.IsNotExist(err) {
+		s.entries, s.tombstones, s.counted = 0, 0, true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ds []DeadLetterEntry
+	deleted := map[string]bool{}
+	tombstones := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20) // Payloads may be large.
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		if bytes.HasPrefix(line, tombstonePrefix) {
+			var t tombstone
+			if err := json.Unmarshal(line, &t); err != nil {
+				return nil, fmt.Errorf("failed to decode dead letter tombstone: %w", err)
+			}
+			deleted[t.Deleted] = true
+			tombstones++
+			continue
+		}
+
+		d, err := ParseDeadLetterEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	s.entries, s.tombstones, s.counted = len(ds), tombstones, true
+	return slices.DeleteFunc(ds, func(d DeadLetterEntry) bool { return deleted[d.ID] }), nil
+}
+
+type dispatcherSink struct {
+	d Dispatcher
+}
+
+// NewDispatcherSink returns a [DeadLetterSink] which delivers [DeadLetterEntry]s
+// with a secondary [Dispatcher], e.g. to a dedicated Kafka topic. They are
+// delivered as [Event]s whose type is "dead_letter", and whose payload
+// contains the original event's type and payload, and the failure details.
+func NewDispatcherSink(d Dispatcher) DeadLetterSink {
+	return &dispatcherSink{d: d}
+}
+
+func (s *dispatcherSink) Put(ctx context.Context, d DeadLetterEntry) error {
+	return s.d.Dispatch(ctx, Event{
+		LinkID:     d.LinkID,
+		LinkType:   d.LinkType,
+		Type:       "dead_letter",
+		ReceivedAt: d.ReceivedAt,
+		Truncated:  d.Truncated,
+		Payload: map[string]any{
+			"id":        d.ID,
+			"event_id":  d.EventID,
+			"type":      d.Type,
+			"payload":   d.Payload,
+			"error":     d.Error,
+			"attempts":  d.Attempts,
+			"failed_at": d.FailedAt.Format(time.RFC3339Nano),
+		},
+	})
+}
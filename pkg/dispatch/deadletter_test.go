@@ -0,0 +1,198 @@
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueueDeadLetterEntries(t *testing.T) {
+	sink := NewFileSink(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	q := NewQueue(&recordingDispatcher{}, 3, SinkFunc(sink))
+
+	payload := map[string]any{"id": json.Number("9007199254740993")}
+	for _, id := range []string{"fail", "ok", "fail"} {
+		if err := q.Enqueue(Event{LinkID: id, LinkType: "test", Payload: payload}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	ds, err := sink.List(t.Context())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(ds) != 2 {
+		t.Fatalf("dead letters = %d, want 2", len(ds))
+	}
+	for _, d := range ds {
+		if d.ID == "" || d.LinkID != "fail" || d.LinkType != "test" || d.Error != "delivery error" || d.Attempts != 1 {
+			t.Errorf("dead letter = %+v", d)
+		}
+		if !reflect.DeepEqual(d.Payload, payload) {
+			t.Errorf("dead letter payload = %#v, want %#v", d.Payload, payload)
+		}
+	}
+
+	// Replaying a dead letter which fails again increments its attempt count.
+	q = NewQueue(&recordingDispatcher{}, 1, SinkFunc(sink))
+	if err := q.Enqueue(ds[0].Event()); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	ds, err = sink.List(t.Context())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(ds) != 3 || ds[2].Attempts != 2 {
+		t.Errorf("dead letters after replay = %+v, want a third one with 2 attempts", ds)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	s := NewFileSink(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	ctx := t.Context()
+
+	ds, err := s.List(ctx)
+	if err != nil || len(ds) != 0 {
+		t.Fatalf("List() before Put() = %v, %v", ds, err)
+	}
+
+	d1 := DeadLetterEntry{ID: "1", LinkID: "a", Payload: map[string]any{"n": json.Number("1")}, Error: "e", Attempts: 1}
+	d2 := DeadLetterEntry{ID: "2", LinkID: "b", Payload: map[string]any{}, Error: "e", Attempts: 3}
+	for _, d := range []DeadLetterEntry{d1, d2} {
+		if err := s.Put(ctx, d); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if ds, err = s.List(ctx); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []DeadLetterEntry{d1, d2}; !reflect.DeepEqual(ds, want) {
+		t.Errorf("List() = %+v, want %+v", ds, want)
+	}
+
+	if err := s.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := s.Delete(ctx, "missing"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if ds, err = s.List(ctx); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []DeadLetterEntry{d2}; !reflect.DeepEqual(ds, want) {
+		t.Errorf("List() after Delete() = %+v, want %+v", ds, want)
+	}
+}
+
+func TestFileSinkTombstones(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	s := NewFileSink(path)
+	ctx := t.Context()
+
+	for i := range 10 {
+		if err := s.Put(ctx, DeadLetterEntry{ID: fmt.Sprint(i), LinkID: "a", Error: "e"}); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// Deletions are appended, until at least half of the entries are deleted.
+	for i := range 4 {
+		if err := s.Delete(ctx, fmt.Sprint(i)); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+	if got := countLines(t, path); got != 14 {
+		t.Errorf("file lines after 4 deletions = %d, want 14", got)
+	}
+
+	// Deletions persist across restarts.
+	s = NewFileSink(path)
+	ds, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(ds) != 6 || ds[0].ID != "4" {
+		t.Errorf("List() after restart = %+v, want entries 4-9", ds)
+	}
+
+	if err := s.Delete(ctx, "4"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := countLines(t, path); got != 5 {
+		t.Errorf("file lines after compaction = %d, want 5", got)
+	}
+
+	for i := 5; i < 10; i++ {
+		if err := s.Delete(ctx, fmt.Sprint(i)); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+	if got := countLines(t, path); got != 0 {
+		t.Errorf("file lines after deleting all entries = %d, want 0", got)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return bytes.Count(b, []byte("\n"))
+}
+
+// eventRecorder records dispatched events.
+type eventRecorder struct {
+	events []Event
+}
+
+func (r *eventRecorder) Dispatch(_ context.Context, e Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestDispatcherSink(t *testing.T) {
+	r := &eventRecorder{}
+	failedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := DeadLetterEntry{ID: "1", LinkID: "a", LinkType: "slack", Type: "message", Error: "e", Attempts: 2, FailedAt: failedAt}
+
+	if err := NewDispatcherSink(r).Put(t.Context(), d); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if len(r.events) != 1 {
+		t.Fatalf("dispatched events = %d, want 1", len(r.events))
+	}
+
+	e := r.events[0]
+	if e.LinkID != "a" || e.LinkType != "slack" || e.Type != "dead_letter" {
+		t.Errorf("dispatched event = %+v", e)
+	}
+	want := map[string]any{
+		"id":        "1",
+		"event_id":  "",
+		"type":      "message",
+		"payload":   map[string]any(nil),
+		"error":     "e",
+		"attempts":  2,
+		"failed_at": "2025-01-02T03:04:05Z",
+	}
+	if !reflect.DeepEqual(e.Payload, want) {
+		t.Errorf("dispatched event payload = %#v, want %#v", e.Payload, want)
+	}
+}
@@ -0,0 +1,123 @@
+// Package dispatch delivers asynchronous event notifications, which were
+// received by link-specific handlers in [pkg/links], to their destination.
+//
+// [pkg/links]: https://pkg.go.dev/github.com/tzrikka/omdient/pkg/links
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Event is a single asynchronous event notification
+// from a third-party service, which was received by Omdient.
+type Event struct {
+	ID         string // Unique, assigned by [Queue.Enqueue] if empty.
+	LinkID     string
+	LinkType   string // E.g. "github", "slack".
+	ReceivedAt time.Time
+	Payload    map[string]any // Numbers are [json.Number], to preserve large IDs.
+	Truncated  bool           // See [WithMaxSize].
+
+	// Type and Typed are set by link handlers for well-known event types
+	// (e.g. Slack "message", GitHub "push"), in addition to the raw payload.
+	// Typed is a pointer to a link-specific struct. It's nil for other event
+	// types, which are available only as raw payloads, but link handlers
+	// may still set their Type (e.g. Slack Events API callbacks).
+	Type  string
+	Typed any
+
+	// spanContext links the dispatch span to the span which received
+	// the event, because dispatching is asynchronous (see [Enqueue]).
+	spanContext trace.SpanContext
+
+	// done reports the outcome of the event's delivery (see [Queue.EnqueueFunc]).
+	done func(error)
+
+	// attempts counts delivery attempts, including
+	// previous ones of replayed events (see [DeadLetterEntry]).
+	attempts int
+}
+
+// As stores the event in the given target, which must be a non-nil pointer.
+// If the target's type matches the event's typed representation, it is copied
+// directly. Otherwise, the raw payload is decoded into the target (see [Decode]).
+func (e Event) As(target any) error {
+	tv := reflect.ValueOf(target)
+	if tv.Kind() != reflect.Pointer || tv.IsNil() {
+		return errors.New("target must be a non-nil pointer")
+	}
+
+	if e.Typed != nil {
+		if ev := reflect.ValueOf(e.Typed); ev.Type() == tv.Type() && !ev.IsNil() {
+			tv.Elem().Set(ev.Elem())
+			return nil
+		}
+	}
+
+	return Decode(e.Payload, target)
+}
+
+// Decode converts a generic JSON value (e.g. an [Event] payload,
+// or a part of it) into a specific struct, by round-tripping it.
+func Decode(v, target any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to re-encode event payload: %w", err)
+	}
+	if err := json.Unmarshal(b, target); err != nil {
+		return fmt.Errorf("failed to decode event payload: %w", err)
+	}
+	return nil
+}
+
+// Dispatcher delivers [Event]s to their destination.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, e Event) error
+}
+
+// AsyncDispatcher is a [Dispatcher] which can also deliver [Event]s without
+// waiting for each one to complete, e.g. to batch them. [Queue] workers prefer
+// it, so each shard hands over its events in order, but not one at a time.
+type AsyncDispatcher interface {
+	Dispatcher
+
+	// DispatchAsync starts delivering an [Event], and calls the given function
+	// exactly once, when the delivery succeeds or fails, or when the context is
+	// canceled. Events of the same link must be delivered in the order of calls.
+	DispatchAsync(ctx context.Context, e Event, done func(error))
+}
+
+// dispatchAsync delivers an [Event] with the given [Dispatcher]'s DispatchAsync
+// method if it's an [AsyncDispatcher], or otherwise with its Dispatch method.
+func dispatchAsync(ctx context.Context, d Dispatcher, e Event, done func(error)) {
+	if ad, ok := d.(AsyncDispatcher); ok {
+		ad.DispatchAsync(ctx, e, done)
+		return
+	}
+	done(d.Dispatch(ctx, e))
+}
+
+// LogDispatcher is a [Dispatcher] which only logs [Event]s,
+// for development and as a fallback when no destination is configured.
+type LogDispatcher struct{}
+
+func (LogDispatcher) Dispatch(ctx context.Context, e Event) error {
+	l := zerolog.Ctx(ctx)
+	if l.GetLevel() == zerolog.Disabled {
+		l = &log.Logger
+	}
+
+	l.Debug().Str("event_id", e.ID).Str("link_id", e.LinkID).Str("link_type", e.LinkType).
+		Str("type", e.Type).Time("received_at", e.ReceivedAt).Bool("truncated", e.Truncated).
+		Any("payload", e.Payload).Msg("dispatched event")
+	return nil
+}
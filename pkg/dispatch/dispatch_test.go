@@ -0,0 +1,68 @@
+package dispatch
+
+import (
+	"testing"
+)
+
+type testEvent struct {
+	Text string `json:"text"`
+}
+
+type otherEvent struct {
+	Type string `json:"type"`
+}
+
+func TestEventAs(t *testing.T) {
+	typed := Event{
+		Payload: map[string]any{"type": "foo", "text": "raw"},
+		Type:    "foo",
+		Typed:   &testEvent{Text: "typed"},
+	}
+
+	// Same type as the typed representation.
+	got := testEvent{}
+	if err := typed.As(&got); err != nil {
+		t.Fatalf("Event.As() error = %v", err)
+	}
+	if got.Text != "typed" {
+		t.Errorf("Event.As() = %+v, want typed representation", got)
+	}
+
+	// Different type: decoded from the raw payload.
+	other := otherEvent{}
+	if err := typed.As(&other); err != nil {
+		t.Fatalf("Event.As() error = %v", err)
+	}
+	if other.Type != "foo" {
+		t.Errorf("Event.As() = %+v, want decoded from payload", other)
+	}
+
+	// Unknown type: decoded from the raw payload.
+	raw := Event{Payload: map[string]any{"text": "raw"}}
+	got = testEvent{}
+	if err := raw.As(&got); err != nil {
+		t.Fatalf("Event.As() error = %v", err)
+	}
+	if got.Text != "raw" {
+		t.Errorf("Event.As() = %+v, want decoded from payload", got)
+	}
+
+	m := map[string]any{}
+	if err := raw.As(&m); err != nil || m["text"] != "raw" {
+		t.Errorf("Event.As(map) = %v, %v", m, err)
+	}
+}
+
+func TestEventAsInvalidTarget(t *testing.T) {
+	e := Event{Payload: map[string]any{"text": "raw"}}
+	if err := e.As(testEvent{}); err == nil {
+		t.Error("Event.As(non-pointer) error = nil")
+	}
+	var p *testEvent
+	if err := e.As(p); err == nil {
+		t.Error("Event.As(nil pointer) error = nil")
+	}
+	if err := (Event{Payload: map[string]any{"text": 1}}).As(&testEvent{}); err == nil {
+		t.Error("Event.As(mismatching payload) error = nil")
+	}
+}
@@ -0,0 +1,158 @@
+package dispatch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli-altsrc/v3/toml"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	DefaultDispatcher   = "log"
+	DefaultShards       = 8
+	DefaultQueueSize    = 1000
+	DefaultDrainTimeout = 10 * time.Second
+	DefaultDeadLetter   = "log"
+)
+
+// Flags defines CLI flags to configure event dispatching. These flags can also
+// be set using environment variables and the application's configuration file.
+func Flags(configFilePath altsrc.StringSourcer) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "dispatch",
+			Usage: `destination of dispatched events: "log" or "kafka"`,
+			Value: DefaultDispatcher,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH"),
+				toml.TOML("dispatch.destination", configFilePath),
+			),
+			Validator: validateDispatcher,
+		},
+		&cli.IntFlag{
+			Name:  "dispatch-shards",
+			Usage: "number of events to dispatch concurrently (events are sharded by link ID, so each link's events are dispatched in order)",
+			Value: DefaultShards,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_SHARDS"),
+				toml.TOML("dispatch.shards", configFilePath),
+			),
+			Validator: validateShards,
+		},
+		&cli.IntFlag{
+			Name:  "dispatch-queue-size",
+			Usage: "maximum number of events waiting to be dispatched",
+			Value: DefaultQueueSize,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_QUEUE_SIZE"),
+				toml.TOML("dispatch.queue_size", configFilePath),
+			),
+			Validator: validateQueueSize,
+		},
+		&cli.DurationFlag{
+			Name:  "dispatch-drain-timeout",
+			Usage: "maximum time to dispatch queued events when shutting down",
+			Value: DefaultDrainTimeout,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_DRAIN_TIMEOUT"),
+				toml.TOML("dispatch.drain_timeout", configFilePath),
+			),
+			Validator: validateDrainTimeout,
+		},
+		&cli.IntFlag{
+			Name:  "dispatch-max-event-bytes",
+			Usage: "maximum JSON size of dispatched event payloads, in bytes (0 = unlimited)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_MAX_EVENT_BYTES"),
+				toml.TOML("dispatch.max_event_bytes", configFilePath),
+			),
+			Validator: validateMaxEventBytes,
+		},
+		&cli.StringFlag{
+			Name:  "dispatch-oversize-policy",
+			Usage: `handling of oversized events: "dead-letter" or "truncate"`,
+			Value: string(DeadLetter),
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_OVERSIZE_POLICY"),
+				toml.TOML("dispatch.oversize_policy", configFilePath),
+			),
+			Validator: validateOversizePolicy,
+		},
+		&cli.StringFlag{
+			Name:  "dead-letter",
+			Usage: `destination of events which failed to be dispatched: "log", "file", "etcd", or "kafka"`,
+			Value: DefaultDeadLetter,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DEAD_LETTER"),
+				toml.TOML("dispatch.dead_letter", configFilePath),
+			),
+			Validator: validateDeadLetter,
+		},
+		&cli.StringFlag{
+			Name:  "dead-letter-file",
+			Usage: `path of a JSON lines file for failed events, if "dead-letter" is "file"`,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DEAD_LETTER_FILE"),
+				toml.TOML("dispatch.dead_letter_file", configFilePath),
+			),
+		},
+	}
+}
+
+func validateDispatcher(s string) error {
+	switch s {
+	case "log", "kafka":
+		return nil
+	default:
+		return errors.New(`must be "log" or "kafka"`)
+	}
+}
+
+func validateShards(n int) error {
+	if n < 1 {
+		return errors.New("must be a positive number")
+	}
+	return nil
+}
+
+func validateDeadLetter(s string) error {
+	switch s {
+	case "log", "file", "etcd", "kafka":
+		return nil
+	default:
+		return errors.New(`must be "log", "file", "etcd", or "kafka"`)
+	}
+}
+
+func validateQueueSize(n int) error {
+	if n < 1 {
+		return errors.New("must be a positive number")
+	}
+	return nil
+}
+
+func validateDrainTimeout(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("must be a positive duration")
+	}
+	return nil
+}
+
+func validateMaxEventBytes(n int) error {
+	if n < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func validateOversizePolicy(p string) error {
+	switch OversizePolicy(p) {
+	case DeadLetter, Truncate:
+		return nil
+	default:
+		return fmt.Errorf("must be %q or %q", DeadLetter, Truncate)
+	}
+}
@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"errors"
+	"time"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli-altsrc/v3/toml"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	DefaultTopic           = "omdient.{link_type}"
+	DefaultDeadLetterTopic = "omdient.dead-letters"
+	DefaultAcks            = "all"
+	DefaultLinger          = 10 * time.Millisecond
+
+	maxLinger = time.Second
+)
+
+// Flags defines CLI flags to configure the Kafka dispatcher. These flags can also
+// be set using environment variables and the application's configuration file.
+func Flags(configFilePath altsrc.StringSourcer) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "dispatch-kafka-brokers",
+			Usage: `Kafka broker addresses (e.g. "localhost:9092"), if "dispatch" is "kafka"`,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_KAFKA_BROKERS"),
+				toml.TOML("dispatch.kafka.brokers", configFilePath),
+			),
+		},
+		&cli.StringFlag{
+			Name:  "dispatch-kafka-topic",
+			Usage: `Kafka topic name template, with optional "{link_type}" and "{event_type}" placeholders`,
+			Value: DefaultTopic,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_KAFKA_TOPIC"),
+				toml.TOML("dispatch.kafka.topic", configFilePath),
+			),
+			Validator: validateTopic,
+		},
+		&cli.StringFlag{
+			Name:  "dispatch-kafka-dead-letter-topic",
+			Usage: `Kafka topic name template for failed events, if "dead-letter" is "kafka"`,
+			Value: DefaultDeadLetterTopic,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_KAFKA_DEAD_LETTER_TOPIC"),
+				toml.TOML("dispatch.kafka.dead_letter_topic", configFilePath),
+			),
+			Validator: validateTopic,
+		},
+		&cli.StringFlag{
+			Name:  "dispatch-kafka-acks",
+			Usage: `Kafka acknowledgements required for produced events: "none", "one", or "all"`,
+			Value: DefaultAcks,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_KAFKA_ACKS"),
+				toml.TOML("dispatch.kafka.acks", configFilePath),
+			),
+			Validator: validateAcks,
+		},
+		&cli.DurationFlag{
+			Name:  "dispatch-kafka-linger",
+			Usage: "maximum time to wait for a batch of Kafka messages to fill up before sending it",
+			Value: DefaultLinger,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_DISPATCH_KAFKA_LINGER"),
+				toml.TOML("dispatch.kafka.linger", configFilePath),
+			),
+			Validator: validateLinger,
+		},
+	}
+}
+
+// NewConfig returns the Kafka dispatcher's configuration, based on CLI flags.
+func NewConfig(cmd *cli.Command) Config {
+	return Config{
+		Brokers: cmd.StringSlice("dispatch-kafka-brokers"),
+		Topic:   cmd.String("dispatch-kafka-topic"),
+		Acks:    cmd.String("dispatch-kafka-acks"),
+		Linger:  cmd.Duration("dispatch-kafka-linger"),
+	}
+}
+
+func validateTopic(s string) error {
+	if s == "" {
+		return errors.New("must not be empty")
+	}
+	return nil
+}
+
+func validateAcks(s string) error {
+	_, err := parseAcks(s)
+	return err
+}
+
+func validateLinger(d time.Duration) error {
+	if d <= 0 || d > maxLinger {
+		return errors.New("must be a positive duration, up to 1s")
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Package kafka implements a [dispatch.Dispatcher] which produces
+// [dispatch.Event]s to [Apache Kafka] topics, keyed by their link IDs.
+//
+// [Apache Kafka]: https://kafka.apache.org/
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+const (
+	maxAttempts     = 10
+	writeBackoffMin = 100 * time.Millisecond
+	writeBackoffMax = time.Second
+)
+
+// Config contains the settings of a Kafka [Dispatcher] (see [NewConfig]).
+type Config struct {
+	Brokers []string
+	Topic   string        // Template (see [Topic]).
+	Acks    string        // "none", "one", or "all".
+	Linger  time.Duration // Maximum time to wait for a batch to fill up.
+}
+
+// producer is the subset of [kafka.Writer] which [Dispatcher] uses.
+type producer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Dispatcher produces each [dispatch.Event] as a JSON message to a Kafka topic
+// (see [Topic]), keyed by its link ID, so all the events of the same link
+// are produced to the same partition, and consumed in the order they were
+// dispatched. It's a [dispatch.AsyncDispatcher]: messages are produced in the
+// background, and batched within the configured linger time. Broker connections
+// are managed by the underlying [kafka.Writer], which reconnects and retries
+// after failures.
+type Dispatcher struct {
+	p     producer
+	topic string
+}
+
+// New initializes a Kafka [Dispatcher]. It doesn't connect to the brokers
+// until the first event is dispatched. Call [Dispatcher.Close] to flush
+// and release its resources after it's no longer used.
+func New(cfg Config) (*Dispatcher, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("missing Kafka broker addresses")
+	}
+	if cfg.Topic == "" {
+		return nil, errors.New("missing Kafka topic")
+	}
+	acks, err := parseAcks(cfg.Acks)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &kafka.Writer{
+		Addr:            kafka.TCP(cfg.Brokers...),
+		Balancer:        &kafka.Hash{},
+		MaxAttempts:     maxAttempts,
+		WriteBackoffMin: writeBackoffMin,
+		WriteBackoffMax: writeBackoffMax,
+		BatchTimeout:    cfg.Linger,
+		RequiredAcks:    acks,
+		Async:           true,
+		Completion:      complete,
+	}
+
+	return &Dispatcher{p: w, topic: cfg.Topic}, nil
+}
+
+func parseAcks(s string) (kafka.RequiredAcks, error) {
+	switch s {
+	case "none":
+		return kafka.RequireNone, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "all", "":
+		return kafka.RequireAll, nil
+	default:
+		return 0, fmt.Errorf("invalid Kafka acks level: %q", s)
+	}
+}
+
+// Dispatch produces an [dispatch.Event] to its Kafka topic, and waits until
+// it's acknowledged by the brokers, based on the configured acks level.
+func (d *Dispatcher) Dispatch(ctx context.Context, e dispatch.Event) error {
+	errs := make(chan error, 1)
+	d.DispatchAsync(ctx, e, func(err error) { errs <- err })
+	return <-errs
+}
+
+// DispatchAsync produces an [dispatch.Event] to its Kafka topic in the background,
+// and calls the given function when it's acknowledged by the brokers (based on
+// the configured acks level), or when producing it fails. If the context is
+// canceled before that, the function is called with the context's error,
+// but the message may still be produced later.
+func (d *Dispatcher) DispatchAsync(ctx context.Context, e dispatch.Event, done func(error)) {
+	msg, err := newMessage(d.topic, e)
+	if err != nil {
+		done(err)
+		return
+	}
+
+	var once sync.Once
+	finish := func(err error) {
+		once.Do(func() { done(err) })
+	}
+	stop := context.AfterFunc(ctx, func() { finish(ctx.Err()) })
+
+	topic := msg.Topic
+	msg.WriterData = completion(func(err error) {
+		stop()
+		if err != nil {
+			err = fmt.Errorf("failed to produce event to Kafka topic %q: %w", topic, err)
+		}
+		finish(err)
+	})
+
+	if err := d.p.WriteMessages(ctx, msg); err != nil {
+		stop()
+		finish(fmt.Errorf("failed to produce event to Kafka topic %q: %w", topic, err))
+	}
+}
+
+// completion is attached to each produced Kafka message, to report its outcome.
+type completion func(err error)
+
+// complete is the [kafka.Writer.Completion] function, which reports the outcome
+// of asynchronously produced messages (see [Dispatcher.DispatchAsync]).
+func complete(msgs []kafka.Message, err error) {
+	for _, m := range msgs {
+		if f, ok := m.WriterData.(completion); ok {
+			f(err)
+		}
+	}
+}
+
+// Close flushes pending messages, and closes all the broker connections.
+func (d *Dispatcher) Close() error {
+	return d.p.Close()
+}
+
+// newMessage converts an [dispatch.Event] into a Kafka
+// message, whose value is a JSON [dispatch.EventRecord].
+func newMessage(topic string, e dispatch.Event) (kafka.Message, error) {
+	b, err := json.Marshal(dispatch.NewEventRecord(e))
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to encode event as Kafka message: %w", err)
+	}
+
+	return kafka.Message{
+		Topic: Topic(topic, e),
+		Key:   []byte(e.LinkID),
+		Value: b,
+		Headers: []kafka.Header{
+			{Key: "link_type", Value: []byte(e.LinkType)},
+			{Key: "event_type", Value: []byte(e.Type)},
+		},
+		Time: e.ReceivedAt,
+	}, nil
+}
+
+// Topic derives the name of a Kafka topic for an [dispatch.Event] from the given
+// template, by replacing the placeholders "{link_type}" and "{event_type}" with
+// the event's values (or "unknown" if they're empty). Characters which are
+// not allowed in Kafka topic names are replaced with underscores.
+func Topic(template string, e dispatch.Event) string {
+	r := strings.NewReplacer(
+		"{link_type}", placeholderValue(e.LinkType),
+		"{event_type}", placeholderValue(e.Type),
+	)
+	return sanitize(r.Replace(template))
+}
+
+func placeholderValue(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// sanitize replaces characters which are not allowed in
+// Kafka topic names (other than [a-zA-Z0-9._-]) with underscores.
+func sanitize(topic string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, topic)
+}
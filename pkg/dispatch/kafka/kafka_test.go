@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// mockProducer records produced messages, or fails to produce them, like
+// an asynchronous [kafka.Writer]: write errors are returned immediately,
+// and the messages' outcome is reported to the completion function.
+type mockProducer struct {
+	msgs       []kafka.Message
+	err        error
+	produceErr error
+	hold       bool // Don't report the messages' outcome.
+	closed     bool
+}
+
+func (m *mockProducer) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.msgs = append(m.msgs, msgs...)
+	if !m.hold {
+		complete(msgs, m.produceErr)
+	}
+	return nil
+}
+
+func (m *mockProducer) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			cfg:  Config{Brokers: []string{"localhost:9092"}, Topic: DefaultTopic, Acks: "one", Linger: DefaultLinger},
+		},
+		{
+			name:    "missing_brokers",
+			cfg:     Config{Topic: DefaultTopic},
+			wantErr: true,
+		},
+		{
+			name:    "missing_topic",
+			cfg:     Config{Brokers: []string{"localhost:9092"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_acks",
+			cfg:     Config{Brokers: []string{"localhost:9092"}, Topic: DefaultTopic, Acks: "some"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				_ = d.Close()
+			}
+		})
+	}
+}
+
+func TestTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		e        dispatch.Event
+		want     string
+	}{
+		{
+			name:     "static",
+			template: "events",
+			e:        dispatch.Event{LinkType: "slack", Type: "message"},
+			want:     "events",
+		},
+		{
+			name:     "link_type",
+			template: DefaultTopic,
+			e:        dispatch.Event{LinkType: "github", Type: "push"},
+			want:     "omdient.github",
+		},
+		{
+			name:     "event_type",
+			template: "{link_type}-{event_type}",
+			e:        dispatch.Event{LinkType: "slack", Type: "message"},
+			want:     "slack-message",
+		},
+		{
+			name:     "missing_event_type",
+			template: "{link_type}-{event_type}",
+			e:        dispatch.Event{LinkType: "slack"},
+			want:     "slack-unknown",
+		},
+		{
+			name:     "invalid_characters",
+			template: "omdient/{link_type}/{event_type}",
+			e:        dispatch.Event{LinkType: "gcp pubsub", Type: "a:b"},
+			want:     "omdient_gcp_pubsub_a_b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Topic(tt.template, tt.e); got != tt.want {
+				t.Errorf("Topic() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	p := &mockProducer{}
+	d := &Dispatcher{p: p, topic: "omdient.{link_type}.{event_type}"}
+
+	receivedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := dispatch.Event{
+		ID:         "event-id",
+		LinkID:     "link-id",
+		LinkType:   "github",
+		Type:       "push",
+		ReceivedAt: receivedAt,
+		Payload:    map[string]any{"id": json.Number("9007199254740993")},
+	}
+
+	if err := d.Dispatch(t.Context(), e); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if len(p.msgs) != 1 {
+		t.Fatalf("produced messages = %d, want 1", len(p.msgs))
+	}
+
+	msg := p.msgs[0]
+	if msg.Topic != "omdient.github.push" {
+		t.Errorf("message topic = %q, want %q", msg.Topic, "omdient.github.push")
+	}
+	if string(msg.Key) != "link-id" {
+		t.Errorf("message key = %q, want %q", msg.Key, "link-id")
+	}
+	if !msg.Time.Equal(receivedAt) {
+		t.Errorf("message time = %v, want %v", msg.Time, receivedAt)
+	}
+
+	want := `{"id":"event-id","link_id":"link-id","link_type":"github","type":"push","received_at":"2025-01-02T03:04:05Z","payload":{"id":9007199254740993}}`
+	if string(msg.Value) != want {
+		t.Errorf("message value = %s, want %s", msg.Value, want)
+	}
+
+	wantHeaders := []kafka.Header{
+		{Key: "link_type", Value: []byte("github")},
+		{Key: "event_type", Value: []byte("push")},
+	}
+	if !reflect.DeepEqual(msg.Headers, wantHeaders) {
+		t.Errorf("message headers = %v, want %v", msg.Headers, wantHeaders)
+	}
+
+	if err := d.Close(); err != nil || !p.closed {
+		t.Errorf("Close() error = %v, closed = %v", err, p.closed)
+	}
+}
+
+func TestDispatchError(t *testing.T) {
+	wantErr := errors.New("broker unavailable")
+	tests := []struct {
+		name string
+		p    *mockProducer
+	}{
+		{
+			name: "write_error",
+			p:    &mockProducer{err: wantErr},
+		},
+		{
+			name: "produce_error",
+			p:    &mockProducer{produceErr: wantErr},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dispatcher{p: tt.p, topic: DefaultTopic}
+			err := d.Dispatch(t.Context(), dispatch.Event{LinkID: "id", LinkType: "slack"})
+			if !errors.Is(err, wantErr) {
+				t.Errorf("Dispatch() error = %v, want %v", err, wantErr)
+			}
+		})
+	}
+}
+
+func TestDispatchAsyncCanceled(t *testing.T) {
+	p := &mockProducer{hold: true}
+	d := &Dispatcher{p: p, topic: DefaultTopic}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errs := make(chan error, 2)
+	d.DispatchAsync(ctx, dispatch.Event{LinkID: "id", LinkType: "slack"}, func(err error) { errs <- err })
+
+	select {
+	case err := <-errs:
+		t.Fatalf("DispatchAsync() completed before the message was produced: %v", err)
+	default:
+	}
+
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("DispatchAsync() error = %v, want %v", err, context.Canceled)
+	}
+
+	// The message's late outcome is ignored.
+	complete(p.msgs, nil)
+	select {
+	case err := <-errs:
+		t.Errorf("DispatchAsync() completed twice: %v", err)
+	default:
+	}
+}
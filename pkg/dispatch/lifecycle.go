@@ -0,0 +1,43 @@
+package dispatch
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/tzrikka/omdient/pkg/websocket"
+)
+
+// LifecycleEventPrefix is the prefix of the [Event] type of
+// connection lifecycle events (e.g. "com.omdient.connection.closed").
+const LifecycleEventPrefix = "com.omdient.connection."
+
+// LifecycleFunc returns a [websocket.LifecycleFunc] which converts connection
+// lifecycle events into normalized [Event]s, and enqueues them for dispatching
+// alongside the link's data events. If the queue is nil, it returns nil.
+func LifecycleFunc(q *Queue, linkID, linkType string) websocket.LifecycleFunc {
+	if q == nil {
+		return nil
+	}
+
+	return func(le websocket.LifecycleEvent) {
+		payload := map[string]any{"type": string(le.Type)}
+		if le.CloseStatus != 0 {
+			payload["close_status"] = int(le.CloseStatus)
+			payload["close_reason"] = le.CloseStatus.String()
+		}
+		if le.Err != nil {
+			payload["error"] = le.Err.Error()
+		}
+
+		e := Event{
+			LinkID:     linkID,
+			LinkType:   linkType,
+			ReceivedAt: le.Time,
+			Payload:    payload,
+			Type:       LifecycleEventPrefix + string(le.Type),
+		}
+		if err := q.Enqueue(e); err != nil {
+			log.Err(err).Str("link_id", linkID).Str("type", e.Type).
+				Msg("failed to enqueue connection lifecycle event for dispatching")
+		}
+	}
+}
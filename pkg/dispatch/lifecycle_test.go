@@ -0,0 +1,70 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tzrikka/omdient/pkg/websocket"
+)
+
+// chanDispatcher sends dispatched events to a channel.
+type chanDispatcher chan Event
+
+func (d chanDispatcher) Dispatch(_ context.Context, e Event) error {
+	d <- e
+	return nil
+}
+
+func TestLifecycleFunc(t *testing.T) {
+	if f := LifecycleFunc(nil, "link", "slack"); f != nil {
+		t.Error("LifecycleFunc(nil queue) != nil")
+	}
+
+	sink := make(chanDispatcher, 3)
+	q := NewQueue(sink, 3, nil)
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+
+	f := LifecycleFunc(q, "link", "slack")
+	f(websocket.LifecycleEvent{Type: websocket.ConnEstablished, Time: time.Now()})
+	f(websocket.LifecycleEvent{Type: websocket.ConnClosed, CloseStatus: websocket.StatusClosedAbnormally})
+	f(websocket.LifecycleEvent{Type: websocket.ConnError, Err: errors.New("dial error")})
+
+	want := []struct {
+		typ     string
+		payload map[string]any
+	}{
+		{
+			typ:     "com.omdient.connection.established",
+			payload: map[string]any{"type": "established"},
+		},
+		{
+			typ: "com.omdient.connection.closed",
+			payload: map[string]any{
+				"type": "closed", "close_status": int(websocket.StatusClosedAbnormally),
+				"close_reason": websocket.StatusClosedAbnormally.String(),
+			},
+		},
+		{
+			typ:     "com.omdient.connection.error",
+			payload: map[string]any{"type": "error", "error": "dial error"},
+		},
+	}
+
+	for _, w := range want {
+		select {
+		case e := <-sink:
+			if e.LinkID != "link" || e.LinkType != "slack" || e.Type != w.typ {
+				t.Errorf("dispatched event = %+v, want type %q", e, w.typ)
+			}
+			for k, v := range w.payload {
+				if e.Payload[k] != v {
+					t.Errorf("event %q payload[%q] = %v, want %v", e.Type, k, e.Payload[k], v)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %q wasn't dispatched", w.typ)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/lithammer/shortuuid/v4"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tzrikka/omdient/internal/metrics"
+	"github.com/tzrikka/omdient/internal/tracing"
+)
+
+var (
+	// ErrClosed is returned by [Queue.Enqueue] after [Queue.Shutdown] was called.
+	ErrClosed = errors.New("dispatch queue is closed")
+	// ErrFull is returned by [Queue.Enqueue] when the queue's buffer is full.
+	ErrFull = errors.New("dispatch queue is full")
+)
+
+// DeadLetterFunc receives [Event]s which could not be delivered, and the reason.
+type DeadLetterFunc func(e Event, err error)
+
+// Queue buffers [Event]s and delivers them asynchronously with a [Dispatcher],
+// using a fixed number of shards. Events are assigned to shards by their link IDs,
+// and each shard delivers its events one at a time, with its own worker. This
+// preserves the order of each link's events, while different links' events are
+// delivered in parallel. If the dispatcher is an [AsyncDispatcher], each shard
+// hands over its events without waiting for the previous ones to be delivered.
+// Events which fail to be delivered are passed to a
+// [DeadLetterFunc], so they are never dropped silently - not even during [Queue.Shutdown].
+type Queue struct {
+	d          Dispatcher
+	deadLetter DeadLetterFunc
+
+	shards []chan Event
+	closed bool
+	mu     sync.RWMutex
+
+	ctx     context.Context // Canceled if draining times out.
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	pending sync.WaitGroup // Asynchronous deliveries (see [AsyncDispatcher]).
+	done    chan struct{}
+}
+
+// NewQueue starts delivering [Event]s with the given [Dispatcher], one at a time,
+// using a buffer of the given size. If the [DeadLetterFunc] is nil, undelivered
+// events are logged. See also [NewPool].
+func NewQueue(d Dispatcher, size int, f DeadLetterFunc) *Queue {
+	return NewPool(d, 1, size, f)
+}
+
+// NewPool is like [NewQueue], but it delivers [Event]s with the given number
+// of shards, i.e. up to that many events concurrently, as long as they belong
+// to different links. The buffer size is divided evenly between the shards.
+func NewPool(d Dispatcher, shards, size int, f DeadLetterFunc) *Queue {
+	if f == nil {
+		f = logDeadLetter
+	}
+
+	shards = max(shards, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		d:          d,
+		deadLetter: f,
+		shards:     make([]chan Event, shards),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+
+	for i := range q.shards {
+		q.shards[i] = make(chan Event, (size+shards-1)/shards)
+		q.workers.Add(1)
+		go func() {
+			defer q.workers.Done()
+			q.run(q.shards[i])
+		}()
+	}
+	go func() {
+		q.workers.Wait()
+		q.pending.Wait()
+		close(q.done)
+	}()
+
+	return q
+}
+
+func logDeadLetter(e Event, err error) {
+	log.Error().Err(err).Str("link_id", e.LinkID).Str("link_type", e.LinkType).
+		Time("received_at", e.ReceivedAt).Any("payload", e.Payload).
+		Msg("dead-lettered undelivered event")
+}
+
+// Enqueue adds an [Event] to the queue without blocking. It returns [ErrFull]
+// if the buffer of the event's shard is full, or [ErrClosed] if the queue is
+// shutting down.
+// Calling this function with a nil queue is a no-op, i.e. dispatching is disabled.
+func (q *Queue) Enqueue(e Event) error {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	if e.ID == "" {
+		e.ID = shortuuid.New()
+	}
+
+	select {
+	case q.shards[q.shard(e.LinkID)] <- e:
+		metrics.DispatchQueueDepth.Inc()
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// EnqueueFunc is like [Queue.Enqueue], but it also calls the given function with
+// the outcome of the event's delivery: nil after it's dispatched successfully, or
+// the reason it was dead-lettered. This allows receivers to acknowledge messages
+// to their sources only after they're delivered. The function isn't called if
+// this function returns an error. If the queue is nil, it's called immediately.
+func (q *Queue) EnqueueFunc(e Event, f func(error)) error {
+	if q == nil {
+		f(nil)
+		return nil
+	}
+
+	e.done = f
+	return q.Enqueue(e)
+}
+
+// shard returns the index of the shard which delivers the given link's [Event]s.
+func (q *Queue) shard(linkID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(linkID))
+	return int(h.Sum32() % uint32(len(q.shards))) //gosec:disable G115 -- small positive number
+}
+
+// run is a shard's worker, which delivers its queued [Event]s
+// in order, until the queue is closed and the shard is fully drained.
+func (q *Queue) run(events <-chan Event) {
+	ad, async := q.d.(AsyncDispatcher)
+	for e := range events {
+		metrics.DispatchQueueDepth.Dec()
+
+		if err := q.ctx.Err(); err != nil {
+			q.finish(e, err)
+			continue
+		}
+
+		e.attempts++
+		if async {
+			q.pending.Add(1)
+			q.dispatchAsync(ad, e)
+			continue
+		}
+
+		q.finish(e, q.dispatch(e))
+	}
+}
+
+// dispatch delivers a single [Event] within a child span
+// of the span in which it was enqueued, if there was one.
+func (q *Queue) dispatch(e Event) error {
+	ctx, span := q.startSpan(e)
+	err := q.d.Dispatch(ctx, e)
+	tracing.End(span, err)
+	return err
+}
+
+// dispatchAsync is like [Queue.dispatch], but it doesn't wait for the
+// delivery to complete: the [Event]'s outcome is handled in the background.
+func (q *Queue) dispatchAsync(d AsyncDispatcher, e Event) {
+	ctx, span := q.startSpan(e)
+	d.DispatchAsync(ctx, e, func(err error) {
+		tracing.End(span, err)
+		q.finish(e, err)
+		q.pending.Done()
+	})
+}
+
+func (q *Queue) startSpan(e Event) (context.Context, trace.Span) {
+	ctx := trace.ContextWithSpanContext(q.ctx, e.spanContext)
+	return tracing.Tracer().Start(ctx, "dispatch", trace.WithAttributes(
+		tracing.TemplateKey.String(e.LinkType), tracing.LinkID(e.LinkID), tracing.EventTypeKey.String(e.Type)))
+}
+
+// finish handles the outcome of an [Event]'s delivery.
+func (q *Queue) finish(e Event, err error) {
+	if err != nil {
+		q.deadLetter(e, err)
+	}
+	if e.done != nil {
+		e.done(err)
+	}
+}
+
+// Shutdown stops accepting new [Event]s, and waits for all the queued ones to
+// be delivered. If the context is done before that, in-flight deliveries are
+// canceled, and the remaining events are dead-lettered instead of being delivered.
+// In that case, this function returns the context's error.
+//
+// This function still waits for in-flight deliveries to return (or complete,
+// for [AsyncDispatcher]s), so implementations should respect context cancellation.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		for _, events := range q.shards {
+			close(events)
+		}
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+		return ctx.Err()
+	}
+}
+
+type ctxKey struct{}
+
+// WithQueue returns a copy of the given context which carries a [Queue].
+func WithQueue(ctx context.Context, q *Queue) context.Context {
+	return context.WithValue(ctx, ctxKey{}, q)
+}
+
+// FromContext returns the [Queue] in the given context (see [WithQueue]),
+// or nil if there isn't one.
+func FromContext(ctx context.Context) *Queue {
+	q, _ := ctx.Value(ctxKey{}).(*Queue)
+	return q
+}
+
+// Enqueue adds an [Event] to the [Queue] in the given context (see [WithQueue]).
+// If the context doesn't carry a queue, dispatching is disabled and this is a no-op.
+// If the context carries a trace span, the event's dispatch is traced as its child.
+func Enqueue(ctx context.Context, e Event) error {
+	e.spanContext = trace.SpanContextFromContext(ctx)
+	return FromContext(ctx).Enqueue(e)
+}
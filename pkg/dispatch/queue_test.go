@@ -0,0 +1,494 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDispatcher records delivered events, after an optional delay.
+// It fails to deliver events whose link ID is "fail".
+type recordingDispatcher struct {
+	delay time.Duration
+
+	mu        sync.Mutex
+	delivered []string
+}
+
+func (r *recordingDispatcher) Dispatch(ctx context.Context, e Event) error {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if e.LinkID == "fail" {
+		return errors.New("delivery error")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delivered = append(r.delivered, e.LinkID)
+	return nil
+}
+
+// deadLetters records dead-lettered events.
+type deadLetters struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (d *deadLetters) add(e Event, _ error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ids = append(d.ids, e.LinkID)
+}
+
+// concurrentDispatcher records the order of delivered events per link (based on
+// their "seq" payload field), and the maximum number of concurrent deliveries.
+// Deliveries take a random delay, or wait until the release channel is closed.
+type concurrentDispatcher struct {
+	release chan struct{}
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	delivered   map[string][]int
+}
+
+func (c *concurrentDispatcher) Dispatch(ctx context.Context, e Event) error {
+	c.mu.Lock()
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.mu.Unlock()
+
+	if c.release != nil {
+		<-c.release
+	} else {
+		time.Sleep(time.Duration(rand.IntN(3)) * time.Millisecond)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	seq, _ := e.Payload["seq"].(int)
+	c.delivered[e.LinkID] = append(c.delivered[e.LinkID], seq)
+	return nil
+}
+
+func (c *concurrentDispatcher) current() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight
+}
+
+func TestPoolOrderingWithinLink(t *testing.T) {
+	d := &concurrentDispatcher{delivered: map[string][]int{}}
+	q := NewPool(d, 4, 200, nil) // Some links may share a shard.
+
+	// Interleave the events of multiple links.
+	links := []string{"a", "b", "c", "d", "e"}
+	for seq := range 20 {
+		for _, id := range links {
+			if err := q.Enqueue(Event{LinkID: id, Payload: map[string]any{"seq": seq}}); err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+		}
+	}
+
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	for _, id := range links {
+		if got := d.delivered[id]; len(got) != 20 || !slices.IsSorted(got) {
+			t.Errorf("delivered events of link %q = %v, want 0-19 in order", id, got)
+		}
+	}
+	if d.maxInFlight > 4 {
+		t.Errorf("concurrent deliveries = %d, want at most 4", d.maxInFlight)
+	}
+}
+
+func TestPoolInterleavedLinks(t *testing.T) {
+	d := &concurrentDispatcher{delivered: map[string][]int{}}
+	q := NewPool(d, 2, 100, nil)
+
+	// Find two links which are assigned to different shards, to dispatch them in parallel.
+	a, b := "link-0", ""
+	for i := 1; b == ""; i++ {
+		if id := fmt.Sprintf("link-%d", i); q.shard(id) != q.shard(a) {
+			b = id
+		}
+	}
+
+	for seq := range 50 {
+		for _, id := range []string{a, b} {
+			if err := q.Enqueue(Event{LinkID: id, Payload: map[string]any{"seq": seq}}); err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+		}
+	}
+
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	want := make([]int, 50)
+	for i := range want {
+		want[i] = i
+	}
+	for _, id := range []string{a, b} {
+		if got := d.delivered[id]; !slices.Equal(got, want) {
+			t.Errorf("delivered events of link %q = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestQueueShard(t *testing.T) {
+	q := NewPool(LogDispatcher{}, 4, 4, nil)
+	defer func() { _ = q.Shutdown(t.Context()) }()
+
+	used := map[int]bool{}
+	for i := range 100 {
+		id := fmt.Sprint(i)
+		s := q.shard(id)
+		if s < 0 || s >= 4 {
+			t.Fatalf("shard(%q) = %d, want 0-3", id, s)
+		}
+		if q.shard(id) != s {
+			t.Errorf("shard(%q) isn't stable", id)
+		}
+		used[s] = true
+	}
+	if len(used) != 4 {
+		t.Errorf("used shards = %d, want 4", len(used))
+	}
+}
+
+func TestPoolWorkerLimit(t *testing.T) {
+	d := &concurrentDispatcher{release: make(chan struct{}), delivered: map[string][]int{}}
+	q := NewPool(d, 3, 30, nil)
+
+	for i := range 10 {
+		if err := q.Enqueue(Event{LinkID: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); d.current() < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond) // Give extra workers a chance to exceed the limit.
+	if got := d.current(); got != 3 {
+		t.Errorf("concurrent deliveries = %d, want 3", got)
+	}
+
+	close(d.release)
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if d.maxInFlight != 3 {
+		t.Errorf("max concurrent deliveries = %d, want 3", d.maxInFlight)
+	}
+}
+
+func TestQueueShutdown(t *testing.T) {
+	tests := []struct {
+		name          string
+		delay         time.Duration
+		timeout       time.Duration
+		ids           []string
+		wantErr       bool
+		wantDelivered int
+	}{
+		{
+			name:          "drain_all",
+			timeout:       time.Second,
+			ids:           []string{"1", "2", "3", "4", "5"},
+			wantDelivered: 5,
+		},
+		{
+			name:          "delivery_failure",
+			timeout:       time.Second,
+			ids:           []string{"1", "fail", "3"},
+			wantDelivered: 2,
+		},
+		{
+			name:          "drain_timeout",
+			delay:         100 * time.Millisecond,
+			timeout:       150 * time.Millisecond,
+			ids:           []string{"1", "2", "3", "4", "5"},
+			wantErr:       true,
+			wantDelivered: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &recordingDispatcher{delay: tt.delay}
+			dl := &deadLetters{}
+			q := NewQueue(d, len(tt.ids), dl.add)
+
+			for _, id := range tt.ids {
+				if err := q.Enqueue(Event{LinkID: id}); err != nil {
+					t.Fatalf("Enqueue() error = %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(t.Context(), tt.timeout)
+			defer cancel()
+			if err := q.Shutdown(ctx); (err != nil) != tt.wantErr {
+				t.Errorf("Shutdown() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := len(d.delivered); got != tt.wantDelivered {
+				t.Errorf("delivered events = %v, want %d", d.delivered, tt.wantDelivered)
+			}
+			if got := len(d.delivered) + len(dl.ids); got != len(tt.ids) {
+				t.Errorf("delivered %v + dead-lettered %v = %d events, want %d", d.delivered, dl.ids, got, len(tt.ids))
+			}
+
+			if err := q.Enqueue(Event{LinkID: "late"}); !errors.Is(err, ErrClosed) {
+				t.Errorf("Enqueue() after Shutdown() error = %v, want %v", err, ErrClosed)
+			}
+		})
+	}
+}
+
+// asyncDispatcher holds delivered events until they're released, and
+// then completes them in order, like a batching [AsyncDispatcher].
+type asyncDispatcher struct {
+	mu      sync.Mutex
+	held    []Event
+	done    []func(error)
+	handled []string
+}
+
+func (a *asyncDispatcher) Dispatch(context.Context, Event) error {
+	return errors.New("unexpected synchronous dispatch")
+}
+
+func (a *asyncDispatcher) DispatchAsync(ctx context.Context, e Event, done func(error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var once sync.Once
+	finish := func(err error) {
+		once.Do(func() { done(err) })
+	}
+
+	a.held = append(a.held, e)
+	a.done = append(a.done, finish)
+	context.AfterFunc(ctx, func() { finish(ctx.Err()) })
+}
+
+func (a *asyncDispatcher) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.held)
+}
+
+func (a *asyncDispatcher) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, e := range a.held {
+		a.handled = append(a.handled, e.LinkID+fmt.Sprint(e.Payload["seq"]))
+		a.done[i](nil)
+	}
+}
+
+func TestQueueAsyncDispatcher(t *testing.T) {
+	d := &asyncDispatcher{}
+	var delivered sync.WaitGroup
+	q := NewQueue(d, 10, nil)
+
+	for seq := range 5 {
+		delivered.Add(1)
+		e := Event{LinkID: "a", Payload: map[string]any{"seq": seq}}
+		if err := q.EnqueueFunc(e, func(err error) {
+			if err != nil {
+				t.Errorf("delivery error = %v", err)
+			}
+			delivered.Done()
+		}); err != nil {
+			t.Fatalf("EnqueueFunc() error = %v", err)
+		}
+	}
+
+	// All the events are handed over without waiting for previous deliveries.
+	for deadline := time.Now().Add(5 * time.Second); d.count() < 5 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if got := d.count(); got != 5 {
+		t.Fatalf("handed over events = %d, want 5", got)
+	}
+
+	d.release()
+	delivered.Wait()
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if want := []string{"a0", "a1", "a2", "a3", "a4"}; !slices.Equal(d.handled, want) {
+		t.Errorf("delivered events = %v, want %v", d.handled, want)
+	}
+}
+
+func TestQueueAsyncDispatcherWrapped(t *testing.T) {
+	tests := []struct {
+		name       string
+		wrap       func(Dispatcher, EventStore) Dispatcher
+		wantStored int
+	}{
+		{
+			name: "max_size",
+			wrap: func(d Dispatcher, _ EventStore) Dispatcher {
+				return WithMaxSize(d, 1000, DeadLetter)
+			},
+		},
+		{
+			name: "store",
+			wrap: func(d Dispatcher, s EventStore) Dispatcher {
+				return WithStore(d, s)
+			},
+			wantStored: 3,
+		},
+		{
+			name: "max_size_and_store",
+			wrap: func(d Dispatcher, s EventStore) Dispatcher {
+				return WithStore(WithMaxSize(d, 1000, DeadLetter), s)
+			},
+			wantStored: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &asyncDispatcher{}
+			s := &memoryStore{events: map[string]Event{}}
+			q := NewQueue(tt.wrap(d, s), 10, nil)
+
+			for seq := range 3 {
+				if err := q.Enqueue(Event{ID: fmt.Sprint(seq), LinkID: "a", Payload: map[string]any{"seq": seq}}); err != nil {
+					t.Fatalf("Enqueue() error = %v", err)
+				}
+			}
+
+			// The wrapped dispatcher's DispatchAsync method is used, not its Dispatch method.
+			for deadline := time.Now().Add(5 * time.Second); d.count() < 3 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			if got := d.count(); got != 3 {
+				t.Fatalf("handed over events = %d, want 3", got)
+			}
+
+			d.release()
+			if err := q.Shutdown(t.Context()); err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+			if want := []string{"a0", "a1", "a2"}; !slices.Equal(d.handled, want) {
+				t.Errorf("delivered events = %v, want %v", d.handled, want)
+			}
+			if len(s.events) != tt.wantStored {
+				t.Errorf("stored events = %d, want %d", len(s.events), tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestQueueAsyncDispatcherShutdownTimeout(t *testing.T) {
+	d := &asyncDispatcher{}
+	dl := &deadLetters{}
+	q := NewQueue(d, 10, dl.add)
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := q.Enqueue(Event{LinkID: id}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); err == nil {
+		t.Error("Shutdown() error = nil, want timeout")
+	}
+	if got := len(dl.ids); got != 3 {
+		t.Errorf("dead-lettered events = %v, want 3", dl.ids)
+	}
+}
+
+func TestQueueEnqueueFull(t *testing.T) {
+	d := &recordingDispatcher{delay: time.Second}
+	dl := &deadLetters{}
+	q := NewQueue(d, 1, dl.add)
+
+	var err error
+	for i := range 3 {
+		if err = q.Enqueue(Event{LinkID: fmt.Sprint(i)}); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrFull) {
+		t.Errorf("Enqueue() error = %v, want %v", err, ErrFull)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_ = q.Shutdown(ctx)
+}
+
+func TestEnqueueWithoutQueue(t *testing.T) {
+	if err := Enqueue(t.Context(), Event{LinkID: "1"}); err != nil {
+		t.Errorf("Enqueue() error = %v, want nil", err)
+	}
+}
+
+func TestQueueEnqueueFunc(t *testing.T) {
+	d := &recordingDispatcher{}
+	dl := &deadLetters{}
+	q := NewQueue(d, 2, dl.add)
+
+	var mu sync.Mutex
+	results := map[string]error{}
+	for _, id := range []string{"ok", "fail"} {
+		err := q.EnqueueFunc(Event{LinkID: id}, func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			results[id] = err
+		})
+		if err != nil {
+			t.Fatalf("EnqueueFunc() error = %v", err)
+		}
+	}
+
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err, ok := results["ok"]; !ok || err != nil {
+		t.Errorf("delivered event result = %v (reported: %v), want nil", err, ok)
+	}
+	if err := results["fail"]; err == nil {
+		t.Error("dead-lettered event result = nil, want an error")
+	}
+	if len(dl.ids) != 1 || dl.ids[0] != "fail" {
+		t.Errorf("dead-lettered events = %v, want [fail]", dl.ids)
+	}
+}
+
+func TestEnqueueFuncWithoutQueue(t *testing.T) {
+	var q *Queue
+	called := false
+	if err := q.EnqueueFunc(Event{LinkID: "1"}, func(err error) { called = err == nil }); err != nil {
+		t.Errorf("EnqueueFunc() error = %v, want nil", err)
+	}
+	if !called {
+		t.Error("EnqueueFunc() didn't report a successful result")
+	}
+}
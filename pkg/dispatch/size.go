@@ -0,0 +1,141 @@
+package dispatch
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tzrikka/omdient/internal/metrics"
+)
+
+// OversizePolicy determines what happens to [Event]s
+// which are larger than a [Dispatcher]'s maximum size.
+type OversizePolicy string
+
+const (
+	// DeadLetter fails the delivery of oversized [Event]s, so
+	// the [Queue] passes them to its [DeadLetterFunc] instead.
+	DeadLetter OversizePolicy = "dead-letter"
+	// Truncate removes the largest top-level fields from the payloads of
+	// oversized [Event]s until they fit, and then delivers them.
+	Truncate OversizePolicy = "truncate"
+)
+
+// ErrTooLarge is returned by [Dispatcher]s which
+// were wrapped with [WithMaxSize], for oversized [Event]s.
+var ErrTooLarge = errors.New("event payload is too large")
+
+type sizeLimiter struct {
+	d        Dispatcher
+	maxBytes int
+	policy   OversizePolicy
+}
+
+// WithMaxSize wraps a [Dispatcher] with a check of the [Event] payload's
+// JSON-encoded size, to respect the destination's message size limit (e.g.
+// 10 MB in Google Cloud Pub/Sub). Each destination may have its own limit.
+// If the maximum size is not positive, the dispatcher is returned as-is.
+func WithMaxSize(d Dispatcher, maxBytes int, p OversizePolicy) Dispatcher {
+	if maxBytes <= 0 {
+		return d
+	}
+	return &sizeLimiter{d: d, maxBytes: maxBytes, policy: p}
+}
+
+func (s *sizeLimiter) Dispatch(ctx context.Context, e Event) error {
+	e, err := s.limit(ctx, e)
+	if err != nil {
+		return err
+	}
+	return s.d.Dispatch(ctx, e)
+}
+
+// DispatchAsync implements the [AsyncDispatcher] interface, so wrapping
+// an [AsyncDispatcher] with [WithMaxSize] doesn't make it synchronous.
+func (s *sizeLimiter) DispatchAsync(ctx context.Context, e Event, done func(error)) {
+	e, err := s.limit(ctx, e)
+	if err != nil {
+		done(err)
+		return
+	}
+	dispatchAsync(ctx, s.d, e, done)
+}
+
+// limit returns the given [Event] as-is if it isn't oversized. Otherwise,
+// it either returns [ErrTooLarge] or a truncated copy, based on the policy.
+func (s *sizeLimiter) limit(ctx context.Context, e Event) (Event, error) {
+	size, err := payloadSize(e.Payload)
+	if err != nil {
+		return e, err
+	}
+	if size <= s.maxBytes {
+		return e, nil
+	}
+
+	metrics.OversizedEvents.WithLabelValues(string(s.policy)).Inc()
+	l := zerolog.Ctx(ctx)
+	if l.GetLevel() == zerolog.Disabled {
+		l = &log.Logger
+	}
+	l.Warn().Str("link_id", e.LinkID).Str("link_type", e.LinkType).Int("size", size).
+		Int("max_size", s.maxBytes).Str("policy", string(s.policy)).Msg("oversized event")
+
+	if s.policy != Truncate {
+		return e, fmt.Errorf("%w: %d bytes > %d", ErrTooLarge, size, s.maxBytes)
+	}
+
+	e.Payload, err = truncate(e.Payload, s.maxBytes)
+	if err != nil {
+		return e, err
+	}
+	e.Truncated = true
+	e.Typed = nil // Keep [Event.As] consistent with the truncated payload.
+	return e, nil
+}
+
+func payloadSize(p map[string]any) (int, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	return len(b), nil
+}
+
+// truncate returns a shallow copy of the given payload, without its largest
+// top-level fields, so that its JSON-encoded size doesn't exceed the maximum.
+// Small fields, which usually identify the event (e.g. its type and ID), are kept.
+func truncate(p map[string]any, maxBytes int) (map[string]any, error) {
+	sizes := make(map[string]int, len(p))
+	for k, v := range p {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode event payload: %w", err)
+		}
+		sizes[k] = len(b)
+	}
+
+	keys := slices.SortedFunc(maps.Keys(p), func(a, b string) int {
+		return cmp.Or(cmp.Compare(sizes[b], sizes[a]), cmp.Compare(a, b))
+	})
+
+	t := maps.Clone(p)
+	for _, k := range keys {
+		size, err := payloadSize(t)
+		if err != nil {
+			return nil, err
+		}
+		if size <= maxBytes {
+			break
+		}
+		delete(t, k)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,118 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lastDispatcher records the last delivered event.
+type lastDispatcher struct {
+	e *Event
+}
+
+func (l *lastDispatcher) Dispatch(_ context.Context, e Event) error {
+	l.e = &e
+	return nil
+}
+
+func TestWithMaxSize(t *testing.T) {
+	payload := map[string]any{
+		"type":     "event_callback",
+		"event_id": "Ev123",
+		"event":    map[string]any{"text": strings.Repeat("a", 100)},
+		"blocks":   strings.Repeat("b", 50),
+	}
+
+	tests := []struct {
+		name        string
+		maxBytes    int
+		policy      OversizePolicy
+		wantErr     error
+		wantPayload map[string]any
+	}{
+		{
+			name:        "unlimited",
+			policy:      DeadLetter,
+			wantPayload: payload,
+		},
+		{
+			name:        "within_limit",
+			maxBytes:    1000,
+			policy:      DeadLetter,
+			wantPayload: payload,
+		},
+		{
+			name:     "dead_letter",
+			maxBytes: 100,
+			policy:   DeadLetter,
+			wantErr:  ErrTooLarge,
+		},
+		{
+			name:     "truncate_largest_field",
+			maxBytes: 120,
+			policy:   Truncate,
+			wantPayload: map[string]any{
+				"type":     "event_callback",
+				"event_id": "Ev123",
+				"blocks":   strings.Repeat("b", 50),
+			},
+		},
+		{
+			name:     "truncate_multiple_fields",
+			maxBytes: 50,
+			policy:   Truncate,
+			wantPayload: map[string]any{
+				"type":     "event_callback",
+				"event_id": "Ev123",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := &lastDispatcher{}
+			d := WithMaxSize(last, tt.maxBytes, tt.policy)
+
+			err := d.Dispatch(t.Context(), Event{LinkID: "id", Payload: payload})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Dispatch() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if last.e != nil {
+					t.Errorf("Dispatch() delivered oversized event: %v", last.e)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(last.e.Payload, tt.wantPayload) {
+				t.Errorf("Dispatch() delivered payload = %v, want %v", last.e.Payload, tt.wantPayload)
+			}
+			wantTruncated := tt.policy == Truncate
+			if last.e.Truncated != wantTruncated {
+				t.Errorf("Dispatch() delivered event truncated = %v, want %v", last.e.Truncated, wantTruncated)
+			}
+			if len(payload) != 4 {
+				t.Errorf("Dispatch() modified the original payload: %v", payload)
+			}
+		})
+	}
+}
+
+func TestWithMaxSizeDeadLetter(t *testing.T) {
+	dl := &deadLetters{}
+	q := NewQueue(WithMaxSize(&lastDispatcher{}, 10, DeadLetter), 1, dl.add)
+
+	if err := q.Enqueue(Event{LinkID: "big", Payload: map[string]any{"text": "0123456789"}}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if len(dl.ids) != 1 || dl.ids[0] != "big" {
+		t.Errorf("dead-lettered events = %v, want [big]", dl.ids)
+	}
+}
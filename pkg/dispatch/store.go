@@ -0,0 +1,113 @@
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrNotFound is returned by [EventStore]s for events which aren't stored.
+var ErrNotFound = errors.New("event not found")
+
+// EventStore keeps dispatched [Event]s, so they can be replayed
+// later without contacting their upstream services (see [WithStore]).
+type EventStore interface {
+	Put(ctx context.Context, e Event) error
+	// Get returns a stored [Event], or [ErrNotFound] if it isn't stored (anymore).
+	Get(ctx context.Context, linkID, eventID string) (Event, error)
+}
+
+// EventRecord is the JSON representation of an [Event], for storage. It
+// doesn't contain the event's typed representation, only its raw payload.
+type EventRecord struct {
+	ID         string         `json:"id"`
+	LinkID     string         `json:"link_id"`
+	LinkType   string         `json:"link_type"`
+	Type       string         `json:"type,omitempty"`
+	ReceivedAt time.Time      `json:"received_at"`
+	Truncated  bool           `json:"truncated,omitempty"`
+	Payload    map[string]any `json:"payload"`
+}
+
+// NewEventRecord converts an [Event] into an [EventRecord].
+func NewEventRecord(e Event) EventRecord {
+	return EventRecord{
+		ID:         e.ID,
+		LinkID:     e.LinkID,
+		LinkType:   e.LinkType,
+		Type:       e.Type,
+		ReceivedAt: e.ReceivedAt,
+		Truncated:  e.Truncated,
+		Payload:    e.Payload,
+	}
+}
+
+// ParseEventRecord decodes a JSON-encoded [EventRecord]. Numbers in
+// the payload are decoded as [json.Number], like in [Event] payloads.
+func ParseEventRecord(b []byte) (EventRecord, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var r EventRecord
+	if err := dec.Decode(&r); err != nil {
+		return EventRecord{}, fmt.Errorf("failed to decode event record: %w", err)
+	}
+	return r, nil
+}
+
+// Event converts an [EventRecord] back into an [Event].
+func (r EventRecord) Event() Event {
+	return Event{
+		ID:         r.ID,
+		LinkID:     r.LinkID,
+		LinkType:   r.LinkType,
+		Type:       r.Type,
+		ReceivedAt: r.ReceivedAt,
+		Truncated:  r.Truncated,
+		Payload:    r.Payload,
+	}
+}
+
+type storingDispatcher struct {
+	d Dispatcher
+	s EventStore
+}
+
+// WithStore wraps a [Dispatcher] so it also stores [Event]s in an [EventStore]
+// after they're dispatched successfully. Failures to store events are only
+// logged, they don't fail the delivery.
+func WithStore(d Dispatcher, s EventStore) Dispatcher {
+	return &storingDispatcher{d: d, s: s}
+}
+
+func (s *storingDispatcher) Dispatch(ctx context.Context, e Event) error {
+	if err := s.d.Dispatch(ctx, e); err != nil {
+		return err
+	}
+
+	s.put(ctx, e)
+	return nil
+}
+
+// DispatchAsync implements the [AsyncDispatcher] interface, so wrapping
+// an [AsyncDispatcher] with [WithStore] doesn't make it synchronous.
+func (s *storingDispatcher) DispatchAsync(ctx context.Context, e Event, done func(error)) {
+	dispatchAsync(ctx, s.d, e, func(err error) {
+		if err == nil {
+			s.put(ctx, e)
+		}
+		done(err)
+	})
+}
+
+func (s *storingDispatcher) put(ctx context.Context, e Event) {
+	if err := s.s.Put(ctx, e); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("link_id", e.LinkID).Str("event_id", e.ID).
+			Msg("failed to store dispatched event")
+	}
+}
@@ -0,0 +1,89 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memoryStore is an in-memory [EventStore].
+type memoryStore struct {
+	events map[string]Event
+}
+
+func (m *memoryStore) Put(_ context.Context, e Event) error {
+	m.events[e.LinkID+"/"+e.ID] = e
+	return nil
+}
+
+func (m *memoryStore) Get(_ context.Context, linkID, eventID string) (Event, error) {
+	e, ok := m.events[linkID+"/"+eventID]
+	if !ok {
+		return Event{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func TestWithStore(t *testing.T) {
+	s := &memoryStore{events: map[string]Event{}}
+	q := NewQueue(WithStore(&recordingDispatcher{}, s), 2, func(Event, error) {})
+
+	for _, id := range []string{"ok", "fail"} {
+		if err := q.Enqueue(Event{LinkID: id}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	// Only successfully-dispatched events are stored,
+	// with the unique IDs which were assigned to them.
+	if len(s.events) != 1 {
+		t.Fatalf("stored events = %v, want 1", s.events)
+	}
+	for k, e := range s.events {
+		if e.LinkID != "ok" || e.ID == "" || k != "ok/"+e.ID {
+			t.Errorf("stored event %q = %+v", k, e)
+		}
+		if _, err := s.Get(t.Context(), "ok", e.ID); err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+	}
+	if _, err := s.Get(t.Context(), "ok", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestEventRecord(t *testing.T) {
+	e := Event{
+		ID:         "id",
+		LinkID:     "link",
+		LinkType:   "slack",
+		Type:       "message",
+		ReceivedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Payload:    map[string]any{"n": json.Number("9007199254740993")},
+		Typed:      &testEvent{Text: "ignored"},
+	}
+
+	b, err := json.Marshal(NewEventRecord(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseEventRecord(b)
+	if err != nil {
+		t.Fatalf("ParseEventRecord() error = %v", err)
+	}
+
+	e.Typed = nil
+	if got := r.Event(); !reflect.DeepEqual(got, e) {
+		t.Errorf("Event() = %+v, want %+v", got, e)
+	}
+
+	if _, err := ParseEventRecord([]byte("not JSON")); err == nil {
+		t.Error("ParseEventRecord() error = nil")
+	}
+}
@@ -0,0 +1,89 @@
+// Package etcd provides a minimal client for an [etcd] cluster,
+// which Omdient uses to persist state across server restarts.
+//
+// [etcd]: https://etcd.io/
+package etcd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	dialTimeout = 3 * time.Second
+)
+
+// NewClient initializes an etcd client, based on CLI flags.
+func NewClient(cmd *cli.Command) (*clientv3.Client, error) {
+	cfg, err := NewConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(cfg)
+}
+
+// NewConfig initializes the configuration of an etcd client, based on CLI flags.
+// It supports username/password authentication, as well as TLS and mTLS.
+func NewConfig(cmd *cli.Command) (clientv3.Config, error) {
+	cfg := clientv3.Config{
+		Endpoints:   cmd.StringSlice("etcd-endpoint-urls"),
+		Username:    cmd.String("etcd-username"),
+		Password:    cmd.String("etcd-password"),
+		DialTimeout: dialTimeout,
+	}
+
+	tlsCfg, err := tlsConfig(cmd.String("etcd-ca"), cmd.String("etcd-tls-cert"), cmd.String("etcd-tls-key"))
+	if err != nil {
+		return clientv3.Config{}, err
+	}
+	cfg.TLS = tlsCfg
+
+	return cfg, nil
+}
+
+// tlsConfig returns nil if none of the given file paths is specified (i.e. no TLS).
+// If only the CA cert is specified, the client uses TLS. If all 3 are specified,
+// the client uses mTLS. If the CA cert is missing, the client uses the system's
+// root CAs. Specifying only one of the client's cert and key is an error.
+func tlsConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+	if caPath == "" && certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+
+	if certPath == "" && keyPath != "" {
+		return nil, errors.New("missing client public cert file for etcd client with mTLS")
+	}
+	if certPath != "" && keyPath == "" {
+		return nil, errors.New("missing client private key file for etcd client with mTLS")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS13}
+
+	if caPath != "" {
+		pem, err := os.ReadFile(caPath) //gosec:disable G304 -- user-specified file by design
+		if err != nil {
+			return nil, fmt.Errorf("failed to read server CA cert file for etcd client: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if ok := cfg.RootCAs.AppendCertsFromPEM(pem); !ok {
+			return nil, fmt.Errorf("failed to parse server CA cert file for etcd client: %s", caPath)
+		}
+	}
+
+	if certPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client PEM key pair for etcd client with mTLS: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
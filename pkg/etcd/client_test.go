@@ -0,0 +1,183 @@
+package etcd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestNewConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestKeyPair(t, dir)
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantEndpoints []string
+		wantUsername  string
+		wantPassword  string
+		wantTLS       bool
+		wantCA        bool
+		wantCerts     int
+		wantErr       bool
+	}{
+		{
+			name:          "defaults",
+			wantEndpoints: []string{DefaultEndpoint},
+		},
+		{
+			name:          "auth",
+			args:          []string{"--etcd-endpoint-urls", "https://a:2379,https://b:2379", "--etcd-username", "user", "--etcd-password", "pass"},
+			wantEndpoints: []string{"https://a:2379", "https://b:2379"},
+			wantUsername:  "user",
+			wantPassword:  "pass",
+		},
+		{
+			name:          "tls",
+			args:          []string{"--etcd-ca", certPath},
+			wantEndpoints: []string{DefaultEndpoint},
+			wantTLS:       true,
+			wantCA:        true,
+		},
+		{
+			name:          "mtls",
+			args:          []string{"--etcd-ca", certPath, "--etcd-tls-cert", certPath, "--etcd-tls-key", keyPath},
+			wantEndpoints: []string{DefaultEndpoint},
+			wantTLS:       true,
+			wantCA:        true,
+			wantCerts:     1,
+		},
+		{
+			name:          "mtls_with_system_cas",
+			args:          []string{"--etcd-tls-cert", certPath, "--etcd-tls-key", keyPath},
+			wantEndpoints: []string{DefaultEndpoint},
+			wantTLS:       true,
+			wantCerts:     1,
+		},
+		{
+			name:    "missing_key",
+			args:    []string{"--etcd-tls-cert", certPath},
+			wantErr: true,
+		},
+		{
+			name:    "missing_cert",
+			args:    []string{"--etcd-tls-key", keyPath},
+			wantErr: true,
+		},
+		{
+			name:    "missing_ca_file",
+			args:    []string{"--etcd-ca", filepath.Join(dir, "missing.pem")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_ca_file",
+			args:    []string{"--etcd-ca", keyPath},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg clientv3.Config
+			var err error
+			cmd := &cli.Command{
+				Flags: Flags(""),
+				Action: func(_ context.Context, cmd *cli.Command) error {
+					cfg, err = NewConfig(cmd)
+					return nil
+				},
+			}
+			if err := cmd.Run(t.Context(), append([]string{"test"}, tt.args...)); err != nil {
+				t.Fatalf("cli.Command.Run() error = %v", err)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(cfg.Endpoints, tt.wantEndpoints) {
+				t.Errorf("NewConfig() endpoints = %v, want %v", cfg.Endpoints, tt.wantEndpoints)
+			}
+			if cfg.Username != tt.wantUsername {
+				t.Errorf("NewConfig() username = %q, want %q", cfg.Username, tt.wantUsername)
+			}
+			if cfg.Password != tt.wantPassword {
+				t.Errorf("NewConfig() password = %q, want %q", cfg.Password, tt.wantPassword)
+			}
+			if (cfg.TLS != nil) != tt.wantTLS {
+				t.Fatalf("NewConfig() TLS = %v, want %v", cfg.TLS != nil, tt.wantTLS)
+			}
+			if !tt.wantTLS {
+				return
+			}
+			if (cfg.TLS.RootCAs != nil) != tt.wantCA {
+				t.Errorf("NewConfig() TLS root CAs = %v, want %v", cfg.TLS.RootCAs != nil, tt.wantCA)
+			}
+			if n := len(cfg.TLS.Certificates); n != tt.wantCerts {
+				t.Errorf("NewConfig() TLS certs = %d, want %d", n, tt.wantCerts)
+			}
+		})
+	}
+}
+
+// writeTestKeyPair generates a self-signed certificate and its private key,
+// writes them as PEM files in the given directory, and returns their paths.
+func writeTestKeyPair(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	writePEM(t, certPath, "CERTIFICATE", cert)
+	writePEM(t, keyPath, "EC PRIVATE KEY", der)
+
+	return certPath, keyPath
+}
+
+func writePEM(t *testing.T, path, blockType string, b []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
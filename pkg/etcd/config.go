@@ -0,0 +1,74 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	configPrefix = "/omdient/config/"
+)
+
+// ConfigHandler reacts to changes in settings which are stored in etcd.
+type ConfigHandler func(ctx context.Context, name, value string)
+
+// LoadConfig overlays settings which are stored in etcd on top of all the other
+// sources of CLI flags (command-line arguments, environment variables, and the
+// application's configuration file). Each setting is stored in a key whose name
+// is a flag name under the prefix "/omdient/config/", e.g.
+// "/omdient/config/webhook-port". Keys that don't match any flag are ignored.
+//
+// Call this function before reading any flag values, and
+// use [WatchConfig] to react to subsequent changes in etcd.
+func LoadConfig(ctx context.Context, kv clientv3.KV, cmd *cli.Command) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := kv.Get(ctx, configPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return fmt.Errorf("failed to read settings from etcd: %w", err)
+	}
+
+	for _, kv := range resp.Kvs {
+		name := strings.TrimPrefix(string(kv.Key), configPrefix)
+		if !hasFlag(cmd, name) {
+			log.Warn().Str("key", string(kv.Key)).Msg("ignoring unknown setting in etcd")
+			continue
+		}
+
+		if err := cmd.Set(name, string(kv.Value)); err != nil {
+			return fmt.Errorf("invalid setting %q in etcd: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func hasFlag(cmd *cli.Command, name string) bool {
+	for _, f := range cmd.Flags {
+		for _, n := range f.Names() {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WatchConfig calls the given handler for each setting which is added or modified
+// in etcd (see [LoadConfig]). Deleted settings are ignored, i.e. their last value
+// remains in effect until the server restarts. This function blocks until the
+// context is canceled (in which case it returns nil), or the watch fails.
+func WatchConfig(ctx context.Context, w clientv3.Watcher, h ConfigHandler) error {
+	return watchPrefix(ctx, w, configPrefix, func(ctx context.Context, e *clientv3.Event) {
+		if e.Type == mvccpb.PUT {
+			h(ctx, strings.TrimPrefix(string(e.Kv.Key), configPrefix), string(e.Kv.Value))
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      map[string]string
+		args      []string
+		wantPort  int
+		wantLimit float64
+		wantErr   bool
+	}{
+		{
+			name:      "no_settings",
+			wantPort:  14480,
+			wantLimit: 10,
+		},
+		{
+			name: "override_defaults",
+			data: map[string]string{
+				"/omdient/config/webhook-port":       "8080",
+				"/omdient/config/webhook-rate-limit": "2.5",
+			},
+			wantPort:  8080,
+			wantLimit: 2.5,
+		},
+		{
+			name: "override_args",
+			data: map[string]string{
+				"/omdient/config/webhook-port": "8080",
+			},
+			args:      []string{"--webhook-port", "9090"},
+			wantPort:  8080,
+			wantLimit: 10,
+		},
+		{
+			name: "unknown_setting",
+			data: map[string]string{
+				"/omdient/config/foo": "bar",
+				"/other/webhook-port": "8080",
+			},
+			wantPort:  14480,
+			wantLimit: 10,
+		},
+		{
+			name: "invalid_setting",
+			data: map[string]string{
+				"/omdient/config/webhook-port": "http",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed_validation",
+			data: map[string]string{
+				"/omdient/config/webhook-port": "0",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := &fakeKV{data: tt.data}
+			if kv.data == nil {
+				kv.data = map[string]string{}
+			}
+
+			var port int
+			var limit float64
+			cmd := &cli.Command{
+				Name: "test",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "webhook-port",
+						Value: 14480,
+						Validator: func(n int) error {
+							if n < 1 {
+								return errors.New("invalid port number")
+							}
+							return nil
+						},
+					},
+					&cli.FloatFlag{Name: "webhook-rate-limit", Value: 10},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if err := LoadConfig(ctx, kv, cmd); err != nil {
+						return err
+					}
+					port = cmd.Int("webhook-port")
+					limit = cmd.Float("webhook-rate-limit")
+					return nil
+				},
+			}
+
+			err := cmd.Run(t.Context(), append([]string{"test"}, tt.args...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if port != tt.wantPort {
+				t.Errorf("webhook-port = %d, want %d", port, tt.wantPort)
+			}
+			if limit != tt.wantLimit {
+				t.Errorf("webhook-rate-limit = %v, want %v", limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	w := &fakeWatcher{ch: make(chan clientv3.WatchResponse, 2)}
+	w.ch <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		event(mvccpb.PUT, "/omdient/config/webhook-rate-limit", "5"),
+		event(mvccpb.DELETE, "/omdient/config/webhook-rate-burst", ""),
+	}}
+	w.ch <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		event(mvccpb.PUT, "/omdient/config/webhook-rate-burst", "3"),
+	}}
+	close(w.ch)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	got := map[string]string{}
+	err := WatchConfig(ctx, w, func(_ context.Context, name, value string) {
+		got[name] = value
+		if len(got) == 2 {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Errorf("WatchConfig() error = %v", err)
+	}
+
+	want := map[string]string{"webhook-rate-limit": "5", "webhook-rate-burst": "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchConfig() changes = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	connectionsPrefix = "/omdient/connections/"
+	timeout           = 3 * time.Second
+)
+
+// ConnectionStore persists the active stateful connections of the Omdient
+// server in etcd, so they can be re-established after server restarts.
+//
+// It stores only the Thrippy link ID and template of each connection,
+// not the link's secrets, which should be re-fetched from Thrippy.
+type ConnectionStore struct {
+	kv clientv3.KV
+}
+
+// NewConnectionStore initializes a [ConnectionStore] on top of
+// an etcd key-value client (usually a [clientv3.Client]).
+func NewConnectionStore(kv clientv3.KV) *ConnectionStore {
+	return &ConnectionStore{kv: kv}
+}
+
+// Put stores (or overwrites) an active connection.
+func (s *ConnectionStore) Put(ctx context.Context, linkID, template string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := s.kv.Put(ctx, connectionsPrefix+linkID, template)
+	return err
+}
+
+// Delete removes a stored connection. This is a no-op if it doesn't exist.
+func (s *ConnectionStore) Delete(ctx context.Context, linkID string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := s.kv.Delete(ctx, connectionsPrefix+linkID)
+	return err
+}
+
+// List returns all the stored connections, as a map of link IDs to templates,
+// and the etcd revision of this snapshot, so subsequent changes can be watched
+// without gaps (see [WatchConnections]).
+func (s *ConnectionStore) List(ctx context.Context) (map[string]string, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := s.kv.Get(ctx, connectionsPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	conns := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		conns[strings.TrimPrefix(string(kv.Key), connectionsPrefix)] = string(kv.Value)
+	}
+
+	return conns, resp.Header.GetRevision(), nil
+}
@@ -0,0 +1,94 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeKV is a minimal in-memory implementation of [clientv3.KV],
+// which supports only the operations used by [ConnectionStore].
+type fakeKV struct {
+	clientv3.KV
+
+	data map[string]string
+	rev  int64
+}
+
+func (f *fakeKV) Put(_ context.Context, key, val string, _ ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.data[key] = val
+	f.rev++
+	return &clientv3.PutResponse{}, nil
+}
+
+func (f *fakeKV) Get(_ context.Context, key string, _ ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	keys := make([]string, 0, len(f.data))
+	for k := range f.data {
+		if strings.HasPrefix(k, key) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: f.rev}}
+	for _, k := range keys {
+		resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(f.data[k])})
+	}
+	return resp, nil
+}
+
+func (f *fakeKV) Delete(_ context.Context, key string, _ ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	delete(f.data, key)
+	f.rev++
+	return &clientv3.DeleteResponse{}, nil
+}
+
+func TestConnectionStore(t *testing.T) {
+	kv := &fakeKV{data: map[string]string{"/other/key": "value"}}
+	s := NewConnectionStore(kv)
+	ctx := t.Context()
+
+	if err := s.Put(ctx, "id1", "slack-bot-token"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := s.Put(ctx, "id2", "slack-socket-mode"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if got := kv.data["/omdient/connections/id1"]; got != "slack-bot-token" {
+		t.Errorf("etcd value = %q, want %q", got, "slack-bot-token")
+	}
+
+	got, rev, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := map[string]string{"id1": "slack-bot-token", "id2": "slack-socket-mode"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+	if rev != 2 {
+		t.Errorf("List() revision = %d, want 2", rev)
+	}
+
+	if err := s.Delete(ctx, "id1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := s.Delete(ctx, "id3"); err != nil {
+		t.Fatalf("Delete() of missing key error = %v", err)
+	}
+
+	got, _, err = s.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want = map[string]string{"id2": "slack-socket-mode"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() after Delete() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+const (
+	deadLettersPrefix = "/omdient/dead-letters/"
+)
+
+// DeadLetterStore is a [dispatch.DeadLetterStore] which persists events that
+// failed to be dispatched in etcd, so they can be inspected and replayed by
+// any replica of the Omdient server.
+type DeadLetterStore struct {
+	kv clientv3.KV
+}
+
+// NewDeadLetterStore initializes a [DeadLetterStore] on top of
+// an etcd key-value client (usually a [clientv3.Client]).
+func NewDeadLetterStore(kv clientv3.KV) *DeadLetterStore {
+	return &DeadLetterStore{kv: kv}
+}
+
+// Put stores a [dispatch.DeadLetterEntry], by its ID.
+func (s *DeadLetterStore) Put(ctx context.Context, d dispatch.DeadLetterEntry) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err = s.kv.Put(ctx, deadLettersPrefix+d.ID, string(b))
+	return err
+}
+
+// List returns all the stored [dispatch.DeadLetterEntry]s, sorted by their IDs.
+func (s *DeadLetterStore) List(ctx context.Context) ([]dispatch.DeadLetterEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := s.kv.Get(ctx, deadLettersPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	ds := make([]dispatch.DeadLetterEntry, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		d, err := dispatch.ParseDeadLetterEntry(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of etcd key %q: %w", kv.Key, err)
+		}
+		ds = append(ds, d)
+	}
+
+	return ds, nil
+}
+
+// Delete removes a stored [dispatch.DeadLetterEntry]. This is a no-op if it doesn't exist.
+func (s *DeadLetterStore) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := s.kv.Delete(ctx, deadLettersPrefix+id)
+	return err
+}
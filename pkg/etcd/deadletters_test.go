@@ -0,0 +1,49 @@
+package etcd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	kv := &fakeKV{data: map[string]string{"/other/key": "value"}}
+	s := NewDeadLetterStore(kv)
+	ctx := t.Context()
+
+	d1 := dispatch.DeadLetterEntry{ID: "1", LinkID: "a", Payload: map[string]any{"n": json.Number("1")}, Error: "e", Attempts: 1}
+	d2 := dispatch.DeadLetterEntry{ID: "2", LinkID: "b", Payload: map[string]any{}, Error: "e", Attempts: 2}
+	for _, d := range []dispatch.DeadLetterEntry{d1, d2} {
+		if err := s.Put(ctx, d); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	if _, ok := kv.data["/omdient/dead-letters/1"]; !ok {
+		t.Errorf("etcd keys = %v, want /omdient/dead-letters/1", kv.data)
+	}
+
+	got, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []dispatch.DeadLetterEntry{d1, d2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %+v, want %+v", got, want)
+	}
+
+	if err := s.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got, err = s.List(ctx); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []dispatch.DeadLetterEntry{d2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() after Delete() = %+v, want %+v", got, want)
+	}
+
+	kv.data["/omdient/dead-letters/3"] = "not JSON"
+	if _, err := s.List(ctx); err == nil {
+		t.Error("List() with invalid value error = nil")
+	}
+}
@@ -0,0 +1,108 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+const (
+	eventsPrefix = "/omdient/events/"
+
+	// eventLeaseReuse is the maximum time to attach stored events to the same etcd
+	// lease, to avoid granting a lease for each event. Events therefore expire up
+	// to this long after the configured retention time.
+	eventLeaseReuse = time.Minute
+)
+
+// EventClient is the subset of [clientv3.Client] which an [EventStore] uses.
+type EventClient interface {
+	clientv3.KV
+	clientv3.Lease
+}
+
+// EventStore is a [dispatch.EventStore] which keeps dispatched events in
+// etcd, for a limited time, so they can be replayed by any replica of the
+// Omdient server. Events expire automatically, using etcd leases.
+type EventStore struct {
+	c         EventClient
+	retention time.Duration
+
+	mu       sync.Mutex
+	lease    clientv3.LeaseID
+	leasedAt time.Time
+}
+
+// NewEventStore initializes an [EventStore] on top of an etcd client
+// (usually a [clientv3.Client]), with the given minimum retention time.
+func NewEventStore(c EventClient, retention time.Duration) *EventStore {
+	return &EventStore{c: c, retention: retention}
+}
+
+// Put stores (or overwrites) a [dispatch.Event], by its link ID and event ID.
+func (s *EventStore) Put(ctx context.Context, e dispatch.Event) error {
+	b, err := json.Marshal(dispatch.NewEventRecord(e))
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	id, err := s.leaseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.c.Put(ctx, eventKey(e.LinkID, e.ID), string(b), clientv3.WithLease(id))
+	return err
+}
+
+// Get returns a stored [dispatch.Event], or [dispatch.ErrNotFound]
+// if it was never stored, or if it already expired.
+func (s *EventStore) Get(ctx context.Context, linkID, eventID string) (dispatch.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := s.c.Get(ctx, eventKey(linkID, eventID))
+	if err != nil {
+		return dispatch.Event{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return dispatch.Event{}, dispatch.ErrNotFound
+	}
+
+	r, err := dispatch.ParseEventRecord(resp.Kvs[0].Value)
+	if err != nil {
+		return dispatch.Event{}, fmt.Errorf("invalid value of etcd key %q: %w", resp.Kvs[0].Key, err)
+	}
+	return r.Event(), nil
+}
+
+// leaseID returns the current lease for stored events, or grants a new one.
+func (s *EventStore) leaseID(ctx context.Context) (clientv3.LeaseID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lease != 0 && time.Since(s.leasedAt) < eventLeaseReuse {
+		return s.lease, nil
+	}
+
+	resp, err := s.c.Grant(ctx, int64((s.retention + eventLeaseReuse).Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	s.lease, s.leasedAt = resp.ID, time.Now()
+	return s.lease, nil
+}
+
+func eventKey(linkID, eventID string) string {
+	return eventsPrefix + linkID + "/" + eventID
+}
@@ -0,0 +1,63 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// fakeEventClient adds minimal lease support to [fakeKV].
+type fakeEventClient struct {
+	*fakeKV
+	clientv3.Lease
+
+	grants []int64
+}
+
+func (f *fakeEventClient) Grant(_ context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.grants = append(f.grants, ttl)
+	return &clientv3.LeaseGrantResponse{ID: clientv3.LeaseID(len(f.grants)), TTL: ttl}, nil
+}
+
+func TestEventStore(t *testing.T) {
+	c := &fakeEventClient{fakeKV: &fakeKV{data: map[string]string{}}}
+	s := NewEventStore(c, DefaultEventRetention)
+	ctx := t.Context()
+
+	e1 := dispatch.Event{ID: "e1", LinkID: "link", LinkType: "slack", Payload: map[string]any{"n": json.Number("1")}}
+	e2 := dispatch.Event{ID: "e2", LinkID: "link", LinkType: "slack", Payload: map[string]any{}}
+	for _, e := range []dispatch.Event{e1, e2} {
+		if err := s.Put(ctx, e); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if _, ok := c.data["/omdient/events/link/e1"]; !ok {
+		t.Errorf("etcd keys = %v, want /omdient/events/link/e1", c.data)
+	}
+	// Events which are stored at the same time share the same lease.
+	if want := []int64{int64((DefaultEventRetention + eventLeaseReuse).Seconds())}; !reflect.DeepEqual(c.grants, want) {
+		t.Errorf("lease grants = %v, want %v", c.grants, want)
+	}
+
+	got, err := s.Get(ctx, "link", "e1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, e1) {
+		t.Errorf("Get() = %+v, want %+v", got, e1)
+	}
+
+	if _, err := s.Get(ctx, "link", "e3"); !errors.Is(err, dispatch.ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, dispatch.ErrNotFound)
+	}
+	if _, err := s.Get(ctx, "other", "e1"); !errors.Is(err, dispatch.ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, dispatch.ErrNotFound)
+	}
+}
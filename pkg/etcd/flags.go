@@ -1,6 +1,9 @@
 package etcd
 
 import (
+	"errors"
+	"time"
+
 	altsrc "github.com/urfave/cli-altsrc/v3"
 	"github.com/urfave/cli-altsrc/v3/toml"
 	"github.com/urfave/cli/v3"
@@ -8,6 +11,9 @@ import (
 
 const (
 	DefaultEndpoint = "http://localhost:2379"
+	DefaultLeaseTTL = 10 * time.Second
+
+	DefaultEventRetention = 24 * time.Hour
 )
 
 // Flags defines CLI flags to configure an etcd gRPC client. These flags can also
@@ -23,5 +29,106 @@ func Flags(configFilePath altsrc.StringSourcer) []cli.Flag {
 				toml.TOML("etcd.endpoint_urls", configFilePath),
 			),
 		},
+		&cli.StringFlag{
+			Name:  "etcd-username",
+			Usage: "etcd client username (for authentication)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_USERNAME"),
+				toml.TOML("etcd.username", configFilePath),
+			),
+		},
+		&cli.StringFlag{
+			Name:  "etcd-password",
+			Usage: "etcd client password (for authentication)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_PASSWORD"),
+				toml.TOML("etcd.password", configFilePath),
+			),
+		},
+		&cli.StringFlag{
+			Name:  "etcd-tls-cert",
+			Usage: "etcd client's public certificate PEM file (mTLS only)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_TLS_CERT"),
+				toml.TOML("etcd.tls_cert", configFilePath),
+			),
+			TakesFile: true,
+		},
+		&cli.StringFlag{
+			Name:  "etcd-tls-key",
+			Usage: "etcd client's private key PEM file (mTLS only)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_TLS_KEY"),
+				toml.TOML("etcd.tls_key", configFilePath),
+			),
+			TakesFile: true,
+		},
+		&cli.StringFlag{
+			Name:  "etcd-ca",
+			Usage: "etcd server's CA certificate PEM file (both TLS and mTLS)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_CA"),
+				toml.TOML("etcd.ca", configFilePath),
+			),
+			TakesFile: true,
+		},
+		&cli.BoolFlag{
+			Name:  "etcd-config",
+			Usage: "overlay settings from etcd, and apply changes to hot-reloadable ones",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_CONFIG"),
+				toml.TOML("etcd.config", configFilePath),
+			),
+		},
+		&cli.BoolFlag{
+			Name:  "etcd-persist-connections",
+			Usage: "persist active connections in etcd, to re-establish them after server restarts",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_PERSIST_CONNECTIONS"),
+				toml.TOML("etcd.persist_connections", configFilePath),
+			),
+		},
+		&cli.DurationFlag{
+			Name:  "etcd-lease-ttl",
+			Usage: "time until other replicas take over persisted connections from a failed one",
+			Value: DefaultLeaseTTL,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_LEASE_TTL"),
+				toml.TOML("etcd.lease_ttl", configFilePath),
+			),
+			Validator: validateLeaseTTL,
+		},
+		&cli.BoolFlag{
+			Name:  "etcd-store-events",
+			Usage: "store dispatched events in etcd, to allow replaying them",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_STORE_EVENTS"),
+				toml.TOML("etcd.store_events", configFilePath),
+			),
+		},
+		&cli.DurationFlag{
+			Name:  "etcd-event-retention",
+			Usage: "minimum time to keep stored events in etcd",
+			Value: DefaultEventRetention,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("ETCD_EVENT_RETENTION"),
+				toml.TOML("etcd.event_retention", configFilePath),
+			),
+			Validator: validateEventRetention,
+		},
+	}
+}
+
+func validateLeaseTTL(d time.Duration) error {
+	if d < time.Second {
+		return errors.New("must be at least 1 second")
+	}
+	return nil
+}
+
+func validateEventRetention(d time.Duration) error {
+	if d < time.Minute {
+		return errors.New("must be at least 1 minute")
 	}
+	return nil
 }
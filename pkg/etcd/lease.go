@@ -0,0 +1,230 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	ownersPrefix = "/omdient/owners/"
+
+	minRegrantDelay = time.Second
+)
+
+// LeaseClient is the subset of [clientv3.Client] which a [ConnectionLeaser] uses.
+type LeaseClient interface {
+	clientv3.KV
+	clientv3.Lease
+	clientv3.Watcher
+}
+
+// ConnectionLeaser distributes stateful connections across multiple
+// replicas of the Omdient server, to prevent duplicate event delivery.
+//
+// Each replica holds a single etcd lease, and claims connections by
+// attaching ownership keys to it. Only the owning replica should run
+// a connection. If the owner fails, its lease expires, the ownership
+// keys are deleted, and other replicas can claim them instead
+// (see [ConnectionLeaser.WatchReleased]).
+type ConnectionLeaser struct {
+	c     LeaseClient
+	owner string
+	ttl   time.Duration
+
+	mu     sync.RWMutex
+	lease  clientv3.LeaseID
+	closed bool
+}
+
+// NewConnectionLeaser initializes a [ConnectionLeaser] for the replica with the
+// given owner ID, using an etcd client (usually a [clientv3.Client]). The lease
+// TTL is the maximum time until other replicas detect that this one failed.
+func NewConnectionLeaser(c LeaseClient, owner string, ttl time.Duration) *ConnectionLeaser {
+	return &ConnectionLeaser{c: c, owner: owner, ttl: ttl}
+}
+
+// Start grants the replica's lease, and keeps it alive in the background until
+// the context is canceled, or [ConnectionLeaser.Close] is called. This must be
+// called before claiming connections.
+//
+// If the lease is lost (e.g. etcd was unreachable for longer than the TTL), other
+// replicas may claim this one's connections. In this case a new lease is granted,
+// and then the given function is called, to re-claim the replica's connections,
+// and stop the ones which other replicas claimed in the meantime.
+func (l *ConnectionLeaser) Start(ctx context.Context, regranted func(ctx context.Context)) error {
+	ch, err := l.grant(ctx)
+	if err != nil {
+		return err
+	}
+
+	go l.keepAlive(ctx, ch, regranted)
+	return nil
+}
+
+// grant grants a new lease to the replica, and starts keeping it alive.
+func (l *ConnectionLeaser) grant(ctx context.Context) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	grantCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := l.c.Grant(grantCtx, max(int64(l.ttl.Seconds()), 1))
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := l.c.KeepAlive(ctx, resp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		_, _ = l.c.Revoke(grantCtx, resp.ID)
+		return nil, errors.New("connection leaser is closed")
+	}
+
+	l.lease = resp.ID
+	return ch, nil
+}
+
+// keepAlive drains the keep-alive responses of the replica's lease, as required
+// by [clientv3.Lease.KeepAlive], and re-grants the lease whenever it's lost.
+func (l *ConnectionLeaser) keepAlive(ctx context.Context, ch <-chan *clientv3.LeaseKeepAliveResponse, regranted func(context.Context)) {
+	for {
+		for range ch {
+			// Drain keep-alive responses.
+		}
+
+		l.mu.Lock()
+		closed := l.closed
+		l.lease = clientv3.NoLease
+		l.mu.Unlock()
+		if ctx.Err() != nil || closed {
+			return
+		}
+
+		log.Error().Str("owner", l.owner).Msg("lost etcd lease, other replicas may claim this one's connections")
+		if ch = l.regrant(ctx); ch == nil {
+			return
+		}
+
+		log.Info().Str("owner", l.owner).Msg("re-granted etcd lease")
+		if regranted != nil {
+			regranted(ctx)
+		}
+	}
+}
+
+// regrant tries to grant a new lease to the replica, with exponential backoff,
+// until it succeeds, or the context is canceled, or the leaser is closed.
+func (l *ConnectionLeaser) regrant(ctx context.Context) <-chan *clientv3.LeaseKeepAliveResponse {
+	delay := minRegrantDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		ch, err := l.grant(ctx)
+		if err == nil {
+			return ch
+		}
+
+		l.mu.RLock()
+		closed := l.closed
+		l.mu.RUnlock()
+		if closed {
+			return nil
+		}
+
+		log.Err(err).Str("owner", l.owner).Msg("failed to re-grant etcd lease")
+		delay = min(delay*2, max(l.ttl, minRegrantDelay))
+	}
+}
+
+// Claim tries to take ownership of a connection. It returns true if this
+// replica owns the connection (including if it already did before this call),
+// or false if another replica owns it.
+func (l *ConnectionLeaser) Claim(ctx context.Context, linkID string) (bool, error) {
+	l.mu.RLock()
+	lease := l.lease
+	l.mu.RUnlock()
+
+	if lease == clientv3.NoLease {
+		return false, errors.New("etcd lease not granted")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	key := ownersPrefix + linkID
+	resp, err := l.c.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, l.owner, clientv3.WithLease(lease))).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+
+	if resp.Succeeded {
+		return true, nil
+	}
+
+	kvs := resp.Responses[0].GetResponseRange().GetKvs()
+	return len(kvs) > 0 && string(kvs[0].Value) == l.owner, nil
+}
+
+// Release gives up ownership of a connection, if this replica owns it.
+func (l *ConnectionLeaser) Release(ctx context.Context, linkID string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	key := ownersPrefix + linkID
+	_, err := l.c.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", l.owner)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	return err
+}
+
+// WatchReleased calls the given function with the link ID of each connection
+// whose ownership was released, either explicitly or because its owner's lease
+// expired, so this replica can try to claim it. This function blocks until the
+// context is canceled (in which case it returns nil), or the watch fails.
+func (l *ConnectionLeaser) WatchReleased(ctx context.Context, f func(ctx context.Context, linkID string)) error {
+	return watchPrefix(ctx, l.c, ownersPrefix, func(ctx context.Context, e *clientv3.Event) {
+		if e.Type == mvccpb.DELETE {
+			f(ctx, strings.TrimPrefix(string(e.Kv.Key), ownersPrefix))
+		}
+	})
+}
+
+// Close revokes the replica's lease, which releases all of its
+// connections immediately, instead of waiting for the lease to expire.
+func (l *ConnectionLeaser) Close(ctx context.Context) error {
+	l.mu.Lock()
+	lease := l.lease
+	l.lease = clientv3.NoLease
+	l.closed = true
+	l.mu.Unlock()
+
+	if lease == clientv3.NoLease {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := l.c.Revoke(ctx, lease)
+	return err
+}
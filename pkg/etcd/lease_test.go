@@ -0,0 +1,341 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeCluster is a minimal in-memory simulation of an etcd cluster, which
+// supports only the transactions, leases, and watches used by [ConnectionLeaser].
+type fakeCluster struct {
+	mu         sync.Mutex
+	nextLease  clientv3.LeaseID
+	data       map[string]fakeEntry
+	keepAlives map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse
+	watchers   []chan clientv3.WatchResponse
+}
+
+type fakeEntry struct {
+	value string
+	lease clientv3.LeaseID
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		data:       map[string]fakeEntry{},
+		keepAlives: map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse{},
+	}
+}
+
+// expire simulates the expiration of a lease, e.g. due to a replica failure.
+func (c *fakeCluster) expire(id clientv3.LeaseID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.keepAlives[id]
+	if !ok {
+		return
+	}
+	close(ch)
+	delete(c.keepAlives, id)
+
+	for k, e := range c.data {
+		if e.lease == id {
+			c.delete(k)
+		}
+	}
+}
+
+// delete must be called while holding the cluster's lock.
+func (c *fakeCluster) delete(key string) {
+	delete(c.data, key)
+	e := &clientv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(key)}}
+	for _, w := range c.watchers {
+		w <- clientv3.WatchResponse{Events: []*clientv3.Event{e}}
+	}
+}
+
+// fakeReplica is a single replica's etcd client, connected to a [fakeCluster].
+type fakeReplica struct {
+	clientv3.KV
+	clientv3.Lease
+	clientv3.Watcher
+
+	c     *fakeCluster
+	lease clientv3.LeaseID
+}
+
+func (r *fakeReplica) Grant(_ context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+
+	r.c.nextLease++
+	r.lease = r.c.nextLease
+	r.c.keepAlives[r.lease] = make(chan *clientv3.LeaseKeepAliveResponse)
+	return &clientv3.LeaseGrantResponse{ID: r.lease, TTL: ttl}, nil
+}
+
+func (r *fakeReplica) KeepAlive(_ context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+
+	ch, ok := r.c.keepAlives[id]
+	if !ok {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	return ch, nil
+}
+
+func (r *fakeReplica) Revoke(_ context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	r.c.expire(id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func (r *fakeReplica) Watch(_ context.Context, _ string, _ ...clientv3.OpOption) clientv3.WatchChan {
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+
+	ch := make(chan clientv3.WatchResponse, 10)
+	r.c.watchers = append(r.c.watchers, ch)
+	return ch
+}
+
+func (r *fakeReplica) Txn(_ context.Context) clientv3.Txn {
+	return &fakeTxn{r: r}
+}
+
+func (r *fakeReplica) Close() error {
+	return nil
+}
+
+type fakeTxn struct {
+	r       *fakeReplica
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+	clientv3.Txn
+}
+
+func (t *fakeTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = cs
+	return t
+}
+
+func (t *fakeTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thenOps = ops
+	return t
+}
+
+func (t *fakeTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elseOps = ops
+	return t
+}
+
+func (t *fakeTxn) Commit() (*clientv3.TxnResponse, error) {
+	c := t.r.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	succeeded := true
+	for _, cmp := range t.cmps {
+		e, ok := c.data[string(cmp.Key)]
+		switch cmp.Target {
+		case pb.Compare_CREATE: // Only "= 0" is supported.
+			succeeded = succeeded && !ok
+		case pb.Compare_VALUE: // Only "=" is supported.
+			succeeded = succeeded && ok && e.value == string(cmp.ValueBytes())
+		}
+	}
+
+	ops := t.elseOps
+	if succeeded {
+		ops = t.thenOps
+	}
+
+	resp := &clientv3.TxnResponse{Succeeded: succeeded}
+	for _, op := range ops {
+		key := string(op.KeyBytes())
+		switch {
+		case op.IsPut():
+			if _, ok := c.keepAlives[t.r.lease]; !ok {
+				return nil, rpctypes.ErrLeaseNotFound
+			}
+			c.data[key] = fakeEntry{value: string(op.ValueBytes()), lease: t.r.lease}
+		case op.IsDelete():
+			c.delete(key)
+		case op.IsGet():
+			rr := &pb.RangeResponse{}
+			if e, ok := c.data[key]; ok {
+				rr.Kvs = append(rr.Kvs, &mvccpb.KeyValue{Key: []byte(key), Value: []byte(e.value)})
+			}
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponseRange{ResponseRange: rr},
+			})
+		}
+	}
+
+	return resp, nil
+}
+
+func startLeaser(t *testing.T, c *fakeCluster, owner string) (*ConnectionLeaser, *fakeReplica) {
+	t.Helper()
+
+	r := &fakeReplica{c: c}
+	l := NewConnectionLeaser(r, owner, 5*time.Second)
+	if err := l.Start(t.Context(), nil); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return l, r
+}
+
+func claim(t *testing.T, l *ConnectionLeaser, linkID string, want bool) {
+	t.Helper()
+
+	got, err := l.Claim(t.Context(), linkID)
+	if err != nil {
+		t.Fatalf("Claim(%q) by %q error = %v", linkID, l.owner, err)
+	}
+	if got != want {
+		t.Errorf("Claim(%q) by %q = %v, want %v", linkID, l.owner, got, want)
+	}
+}
+
+func TestConnectionLeaserClaimAndRelease(t *testing.T) {
+	c := newFakeCluster()
+	a, _ := startLeaser(t, c, "a")
+	b, _ := startLeaser(t, c, "b")
+
+	claim(t, a, "id1", true)
+	claim(t, a, "id1", true) // Idempotent.
+	claim(t, b, "id1", false)
+	claim(t, b, "id2", true)
+
+	// Releasing a connection owned by another replica is a no-op.
+	if err := b.Release(t.Context(), "id1"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	claim(t, b, "id1", false)
+
+	if err := a.Release(t.Context(), "id1"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	claim(t, b, "id1", true)
+}
+
+func TestConnectionLeaserFailover(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(a *ConnectionLeaser, r *fakeReplica, c *fakeCluster) error
+	}{
+		{
+			name: "lease_expired",
+			fail: func(_ *ConnectionLeaser, r *fakeReplica, c *fakeCluster) error {
+				c.expire(r.lease)
+				return nil
+			},
+		},
+		{
+			name: "graceful_close",
+			fail: func(a *ConnectionLeaser, _ *fakeReplica, _ *fakeCluster) error {
+				return a.Close(context.Background())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeCluster()
+			a, ra := startLeaser(t, c, "a")
+			b, _ := startLeaser(t, c, "b")
+
+			claim(t, a, "id1", true)
+			claim(t, a, "id2", true)
+			claim(t, b, "id1", false)
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			released := make(chan string, 10)
+			go func() {
+				_ = b.WatchReleased(ctx, func(ctx context.Context, linkID string) {
+					if ok, _ := b.Claim(ctx, linkID); ok {
+						released <- linkID
+					}
+				})
+			}()
+			waitForWatchers(t, c, 1)
+
+			if err := tt.fail(a, ra, c); err != nil {
+				t.Fatalf("owner failure error = %v", err)
+			}
+
+			got := map[string]bool{}
+			for range 2 {
+				select {
+				case id := <-released:
+					got[id] = true
+				case <-time.After(time.Second):
+					t.Fatalf("connections taken over by replica b = %v, want 2", got)
+				}
+			}
+			if !got["id1"] || !got["id2"] {
+				t.Errorf("connections taken over by replica b = %v, want id1 and id2", got)
+			}
+
+			claim(t, b, "id1", true)
+			if ok, _ := a.Claim(t.Context(), "id1"); ok {
+				t.Error("Claim() by failed owner = true, want false")
+			}
+		})
+	}
+}
+
+func TestConnectionLeaserRegrant(t *testing.T) {
+	c := newFakeCluster()
+	ra := &fakeReplica{c: c}
+	a := NewConnectionLeaser(ra, "a", 5*time.Second)
+	regranted := make(chan struct{}, 1)
+	if err := a.Start(t.Context(), func(context.Context) { regranted <- struct{}{} }); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	b, _ := startLeaser(t, c, "b")
+
+	claim(t, a, "id1", true)
+	claim(t, a, "id2", true)
+
+	// Replica b claims one of replica a's connections while a's lease is lost.
+	c.expire(ra.lease)
+	claim(t, b, "id1", true)
+
+	select {
+	case <-regranted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lost lease wasn't re-granted")
+	}
+
+	claim(t, a, "id1", false)
+	claim(t, a, "id2", true)
+	claim(t, b, "id2", false)
+}
+
+func waitForWatchers(t *testing.T, c *fakeCluster, n int) {
+	t.Helper()
+
+	for range 100 {
+		c.mu.Lock()
+		ok := len(c.watchers) >= n
+		c.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("watcher didn't start")
+}
@@ -0,0 +1,71 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ConnectionEvent is a change in the persisted connections (see [ConnectionStore]),
+// possibly by a different process, which is reported by [WatchConnections].
+type ConnectionEvent struct {
+	LinkID   string
+	Template string // Empty if the connection was deleted.
+	Deleted  bool
+}
+
+// ConnectionEventHandler reacts to [ConnectionEvent]s.
+type ConnectionEventHandler func(ctx context.Context, e ConnectionEvent)
+
+// WatchConnections calls the given handler for each change in the persisted
+// connections, so that other processes (or operators) can add and remove
+// connections dynamically. This function blocks until the context is canceled
+// (in which case it returns nil), or the watch fails (e.g. due to compaction).
+//
+// The watch starts after the given revision, which is typically returned by
+// [ConnectionStore.List], so no changes are missed between the two calls.
+// If it's 0, the watch starts at the current revision.
+func WatchConnections(ctx context.Context, w clientv3.Watcher, rev int64, h ConnectionEventHandler) error {
+	var opts []clientv3.OpOption
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+
+	return watchPrefix(ctx, w, connectionsPrefix, func(ctx context.Context, e *clientv3.Event) {
+		ce := ConnectionEvent{LinkID: strings.TrimPrefix(string(e.Kv.Key), connectionsPrefix)}
+		switch e.Type {
+		case mvccpb.PUT:
+			ce.Template = string(e.Kv.Value)
+		case mvccpb.DELETE:
+			ce.Deleted = true
+		}
+		h(ctx, ce)
+	}, opts...)
+}
+
+// watchPrefix calls the given function for each change in the keys under the
+// given prefix. This function blocks until the context is canceled (in which
+// case it returns nil), or the watch fails (e.g. due to compaction).
+func watchPrefix(ctx context.Context, w clientv3.Watcher, prefix string, f func(context.Context, *clientv3.Event), opts ...clientv3.OpOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	opts = append([]clientv3.OpOption{clientv3.WithPrefix()}, opts...)
+	for resp := range w.Watch(ctx, prefix, opts...) {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+
+		for _, e := range resp.Events {
+			f(ctx, e)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("etcd watch channel closed unexpectedly")
+}
@@ -0,0 +1,110 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeWatcher is an implementation of [clientv3.Watcher]
+// which publishes synthetic watch responses.
+type fakeWatcher struct {
+	clientv3.Watcher
+
+	ch  chan clientv3.WatchResponse
+	rev int64 // Starting revision of the last watch.
+}
+
+func (f *fakeWatcher) Watch(_ context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	f.rev = clientv3.OpGet(key, opts...).Rev()
+	return f.ch
+}
+
+func event(t mvccpb.Event_EventType, key, val string) *clientv3.Event {
+	return &clientv3.Event{Type: t, Kv: &mvccpb.KeyValue{Key: []byte(key), Value: []byte(val)}}
+}
+
+func TestWatchConnections(t *testing.T) {
+	tests := []struct {
+		name      string
+		rev       int64
+		responses []clientv3.WatchResponse
+		cancel    bool
+		want      []ConnectionEvent
+		wantRev   int64
+		wantErr   bool
+	}{
+		{
+			name: "put_and_delete",
+			rev:  7,
+			responses: []clientv3.WatchResponse{
+				{Events: []*clientv3.Event{
+					event(mvccpb.PUT, "/omdient/connections/id1", "slack-socket-mode"),
+					event(mvccpb.PUT, "/omdient/connections/id2", "slack-socket-mode"),
+				}},
+				{Events: []*clientv3.Event{
+					event(mvccpb.DELETE, "/omdient/connections/id1", ""),
+				}},
+			},
+			cancel: true,
+			want: []ConnectionEvent{
+				{LinkID: "id1", Template: "slack-socket-mode"},
+				{LinkID: "id2", Template: "slack-socket-mode"},
+				{LinkID: "id1", Deleted: true},
+			},
+			wantRev: 8,
+		},
+		{
+			name: "compacted",
+			responses: []clientv3.WatchResponse{
+				{CompactRevision: 5, Canceled: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "canceled",
+			responses: []clientv3.WatchResponse{
+				{Canceled: true},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unexpected_close",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			w := &fakeWatcher{ch: make(chan clientv3.WatchResponse, len(tt.responses))}
+			for _, r := range tt.responses {
+				w.ch <- r
+			}
+			close(w.ch)
+
+			var got []ConnectionEvent
+			err := WatchConnections(ctx, w, tt.rev, func(_ context.Context, e ConnectionEvent) {
+				got = append(got, e)
+				if tt.cancel && len(got) == len(tt.want) {
+					cancel()
+				}
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WatchConnections() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WatchConnections() events = %v, want %v", got, tt.want)
+			}
+			if w.rev != tt.wantRev {
+				t.Errorf("WatchConnections() start revision = %d, want %d", w.rev, tt.wantRev)
+			}
+		})
+	}
+}
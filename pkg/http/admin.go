@@ -0,0 +1,154 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// connectionInfo is the JSON representation of an active
+// stateful connection, in responses of [httpServer.connectionsHandler].
+type connectionInfo struct {
+	LinkID         string    `json:"link_id"`
+	Template       string    `json:"template"`
+	ConnectedSince time.Time `json:"connected_since"`
+	Reconnections  int64     `json:"reconnections"`
+}
+
+// requireAdminToken wraps an administrative HTTP handler, to allow only
+// requests with the configured static bearer token.
+func (s *httpServer) requireAdminToken(h http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + s.adminToken)
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(strings.TrimSpace(r.Header.Get("Authorization")))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			log.Warn().Str("http_method", r.Method).Str("url_path", r.URL.EscapedPath()).
+				Msg("unauthorized: missing or invalid admin token")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// connectionsHandler lists the stateful connections which are active in this
+// server (but not in other replicas), sorted by their Thrippy link IDs.
+func (s *httpServer) connectionsHandler(w http.ResponseWriter, _ *http.Request) {
+	conns := []connectionInfo{}
+	s.connections.Range(func(_, v any) bool {
+		c := v.(*connection)
+		conns = append(conns, connectionInfo{
+			LinkID:         c.ID,
+			Template:       c.Template,
+			ConnectedSince: c.since.UTC(),
+			Reconnections:  c.reconnects.Load(),
+		})
+		return true
+	})
+
+	slices.SortFunc(conns, func(a, b connectionInfo) int {
+		return strings.Compare(a.LinkID, b.LinkID)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(conns); err != nil {
+		log.Err(err).Msg("failed to write list of connections")
+	}
+}
+
+// replayHandler re-dispatches a previously-dispatched event, which is
+// read from the [dispatch.EventStore], without contacting its upstream service.
+func (s *httpServer) replayHandler(w http.ResponseWriter, r *http.Request) {
+	linkID, eventID := r.PathValue("link_id"), r.PathValue("event_id")
+	l := log.With().Str("link_id", linkID).Str("event_id", eventID).Logger()
+
+	e, err := s.events.Get(r.Context(), linkID, eventID)
+	if errors.Is(err, dispatch.ErrNotFound) {
+		l.Warn().Msg("not found: event isn't stored")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		l.Err(err).Msg("failed to read stored event")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.queue.Enqueue(e); err != nil {
+		l.Warn().Err(err).Msg("service unavailable: failed to enqueue stored event for replay")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	l.Info().Msg("replaying stored event")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deadLettersHandler lists the stored events which failed to be dispatched.
+func (s *httpServer) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	ds, err := s.deadLetters.List(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to list dead letters")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if ds == nil {
+		ds = []dispatch.DeadLetterEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ds); err != nil {
+		log.Err(err).Msg("failed to write list of dead letters")
+	}
+}
+
+// replayResult is the JSON response of [httpServer.replayDeadLettersHandler].
+type replayResult struct {
+	Replayed  int `json:"replayed"`
+	Remaining int `json:"remaining"`
+}
+
+// replayDeadLettersHandler re-enqueues all the stored events which failed to be
+// dispatched. Each one is deleted from the store after its replay is handled: if
+// it fails again, it's stored as a new dead letter, with an incremented attempt
+// count. If the dispatch queue is full, the remaining events are kept for later.
+func (s *httpServer) replayDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	ds, err := s.deadLetters.List(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to list dead letters")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res := replayResult{}
+	for _, d := range ds {
+		err := s.queue.EnqueueFunc(d.Event(), func(error) {
+			if err := s.deadLetters.Delete(context.Background(), d.ID); err != nil {
+				log.Err(err).Str("dead_letter_id", d.ID).Msg("failed to delete replayed dead letter")
+			}
+		})
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to enqueue dead letter for replay")
+			break
+		}
+		res.Replayed++
+	}
+	res.Remaining = len(ds) - res.Replayed
+
+	log.Info().Int("replayed", res.Replayed).Int("remaining", res.Remaining).Msg("replaying dead letters")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Err(err).Msg("failed to write dead letter replay result")
+	}
+}
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/lithammer/shortuuid/v4"
+
+	intlinks "github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/links"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+	"github.com/tzrikka/omdient/pkg/websocket"
+)
+
+func TestConnectionsHandler(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, map[string]string{})
+	s.adminToken = "token"
+
+	// Simulate a WebSocket reconnection in the link-specific connection handler.
+	links.ConnectionHandlers[testTemplate] = func(ctx context.Context, _ intlinks.LinkData) int {
+		websocket.LifecycleFromContext(ctx)(websocket.LifecycleEvent{Type: websocket.ConnReconnected})
+		receivers.RegisterStop(ctx, func() {})
+		return http.StatusOK
+	}
+
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	list := func(t *testing.T) []connectionInfo {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connections", http.NoBody)
+		r.Header.Set("Authorization", "Bearer token")
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("connections response status code = %d, want %d", w.Code, http.StatusOK)
+		}
+
+		var got []connectionInfo
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := list(t); len(got) != 0 {
+		t.Fatalf("connections before connect = %v, want none", got)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connect/"+id, http.NoBody)
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("connect response status code = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	got := list(t)
+	if len(got) != 1 {
+		t.Fatalf("connections after connect = %v, want 1", got)
+	}
+	if got[0].LinkID != id || got[0].Template != testTemplate {
+		t.Errorf("connection = %+v, want link ID %q and template %q", got[0], id, testTemplate)
+	}
+	if got[0].ConnectedSince.IsZero() {
+		t.Error("connection's connected-since timestamp is zero")
+	}
+	if got[0].Reconnections != 1 {
+		t.Errorf("connection reconnections = %d, want 1", got[0].Reconnections)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/disconnect/"+id, http.NoBody)
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("disconnect response status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := list(t); len(got) != 0 {
+		t.Errorf("connections after disconnect = %v, want none", got)
+	}
+}
+
+func TestConnectionsHandlerAuthentication(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     string
+		wantCode int
+	}{
+		{
+			name:     "missing_token",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "invalid_token",
+			auth:     "Bearer other",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong_scheme",
+			auth:     "Basic token",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "valid_token",
+			auth:     "Bearer token",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	s := &httpServer{adminToken: "token"}
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connections", http.NoBody)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestConnectionsHandlerDisabled(t *testing.T) {
+	mux, err := (&httpServer{}).routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connections", http.NoBody)
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("response status code = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	store := dispatch.NewFileSink(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	for _, id := range []string{"1", "2"} {
+		d := dispatch.DeadLetterEntry{ID: id, LinkID: "link", LinkType: "test", Error: "e", Attempts: 1}
+		if err := store.Put(t.Context(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := dispatch.NewQueue(dispatch.LogDispatcher{}, 10, nil)
+	s := &httpServer{adminToken: "token", queue: q, deadLetters: store}
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/dead-letters", http.NoBody)
+	r.Header.Set("Authorization", "Bearer token")
+	mux.ServeHTTP(w, r)
+	var list []dispatch.DeadLetterEntry
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(list) != 2 {
+		t.Fatalf("dead letters response = %d %v, want %d with 2 entries", w.Code, list, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/dead-letters/replay", http.NoBody)
+	r.Header.Set("Authorization", "Bearer token")
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("replay response status code = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	var got replayResult
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (replayResult{Replayed: 2}) {
+		t.Errorf("replay result = %+v, want 2 replayed", got)
+	}
+
+	// Replayed events are deleted after they're dispatched.
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if ds, err := store.List(t.Context()); err != nil || len(ds) != 0 {
+		t.Errorf("dead letters after replay = %v, %v, want none", ds, err)
+	}
+}
+
+func TestReplayDeadLettersDisabled(t *testing.T) {
+	mux, err := (&httpServer{adminToken: "token"}).routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/dead-letters/replay", http.NoBody)
+	r.Header.Set("Authorization", "Bearer token")
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("response status code = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// memoryEvents is an in-memory [dispatch.EventStore].
+type memoryEvents map[string]dispatch.Event
+
+func (m memoryEvents) Put(_ context.Context, e dispatch.Event) error {
+	m[e.LinkID+"/"+e.ID] = e
+	return nil
+}
+
+func (m memoryEvents) Get(_ context.Context, linkID, eventID string) (dispatch.Event, error) {
+	e, ok := m[linkID+"/"+eventID]
+	if !ok {
+		return dispatch.Event{}, dispatch.ErrNotFound
+	}
+	return e, nil
+}
+
+// eventRecorder records dispatched events.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []dispatch.Event
+}
+
+func (r *eventRecorder) Dispatch(_ context.Context, e dispatch.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestReplayHandler(t *testing.T) {
+	events := memoryEvents{"link/event": {ID: "event", LinkID: "link", LinkType: "test"}}
+	d := &eventRecorder{}
+	q := dispatch.NewQueue(d, 10, nil)
+	s := &httpServer{adminToken: "token", queue: q, events: events}
+
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		auth     string
+		wantCode int
+	}{
+		{
+			name:     "unauthorized",
+			path:     "/replay/link/event",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "stored_event",
+			path:     "/replay/link/event",
+			auth:     "Bearer token",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "missing_event",
+			path:     "/replay/link/other",
+			auth:     "Bearer token",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, tt.path, http.NoBody)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+
+	if err := q.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.events) != 1 || d.events[0].ID != "event" || d.events[0].LinkID != "link" {
+		t.Errorf("replayed events = %+v, want the stored one", d.events)
+	}
+}
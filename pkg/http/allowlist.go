@@ -0,0 +1,108 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// linkAllowlist maps Thrippy link IDs to the CIDR ranges of network
+// addresses which are allowed to send webhook requests to these links
+// (e.g. https://api.github.com/meta). Links without ranges allow all sources.
+type linkAllowlist map[string][]netip.Prefix
+
+// parseAllowlist converts the value of the "webhook-allowed-cidrs" flag
+// into a [linkAllowlist]. Each key is a link ID, and each value is a list
+// of CIDR ranges, separated by spaces (commas separate the flag's entries).
+func parseAllowlist(m map[string]string) (linkAllowlist, error) {
+	a := make(linkAllowlist, len(m))
+	for id, ranges := range m {
+		if id == "" {
+			return nil, fmt.Errorf("missing link ID for CIDR ranges %q", ranges)
+		}
+
+		for _, r := range strings.Fields(ranges) {
+			p, err := netip.ParsePrefix(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range for link %q: %w", id, err)
+			}
+			a[id] = append(a[id], p.Masked())
+		}
+	}
+	return a, nil
+}
+
+// allow reports whether the given IP address may send webhook requests to the
+// given link ID. Unparsable addresses are allowed only if the link has no ranges.
+func (a linkAllowlist) allow(linkID string, ip net.IP) bool {
+	ranges := a[linkID]
+	if len(ranges) == 0 {
+		return true
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, p := range ranges {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedProxies are the CIDR ranges of the reverse proxies and load balancers in
+// front of the server, whose "X-Forwarded-For" and "X-Real-IP" headers identify
+// webhook clients. Headers from any other source are ignored (see [remoteAddr]).
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies converts the value of the "trusted-proxies" flag into [trustedProxies].
+func parseTrustedProxies(ranges []string) (trustedProxies, error) {
+	ps := make(trustedProxies, 0, len(ranges))
+	for _, r := range ranges {
+		p, err := netip.ParsePrefix(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy CIDR range: %w", err)
+		}
+		ps = append(ps, p.Masked())
+	}
+	return ps, nil
+}
+
+// contains reports whether the given IP address belongs to a trusted proxy.
+// Unparsable addresses are never trusted.
+func (ps trustedProxies) contains(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, p := range ps {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStringMap parses the string representation of a map flag's
+// value, e.g. from etcd: comma-separated "key=value" pairs.
+func parseStringMap(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for kv := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid map entry %q: must be \"key=value\"", kv)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m, nil
+}
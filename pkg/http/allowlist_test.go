@@ -0,0 +1,196 @@
+package http
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "single_range",
+			m:    map[string]string{"link": "192.30.252.0/22"},
+			want: 1,
+		},
+		{
+			name: "multiple_ranges",
+			m:    map[string]string{"link": " 192.30.252.0/22  2a0a:a440::/29 "},
+			want: 2,
+		},
+		{
+			name:    "missing_link_id",
+			m:       map[string]string{"": "192.30.252.0/22"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_range",
+			m:       map[string]string{"link": "192.30.252.0"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAllowlist(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAllowlist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n := len(got["link"]); n != tt.want {
+				t.Errorf("parseAllowlist() ranges = %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkAllowlistAllow(t *testing.T) {
+	a, err := parseAllowlist(map[string]string{"link": "192.30.252.0/22 2a0a:a440::/29"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		linkID string
+		ip     net.IP
+		want   bool
+	}{
+		{
+			name:   "allowed_ipv4",
+			linkID: "link",
+			ip:     net.ParseIP("192.30.253.1"),
+			want:   true,
+		},
+		{
+			name:   "allowed_ipv4_16_byte_form",
+			linkID: "link",
+			ip:     net.ParseIP("192.30.252.1").To16(),
+			want:   true,
+		},
+		{
+			name:   "allowed_ipv6",
+			linkID: "link",
+			ip:     net.ParseIP("2a0a:a440::1"),
+			want:   true,
+		},
+		{
+			name:   "denied",
+			linkID: "link",
+			ip:     net.ParseIP("203.0.113.7"),
+		},
+		{
+			name:   "invalid_ip",
+			linkID: "link",
+		},
+		{
+			name:   "other_link_allows_all",
+			linkID: "other",
+			ip:     net.ParseIP("203.0.113.7"),
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.allow(tt.linkID, tt.ip); got != tt.want {
+				t.Errorf("allow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  []string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "multiple_ranges",
+			ranges: []string{"10.0.0.0/8", " fd00::/8 "},
+			want:   2,
+		},
+		{
+			name:    "invalid_range",
+			ranges:  []string{"10.0.0.1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTrustedProxies(tt.ranges)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseTrustedProxies() ranges = %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesContains(t *testing.T) {
+	ps, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ps.contains(net.ParseIP("10.1.2.3").To16()) {
+		t.Error("contains(10.1.2.3) = false, want true")
+	}
+	if ps.contains(net.ParseIP("192.0.2.1")) {
+		t.Error("contains(192.0.2.1) = true, want false")
+	}
+	if ps.contains(nil) {
+		t.Error("contains(nil) = true, want false")
+	}
+}
+
+func TestParseStringMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: map[string]string{},
+		},
+		{
+			name: "multiple_entries",
+			s:    "a=1.2.3.0/24 5.6.7.0/24, b=8.8.8.8/32",
+			want: map[string]string{"a": "1.2.3.0/24 5.6.7.0/24", "b": "8.8.8.8/32"},
+		},
+		{
+			name:    "invalid_entry",
+			s:       "a",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStringMap(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStringMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStringMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// applyConfig applies changes in hot-reloadable settings, which were
+// made in etcd while the server is running (see [etcd.WatchConfig]).
+// Changes in other settings take effect only after a restart.
+//
+// [etcd.WatchConfig]: https://pkg.go.dev/github.com/tzrikka/omdient/pkg/etcd#WatchConfig
+func (s *httpServer) applyConfig(_ context.Context, name, value string) {
+	l := log.With().Str("setting", name).Str("value", value).Logger()
+
+	var err error
+	switch name {
+	case "webhook-rate-limit":
+		var v float64
+		if v, err = strconv.ParseFloat(value, 64); err == nil {
+			if err = validateRateLimit(v); err == nil {
+				s.setRateLimit(v, -1)
+			}
+		}
+
+	case "webhook-rate-burst":
+		var v int
+		if v, err = strconv.Atoi(value); err == nil {
+			if err = validateRateBurst(v); err == nil {
+				s.setRateLimit(-1, v)
+			}
+		}
+
+	case "log-level":
+		err = setLogLevel(value, s.devMode)
+
+	case "webhook-allowed-cidrs":
+		var m map[string]string
+		if m, err = parseStringMap(value); err == nil {
+			var a linkAllowlist
+			if a, err = parseAllowlist(m); err == nil {
+				s.allowlist.Store(&a)
+			}
+		}
+
+	default:
+		l.Warn().Msg("setting changed in etcd, but it takes effect only after a restart")
+		return
+	}
+
+	if err != nil {
+		l.Warn().Err(err).Msg("ignoring invalid setting change in etcd")
+		return
+	}
+
+	l.Info().Msg("applied setting change from etcd")
+}
+
+// setRateLimit replaces the per-link webhook rate limiter. Negative values
+// keep the current settings. This also resets the state of all links.
+func (s *httpServer) setRateLimit(perSecond float64, burst int) {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+
+	if perSecond >= 0 {
+		s.rateLimit = perSecond
+	}
+	if burst >= 0 {
+		s.rateBurst = burst
+	}
+
+	s.limiter.Store(newLinkRateLimiter(s.rateLimit, s.rateBurst))
+}
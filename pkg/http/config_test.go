@@ -0,0 +1,121 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		setting   string
+		value     string
+		wantLimit rate.Limit
+		wantBurst int
+		wantNil   bool
+	}{
+		{
+			name:      "rate_limit",
+			setting:   "webhook-rate-limit",
+			value:     "2.5",
+			wantLimit: 2.5,
+			wantBurst: 20,
+		},
+		{
+			name:    "disable_rate_limit",
+			setting: "webhook-rate-limit",
+			value:   "0",
+			wantNil: true,
+		},
+		{
+			name:      "rate_burst",
+			setting:   "webhook-rate-burst",
+			value:     "5",
+			wantLimit: 10,
+			wantBurst: 5,
+		},
+		{
+			name:      "invalid_value",
+			setting:   "webhook-rate-limit",
+			value:     "fast",
+			wantLimit: 10,
+			wantBurst: 20,
+		},
+		{
+			name:      "failed_validation",
+			setting:   "webhook-rate-burst",
+			value:     "0",
+			wantLimit: 10,
+			wantBurst: 20,
+		},
+		{
+			name:      "not_hot_reloadable",
+			setting:   "webhook-port",
+			value:     "8080",
+			wantLimit: 10,
+			wantBurst: 20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &httpServer{rateLimit: DefaultWebhookRateLimit, rateBurst: DefaultWebhookRateBurst}
+			s.limiter.Store(newLinkRateLimiter(s.rateLimit, s.rateBurst))
+
+			s.applyConfig(t.Context(), tt.setting, tt.value)
+
+			l := s.limiter.Load()
+			if tt.wantNil {
+				if l != nil {
+					t.Errorf("rate limiter = %+v, want nil", l)
+				}
+				return
+			}
+			if l == nil {
+				t.Fatal("rate limiter = nil")
+			}
+			if l.limit != tt.wantLimit || l.burst != tt.wantBurst {
+				t.Errorf("rate limiter = (%v, %d), want (%v, %d)", l.limit, l.burst, tt.wantLimit, tt.wantBurst)
+			}
+		})
+	}
+}
+
+func TestApplyConfigAllowlist(t *testing.T) {
+	s := &httpServer{}
+
+	s.applyConfig(t.Context(), "webhook-allowed-cidrs", "link=192.30.252.0/22")
+	a := s.allowlist.Load()
+	if a == nil || len((*a)["link"]) != 1 {
+		t.Fatalf("allowlist = %v, want 1 range for link", a)
+	}
+
+	s.applyConfig(t.Context(), "webhook-allowed-cidrs", "link=invalid")
+	if got := s.allowlist.Load(); got != a {
+		t.Errorf("allowlist changed after invalid setting: %v", got)
+	}
+}
+
+func TestApplyConfigLogLevel(t *testing.T) {
+	orig := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(orig) })
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	s := &httpServer{}
+
+	s.applyConfig(t.Context(), "log-level", "warn")
+	if got := zerolog.GlobalLevel(); got != zerolog.WarnLevel {
+		t.Fatalf("log level = %v, want %v", got, zerolog.WarnLevel)
+	}
+
+	s.applyConfig(t.Context(), "log-level", "loud")
+	if got := zerolog.GlobalLevel(); got != zerolog.WarnLevel {
+		t.Errorf("log level changed after invalid setting: %v", got)
+	}
+
+	s.applyConfig(t.Context(), "log-level", "")
+	if got := zerolog.GlobalLevel(); got != zerolog.DebugLevel {
+		t.Errorf("log level = %v, want default %v", got, zerolog.DebugLevel)
+	}
+}
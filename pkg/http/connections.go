@@ -0,0 +1,441 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	intlinks "github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/internal/metrics"
+	"github.com/tzrikka/omdient/internal/thrippy"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/etcd"
+	"github.com/tzrikka/omdient/pkg/links"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+	"github.com/tzrikka/omdient/pkg/websocket"
+)
+
+// errNotStoppable is returned by [httpServer.stopConnection] for connections
+// whose link-specific handlers don't support stopping (see [receivers.RegisterStop]).
+var errNotStoppable = errors.New("stopping connections of this link template is not supported")
+
+// minReapInterval limits the rate of Thrippy lookups in [httpServer.reapConnections].
+const minReapInterval = 10 * time.Second
+
+// connectionStore persists active stateful connections, so they can be
+// re-established after server restarts (see [etcd.ConnectionStore]).
+//
+// [etcd.ConnectionStore]: https://pkg.go.dev/github.com/tzrikka/omdient/pkg/etcd#ConnectionStore
+type connectionStore interface {
+	Put(ctx context.Context, linkID, template string) error
+	Delete(ctx context.Context, linkID string) error
+	List(ctx context.Context) (map[string]string, int64, error)
+}
+
+// connectionLeaser distributes stateful connections across multiple
+// replicas of the server, so only one of them runs each connection
+// (see [etcd.ConnectionLeaser]).
+//
+// [etcd.ConnectionLeaser]: https://pkg.go.dev/github.com/tzrikka/omdient/pkg/etcd#ConnectionLeaser
+type connectionLeaser interface {
+	Claim(ctx context.Context, linkID string) (bool, error)
+	Release(ctx context.Context, linkID string) error
+}
+
+// connection is the in-memory record of an active stateful connection.
+type connection struct {
+	intlinks.LinkData
+
+	since      time.Time
+	reconnects atomic.Int64
+
+	stopMu sync.Mutex
+	stops  []receivers.StopFunc
+}
+
+// observe is a [websocket.LifecycleFunc] which counts reconnections.
+func (c *connection) observe(e websocket.LifecycleEvent) {
+	if e.Type == websocket.ConnReconnected {
+		c.reconnects.Add(1)
+	}
+}
+
+// addStop is a function for [receivers.ContextWithStopper], which
+// records how to stop the connection that the handler starts.
+func (c *connection) addStop(f receivers.StopFunc) {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+	c.stops = append(c.stops, f)
+}
+
+// stoppable returns false if the connection's link-specific handler
+// doesn't support stopping (see [receivers.RegisterStop]).
+func (c *connection) stoppable() bool {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+	return len(c.stops) > 0
+}
+
+// stop stops the connection.
+func (c *connection) stop() {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+
+	for _, f := range c.stops {
+		f()
+	}
+}
+
+// startConnection calls the link-specific connection handler, and
+// records the connection in memory and (optionally) in persistent storage.
+// If the connection is already active, or owned by another replica, this
+// is a no-op, even when called concurrently for the same connection.
+func (s *httpServer) startConnection(ctx context.Context, d intlinks.LinkData) int {
+	l := zerolog.Ctx(ctx)
+	f, ok := links.ConnectionHandlers[d.Template]
+	if !ok {
+		l.Warn().Msg("bad request: unsupported link template for connections")
+		return http.StatusNotImplemented
+	}
+
+	// Only the request that records the connection may start it.
+	c := &connection{LinkData: d, since: time.Now()}
+	if _, loaded := s.connections.LoadOrStore(d.ID, c); loaded {
+		l.Debug().Msg("connection is already active")
+		return http.StatusOK
+	}
+
+	if s.leaser != nil {
+		owned, err := s.leaser.Claim(ctx, d.ID)
+		if err != nil {
+			s.connections.Delete(d.ID)
+			l.Err(err).Msg("failed to claim connection ownership")
+			return http.StatusInternalServerError
+		}
+		if !owned {
+			s.connections.Delete(d.ID)
+			l.Debug().Msg("connection is owned by another replica")
+			return http.StatusOK
+		}
+	}
+
+	ctx = websocket.ContextWithLifecycle(dispatch.WithQueue(ctx, s.queue), c.observe)
+	ctx = receivers.ContextWithStopper(ctx, c.addStop)
+	statusCode := f(ctx, d)
+	if statusCode != http.StatusOK {
+		s.connections.Delete(d.ID)
+		return statusCode
+	}
+	metrics.ActiveConnections.Inc()
+
+	if s.store != nil {
+		if err := s.store.Put(ctx, d.ID, d.Template); err != nil {
+			l.Err(err).Msg("failed to persist connection")
+		}
+	}
+
+	return statusCode
+}
+
+// restoreConnections re-establishes all the persisted connections, when the
+// server starts. Links which no longer exist in Thrippy are forgotten.
+// Errors are logged, but they don't prevent the server from starting.
+//
+// It returns the store's revision of the restored connections, to watch
+// subsequent changes from (see [etcd.WatchConnections]), or 0 if unknown.
+func (s *httpServer) restoreConnections(ctx context.Context) int64 {
+	if s.store == nil {
+		return 0
+	}
+
+	conns, rev, err := s.store.List(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to list persisted connections")
+		return 0
+	}
+
+	results := thrippy.BatchLinkData(ctx, s.thrippyCfg, slices.Collect(maps.Keys(conns)))
+	for id, template := range conns {
+		l := log.With().Str("link_id", id).Str("template", template).Logger()
+		ctx := l.WithContext(ctx)
+
+		r := results[id]
+		if statusCode := checkLinkData(l, r.Template, r.Secrets, r.Err); statusCode != http.StatusOK {
+			if statusCode == http.StatusNotFound {
+				_ = s.store.Delete(ctx, id)
+			}
+			continue
+		}
+
+		d := intlinks.LinkData{ID: id, Template: r.Template, Secrets: r.Secrets}
+		if statusCode := s.startConnection(ctx, d); statusCode != http.StatusOK {
+			l.Warn().Int("status_code", statusCode).Msg("failed to restore persisted connection")
+			continue
+		}
+
+		l.Info().Msg("restored persisted connection")
+	}
+
+	return rev
+}
+
+// handleConnectionEvent starts or forgets connections that were added to or
+// removed from persistent storage dynamically, by other processes or operators.
+// Events about connections that this process already knows are ignored,
+// because they originate from its own calls to [connectionStore.Put].
+func (s *httpServer) handleConnectionEvent(ctx context.Context, e etcd.ConnectionEvent) {
+	l := log.With().Str("link_id", e.LinkID).Logger()
+	ctx = l.WithContext(ctx)
+
+	if e.Deleted {
+		stopped, err := s.stopConnection(ctx, e.LinkID)
+		if err != nil {
+			l.Warn().Err(err).Msg("failed to stop deleted persisted connection")
+		} else if stopped {
+			l.Info().Msg("stopped deleted persisted connection")
+		}
+		return
+	}
+
+	if _, ok := s.connections.Load(e.LinkID); ok {
+		return
+	}
+
+	l = l.With().Str("template", e.Template).Logger()
+	template, secrets, err := s.thrippyLinks.LinkData(ctx, e.LinkID)
+	if statusCode := checkLinkData(l, template, secrets, err); statusCode != http.StatusOK {
+		return
+	}
+
+	d := intlinks.LinkData{ID: e.LinkID, Template: template, Secrets: secrets}
+	if statusCode := s.startConnection(ctx, d); statusCode != http.StatusOK {
+		l.Warn().Int("status_code", statusCode).Msg("failed to start persisted connection")
+		return
+	}
+
+	l.Info().Msg("started persisted connection")
+}
+
+// handleConnectionReleased tries to take over a persisted connection whose
+// ownership was released by another replica, e.g. because it failed or shut down.
+func (s *httpServer) handleConnectionReleased(ctx context.Context, linkID string) {
+	conns, _, err := s.store.List(ctx)
+	if err != nil {
+		log.Err(err).Str("link_id", linkID).Msg("failed to list persisted connections")
+		return
+	}
+
+	template, ok := conns[linkID]
+	if !ok {
+		return // Disconnected, not just released.
+	}
+
+	s.handleConnectionEvent(ctx, etcd.ConnectionEvent{LinkID: linkID, Template: template})
+}
+
+// stopConnection stops and forgets an active connection, and gives up its
+// ownership, but doesn't delete it from persistent storage. It returns false
+// if the connection isn't active in this replica, or [errNotStoppable] if it
+// can't be stopped, in which case it keeps running and remains recorded.
+func (s *httpServer) stopConnection(ctx context.Context, linkID string) (bool, error) {
+	v, ok := s.connections.Load(linkID)
+	if !ok {
+		return false, nil
+	}
+
+	c := v.(*connection)
+	if !c.stoppable() {
+		return false, errNotStoppable
+	}
+	if !s.connections.CompareAndDelete(linkID, c) {
+		return false, nil // Stopped concurrently.
+	}
+
+	s.releaseConnection(ctx, linkID)
+	metrics.ActiveConnections.Dec()
+	c.stop()
+	return true, nil
+}
+
+// removeConnection stops and forgets an active connection, and deletes it from
+// persistent storage, so other replicas stop it too if it's active in them (see
+// [httpServer.handleConnectionEvent]). It returns an HTTP status code.
+//
+// Connections which can't be stopped (see [errNotStoppable]) are still deleted
+// from persistent storage, if they're recorded there, so they aren't restored
+// later. Otherwise, there's nothing to remove, and the request isn't supported.
+func (s *httpServer) removeConnection(ctx context.Context, linkID string) int {
+	l := zerolog.Ctx(ctx)
+	if _, err := s.stopConnection(ctx, linkID); err != nil {
+		if !s.persisted(ctx, linkID) {
+			l.Warn().Err(err).Msg("failed to stop connection")
+			return http.StatusNotImplemented
+		}
+		l.Warn().Err(err).Msg("failed to stop connection, deleting it from persistent storage anyway")
+	}
+
+	if s.store != nil {
+		if err := s.store.Delete(ctx, linkID); err != nil {
+			l.Err(err).Msg("failed to delete persisted connection")
+		}
+	}
+
+	return http.StatusOK
+}
+
+// persisted reports whether a connection is recorded in persistent storage.
+func (s *httpServer) persisted(ctx context.Context, linkID string) bool {
+	if s.store == nil {
+		return false
+	}
+
+	conns, _, err := s.store.List(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("failed to list persisted connections")
+		return false
+	}
+
+	_, ok := conns[linkID]
+	return ok
+}
+
+// connectionManager exposes the connection management of an [httpServer]
+// to webhook handlers (see [intlinks.ContextWithConnectionManager]).
+type connectionManager struct {
+	s *httpServer
+}
+
+// Connect starts the connection of the given link, if its template supports connections.
+func (m connectionManager) Connect(ctx context.Context, linkID string) int {
+	l := zerolog.Ctx(ctx)
+	template, secrets, err := m.s.thrippyLinks.LinkData(ctx, linkID)
+	if statusCode := checkLinkData(*l, template, secrets, err); statusCode != http.StatusOK {
+		return statusCode
+	}
+
+	if _, ok := links.ConnectionHandlers[template]; !ok {
+		return http.StatusNotImplemented
+	}
+
+	d := intlinks.LinkData{ID: linkID, Template: template, Secrets: secrets}
+	return m.s.startConnection(ctx, d)
+}
+
+// Disconnect stops and forgets the connection of the given link (see [httpServer.removeConnection]).
+func (m connectionManager) Disconnect(ctx context.Context, linkID string) int {
+	return m.s.removeConnection(ctx, linkID)
+}
+
+// reapConnections runs as a goroutine until the given context is canceled,
+// to call [httpServer.reapDeletedLinks] periodically, based on the configured
+// interval. Links may be deleted from Thrippy without notifying Omdient, and their
+// connections would otherwise keep running (and holding resources) forever.
+func (s *httpServer) reapConnections(ctx context.Context) {
+	t := time.NewTicker(s.reapInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.reapDeletedLinks(ctx)
+		}
+	}
+}
+
+// reapDeletedLinks stops and forgets all the active connections whose links no
+// longer exist in Thrippy, and returns their number. Connections are not reaped
+// if Thrippy lookups fail, e.g. when the Thrippy server is temporarily unreachable.
+func (s *httpServer) reapDeletedLinks(ctx context.Context) int {
+	var ids []string
+	s.connections.Range(func(k, _ any) bool {
+		ids = append(ids, k.(string))
+		return true
+	})
+
+	reaped := 0
+	for _, id := range ids {
+		l := log.With().Str("link_id", id).Logger()
+		ctx := l.WithContext(ctx)
+
+		template, err := thrippy.LinkTemplate(ctx, s.thrippyCfg, id)
+		if err != nil || template != "" {
+			continue
+		}
+
+		stopped, err := s.stopConnection(ctx, id)
+		if err != nil {
+			l.Warn().Err(err).Msg("can't reap connection of deleted Thrippy link")
+			continue
+		}
+		if !stopped {
+			continue // Stopped concurrently.
+		}
+		if s.store != nil {
+			if err := s.store.Delete(ctx, id); err != nil {
+				l.Err(err).Msg("failed to delete persisted connection")
+			}
+		}
+
+		l.Info().Msg("reaped connection of deleted Thrippy link")
+		reaped++
+	}
+
+	return reaped
+}
+
+// reclaimConnections re-claims the ownership of this replica's active connections,
+// after its etcd lease was lost and re-granted (see [etcd.ConnectionLeaser.Start]).
+// Connections which other replicas claimed in the meantime are stopped, to prevent
+// duplicate event delivery. Connections which can't be re-claimed due to errors
+// keep running, because other replicas can't claim them either.
+//
+// [etcd.ConnectionLeaser.Start]: https://pkg.go.dev/github.com/tzrikka/omdient/pkg/etcd#ConnectionLeaser.Start
+func (s *httpServer) reclaimConnections(ctx context.Context) {
+	if s.leaser == nil {
+		return
+	}
+
+	s.connections.Range(func(k, _ any) bool {
+		id := k.(string)
+		l := log.With().Str("link_id", id).Logger()
+
+		owned, err := s.leaser.Claim(ctx, id)
+		if err != nil {
+			l.Err(err).Msg("failed to re-claim connection ownership")
+			return true
+		}
+		if owned {
+			return true
+		}
+
+		stopped, err := s.stopConnection(l.WithContext(ctx), id)
+		if err != nil {
+			l.Warn().Err(err).Msg("failed to stop connection which another replica claimed")
+		} else if stopped {
+			l.Warn().Msg("stopped connection which another replica claimed")
+		}
+		return true
+	})
+}
+
+// releaseConnection gives up the ownership of a connection, if this replica
+// owns it, so other replicas don't assume that it's still running.
+func (s *httpServer) releaseConnection(ctx context.Context, linkID string) {
+	if s.leaser == nil {
+		return
+	}
+
+	if err := s.leaser.Release(ctx, linkID); err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("failed to release connection ownership")
+	}
+}
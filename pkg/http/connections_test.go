@@ -0,0 +1,630 @@
+package http
+
+import (
+	"context"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lithammer/shortuuid/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	intlinks "github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/internal/thrippy"
+	"github.com/tzrikka/omdient/pkg/etcd"
+	"github.com/tzrikka/omdient/pkg/links"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+)
+
+const testTemplate = "test-template"
+
+// fakeStore is an in-memory implementation of [connectionStore].
+type fakeStore struct {
+	mu    sync.Mutex
+	conns map[string]string
+}
+
+func (f *fakeStore) Put(_ context.Context, linkID, template string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conns[linkID] = template
+	return nil
+}
+
+func (f *fakeStore) Delete(_ context.Context, linkID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, linkID)
+	return nil
+}
+
+func (f *fakeStore) List(_ context.Context) (map[string]string, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return maps.Clone(f.conns), 0, nil
+}
+
+// mockThrippy is a Thrippy gRPC server which knows only the given link IDs.
+type mockThrippy struct {
+	thrippypb.UnimplementedThrippyServiceServer
+
+	links       map[string]bool
+	deleted     sync.Map     // Link IDs which were deleted after the server started.
+	unavailable atomic.Int32 // Number of initial GetLink calls which fail.
+	requestIDs  sync.Map     // Link ID --> last request ID in GetLink metadata.
+	lookups     atomic.Int32 // Number of GetLink calls.
+}
+
+func (m *mockThrippy) GetLink(ctx context.Context, r *thrippypb.GetLinkRequest) (*thrippypb.GetLinkResponse, error) {
+	m.lookups.Add(1)
+	if ids := metadata.ValueFromIncomingContext(ctx, requestIDMetadata); len(ids) > 0 {
+		m.requestIDs.Store(r.GetLinkId(), ids[0])
+	}
+	if m.unavailable.Add(-1) >= 0 {
+		return nil, status.Error(codes.Unavailable, "warming up")
+	}
+	if _, deleted := m.deleted.Load(r.GetLinkId()); deleted || !m.links[r.GetLinkId()] {
+		return nil, status.Error(codes.NotFound, "link not found")
+	}
+	return thrippypb.GetLinkResponse_builder{Template: proto.String(testTemplate)}.Build(), nil
+}
+
+func (m *mockThrippy) GetCredentials(_ context.Context, _ *thrippypb.GetCredentialsRequest) (*thrippypb.GetCredentialsResponse, error) {
+	return thrippypb.GetCredentialsResponse_builder{Credentials: map[string]string{"token": "secret", "signing_secret": "secret"}}.Build(), nil
+}
+
+// newTestServerWithStore returns an [httpServer] with a fake [connectionStore], which
+// uses a mock Thrippy gRPC server, and a fake connection handler for [testTemplate].
+func newTestServerWithStore(t *testing.T, thrippyLinks []string, stored map[string]string) (*httpServer, *fakeStore, *sync.Map) {
+	t.Helper()
+
+	m := &mockThrippy{links: map[string]bool{}}
+	for _, id := range thrippyLinks {
+		m.links[id] = true
+	}
+	return newTestServerWithMock(t, m, stored)
+}
+
+// newTestServerWithMock is like [newTestServerWithStore], with a given mock Thrippy server.
+func newTestServerWithMock(t *testing.T, m *mockThrippy, stored map[string]string) (*httpServer, *fakeStore, *sync.Map) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	thrippypb.RegisterThrippyServiceServer(gs, m)
+	go func() {
+		_ = gs.Serve(lis)
+	}()
+	t.Cleanup(gs.Stop)
+
+	handled := &sync.Map{}
+	links.ConnectionHandlers[testTemplate] = func(ctx context.Context, d intlinks.LinkData) int {
+		handled.Store(d.ID, d)
+		receivers.RegisterStop(ctx, func() {})
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.ConnectionHandlers, testTemplate) })
+
+	cfg := thrippy.Config{Addr: lis.Addr().String(), Creds: insecure.NewCredentials()}
+	store := &fakeStore{conns: stored}
+	s := &httpServer{thrippyCfg: cfg, thrippyLinks: thrippy.NewLinkCache(cfg, 0), store: store}
+	s.jsonTypes = DefaultJSONContentTypes
+
+	return s, store, handled
+}
+
+func TestRestoreConnections(t *testing.T) {
+	id1, id2 := shortuuid.New(), shortuuid.New()
+	stored := map[string]string{id1: testTemplate, id2: testTemplate}
+	s, store, handled := newTestServerWithStore(t, []string{id1}, stored)
+
+	s.restoreConnections(t.Context())
+
+	v, ok := handled.Load(id1)
+	if !ok {
+		t.Fatal("existing link's connection wasn't restored")
+	}
+	if d := v.(intlinks.LinkData); d.Secrets["token"] != "secret" {
+		t.Errorf("restored connection secrets = %v, want re-fetched from Thrippy", d.Secrets)
+	}
+	if _, ok := s.connections.Load(id1); !ok {
+		t.Error("restored connection isn't tracked in memory")
+	}
+
+	if _, ok := handled.Load(id2); ok {
+		t.Error("deleted link's connection was restored")
+	}
+	if got, _, _ := store.List(t.Context()); len(got) != 1 || got[id1] != testTemplate {
+		t.Errorf("persisted connections after restore = %v, want only %q", got, id1)
+	}
+}
+
+func TestConnectAndDisconnectPersistence(t *testing.T) {
+	id := shortuuid.New()
+	s, store, _ := newTestServerWithStore(t, []string{id}, map[string]string{})
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connect/"+id, http.NoBody)
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("connect response status code: got %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, _, _ := store.List(t.Context()); got[id] != testTemplate {
+		t.Errorf("persisted connections after connect = %v, want %q", got, id)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/disconnect/"+id, http.NoBody)
+	mux.ServeHTTP(w, r)
+	if got, _, _ := store.List(t.Context()); len(got) != 0 {
+		t.Errorf("persisted connections after disconnect = %v, want none", got)
+	}
+}
+
+func TestConnectionManager(t *testing.T) {
+	id := shortuuid.New()
+	s, store, handled := newTestServerWithStore(t, []string{id}, map[string]string{})
+	m := intlinks.ConnectionManagerFromContext(intlinks.ContextWithConnectionManager(t.Context(), connectionManager{s}))
+
+	if statusCode := m.Connect(t.Context(), id); statusCode != http.StatusOK {
+		t.Fatalf("Connect() = %d, want %d", statusCode, http.StatusOK)
+	}
+	if _, ok := handled.Load(id); !ok {
+		t.Error("connection handler wasn't called")
+	}
+	if got, _, _ := store.List(t.Context()); got[id] != testTemplate {
+		t.Errorf("persisted connections after Connect() = %v, want %q", got, id)
+	}
+
+	if statusCode := m.Disconnect(t.Context(), id); statusCode != http.StatusOK {
+		t.Fatalf("Disconnect() = %d, want %d", statusCode, http.StatusOK)
+	}
+	if _, ok := s.connections.Load(id); ok {
+		t.Error("stopped connection is still tracked in memory")
+	}
+	if got, _, _ := store.List(t.Context()); len(got) != 0 {
+		t.Errorf("persisted connections after Disconnect() = %v, want none", got)
+	}
+
+	delete(links.ConnectionHandlers, testTemplate)
+	if statusCode := m.Connect(t.Context(), id); statusCode != http.StatusNotImplemented {
+		t.Errorf("Connect() without connection handler = %d, want %d", statusCode, http.StatusNotImplemented)
+	}
+}
+
+func TestHandleConnectionEvent(t *testing.T) {
+	id1, id2 := shortuuid.New(), shortuuid.New()
+	s, _, handled := newTestServerWithStore(t, []string{id1}, map[string]string{})
+	ctx := t.Context()
+
+	s.handleConnectionEvent(ctx, etcd.ConnectionEvent{LinkID: id1, Template: testTemplate})
+	if _, ok := handled.Load(id1); !ok {
+		t.Fatal("added connection wasn't started")
+	}
+	if _, ok := s.connections.Load(id1); !ok {
+		t.Error("added connection isn't tracked in memory")
+	}
+
+	// Repeated PUT events (e.g. due to our own store writes) are no-ops.
+	handled.Delete(id1)
+	s.handleConnectionEvent(ctx, etcd.ConnectionEvent{LinkID: id1, Template: testTemplate})
+	if _, ok := handled.Load(id1); ok {
+		t.Error("known connection was started again")
+	}
+
+	s.handleConnectionEvent(ctx, etcd.ConnectionEvent{LinkID: id2, Template: testTemplate})
+	if _, ok := handled.Load(id2); ok {
+		t.Error("unknown link's connection was started")
+	}
+
+	s.handleConnectionEvent(ctx, etcd.ConnectionEvent{LinkID: id1, Deleted: true})
+	if _, ok := s.connections.Load(id1); ok {
+		t.Error("deleted connection is still tracked in memory")
+	}
+}
+
+// fakeLeaser is an implementation of [connectionLeaser],
+// where other replicas own all the connections except the ones in it.
+type fakeLeaser struct {
+	mu    sync.Mutex
+	owned map[string]bool
+}
+
+func (f *fakeLeaser) Claim(_ context.Context, linkID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.owned[linkID], nil
+}
+
+func (f *fakeLeaser) Release(_ context.Context, linkID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.owned, linkID)
+	return nil
+}
+
+func TestStartConnectionOwnedByOtherReplica(t *testing.T) {
+	id1, id2 := shortuuid.New(), shortuuid.New()
+	s, store, handled := newTestServerWithStore(t, []string{id1, id2}, map[string]string{})
+	s.leaser = &fakeLeaser{owned: map[string]bool{id1: true}}
+
+	for _, id := range []string{id1, id2} {
+		d := intlinks.LinkData{ID: id, Template: testTemplate}
+		if got := s.startConnection(t.Context(), d); got != http.StatusOK {
+			t.Errorf("startConnection(%q) = %d, want %d", id, got, http.StatusOK)
+		}
+	}
+
+	if _, ok := handled.Load(id1); !ok {
+		t.Error("owned connection wasn't started")
+	}
+	if _, ok := handled.Load(id2); ok {
+		t.Error("connection owned by another replica was started")
+	}
+	if got, _, _ := store.List(t.Context()); len(got) != 1 || got[id1] != testTemplate {
+		t.Errorf("persisted connections = %v, want only %q", got, id1)
+	}
+}
+
+func TestHandleConnectionReleased(t *testing.T) {
+	id1, id2 := shortuuid.New(), shortuuid.New()
+	s, _, handled := newTestServerWithStore(t, []string{id1, id2}, map[string]string{id1: testTemplate})
+	s.leaser = &fakeLeaser{owned: map[string]bool{id1: true, id2: true}}
+
+	s.handleConnectionReleased(t.Context(), id1)
+	if _, ok := handled.Load(id1); !ok {
+		t.Error("released connection wasn't taken over")
+	}
+
+	s.handleConnectionReleased(t.Context(), id2)
+	if _, ok := handled.Load(id2); ok {
+		t.Error("disconnected (not persisted) connection was taken over")
+	}
+}
+
+func TestReclaimConnections(t *testing.T) {
+	id1, id2 := shortuuid.New(), shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id1, id2}, map[string]string{})
+	leaser := &fakeLeaser{owned: map[string]bool{id1: true, id2: true}}
+	s.leaser = leaser
+
+	for _, id := range []string{id1, id2} {
+		d := intlinks.LinkData{ID: id, Template: testTemplate}
+		if got := s.startConnection(t.Context(), d); got != http.StatusOK {
+			t.Fatalf("startConnection(%q) = %d, want %d", id, got, http.StatusOK)
+		}
+	}
+
+	// Another replica claims one of the connections while the lease is lost.
+	leaser.mu.Lock()
+	delete(leaser.owned, id2)
+	leaser.mu.Unlock()
+
+	s.reclaimConnections(t.Context())
+	if _, ok := s.connections.Load(id1); !ok {
+		t.Error("re-claimed connection was stopped")
+	}
+	if _, ok := s.connections.Load(id2); ok {
+		t.Error("connection claimed by another replica is still tracked in memory")
+	}
+}
+
+func TestConnectHandlerConcurrentRequests(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, map[string]string{})
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	var clients atomic.Int32
+	links.ConnectionHandlers[testTemplate] = func(_ context.Context, _ intlinks.LinkData) int {
+		clients.Add(1)
+		time.Sleep(10 * time.Millisecond) // Widen the race window.
+		return http.StatusOK
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	codes := make(chan int, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connect/"+id, http.NoBody)
+			mux.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("connect response status code: got %d, want %d", code, http.StatusOK)
+		}
+	}
+	if got := clients.Load(); got != 1 {
+		t.Errorf("connection handler calls = %d, want 1", got)
+	}
+}
+
+func TestStartConnectionFailure(t *testing.T) {
+	id := shortuuid.New()
+	s, store, _ := newTestServerWithStore(t, []string{id}, map[string]string{})
+	links.ConnectionHandlers[testTemplate] = func(_ context.Context, _ intlinks.LinkData) int {
+		return http.StatusForbidden
+	}
+
+	d := intlinks.LinkData{ID: id, Template: testTemplate}
+	if got := s.startConnection(t.Context(), d); got != http.StatusForbidden {
+		t.Errorf("startConnection() = %d, want %d", got, http.StatusForbidden)
+	}
+	if _, ok := s.connections.Load(id); ok {
+		t.Error("failed connection is tracked in memory")
+	}
+	if got, _, _ := store.List(t.Context()); len(got) != 0 {
+		t.Errorf("persisted connections = %v, want none", got)
+	}
+}
+
+func TestConnectHandlerWaitsForThrippy(t *testing.T) {
+	tests := []struct {
+		name           string
+		unavailable    int32
+		down           bool
+		wantCode       int
+		wantRetryAfter string
+	}{
+		{
+			name:     "available",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:        "temporarily_unavailable",
+			unavailable: 2,
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:           "unavailable_beyond_timeout",
+			unavailable:    100,
+			wantCode:       http.StatusServiceUnavailable,
+			wantRetryAfter: "5",
+		},
+		{
+			name:           "permanently_down",
+			down:           true,
+			wantCode:       http.StatusServiceUnavailable,
+			wantRetryAfter: "5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := shortuuid.New()
+			m := &mockThrippy{links: map[string]bool{id: true}}
+			m.unavailable.Store(tt.unavailable)
+			s, _, _ := newTestServerWithMock(t, m, map[string]string{})
+			s.connectReadyTimeout = 500 * time.Millisecond
+
+			if tt.down {
+				lis, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.thrippyCfg.Addr = lis.Addr().String()
+				_ = lis.Close()
+				s.thrippyLinks = thrippy.NewLinkCache(s.thrippyCfg, 0)
+			}
+
+			mux, err := s.routes()
+			if err != nil {
+				t.Fatalf("routes() error = %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connect/"+id, http.NoBody)
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("connect response status code: got %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("connect response Retry-After header: got %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestConnectHandlerReadyTimeoutIncludesRetries(t *testing.T) {
+	id := shortuuid.New()
+	m := &mockThrippy{links: map[string]bool{id: true}}
+	m.unavailable.Store(1000)
+	s, _, _ := newTestServerWithMock(t, m, map[string]string{})
+	s.connectReadyTimeout = 300 * time.Millisecond
+
+	// Each lookup retries for much longer than the readiness timeout.
+	s.thrippyCfg.Retries = 100
+	s.thrippyCfg.Backoff = 100 * time.Millisecond
+	s.thrippyLinks = thrippy.NewLinkCache(s.thrippyCfg, 0)
+
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/connect/"+id, http.NoBody)
+	mux.ServeHTTP(w, r)
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("connect response duration = %s, want up to the readiness timeout", d)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("connect response status code: got %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestReapDeletedLinks(t *testing.T) {
+	id1, id2 := shortuuid.New(), shortuuid.New()
+	m := &mockThrippy{links: map[string]bool{id1: true, id2: true}}
+	s, store, _ := newTestServerWithMock(t, m, map[string]string{})
+	ctx := t.Context()
+
+	stopped := &sync.Map{}
+	links.ConnectionHandlers[testTemplate] = func(ctx context.Context, d intlinks.LinkData) int {
+		receivers.RegisterStop(ctx, func() { stopped.Store(d.ID, true) })
+		return http.StatusOK
+	}
+
+	for _, id := range []string{id1, id2} {
+		d := intlinks.LinkData{ID: id, Template: testTemplate, Secrets: map[string]string{"token": "secret"}}
+		if statusCode := s.startConnection(ctx, d); statusCode != http.StatusOK {
+			t.Fatalf("startConnection(%q) = %d, want %d", id, statusCode, http.StatusOK)
+		}
+	}
+
+	// Nothing to reap while all the links exist.
+	if n := s.reapDeletedLinks(ctx); n != 0 {
+		t.Fatalf("reapDeletedLinks() = %d, want 0", n)
+	}
+
+	// Don't reap anything while Thrippy is unavailable.
+	m.deleted.Store(id1, true)
+	m.unavailable.Store(100)
+	if n := s.reapDeletedLinks(ctx); n != 0 {
+		t.Fatalf("reapDeletedLinks() while Thrippy is unavailable = %d, want 0", n)
+	}
+
+	m.unavailable.Store(0)
+	if n := s.reapDeletedLinks(ctx); n != 1 {
+		t.Fatalf("reapDeletedLinks() = %d, want 1", n)
+	}
+
+	if _, ok := stopped.Load(id1); !ok {
+		t.Error("deleted link's connection wasn't stopped")
+	}
+	if _, ok := s.connections.Load(id1); ok {
+		t.Error("deleted link's connection is still tracked in memory")
+	}
+	if _, ok := stopped.Load(id2); ok {
+		t.Error("existing link's connection was stopped")
+	}
+	if _, ok := s.connections.Load(id2); !ok {
+		t.Error("existing link's connection isn't tracked in memory")
+	}
+	if got, _, _ := store.List(ctx); len(got) != 1 || got[id2] != testTemplate {
+		t.Errorf("persisted connections after reaping = %v, want only %q", got, id2)
+	}
+}
+
+func TestUnstoppableConnection(t *testing.T) {
+	id := shortuuid.New()
+	m := &mockThrippy{links: map[string]bool{id: true}}
+	s, store, _ := newTestServerWithMock(t, m, map[string]string{})
+	links.ConnectionHandlers[testTemplate] = func(context.Context, intlinks.LinkData) int {
+		return http.StatusOK // Without [receivers.RegisterStop].
+	}
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	d := intlinks.LinkData{ID: id, Template: testTemplate, Secrets: map[string]string{"token": "secret"}}
+	if statusCode := s.startConnection(t.Context(), d); statusCode != http.StatusOK {
+		t.Fatalf("startConnection() = %d, want %d", statusCode, http.StatusOK)
+	}
+
+	m.deleted.Store(id, true)
+	if n := s.reapDeletedLinks(t.Context()); n != 0 {
+		t.Errorf("reapDeletedLinks() = %d, want 0", n)
+	}
+	if got, _, _ := store.List(t.Context()); got[id] != testTemplate {
+		t.Errorf("persisted connections after reaping = %v, want %q", got, id)
+	}
+	m.deleted.Delete(id)
+
+	// The persisted connection is deleted from storage, even though it can't be stopped.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/disconnect/"+id, http.NoBody)
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("disconnect response status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, _, _ := store.List(t.Context()); len(got) != 0 {
+		t.Errorf("persisted connections after disconnect = %v, want none", got)
+	}
+
+	// Without a persisted connection, there's nothing left to disconnect.
+	w = httptest.NewRecorder()
+	r = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/disconnect/"+id, http.NoBody)
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("second disconnect response status code = %d, want %d", w.Code, http.StatusNotImplemented)
+	}
+
+	if _, ok := s.connections.Load(id); !ok {
+		t.Error("running connection isn't tracked in memory")
+	}
+}
+
+func TestReapConnections(t *testing.T) {
+	id := shortuuid.New()
+	m := &mockThrippy{links: map[string]bool{id: true}}
+	s, _, _ := newTestServerWithMock(t, m, map[string]string{})
+	s.reapInterval = 10 * time.Millisecond
+
+	stopped := make(chan string, 1)
+	links.ConnectionHandlers[testTemplate] = func(ctx context.Context, d intlinks.LinkData) int {
+		receivers.RegisterStop(ctx, func() { stopped <- d.ID })
+		return http.StatusOK
+	}
+
+	d := intlinks.LinkData{ID: id, Template: testTemplate, Secrets: map[string]string{"token": "secret"}}
+	if statusCode := s.startConnection(t.Context(), d); statusCode != http.StatusOK {
+		t.Fatalf("startConnection() = %d, want %d", statusCode, http.StatusOK)
+	}
+
+	// Wait for the reaper to stop before the test ends, so
+	// it doesn't log concurrently with subsequent tests.
+	ctx, cancel := context.WithCancel(t.Context())
+	reaped := make(chan struct{})
+	go func() {
+		s.reapConnections(ctx)
+		close(reaped)
+	}()
+	defer func() {
+		cancel()
+		<-reaped
+	}()
+
+	m.deleted.Store(id, true)
+	select {
+	case got := <-stopped:
+		if got != id {
+			t.Errorf("reaped connection = %q, want %q", got, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection of deleted link wasn't reaped")
+	}
+}
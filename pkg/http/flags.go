@@ -2,16 +2,42 @@ package http
 
 import (
 	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	altsrc "github.com/urfave/cli-altsrc/v3"
 	"github.com/urfave/cli-altsrc/v3/toml"
 	"github.com/urfave/cli/v3"
+
+	"github.com/tzrikka/omdient/internal/tracing"
+	"github.com/tzrikka/omdient/pkg/websocket"
 )
 
 const (
-	DefaultWebhookPort = 14480
+	DefaultWebhookPort  = 14480
+	DefaultMaxBodyBytes = 10 << 20 // 10 MiB.
+
+	DefaultWebhookRateLimit = 10.0 // Requests per second, per link.
+	DefaultWebhookRateBurst = 20
+
+	DefaultReadTimeout  = 3 * time.Second
+	DefaultWriteTimeout = 3 * time.Second
+	DefaultIdleTimeout  = 3 * time.Second
+
+	DefaultConnectReadyTimeout    = 2 * time.Second // Must be shorter than the write timeout.
+	DefaultConnectionReapInterval = 5 * time.Minute
+
+	DefaultLogFileMaxMegabytes = 100
 )
 
+// DefaultJSONContentTypes are the media types of webhook request bodies
+// which are decoded as JSON, in addition to any "+json" structured syntax.
+var DefaultJSONContentTypes = []string{"application/json", "text/json"}
+
 // Flags defines CLI flags to configure the HTTP server. These flags can also
 // be set using environment variables and the application's configuration file.
 func Flags(configFilePath altsrc.StringSourcer) []cli.Flag {
@@ -26,6 +52,255 @@ func Flags(configFilePath altsrc.StringSourcer) []cli.Flag {
 			),
 			Validator: validatePort,
 		},
+		&cli.IntFlag{
+			Name:  "max-body-bytes",
+			Usage: "maximum size of HTTP webhook request bodies, in bytes",
+			Value: DefaultMaxBodyBytes,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_MAX_BODY_BYTES"),
+				toml.TOML("http_server.max_body_bytes", configFilePath),
+			),
+			Validator: validateMaxBodyBytes,
+		},
+		&cli.StringMapFlag{
+			Name:  "webhook-max-body-bytes",
+			Usage: "per-template maximum size of HTTP webhook request bodies, instead of --max-body-bytes (e.g. \"github=26214400\")",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WEBHOOK_MAX_BODY_BYTES"),
+				toml.TOML("http_server.webhook_max_body_bytes", configFilePath),
+			),
+			Validator: validateTemplateMaxBodyBytes,
+		},
+		&cli.StringSliceFlag{
+			Name:  "json-content-types",
+			Usage: "media types of HTTP webhook request bodies to decode as JSON",
+			Value: DefaultJSONContentTypes,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_JSON_CONTENT_TYPES"),
+				toml.TOML("http_server.json_content_types", configFilePath),
+			),
+			Validator: validateJSONContentTypes,
+		},
+		&cli.FloatFlag{
+			Name:  "webhook-rate-limit",
+			Usage: "maximum rate of HTTP webhook requests per second, per link (0 = unlimited)",
+			Value: DefaultWebhookRateLimit,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WEBHOOK_RATE_LIMIT"),
+				toml.TOML("http_server.webhook_rate_limit", configFilePath),
+			),
+			Validator: validateRateLimit,
+		},
+		&cli.IntFlag{
+			Name:  "webhook-rate-burst",
+			Usage: "maximum burst size of HTTP webhook requests, per link",
+			Value: DefaultWebhookRateBurst,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WEBHOOK_RATE_BURST"),
+				toml.TOML("http_server.webhook_rate_burst", configFilePath),
+			),
+			Validator: validateRateBurst,
+		},
+		&cli.BoolFlag{
+			Name:  "no-content-on-empty-response",
+			Usage: "respond with 204 (No Content) instead of 200 when a webhook handler doesn't write a response",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_NO_CONTENT_ON_EMPTY_RESPONSE"),
+				toml.TOML("http_server.no_content_on_empty_response", configFilePath),
+			),
+		},
+		&cli.StringSliceFlag{
+			Name:  "trusted-proxies",
+			Usage: "CIDR ranges of reverse proxies whose X-Forwarded-For and X-Real-IP headers identify webhook clients",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_TRUSTED_PROXIES"),
+				toml.TOML("http_server.trusted_proxies", configFilePath),
+			),
+			Validator: validateTrustedProxies,
+		},
+		&cli.StringMapFlag{
+			Name:  "webhook-success-status",
+			Usage: "per-template status code of successful webhook responses, instead of 200 (e.g. \"slack=204\")",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WEBHOOK_SUCCESS_STATUS"),
+				toml.TOML("http_server.webhook_success_status", configFilePath),
+			),
+			Validator: validateSuccessStatuses,
+		},
+		&cli.StringMapFlag{
+			Name:  "webhook-response-headers",
+			Usage: "per-link static headers in webhook responses (e.g. \"<link ID>:Cache-Control=no-store\")",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WEBHOOK_RESPONSE_HEADERS"),
+				toml.TOML("http_server.webhook_response_headers", configFilePath),
+			),
+			Validator: validateResponseHeaders,
+		},
+		&cli.StringMapFlag{
+			Name:  "webhook-allowed-cidrs",
+			Usage: "per-link space-separated CIDR ranges of allowed webhook sources (e.g. \"<link ID>=192.30.252.0/22 185.199.108.0/22\")",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WEBHOOK_ALLOWED_CIDRS"),
+				toml.TOML("http_server.webhook_allowed_cidrs", configFilePath),
+			),
+			Validator: validateAllowlist,
+		},
+		&cli.DurationFlag{
+			Name:  "read-timeout",
+			Usage: "maximum duration for reading entire HTTP requests, including their bodies",
+			Value: DefaultReadTimeout,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_READ_TIMEOUT"),
+				toml.TOML("http_server.read_timeout", configFilePath),
+			),
+			Validator: validateTimeout,
+		},
+		&cli.DurationFlag{
+			Name:  "write-timeout",
+			Usage: "maximum duration before timing out writes of HTTP responses",
+			Value: DefaultWriteTimeout,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WRITE_TIMEOUT"),
+				toml.TOML("http_server.write_timeout", configFilePath),
+			),
+			Validator: validateTimeout,
+		},
+		&cli.DurationFlag{
+			Name:  "idle-timeout",
+			Usage: "maximum duration to wait for the next HTTP request when keep-alives are enabled",
+			Value: DefaultIdleTimeout,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_IDLE_TIMEOUT"),
+				toml.TOML("http_server.idle_timeout", configFilePath),
+			),
+			Validator: validateTimeout,
+		},
+		&cli.DurationFlag{
+			Name:  "connect-ready-timeout",
+			Usage: "maximum duration to wait for Thrippy to become available when starting connections, shorter than --write-timeout (0 = don't wait)",
+			Value: DefaultConnectReadyTimeout,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_CONNECT_READY_TIMEOUT"),
+				toml.TOML("http_server.connect_ready_timeout", configFilePath),
+			),
+			Validator: validateReadyTimeout,
+		},
+		&cli.DurationFlag{
+			Name:  "webhook-warmup",
+			Usage: "duration after startup in which webhooks are rejected with 503 and Retry-After, for third-party services to retry them later (0 = none)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_WEBHOOK_WARMUP"),
+				toml.TOML("http_server.webhook_warmup", configFilePath),
+			),
+			Validator: validateReadyTimeout,
+		},
+		&cli.DurationFlag{
+			Name:  "connection-reap-interval",
+			Usage: "how often to stop stateful connections whose Thrippy links were deleted (0 = never)",
+			Value: DefaultConnectionReapInterval,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_CONNECTION_REAP_INTERVAL"),
+				toml.TOML("http_server.connection_reap_interval", configFilePath),
+			),
+			Validator: validateReapInterval,
+		},
+		&cli.IntFlag{
+			Name:  "max-concurrent-reconnects",
+			Usage: "maximum number of WebSocket connections which reconnect simultaneously (0 = unlimited)",
+			Value: websocket.DefaultMaxConcurrentReconnects,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_MAX_CONCURRENT_RECONNECTS"),
+				toml.TOML("http_server.max_concurrent_reconnects", configFilePath),
+			),
+			Validator: validateMaxConcurrentReconnects,
+		},
+		&cli.BoolFlag{
+			Name:  "metrics",
+			Usage: "expose Prometheus metrics in the HTTP server's /metrics endpoint",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_METRICS"),
+				toml.TOML("http_server.metrics", configFilePath),
+			),
+		},
+		&cli.StringFlag{
+			Name:  "log-level",
+			Usage: "minimum level of log messages: trace, debug, info, warn, or error (default: debug, or trace in dev mode)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_LOG_LEVEL"),
+				toml.TOML("logging.level", configFilePath),
+			),
+			Validator: validateLogLevel,
+		},
+		&cli.StringFlag{
+			Name:  "log-output",
+			Usage: "destination of log messages: stderr, stdout, file, or syslog (default: stderr, or stdout in dev mode)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_LOG_OUTPUT"),
+				toml.TOML("logging.output", configFilePath),
+			),
+			Validator: validateLogOutput,
+		},
+		&cli.StringFlag{
+			Name:  "log-file",
+			Usage: "path of the log file, if the log output is a file",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_LOG_FILE"),
+				toml.TOML("logging.file", configFilePath),
+			),
+		},
+		&cli.IntFlag{
+			Name:  "log-file-max-megabytes",
+			Usage: "maximum size of the log file before it gets rotated, in megabytes",
+			Value: DefaultLogFileMaxMegabytes,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_LOG_FILE_MAX_MEGABYTES"),
+				toml.TOML("logging.file_max_megabytes", configFilePath),
+			),
+			Validator: validateLogFileMaxMegabytes,
+		},
+		&cli.IntFlag{
+			Name:  "log-file-max-backups",
+			Usage: "maximum number of rotated log files to retain (0 = unlimited)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_LOG_FILE_MAX_BACKUPS"),
+				toml.TOML("logging.file_max_backups", configFilePath),
+			),
+			Validator: validateNonNegative,
+		},
+		&cli.IntFlag{
+			Name:  "log-file-max-age-days",
+			Usage: "maximum number of days to retain rotated log files (0 = unlimited)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_LOG_FILE_MAX_AGE_DAYS"),
+				toml.TOML("logging.file_max_age_days", configFilePath),
+			),
+			Validator: validateNonNegative,
+		},
+		&cli.StringFlag{
+			Name:  "log-syslog-addr",
+			Usage: "remote syslog address, if the log output is syslog (e.g. \"udp://host:514\", empty = local syslog)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_LOG_SYSLOG_ADDR"),
+				toml.TOML("logging.syslog_addr", configFilePath),
+			),
+		},
+		&cli.StringFlag{
+			Name:  "otel-endpoint",
+			Usage: "OpenTelemetry collector address, to export traces with OTLP over HTTP (empty = disabled)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_OTEL_ENDPOINT"),
+				toml.TOML("http_server.otel_endpoint", configFilePath),
+			),
+			Validator: validateOTelEndpoint,
+		},
+		&cli.StringFlag{
+			Name:  "admin-token",
+			Usage: "static bearer token to authenticate requests to administrative endpoints (empty = disabled)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("OMDIENT_ADMIN_TOKEN"),
+				toml.TOML("http_server.admin_token", configFilePath),
+			),
+		},
 		&cli.StringFlag{
 			Name:  "thrippy-http-addr",
 			Usage: "optional Thrippy address, to pass-through OAuth callbacks, to share a single HTTP tunnel",
@@ -43,3 +318,196 @@ func validatePort(p int) error {
 	}
 	return nil
 }
+
+func validateMaxBodyBytes(n int) error {
+	if n <= 0 {
+		return errors.New("must be positive")
+	}
+	return nil
+}
+
+func validateTemplateMaxBodyBytes(m map[string]string) error {
+	_, err := parseTemplateMaxBodyBytes(m)
+	return err
+}
+
+// parseTemplateMaxBodyBytes converts the value of the "webhook-max-body-bytes"
+// flag into a map of link templates to positive body size limits, in bytes.
+func parseTemplateMaxBodyBytes(m map[string]string) (map[string]int64, error) {
+	limits := make(map[string]int64, len(m))
+	for template, s := range m {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid body size limit for template %q: must be a positive number of bytes", template)
+		}
+		limits[template] = n
+	}
+	return limits, nil
+}
+
+func validateJSONContentTypes(types []string) error {
+	for _, t := range types {
+		mt, params, err := mime.ParseMediaType(t)
+		if err != nil {
+			return fmt.Errorf("invalid media type %q: %w", t, err)
+		}
+		if len(params) > 0 || mt != strings.ToLower(strings.TrimSpace(t)) {
+			return fmt.Errorf("invalid media type %q: parameters are not allowed", t)
+		}
+	}
+	return nil
+}
+
+func validateLogLevel(level string) error {
+	_, err := parseLogLevel(level, false)
+	return err
+}
+
+func validateLogOutput(output string) error {
+	switch output {
+	case "", logOutputStderr, logOutputStdout, logOutputFile, logOutputSyslog:
+		return nil
+	default:
+		return fmt.Errorf("must be one of: %s, %s, %s, %s", logOutputStderr, logOutputStdout, logOutputFile, logOutputSyslog)
+	}
+}
+
+func validateLogFileMaxMegabytes(n int) error {
+	if n < 1 {
+		return errors.New("must be a positive number")
+	}
+	return nil
+}
+
+func validateNonNegative(n int) error {
+	if n < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func validateOTelEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	_, err := tracing.EndpointURL(endpoint)
+	return err
+}
+
+func validateRateLimit(r float64) error {
+	if r < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func validateRateBurst(n int) error {
+	if n <= 0 {
+		return errors.New("must be positive")
+	}
+	return nil
+}
+
+func validateSuccessStatuses(m map[string]string) error {
+	_, err := parseSuccessStatuses(m)
+	return err
+}
+
+// parseSuccessStatuses converts the value of the "webhook-success-status" flag into
+// a map of link templates to status codes. Only 200 and 204 are allowed, because
+// webhook handlers don't write a response body when they return a status code.
+func parseSuccessStatuses(m map[string]string) (map[string]int, error) {
+	statuses := make(map[string]int, len(m))
+	for template, s := range m {
+		switch s {
+		case "200":
+			statuses[template] = http.StatusOK
+		case "204":
+			statuses[template] = http.StatusNoContent
+		default:
+			return nil, fmt.Errorf("invalid status code for template %q: must be 200 or 204", template)
+		}
+	}
+	return statuses, nil
+}
+
+func validateResponseHeaders(m map[string]string) error {
+	_, err := parseResponseHeaders(m)
+	return err
+}
+
+// parseResponseHeaders converts the value of the "webhook-response-headers" flag
+// into a map of link IDs to HTTP headers. Each key is a link ID and a header name,
+// separated by a colon, and each value is the header's value.
+func parseResponseHeaders(m map[string]string) (map[string]http.Header, error) {
+	headers := make(map[string]http.Header, len(m))
+	for k, v := range m {
+		id, name, ok := strings.Cut(k, ":")
+		if !ok || id == "" || name == "" {
+			return nil, fmt.Errorf("invalid key %q: must be \"<link ID>:<header name>\"", k)
+		}
+		if strings.ContainsAny(name, " \t\r\n:") {
+			return nil, fmt.Errorf("invalid header name for link %q: %q", id, name)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("invalid value for header %q of link %q", name, id)
+		}
+
+		if headers[id] == nil {
+			headers[id] = http.Header{}
+		}
+		headers[id].Add(name, v)
+	}
+	return headers, nil
+}
+
+func validateAllowlist(m map[string]string) error {
+	_, err := parseAllowlist(m)
+	return err
+}
+
+func validateTrustedProxies(ranges []string) error {
+	_, err := parseTrustedProxies(ranges)
+	return err
+}
+
+func validateTimeout(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("must be a positive duration")
+	}
+	return nil
+}
+
+func validateReadyTimeout(d time.Duration) error {
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+// validateConnectReadyTimeout checks the relationship between the "connect-ready-timeout"
+// and "write-timeout" flags: the server must still be able to write its response
+// (e.g. a 503 with a "Retry-After" header) after waiting for Thrippy.
+func validateConnectReadyTimeout(ready, write time.Duration) error {
+	if ready >= write {
+		return fmt.Errorf("connect ready timeout (%s) must be shorter than the write timeout (%s)", ready, write)
+	}
+	return nil
+}
+
+func validateReapInterval(d time.Duration) error {
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	if d > 0 && d < minReapInterval {
+		return fmt.Errorf("must be 0 or at least %s", minReapInterval)
+	}
+	return nil
+}
+
+func validateMaxConcurrentReconnects(n int) error {
+	if n < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
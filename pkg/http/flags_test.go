@@ -1,7 +1,12 @@
 package http
 
 import (
+	"net/http"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/tzrikka/omdient/pkg/websocket"
 )
 
 func TestValidatePort(t *testing.T) {
@@ -47,3 +52,447 @@ func TestValidatePort(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateMaxBodyBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		wantErr bool
+	}{
+		{
+			name:    "negative",
+			n:       -1,
+			wantErr: true,
+		},
+		{
+			name:    "zero",
+			n:       0,
+			wantErr: true,
+		},
+		{
+			name: "positive",
+			n:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMaxBodyBytes(tt.n); (err != nil) != tt.wantErr {
+				t.Errorf("validateMaxBodyBytes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateJSONContentTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   []string
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			types: DefaultJSONContentTypes,
+		},
+		{
+			name:  "upper_case",
+			types: []string{"Application/JSON"},
+		},
+		{
+			name:    "with_parameters",
+			types:   []string{"application/json; charset=utf-8"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			types:   []string{"application/json", "not a type"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateJSONContentTypes(tt.types); (err != nil) != tt.wantErr {
+				t.Errorf("validateJSONContentTypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       float64
+		wantErr bool
+	}{
+		{
+			name:    "negative",
+			r:       -1,
+			wantErr: true,
+		},
+		{
+			name: "zero",
+			r:    0,
+		},
+		{
+			name: "fraction",
+			r:    0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRateLimit(tt.r); (err != nil) != tt.wantErr {
+				t.Errorf("validateRateLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRateBurst(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		wantErr bool
+	}{
+		{
+			name:    "negative",
+			n:       -1,
+			wantErr: true,
+		},
+		{
+			name:    "zero",
+			n:       0,
+			wantErr: true,
+		},
+		{
+			name: "positive",
+			n:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRateBurst(tt.n); (err != nil) != tt.wantErr {
+				t.Errorf("validateRateBurst() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSuccessStatuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: map[string]int{},
+		},
+		{
+			name: "valid",
+			m:    map[string]string{"github": "200", "slack": "204"},
+			want: map[string]int{"github": 200, "slack": 204},
+		},
+		{
+			name:    "invalid_status_code",
+			m:       map[string]string{"slack": "202"},
+			wantErr: true,
+		},
+		{
+			name:    "not_a_number",
+			m:       map[string]string{"slack": "ok"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSuccessStatuses(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSuccessStatuses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("parseSuccessStatuses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplateMaxBodyBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]string
+		want    map[string]int64
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: map[string]int64{},
+		},
+		{
+			name: "valid",
+			m:    map[string]string{"github": "26214400", "slack": "1024"},
+			want: map[string]int64{"github": 26214400, "slack": 1024},
+		},
+		{
+			name:    "zero",
+			m:       map[string]string{"slack": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			m:       map[string]string{"slack": "-1"},
+			wantErr: true,
+		},
+		{
+			name:    "not_a_number",
+			m:       map[string]string{"slack": "1MiB"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTemplateMaxBodyBytes(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTemplateMaxBodyBytes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("parseTemplateMaxBodyBytes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]string
+		want    map[string]http.Header
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: map[string]http.Header{},
+		},
+		{
+			name: "valid",
+			m:    map[string]string{"id1:cache-control": "no-store", "id1:X-Foo": "bar", "id2:X-Foo": "baz"},
+			want: map[string]http.Header{
+				"id1": {"Cache-Control": {"no-store"}, "X-Foo": {"bar"}},
+				"id2": {"X-Foo": {"baz"}},
+			},
+		},
+		{
+			name:    "missing_link_id",
+			m:       map[string]string{":X-Foo": "bar"},
+			wantErr: true,
+		},
+		{
+			name:    "missing_header_name",
+			m:       map[string]string{"id1": "bar"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_header_name",
+			m:       map[string]string{"id1:X Foo": "bar"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_header_value",
+			m:       map[string]string{"id1:X-Foo": "bar\r\nX-Bar: baz"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResponseHeaders(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResponseHeaders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("parseResponseHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "negative",
+			d:       -time.Second,
+			wantErr: true,
+		},
+		{
+			name:    "zero",
+			d:       0,
+			wantErr: true,
+		},
+		{
+			name: "positive",
+			d:    time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTimeout(tt.d); (err != nil) != tt.wantErr {
+				t.Errorf("validateTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConnectReadyTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		ready   time.Duration
+		write   time.Duration
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			ready: DefaultConnectReadyTimeout,
+			write: DefaultWriteTimeout,
+		},
+		{
+			name:  "no_wait",
+			write: DefaultWriteTimeout,
+		},
+		{
+			name:    "equal",
+			ready:   time.Second,
+			write:   time.Second,
+			wantErr: true,
+		},
+		{
+			name:    "longer",
+			ready:   5 * time.Second,
+			write:   3 * time.Second,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateConnectReadyTimeout(tt.ready, tt.write); (err != nil) != tt.wantErr {
+				t.Errorf("validateConnectReadyTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReapInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "negative",
+			d:       -time.Second,
+			wantErr: true,
+		},
+		{
+			name: "disabled",
+			d:    0,
+		},
+		{
+			name:    "too_short",
+			d:       time.Second,
+			wantErr: true,
+		},
+		{
+			name: "default",
+			d:    DefaultConnectionReapInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateReapInterval(tt.d); (err != nil) != tt.wantErr {
+				t.Errorf("validateReapInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMaxConcurrentReconnects(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		wantErr bool
+	}{
+		{
+			name:    "negative",
+			n:       -1,
+			wantErr: true,
+		},
+		{
+			name: "unlimited",
+			n:    0,
+		},
+		{
+			name: "default",
+			n:    websocket.DefaultMaxConcurrentReconnects,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMaxConcurrentReconnects(tt.n); (err != nil) != tt.wantErr {
+				t.Errorf("validateMaxConcurrentReconnects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLogOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantErr bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:   "stderr",
+			output: "stderr",
+		},
+		{
+			name:   "stdout",
+			output: "stdout",
+		},
+		{
+			name:   "file",
+			output: "file",
+		},
+		{
+			name:   "syslog",
+			output: "syslog",
+		},
+		{
+			name:    "unsupported",
+			output:  "console",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateLogOutput(tt.output); (err != nil) != tt.wantErr {
+				t.Errorf("validateLogOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
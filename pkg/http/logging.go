@@ -0,0 +1,116 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Supported values of the "--log-output" flag. The default (empty)
+// is stderr in production, and the console (stdout) in dev mode.
+const (
+	logOutputStderr = "stderr"
+	logOutputStdout = "stdout"
+	logOutputFile   = "file"
+	logOutputSyslog = "syslog"
+)
+
+// logLevels are the supported values of the "--log-level" flag.
+var logLevels = []zerolog.Level{
+	zerolog.TraceLevel, zerolog.DebugLevel, zerolog.InfoLevel, zerolog.WarnLevel, zerolog.ErrorLevel,
+}
+
+// logConfig contains the settings of the server's log output.
+type logConfig struct {
+	output string
+
+	file       string // For [logOutputFile].
+	maxMB      int
+	maxBackups int
+	maxAgeDays int
+
+	syslogAddr string // For [logOutputSyslog], empty = local syslog.
+}
+
+func newLogConfig(cmd *cli.Command) logConfig {
+	return logConfig{
+		output:     cmd.String("log-output"),
+		file:       cmd.String("log-file"),
+		maxMB:      cmd.Int("log-file-max-megabytes"),
+		maxBackups: cmd.Int("log-file-max-backups"),
+		maxAgeDays: cmd.Int("log-file-max-age-days"),
+		syslogAddr: cmd.String("log-syslog-addr"),
+	}
+}
+
+// logWriter returns the destination of the server's log messages.
+// Files are rotated by size, and pruned by count and age.
+func logWriter(cfg logConfig, devMode bool) (io.Writer, error) {
+	switch cfg.output {
+	case "":
+		if devMode {
+			return os.Stdout, nil
+		}
+		return os.Stderr, nil
+
+	case logOutputStderr:
+		return os.Stderr, nil
+
+	case logOutputStdout:
+		return os.Stdout, nil
+
+	case logOutputFile:
+		if cfg.file == "" {
+			return nil, errors.New("log output is a file, but the log file path is missing")
+		}
+		return &lumberjack.Logger{
+			Filename:   cfg.file,
+			MaxSize:    cfg.maxMB,
+			MaxBackups: cfg.maxBackups,
+			MaxAge:     cfg.maxAgeDays,
+		}, nil
+
+	case logOutputSyslog:
+		return syslogWriter(cfg.syslogAddr)
+
+	default:
+		return nil, fmt.Errorf("unsupported log output: %q", cfg.output)
+	}
+}
+
+// parseLogLevel returns the minimum level of log messages. The default (empty)
+// is [zerolog.DebugLevel] in production, and [zerolog.TraceLevel] in dev mode.
+func parseLogLevel(s string, devMode bool) (zerolog.Level, error) {
+	if s == "" {
+		if devMode {
+			return zerolog.TraceLevel, nil
+		}
+		return zerolog.DebugLevel, nil
+	}
+
+	l, err := zerolog.ParseLevel(strings.ToLower(s))
+	if err != nil || !slices.Contains(logLevels, l) {
+		return zerolog.NoLevel, fmt.Errorf("unsupported log level: %q", s)
+	}
+	return l, nil
+}
+
+// setLogLevel sets the global minimum level of log messages (see [parseLogLevel]).
+// It's called when logging is initialized, and again when the level is changed
+// in etcd, at startup or while the server is running.
+func setLogLevel(s string, devMode bool) error {
+	l, err := parseLogLevel(s, devMode)
+	if err != nil {
+		return err
+	}
+
+	zerolog.SetGlobalLevel(l)
+	return nil
+}
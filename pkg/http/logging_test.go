@@ -0,0 +1,215 @@
+package http
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func TestLogWriter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "omdient.log")
+
+	tests := []struct {
+		name    string
+		cfg     logConfig
+		devMode bool
+		want    any
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: os.Stderr,
+		},
+		{
+			name:    "default_dev_mode",
+			devMode: true,
+			want:    os.Stdout,
+		},
+		{
+			name:    "stderr_dev_mode",
+			cfg:     logConfig{output: logOutputStderr},
+			devMode: true,
+			want:    os.Stderr,
+		},
+		{
+			name: "stdout",
+			cfg:  logConfig{output: logOutputStdout},
+			want: os.Stdout,
+		},
+		{
+			name: "file",
+			cfg:  logConfig{output: logOutputFile, file: file, maxMB: 10, maxBackups: 3, maxAgeDays: 7},
+			want: &lumberjack.Logger{Filename: file, MaxSize: 10, MaxBackups: 3, MaxAge: 7},
+		},
+		{
+			name:    "file_without_path",
+			cfg:     logConfig{output: logOutputFile},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported",
+			cfg:     logConfig{output: "kafka"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := logWriter(tt.cfg, tt.devMode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("logWriter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("logWriter() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogWriterSyslog(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w, err := logWriter(logConfig{output: logOutputSyslog, syslogAddr: "udp://" + pc.LocalAddr().String()}, false)
+	if err != nil {
+		t.Fatalf("logWriter() error = %v", err)
+	}
+
+	l := zerolog.New(w)
+	l.Warn().Msg("hello")
+
+	buf := make([]byte, 1024)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := string(buf[:n])
+	if !strings.Contains(got, "omdient") || !strings.Contains(got, `"message":"hello"`) {
+		t.Errorf("syslog message = %q", got)
+	}
+	// Priority = facility (daemon = 3) * 8 + severity (warning = 4).
+	if !strings.HasPrefix(got, "<28>") {
+		t.Errorf("syslog message priority = %q, want <28>", got[:4])
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		devMode bool
+		want    zerolog.Level
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: zerolog.DebugLevel,
+		},
+		{
+			name:    "default_dev_mode",
+			devMode: true,
+			want:    zerolog.TraceLevel,
+		},
+		{
+			name:  "trace",
+			level: "trace",
+			want:  zerolog.TraceLevel,
+		},
+		{
+			name:  "debug",
+			level: "debug",
+			want:  zerolog.DebugLevel,
+		},
+		{
+			name:  "info",
+			level: "info",
+			want:  zerolog.InfoLevel,
+		},
+		{
+			name:    "info_overrides_dev_mode",
+			level:   "info",
+			devMode: true,
+			want:    zerolog.InfoLevel,
+		},
+		{
+			name:  "warn",
+			level: "warn",
+			want:  zerolog.WarnLevel,
+		},
+		{
+			name:  "error",
+			level: "error",
+			want:  zerolog.ErrorLevel,
+		},
+		{
+			name:  "upper_case",
+			level: "INFO",
+			want:  zerolog.InfoLevel,
+		},
+		{
+			name:    "fatal",
+			level:   "fatal",
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			level:   "verbose",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLogLevel(tt.level, tt.devMode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLogLevel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseLogLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitLog(t *testing.T) {
+	prevLevel, prevLogger := zerolog.GlobalLevel(), log.Logger
+	t.Cleanup(func() {
+		zerolog.SetGlobalLevel(prevLevel)
+		log.Logger = prevLogger
+	})
+
+	var buf bytes.Buffer
+	if err := initLog(false, &buf, "warn"); err != nil {
+		t.Fatalf("initLog() error = %v", err)
+	}
+	if got := zerolog.GlobalLevel(); got != zerolog.WarnLevel {
+		t.Errorf("global log level = %v, want %v", got, zerolog.WarnLevel)
+	}
+
+	log.Info().Msg("dropped")
+	log.Warn().Msg("written")
+	if got := buf.String(); strings.Contains(got, "dropped") || !strings.Contains(got, "written") {
+		t.Errorf("log output = %q", got)
+	}
+
+	if err := initLog(false, &buf, "verbose"); err == nil {
+		t.Error("initLog() with an invalid level should fail")
+	}
+	if got := zerolog.GlobalLevel(); got != zerolog.WarnLevel {
+		t.Errorf("global log level = %v after an invalid level, want %v", got, zerolog.WarnLevel)
+	}
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Per-link budget of throttled webhook requests which are checked
+// anyway, in case they're URL verifications (see [isVerificationRequest]).
+const (
+	verificationRateLimit = 0.2 // Requests per second, i.e. one every 5 seconds.
+	verificationRateBurst = 2
+)
+
+// linkRateLimiter is a collection of token-bucket rate limiters for
+// HTTP webhook requests, one per Thrippy link ID, which are created lazily.
+type linkRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	limiters sync.Map // Link ID --> [*rate.Limiter].
+}
+
+// newLinkRateLimiter returns a new [linkRateLimiter] which allows up to
+// perSecond requests per second per link, with the given burst size.
+// If perSecond is zero, this function returns nil to disable rate limiting.
+func newLinkRateLimiter(perSecond float64, burst int) *linkRateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &linkRateLimiter{limit: rate.Limit(perSecond), burst: burst}
+}
+
+// allow reports whether a request for the given link ID may be processed
+// at the given time. If not, it also returns the duration after which
+// the client may retry it. This is a no-op if the limiter is nil.
+func (l *linkRateLimiter) allow(linkID string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	v, _ := l.limiters.LoadOrStore(linkID, rate.NewLimiter(l.limit, l.burst))
+	r := v.(*rate.Limiter).ReserveN(now, 1)
+	if !r.OK() {
+		return false, time.Second
+	}
+
+	d := r.DelayFrom(now)
+	if d == 0 {
+		return true, 0
+	}
+
+	r.CancelAt(now) // Don't consume a token for a rejected request.
+	return false, d
+}
+
+// retryAfter formats the given duration as the value of a "Retry-After"
+// HTTP header, i.e. a whole number of seconds, rounded up to at least 1.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(d.Seconds()))))
+}
+
+// isVerificationRequest reports whether the given JSON payload is a URL verification
+// request (e.g. a Slack challenge), which is exempt from rate limiting so as not to
+// block the setup of new links. See https://docs.slack.dev/reference/events/url_verification.
+// This is based only on the payload, so callers must authenticate the request first.
+func isVerificationRequest(decoded map[string]any) bool {
+	return decoded["type"] == "url_verification"
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lithammer/shortuuid/v4"
+
+	intlinks "github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/links"
+)
+
+func TestLinkRateLimiterAllow(t *testing.T) {
+	l := newLinkRateLimiter(1, 2)
+	now := time.Now()
+
+	// Burst.
+	for i := range 2 {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("allow() #%d = false, want true", i+1)
+		}
+	}
+
+	// Exceeded.
+	ok, d := l.allow("a", now)
+	if ok {
+		t.Fatal("allow() #3 = true, want false")
+	}
+	if d <= 0 || d > time.Second {
+		t.Errorf("allow() #3 retry after = %v, want (0s, 1s]", d)
+	}
+
+	// Other links are unaffected.
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("allow() for another link = false, want true")
+	}
+
+	// Recovery.
+	if ok, _ := l.allow("a", now.Add(d)); !ok {
+		t.Error("allow() after retry period = false, want true")
+	}
+}
+
+func TestLinkRateLimiterDisabled(t *testing.T) {
+	l := newLinkRateLimiter(0, 1)
+	if l != nil {
+		t.Fatalf("newLinkRateLimiter() = %v, want nil", l)
+	}
+
+	for i := range 100 {
+		if ok, _ := l.allow("a", time.Now()); !ok {
+			t.Fatalf("allow() #%d = false, want true", i+1)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		want string
+	}{
+		{
+			name: "zero",
+			want: "1",
+		},
+		{
+			name: "sub_second",
+			d:    100 * time.Millisecond,
+			want: "1",
+		},
+		{
+			name: "round_up",
+			d:    1500 * time.Millisecond,
+			want: "2",
+		},
+		{
+			name: "exact",
+			d:    3 * time.Second,
+			want: "3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.d); got != tt.want {
+				t.Errorf("retryAfter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerRateLimit(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+	s.limiter.Store(newLinkRateLimiter(10, 1))
+	s.verifyLimiter = newLinkRateLimiter(verificationRateLimit, 3)
+
+	links.WebhookHandlers[testTemplate] = func(_ context.Context, _ http.ResponseWriter, _ intlinks.RequestData) int {
+		return http.StatusOK
+	}
+	links.WebhookVerifiers[testTemplate] = func(_ context.Context, r intlinks.RequestData) int {
+		if r.Headers.Get("X-Test-Signature") != "valid" {
+			return http.StatusUnauthorized
+		}
+		return http.StatusOK
+	}
+	t.Cleanup(func() {
+		delete(links.WebhookHandlers, testTemplate)
+		delete(links.WebhookVerifiers, testTemplate)
+	})
+
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	path := "/webhook/" + id
+	send := func(body string, signed bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if signed {
+			r.Header.Set("X-Test-Signature", "valid")
+		}
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	// Within the burst.
+	if w := send("{}", true); w.Code == http.StatusTooManyRequests {
+		t.Fatalf("1st webhook response status code: got %d, want anything else", w.Code)
+	}
+
+	// Exceeded.
+	w := send("{}", true)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("2nd webhook response status code: got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("2nd webhook response Retry-After header: got %q, want %q", got, "1")
+	}
+
+	// Not exempt without authentication.
+	verification := `{"type":"url_verification","challenge":"abc"}`
+	if w := send(verification, false); w.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned URL verification response status code: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Exempt.
+	if w := send(verification, true); w.Code == http.StatusTooManyRequests {
+		t.Errorf("URL verification response status code: got %d, want anything else", w.Code)
+	}
+
+	// Exceeded the separate budget of throttled requests.
+	if w := send(verification, true); w.Code != http.StatusTooManyRequests {
+		t.Errorf("URL verification response status code after budget: got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	// Recovery.
+	time.Sleep(100 * time.Millisecond)
+	if w := send("{}", true); w.Code == http.StatusTooManyRequests {
+		t.Errorf("webhook response status code after recovery: got %d, want anything else", w.Code)
+	}
+}
+
+func TestWebhookHandlerThrottledSkipsThrippy(t *testing.T) {
+	id := shortuuid.New()
+	m := &mockThrippy{links: map[string]bool{id: true}}
+	s, _, _ := newTestServerWithMock(t, m, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+	s.limiter.Store(newLinkRateLimiter(0.001, 1))
+	s.verifyLimiter = newLinkRateLimiter(0.001, 2)
+
+	links.WebhookHandlers[testTemplate] = func(_ context.Context, _ http.ResponseWriter, _ intlinks.RequestData) int {
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+
+	codes := map[int]int{}
+	for range 20 {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id, strings.NewReader("{}"))
+		r.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+		codes[w.Code]++
+	}
+
+	if codes[http.StatusOK] != 1 || codes[http.StatusTooManyRequests] != 19 {
+		t.Errorf("response status codes = %v, want 1 OK and 19 Too Many Requests", codes)
+	}
+	// 1 within the burst + 2 within the separate budget of throttled requests.
+	if n := m.lookups.Load(); n != 3 {
+		t.Errorf("Thrippy lookups = %d, want %d", n, 3)
+	}
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// recoverPanics is an HTTP middleware that recovers from panics in the given
+// handler, logs them along with their stack trace, and responds with an
+// [http.StatusInternalServerError] (unless the handler already responded).
+// The log uses the request's context logger, if there is one.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// Special sentinel value to abort a handler silently.
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			l := log.Logger
+			if cl := zerolog.Ctx(r.Context()); cl.GetLevel() != zerolog.Disabled {
+				l = *cl
+			}
+			l.Error().Str("http_method", r.Method).Str("url_path", r.URL.EscapedPath()).
+				Any("panic", v).Str("stack", string(debug.Stack())).Msg("recovered from panic in HTTP handler")
+
+			if sr.status == 0 {
+				sr.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(sr, r)
+	})
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		ctxLog   bool
+		wantCode int
+		wantLog  bool
+	}{
+		{
+			name:     "no_panic",
+			handler:  func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusAccepted) },
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name: "panic",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {
+				var m map[string]int
+				m["a"]++
+			},
+			wantCode: http.StatusInternalServerError,
+			wantLog:  true,
+		},
+		{
+			name:     "panic_with_context_logger",
+			handler:  func(_ http.ResponseWriter, _ *http.Request) { panic("test") },
+			ctxLog:   true,
+			wantCode: http.StatusInternalServerError,
+			wantLog:  true,
+		},
+		{
+			name: "panic_after_response",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				panic("test")
+			},
+			wantCode: http.StatusOK,
+			wantLog:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/test", http.NoBody)
+			if tt.ctxLog {
+				l := zerolog.New(buf).With().Str("request_id", "123").Logger()
+				r = r.WithContext(l.WithContext(r.Context()))
+			} else {
+				orig := log.Logger
+				log.Logger = zerolog.New(buf)
+				defer func() { log.Logger = orig }()
+			}
+
+			w := httptest.NewRecorder()
+			recoverPanics(tt.handler).ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code: got %d, want %d", w.Code, tt.wantCode)
+			}
+
+			got := buf.String()
+			if !tt.wantLog {
+				if got != "" {
+					t.Errorf("unexpected log: %s", got)
+				}
+				return
+			}
+			if !strings.Contains(got, `"stack":"goroutine `) {
+				t.Errorf("log doesn't contain a stack trace: %s", got)
+			}
+			if !strings.Contains(got, `"url_path":"/test"`) {
+				t.Errorf("log doesn't contain the request's URL path: %s", got)
+			}
+			if tt.ctxLog && !strings.Contains(got, `"request_id":"123"`) {
+				t.Errorf("log doesn't preserve the context logger's fields: %s", got)
+			}
+		})
+	}
+}
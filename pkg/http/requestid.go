@@ -0,0 +1,38 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/lithammer/shortuuid/v4"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	requestIDHeader   = "X-Request-ID"
+	requestIDMetadata = "x-request-id" // gRPC metadata keys are lowercase.
+	maxRequestIDLen   = 128
+)
+
+// requestID returns the ID which correlates all the logs and outgoing calls of
+// a single HTTP request: the client's "X-Request-ID" header, if it's safe to
+// use (i.e. short and printable ASCII), or else a newly-generated ID.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > maxRequestIDLen {
+		return shortuuid.New()
+	}
+
+	if strings.ContainsFunc(id, func(r rune) bool { return r <= ' ' || r > '~' }) {
+		return shortuuid.New()
+	}
+
+	return id
+}
+
+// withRequestID attaches the given request ID to outgoing
+// gRPC calls, such as link data requests to Thrippy.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, requestIDMetadata, id)
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/shortuuid/v4"
+
+	intlinks "github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/links"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{
+			name: "absent",
+		},
+		{
+			name:     "supplied",
+			header:   "req-123_abc.DEF",
+			wantSame: true,
+		},
+		{
+			name:   "too_long",
+			header: strings.Repeat("a", maxRequestIDLen+1),
+		},
+		{
+			name:   "whitespace",
+			header: "req 123",
+		},
+		{
+			name:   "non_ascii",
+			header: "req-ü",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", http.NoBody)
+			if tt.header != "" {
+				r.Header.Set(requestIDHeader, tt.header)
+			}
+
+			got := requestID(r)
+			if tt.wantSame {
+				if got != tt.header {
+					t.Errorf("requestID() = %q, want %q", got, tt.header)
+				}
+				return
+			}
+			if _, err := shortuuid.DefaultEncoder.Decode(got); err != nil {
+				t.Errorf("requestID() = %q, want a generated short UUID", got)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerRequestID(t *testing.T) {
+	id := shortuuid.New()
+	m := &mockThrippy{links: map[string]bool{id: true}}
+	s, _, _ := newTestServerWithMock(t, m, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+
+	links.WebhookHandlers[testTemplate] = func(context.Context, http.ResponseWriter, intlinks.RequestData) int {
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	tests := []struct {
+		name     string
+		supplied string
+	}{
+		{
+			name: "generated",
+		},
+		{
+			name:     "preserved",
+			supplied: "req-123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id, strings.NewReader("{}"))
+			r.Header.Set("Content-Type", "application/json")
+			if tt.supplied != "" {
+				r.Header.Set(requestIDHeader, tt.supplied)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			got := w.Header().Get(requestIDHeader)
+			if got == "" {
+				t.Fatal("response has no request ID header")
+			}
+			if tt.supplied != "" && got != tt.supplied {
+				t.Errorf("response request ID = %q, want %q", got, tt.supplied)
+			}
+
+			v, ok := m.requestIDs.Load(id)
+			if !ok || v.(string) != got {
+				t.Errorf("request ID in Thrippy metadata = %v, want %q", v, got)
+			}
+		})
+	}
+}
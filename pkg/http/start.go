@@ -2,37 +2,147 @@ package http
 
 import (
 	"context"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/lithammer/shortuuid/v4"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
 	"github.com/urfave/cli/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/tzrikka/omdient/internal/thrippy"
+	"github.com/tzrikka/omdient/internal/tracing"
+	"github.com/tzrikka/omdient/pkg/etcd"
+	"github.com/tzrikka/omdient/pkg/websocket"
 )
 
 // Start initializes Omdient's HTTP server, backend clients, and logging.
-func Start(_ context.Context, cmd *cli.Command) error {
-	initLog(cmd.Bool("dev"))
-	return newHTTPServer(cmd).run()
+func Start(ctx context.Context, cmd *cli.Command) error {
+	w, err := logWriter(newLogConfig(cmd), cmd.Bool("dev"))
+	if err == nil {
+		err = initLog(cmd.Bool("dev"), w, cmd.String("log-level"))
+	}
+	if err != nil {
+		_ = initLog(cmd.Bool("dev"), os.Stderr, "")
+		log.Err(err).Msg("failed to initialize logging")
+		return err
+	}
+	defer func() { _ = thrippy.Close() }()
+
+	shutdownTracing, err := tracing.Init(ctx, cmd.String("otel-endpoint"))
+	if err != nil {
+		log.Err(err).Msg("failed to initialize OpenTelemetry tracing")
+		return err
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var c *clientv3.Client
+	if cmd.Bool("etcd-config") || cmd.Bool("etcd-persist-connections") || cmd.String("dead-letter") == "etcd" || cmd.Bool("etcd-store-events") {
+		if c, err = etcd.NewClient(cmd); err != nil {
+			log.Err(err).Msg("failed to initialize etcd client")
+			return err
+		}
+		defer c.Close()
+	}
+
+	// Overlay settings from etcd before reading any of them. Logging is already
+	// initialized at this point, so only its level is applied from etcd: other
+	// logging settings (e.g. the output) are supported only in other sources.
+	if cmd.Bool("etcd-config") {
+		if err := etcd.LoadConfig(ctx, c, cmd); err != nil {
+			log.Err(err).Msg("failed to load settings from etcd")
+			return err
+		}
+		if err := setLogLevel(cmd.String("log-level"), cmd.Bool("dev")); err != nil {
+			log.Err(err).Msg("invalid log level in etcd")
+			return err
+		}
+	}
+
+	websocket.SetMaxConcurrentReconnects(cmd.Int("max-concurrent-reconnects"))
+
+	s, err := newHTTPServer(cmd, c)
+	if err != nil {
+		log.Err(err).Msg("failed to initialize HTTP server")
+		return err
+	}
+
+	if cmd.Bool("etcd-config") {
+		go func() {
+			if err := etcd.WatchConfig(ctx, c, s.applyConfig); err != nil {
+				log.Err(err).Msg("stopped watching settings in etcd")
+			}
+		}()
+	}
+
+	if cmd.Bool("etcd-persist-connections") {
+		leaser := etcd.NewConnectionLeaser(c, replicaID(), cmd.Duration("etcd-lease-ttl"))
+		s.store = etcd.NewConnectionStore(c)
+		s.leaser = leaser
+
+		if err := leaser.Start(ctx, s.reclaimConnections); err != nil {
+			log.Err(err).Msg("failed to initialize etcd lease")
+			return err
+		}
+		defer func() { _ = leaser.Close(context.Background()) }()
+
+		rev := s.restoreConnections(ctx)
+
+		go func() {
+			if err := leaser.WatchReleased(ctx, s.handleConnectionReleased); err != nil {
+				log.Err(err).Msg("stopped watching released connections")
+			}
+		}()
+
+		go func() {
+			if err := etcd.WatchConnections(ctx, c, rev, s.handleConnectionEvent); err != nil {
+				log.Err(err).Msg("stopped watching persisted connections")
+			}
+		}()
+	}
+
+	return s.run(ctx)
+}
+
+// replicaID returns a unique identifier for this server process,
+// to distinguish between replicas which share persisted connections.
+func replicaID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "omdient"
+	}
+	return host + "-" + shortuuid.New()
 }
 
-// initLog initializes the logger for the Omdient server,
-// based on whether it's running in development mode or not.
-func initLog(devMode bool) {
+// initLog initializes the logger for the Omdient server, based on whether it's
+// running in development mode or not, with the given output (see [logWriter])
+// and minimum level (see [parseLogLevel]), which overrides the mode's default.
+func initLog(devMode bool, w io.Writer, level string) error {
+	if err := setLogLevel(level, devMode); err != nil {
+		return err
+	}
+
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
 
 	if !devMode {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Caller().Logger()
-		return
+		log.Logger = zerolog.New(w).With().Timestamp().Caller().Logger()
+		return nil
 	}
 
-	zerolog.SetGlobalLevel(zerolog.TraceLevel)
 	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out:        os.Stdout,
+		Out:        w,
+		NoColor:    w != os.Stdout && w != os.Stderr,
 		TimeFormat: "15:04:05.000",
 	}).With().Caller().Logger()
 
 	log.Warn().Msg("********** DEV MODE - UNSAFE IN PRODUCTION! **********")
+	return nil
 }
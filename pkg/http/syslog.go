@@ -0,0 +1,31 @@
+//go:build !windows && !plan9
+
+package http
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// syslogWriter connects to the local syslog server if the address is empty,
+// or to a remote one (e.g. "udp://host:514", or "host:514" which implies UDP).
+func syslogWriter(addr string) (io.Writer, error) {
+	var network, raddr string
+	if addr != "" {
+		network, raddr = "udp", addr
+		if n, a, ok := strings.Cut(addr, "://"); ok {
+			network, raddr = n, a
+		}
+	}
+
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, "omdient")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return zerolog.SyslogLevelWriter(w), nil
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package http
+
+import (
+	"errors"
+	"io"
+)
+
+func syslogWriter(_ string) (io.Writer, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -2,50 +2,237 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lithammer/shortuuid/v4"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
-	"google.golang.org/grpc/credentials"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	intlinks "github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/internal/metrics"
 	"github.com/tzrikka/omdient/internal/thrippy"
+	"github.com/tzrikka/omdient/internal/tracing"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/dispatch/kafka"
+	"github.com/tzrikka/omdient/pkg/etcd"
 	"github.com/tzrikka/omdient/pkg/links"
+	"github.com/tzrikka/omdient/pkg/links/echo"
 )
 
 const (
-	timeout = 3 * time.Second
-	maxSize = 10 << 20 // 10 MiB.
+	proxyTimeout = 3 * time.Second // For Thrippy passthrough requests.
+
+	// Backoff between Thrippy lookups in [httpServer.waitForLinkData],
+	// and suggested client delay when Thrippy is still unavailable after that.
+	minReadyBackoff   = 100 * time.Millisecond
+	maxReadyBackoff   = time.Second
+	thrippyRetryAfter = 5 * time.Second
 )
 
-type httpServer struct {
-	httpPort   int      // To initialize the HTTP server.
-	thrippyURL *url.URL // Optional passthrough for Thrippy OAuth.
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
 
-	thrippyGRPCAddr string
-	thrippyCreds    credentials.TransportCredentials
+type httpServer struct {
+	httpPort     int      // To initialize the HTTP server.
+	thrippyURL   *url.URL // Optional passthrough for Thrippy OAuth.
+	metrics      bool     // Optional Prometheus metrics endpoint.
+	adminToken   string   // Optional administrative endpoints.
+	devMode      bool     // Enables link templates for local testing.
+	maxBodyBytes int64    // Limit for HTTP webhook request bodies.
+	jsonTypes    []string // Media types of JSON request bodies.
+
+	limiter       atomic.Pointer[linkRateLimiter] // Optional per-link webhook rate limiting.
+	verifyLimiter *linkRateLimiter                // Throttled requests which may be URL verifications.
+	rateMu        sync.Mutex                      // Serializes hot-reloads of the rate limit.
+	rateLimit     float64
+	rateBurst     int
+
+	noContentOnEmpty bool                   // Respond with 204 if a webhook handler doesn't.
+	successStatuses  map[string]int         // Per-template alternatives to 200.
+	bodyLimits       map[string]int64       // Per-template overrides of maxBodyBytes.
+	respHeaders      map[string]http.Header // Per-link static response headers.
+	trustedProxies   trustedProxies         // Identify clients by proxy headers.
+
+	allowlist atomic.Pointer[linkAllowlist] // Optional per-link source CIDR ranges.
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+
+	connectReadyTimeout time.Duration // Wait for Thrippy before failing connections.
+	webhookWarmup       time.Duration // Reject webhooks with 503 after startup.
+	warmupEnd           time.Time     // Set when the server starts running.
+	reapInterval        time.Duration // Stop connections of deleted links, 0 = never.
+
+	thrippyCfg   thrippy.Config
+	thrippyLinks *thrippy.LinkCache
 
 	connections sync.Map
+	store       connectionStore  // Optional persistence of connections.
+	leaser      connectionLeaser // Optional distribution across replicas.
+
+	queue        *dispatch.Queue          // Asynchronous event dispatching.
+	deadLetters  dispatch.DeadLetterStore // Optional, for inspection and replay.
+	events       dispatch.EventStore      // Optional, for replaying dispatched events.
+	outputs      []io.Closer              // Closed after draining the queue.
+	drainTimeout time.Duration            // When shutting down the server.
 }
 
-func newHTTPServer(cmd *cli.Command) *httpServer {
-	return &httpServer{
+// newHTTPServer initializes the HTTP server based on CLI flags. The etcd client is
+// used only if dead letters or dispatched events are stored in etcd, otherwise it may be nil.
+func newHTTPServer(cmd *cli.Command, c *clientv3.Client) (*httpServer, error) {
+	readyTimeout, writeTimeout := cmd.Duration("connect-ready-timeout"), cmd.Duration("write-timeout")
+	if err := validateConnectReadyTimeout(readyTimeout, writeTimeout); err != nil {
+		return nil, err
+	}
+
+	d, output, err := newDispatcher(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var events dispatch.EventStore
+	if cmd.Bool("etcd-store-events") {
+		events = etcd.NewEventStore(c, cmd.Duration("etcd-event-retention"))
+		d = dispatch.WithStore(d, events)
+	}
+
+	sink, dlOutput, err := newDeadLetterSink(cmd, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadLetter dispatch.DeadLetterFunc // Default = log.
+	if sink != nil {
+		deadLetter = dispatch.SinkFunc(sink)
+	}
+
+	cfg := thrippy.NewConfig(cmd)
+	limits, _ := parseTemplateMaxBodyBytes(cmd.StringMap("webhook-max-body-bytes")) // Already validated.
+	statuses, _ := parseSuccessStatuses(cmd.StringMap("webhook-success-status"))    // Already validated.
+	headers, _ := parseResponseHeaders(cmd.StringMap("webhook-response-headers"))   // Already validated.
+	allowlist, _ := parseAllowlist(cmd.StringMap("webhook-allowed-cidrs"))          // Already validated.
+	proxies, _ := parseTrustedProxies(cmd.StringSlice("trusted-proxies"))           // Already validated.
+
+	s := &httpServer{
 		httpPort:   cmd.Int("webhook-port"),
 		thrippyURL: baseURL(cmd.String("thrippy-http-addr")),
+		metrics:    cmd.Bool("metrics"),
+		adminToken: cmd.String("admin-token"),
+		devMode:    cmd.Bool("dev"),
+
+		maxBodyBytes: int64(cmd.Int("max-body-bytes")),
+		jsonTypes:    cmd.StringSlice("json-content-types"),
+		rateLimit:    cmd.Float("webhook-rate-limit"),
+		rateBurst:    cmd.Int("webhook-rate-burst"),
+
+		noContentOnEmpty: cmd.Bool("no-content-on-empty-response"),
+		successStatuses:  statuses,
+		bodyLimits:       limits,
+		respHeaders:      headers,
+		trustedProxies:   proxies,
+
+		readTimeout:  cmd.Duration("read-timeout"),
+		writeTimeout: writeTimeout,
+		idleTimeout:  cmd.Duration("idle-timeout"),
+
+		connectReadyTimeout: readyTimeout,
+		webhookWarmup:       cmd.Duration("webhook-warmup"),
+		reapInterval:        cmd.Duration("connection-reap-interval"),
+
+		thrippyCfg:   cfg,
+		thrippyLinks: thrippy.NewLinkCache(cfg, cmd.Duration("thrippy-cache-ttl")),
+
+		queue:        dispatch.NewPool(d, cmd.Int("dispatch-shards"), cmd.Int("dispatch-queue-size"), deadLetter),
+		events:       events,
+		drainTimeout: cmd.Duration("dispatch-drain-timeout"),
+	}
+
+	if store, ok := sink.(dispatch.DeadLetterStore); ok {
+		s.deadLetters = store
+	}
+	for _, c := range []io.Closer{output, dlOutput} {
+		if c != nil {
+			s.outputs = append(s.outputs, c)
+		}
+	}
+
+	s.limiter.Store(newLinkRateLimiter(s.rateLimit, s.rateBurst))
+	s.verifyLimiter = newLinkRateLimiter(verificationRateLimit, verificationRateBurst)
+	s.allowlist.Store(&allowlist)
 
-		thrippyGRPCAddr: cmd.String("thrippy-server-addr"),
-		thrippyCreds:    thrippy.SecureCreds(cmd),
+	if s.devMode {
+		links.EnableDevTemplates()
+	}
+
+	return s, nil
+}
+
+// newDispatcher initializes the destination of asynchronous event notifications.
+// It also returns the destination's resources to release after draining the
+// dispatch queue, if there are any.
+func newDispatcher(cmd *cli.Command) (dispatch.Dispatcher, io.Closer, error) {
+	var d dispatch.Dispatcher = dispatch.LogDispatcher{}
+	var c io.Closer
+
+	if cmd.String("dispatch") == "kafka" {
+		k, err := kafka.New(kafka.NewConfig(cmd))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize Kafka dispatcher: %w", err)
+		}
+		d, c = k, k
+	}
+
+	policy := dispatch.OversizePolicy(cmd.String("dispatch-oversize-policy"))
+	return dispatch.WithMaxSize(d, cmd.Int("dispatch-max-event-bytes"), policy), c, nil
+}
+
+// newDeadLetterSink initializes the destination of events which failed to be
+// dispatched, or returns nil if they're only logged. Like [newDispatcher],
+// it also returns the destination's resources to release, if there are any.
+func newDeadLetterSink(cmd *cli.Command, kv clientv3.KV) (dispatch.DeadLetterSink, io.Closer, error) {
+	switch cmd.String("dead-letter") {
+	case "file":
+		path := cmd.String("dead-letter-file")
+		if path == "" {
+			return nil, nil, errors.New("missing dead letter file path")
+		}
+		return dispatch.NewFileSink(path), nil, nil
+
+	case "etcd":
+		return etcd.NewDeadLetterStore(kv), nil, nil
+
+	case "kafka":
+		cfg := kafka.NewConfig(cmd)
+		cfg.Topic = cmd.String("dispatch-kafka-dead-letter-topic")
+		k, err := kafka.New(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize Kafka dead letter dispatcher: %w", err)
+		}
+		return dispatch.NewDispatcherSink(k), k, nil
+
+	default:
+		return nil, nil, nil
 	}
 }
 
@@ -79,50 +266,158 @@ func baseURL(addr string) *url.URL {
 	return u
 }
 
-// run starts an HTTP server to expose webhooks.
-// This is blocking, to keep the Omdient server running.
-func (s *httpServer) run() error {
-	http.HandleFunc("GET /connect/{id}", s.connectHandler)
-	http.HandleFunc("GET /disconnect/{id}", s.disconnectHandler)
+// run starts an HTTP server to expose webhooks. This is blocking, to keep
+// the Omdient server running, until the context is canceled (e.g. by a signal).
+func (s *httpServer) run(ctx context.Context) error {
+	mux, err := s.routes()
+	if err != nil {
+		log.Err(err).Send()
+		return err
+	}
 
-	http.HandleFunc("GET /webhook/{id...}", s.webhookHandler)
-	http.HandleFunc("POST /webhook/{id...}", s.webhookHandler)
+	server := s.newServer(recoverPanics(mux))
+	log.Info().Msgf("HTTP server listening on port %d", s.httpPort)
+	s.warmupEnd = time.Now().Add(s.webhookWarmup)
 
-	if s.thrippyURL != nil {
-		log.Info().Msgf("HTTP passthrough for Thrippy OAuth callbacks: %s", s.thrippyURL)
-		http.HandleFunc("GET /callback", s.thrippyHandler)
-		http.HandleFunc("GET /start", s.thrippyHandler)
-		http.HandleFunc("POST /start", s.thrippyHandler)
-		http.HandleFunc("GET /success", s.thrippyHandler)
+	if s.reapInterval > 0 {
+		go s.reapConnections(ctx)
 	}
 
-	server := &http.Server{
-		Addr:         net.JoinHostPort("", strconv.Itoa(s.httpPort)),
-		ReadTimeout:  timeout,
-		WriteTimeout: timeout,
-	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
 
-	log.Info().Msgf("HTTP server listening on port %d", s.httpPort)
-	err := server.ListenAndServe()
-	if err != nil {
+	select {
+	case err := <-errs:
 		log.Err(err).Send()
 		return err
+	case <-ctx.Done():
+		return s.shutdown(server)
+	}
+}
+
+// shutdown gracefully stops the HTTP server, and then drains the dispatch
+// queue, within the configured drain timeout. Queued events which are not
+// dispatched in time are dead-lettered rather than dropped (see [dispatch.Queue]).
+func (s *httpServer) shutdown(server *http.Server) error {
+	log.Info().Dur("timeout", s.drainTimeout).Msg("shutting down HTTP server")
+	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+
+	errHTTP := server.Shutdown(ctx)
+	if errHTTP != nil {
+		log.Err(errHTTP).Msg("failed to shut down HTTP server gracefully")
+	}
+
+	errQueue := s.queue.Shutdown(ctx)
+	if errQueue != nil {
+		log.Err(errQueue).Msg("failed to drain dispatch queue before timeout")
+	}
+
+	errs := []error{errHTTP, errQueue}
+	for _, c := range s.outputs {
+		if err := c.Close(); err != nil {
+			log.Err(err).Msg("failed to close event dispatcher")
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// newServer initializes an [http.Server] with the given handler,
+// and the server's configured port number and timeouts.
+func (s *httpServer) newServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         net.JoinHostPort("", strconv.Itoa(s.httpPort)),
+		Handler:      h,
+		ReadTimeout:  s.readTimeout,
+		WriteTimeout: s.writeTimeout,
+		IdleTimeout:  s.idleTimeout,
+	}
+}
+
+// routes registers all the HTTP server's handlers in a new [http.ServeMux].
+func (s *httpServer) routes() (*http.ServeMux, error) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /connect/{id}", s.connectHandler)
+	mux.HandleFunc("GET /disconnect/{id}", s.disconnectHandler)
+
+	mux.HandleFunc("GET /webhook/{id...}", s.webhookHandler)
+	mux.HandleFunc("POST /webhook/{id...}", s.webhookHandler)
+	mux.HandleFunc("/webhook/{id...}", methodNotAllowed(http.MethodGet, http.MethodPost))
+
+	if s.thrippyURL != nil {
+		log.Info().Msgf("HTTP passthrough for Thrippy OAuth callbacks: %s", s.thrippyURL)
+		mux.HandleFunc("GET /callback", s.thrippyHandler)
+		mux.HandleFunc("GET /start", s.thrippyHandler)
+		mux.HandleFunc("POST /start", s.thrippyHandler)
+		mux.HandleFunc("GET /success", s.thrippyHandler)
+	}
+
+	if s.adminToken != "" {
+		log.Info().Msg("exposing administrative endpoints")
+		mux.HandleFunc("GET /connections", s.requireAdminToken(s.connectionsHandler))
+		if s.deadLetters != nil {
+			mux.HandleFunc("GET /dead-letters", s.requireAdminToken(s.deadLettersHandler))
+			mux.HandleFunc("POST /dead-letters/replay", s.requireAdminToken(s.replayDeadLettersHandler))
+		}
+		if s.events != nil {
+			mux.HandleFunc("POST /replay/{link_id}/{event_id}", s.requireAdminToken(s.replayHandler))
+		}
 	}
 
-	return nil
+	if s.metrics {
+		h, err := metrics.Handler()
+		if err != nil {
+			return nil, fmt.Errorf("failed to register Prometheus metrics: %w", err)
+		}
+		log.Info().Msg("exposing Prometheus metrics at /metrics")
+		mux.Handle("GET /metrics", h)
+	}
+
+	return mux, nil
+}
+
+// methodNotAllowed returns a handler which rejects requests with methods other than
+// the given ones, consistently, instead of relying on the fallback of [http.ServeMux].
+func methodNotAllowed(allowed ...string) http.HandlerFunc {
+	allow := strings.Join(allowed, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Warn().Str("http_method", r.Method).Str("url_path", r.URL.EscapedPath()).
+			Msg("method not allowed")
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
 }
 
 // connectHandler is an idempotent webhook to let users manually start
 // stateful non-webhook connections to process incoming asynchronous event
 // notifications from third-party services, based on their Thrippy link ID.
 func (s *httpServer) connectHandler(w http.ResponseWriter, r *http.Request) {
+	var template string
+	sr := &statusRecorder{ResponseWriter: w}
+	w = sr
+	defer func() {
+		metrics.ConnectRequests.WithLabelValues(template, strconv.Itoa(sr.statusCode())).Inc()
+	}()
+
 	l, id, statusCode := connID(r)
 	if statusCode != http.StatusOK {
 		w.WriteHeader(statusCode)
 		return
 	}
 
-	template, secrets, err := thrippy.LinkData(r.Context(), s.thrippyGRPCAddr, s.thrippyCreds, id)
+	template, secrets, err := s.waitForLinkData(l.WithContext(r.Context()), id)
+	if thrippy.IsTransient(err) {
+		l.Warn().Err(err).Msg("service unavailable: Thrippy is unreachable")
+		w.Header().Set("Retry-After", retryAfter(thrippyRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
 	statusCode = checkLinkData(l, template, secrets, err)
 	if statusCode != http.StatusOK {
 		w.WriteHeader(statusCode)
@@ -130,21 +425,45 @@ func (s *httpServer) connectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	l = l.With().Str("template", template).Logger()
 
-	f, ok := links.ConnectionHandlers[template]
-	if !ok {
-		l.Warn().Msg("bad request: unsupported link template for connections")
-		w.WriteHeader(http.StatusNotImplemented)
-		return
-	}
-
 	d := intlinks.LinkData{
 		ID:       id,
 		Template: template,
 		Secrets:  secrets,
 	}
 
-	w.WriteHeader(f(l.WithContext(r.Context()), d))
-	s.connections.Store(id, d)
+	w.WriteHeader(s.startConnection(l.WithContext(r.Context()), d))
+}
+
+// waitForLinkData is a health-gated variant of [thrippy.LinkCache.LinkData]:
+// if the Thrippy server is temporarily unreachable, it retries the lookup with
+// an exponential backoff, until the server's configured readiness timeout.
+// The timeout bounds the entire wait, including the retries within each lookup
+// (see [thrippy.Config]), so the caller can still respond before the server's
+// write timeout (see [validateConnectReadyTimeout]).
+func (s *httpServer) waitForLinkData(ctx context.Context, linkID string) (string, map[string]string, error) {
+	if s.connectReadyTimeout <= 0 {
+		return s.thrippyLinks.LinkData(ctx, linkID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.connectReadyTimeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	backoff := minReadyBackoff
+	for {
+		template, secrets, err := s.thrippyLinks.LinkData(ctx, linkID)
+		if !thrippy.IsTransient(err) || time.Now().Add(backoff).After(deadline) {
+			return template, secrets, err
+		}
+
+		zerolog.Ctx(ctx).Debug().Err(err).Dur("backoff", backoff).Msg("waiting for Thrippy to become available")
+		select {
+		case <-ctx.Done():
+			return template, secrets, err
+		case <-time.After(backoff):
+			backoff = min(backoff*2, maxReadyBackoff)
+		}
+	}
 }
 
 // disconnectHandler is an idempotent webhook to let users manually stop
@@ -157,7 +476,7 @@ func (s *httpServer) disconnectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	template, err := thrippy.LinkTemplate(r.Context(), s.thrippyGRPCAddr, s.thrippyCreds, id)
+	template, err := thrippy.LinkTemplate(r.Context(), s.thrippyCfg, id)
 	statusCode = checkLinkData(l, template, map[string]string{}, err)
 	if statusCode != http.StatusOK {
 		w.WriteHeader(statusCode)
@@ -165,11 +484,7 @@ func (s *httpServer) disconnectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	l = l.With().Str("template", template).Logger()
-	if _, ok := s.connections.Load(id); !ok {
-		return
-	}
-
-	w.WriteHeader(http.StatusNotImplemented)
+	w.WriteHeader(s.removeConnection(l.WithContext(r.Context()), id))
 }
 
 func connID(r *http.Request) (zerolog.Logger, string, int) {
@@ -188,7 +503,31 @@ func connID(r *http.Request) (zerolog.Logger, string, int) {
 // webhookHandler checks and processes incoming asynchronous
 // event notifications over HTTP from third-party services.
 func (s *httpServer) webhookHandler(w http.ResponseWriter, r *http.Request) {
-	l := log.With().Str("http_method", r.Method).Str("url_path", r.URL.EscapedPath()).Logger()
+	var template string
+	sr := &statusRecorder{ResponseWriter: w}
+	w = sr
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracing.Tracer().Start(ctx, "webhook", trace.WithSpanKind(trace.SpanKindServer))
+	r = r.WithContext(ctx)
+
+	defer func() {
+		statusCode := sr.statusCode()
+		metrics.WebhookRequests.WithLabelValues(template, strconv.Itoa(statusCode)).Inc()
+
+		span.SetAttributes(tracing.TemplateKey.String(template), tracing.StatusCodeKey.Int(statusCode))
+		if statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+		span.End()
+	}()
+
+	reqID := requestID(r)
+	w.Header().Set(requestIDHeader, reqID)
+	r = r.WithContext(withRequestID(r.Context(), reqID))
+
+	l := log.With().Str("request_id", reqID).Str("http_method", r.Method).
+		Str("url_path", r.URL.EscapedPath()).Logger()
 	if r.Method == http.MethodPost {
 		l = l.With().Str("content_type", r.Header.Get("Content-Type")).Logger()
 	}
@@ -200,48 +539,231 @@ func (s *httpServer) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	l = l.With().Str("link_id", linkID).Logger()
+	span.SetAttributes(tracing.LinkID(linkID))
 	if pathSuffix != "" {
 		l = l.With().Str("path_suffix", pathSuffix).Logger()
 	}
 
-	template, secrets, err := thrippy.LinkData(r.Context(), s.thrippyGRPCAddr, s.thrippyCreds, linkID)
-	if statusCode := checkLinkData(l, template, secrets, err); statusCode != http.StatusOK {
-		w.WriteHeader(statusCode)
+	// Reject disallowed sources before reading the body or querying Thrippy.
+	addr, ip := remoteAddr(r, s.trustedProxies)
+	if a := s.allowlist.Load(); a != nil && !a.allow(linkID, ip) {
+		l.Warn().Str("remote_addr", addr).Msg("forbidden: webhook source not in allowlist")
+		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	raw, decoded, err := parseBody(w, r)
-	if err != nil {
-		l.Warn().Err(err).Msg("bad request: JSON decoding error")
-		w.WriteHeader(http.StatusBadRequest)
+	// Ask third-party services to retry later, instead of failing
+	// while the server and its dependencies are still starting up.
+	if d := time.Until(s.warmupEnd); d > 0 {
+		l.Warn().Dur("retry_after", d).Msg("service unavailable: server is warming up")
+		w.Header().Set("Retry-After", retryAfter(d))
+		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 
-	r.Body = io.NopCloser(bytes.NewReader(raw))
-	_ = r.ParseForm()
+	// Throttle noisy sources before querying Thrippy or reading the body. URL
+	// verifications are exempt, so as not to block the setup of new links, but
+	// identifying them requires the link's data, so throttled requests proceed
+	// only within a small separate budget, and only verifications pass after that.
+	throttled, throttledRetry := false, time.Duration(0)
+	if ok, d := s.limiter.Load().allow(linkID, time.Now()); !ok {
+		if ok, _ := s.verifyLimiter.allow(linkID, time.Now()); !ok {
+			tooManyRequests(l, w, d)
+			return
+		}
+		throttled, throttledRetry = true, d
+	}
 
-	// Forward the request's data to a service-specific handler.
+	// Resolve the link's template first, to apply its body size limit.
+	template, secrets, err := s.linkData(r.Context(), linkID)
+	if thrippy.IsTransient(err) {
+		l.Warn().Err(err).Msg("service unavailable: Thrippy is unreachable")
+		w.Header().Set("Retry-After", retryAfter(thrippyRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if statusCode := checkLinkData(l, template, secrets, err); statusCode != http.StatusOK {
+		w.WriteHeader(statusCode)
+		return
+	}
 	l = l.With().Str("template", template).Logger()
+
+	// Reject unsupported templates and path suffixes before reading the body.
 	f, ok := links.WebhookHandlers[template]
+	if router, found := links.WebhookSuffixRouters[template]; found {
+		if f, ok = router[pathSuffix]; !ok {
+			l.Warn().Msg("bad request: unsupported path suffix for link template")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
 	if !ok {
 		l.Warn().Msg("bad request: unsupported link template for webhooks")
 		w.WriteHeader(http.StatusNotImplemented)
 		return
 	}
 
-	statusCode = f(l.WithContext(r.Context()), w, intlinks.RequestData{
+	raw, plain, decoded, err := parseBody(w, r, s.maxBody(template), s.jsonTypes)
+	if err != nil {
+		statusCode := parseBodyErrorStatus(err)
+		if statusCode == http.StatusRequestEntityTooLarge {
+			l.Warn().Err(err).Msg("bad request: body too large")
+		} else {
+			l.Warn().Err(err).Msg("bad request: JSON decoding error")
+		}
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(plain))
+	_ = r.ParseForm()
+
+	// Set configured headers before the handler writes its response.
+	for k, vs := range s.respHeaders[linkID] {
+		w.Header()[k] = append(w.Header()[k], vs...)
+	}
+
+	data := intlinks.RequestData{
+		LinkID:      linkID,
 		PathSuffix:  pathSuffix,
+		RemoteAddr:  addr,
+		RemoteIP:    ip,
 		Headers:     r.Header,
 		QueryOrForm: r.Form,
-		RawPayload:  raw,
+		RawPayload:  plain,
 		JSONPayload: decoded,
 		LinkSecrets: secrets,
-	})
+	}
+	if r.Header.Get("Content-Encoding") != "" {
+		data.EncodedPayload = raw
+	}
+
+	// Reject unauthenticated requests before they reach the handler.
+	verified := false
+	if v, ok := links.WebhookVerifiers[template]; ok {
+		if statusCode := v(l.WithContext(r.Context()), data); statusCode != http.StatusOK {
+			w.WriteHeader(statusCode)
+			return
+		}
+		verified = true
+	}
+
+	// Only authenticated URL verifications are exempt from throttling,
+	// otherwise any client could bypass it by claiming to be one.
+	if throttled && (!verified || !isVerificationRequest(decoded)) {
+		tooManyRequests(l, w, throttledRetry)
+		return
+	}
+
+	// Forward the request's data to a service-specific handler.
+	start := time.Now()
+	ctx = dispatch.WithQueue(l.WithContext(r.Context()), s.queue)
+	ctx = intlinks.ContextWithConnectionManager(ctx, connectionManager{s})
+	statusCode = f(ctx, w, data)
+	metrics.WebhookLatency.WithLabelValues(template).Observe(time.Since(start).Seconds())
+	s.writeStatus(l, sr, template, statusCode)
+}
+
+// tooManyRequests rejects a webhook request which exceeded its link's rate limit.
+func tooManyRequests(l zerolog.Logger, w http.ResponseWriter, retry time.Duration) {
+	l.Warn().Dur("retry_after", retry).Msg("too many requests: link rate limit exceeded")
+	w.Header().Set("Retry-After", retryAfter(retry))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+// writeStatus writes the status code which was returned by a link-specific
+// webhook handler, or the template's configured alternative to a 200.
+// If it's 0, the handler is supposed to have written its own response
+// already - if it didn't, this function logs a warning and optionally
+// writes an [http.StatusNoContent] instead of an implicit 200.
+func (s *httpServer) writeStatus(l zerolog.Logger, sr *statusRecorder, template string, statusCode int) {
+	if statusCode == http.StatusOK {
+		if code, ok := s.successStatuses[template]; ok {
+			statusCode = code
+		}
+	}
+
 	if statusCode != 0 {
-		w.WriteHeader(statusCode)
+		sr.WriteHeader(statusCode)
+		return
+	}
+
+	if sr.status != 0 {
+		return
+	}
+
+	l.Warn().Bool("no_content", s.noContentOnEmpty).Msg("webhook handler didn't write a response")
+	if s.noContentOnEmpty {
+		sr.WriteHeader(http.StatusNoContent)
 	}
 }
 
+// linkData returns the template and secrets of a Thrippy link, except for
+// the pseudo link of the echo template, which doesn't require Thrippy,
+// and exists only in dev mode (see [links.EnableDevTemplates]).
+func (s *httpServer) linkData(ctx context.Context, linkID string) (string, map[string]string, error) {
+	if linkID == echo.LinkID {
+		if !s.devMode {
+			return "", nil, nil // Not found.
+		}
+		return echo.Template, map[string]string{}, nil
+	}
+
+	return s.thrippyLinks.LinkData(ctx, linkID)
+}
+
+// maxBody returns the limit for HTTP webhook request bodies
+// of the given link template: its override, or the default.
+func (s *httpServer) maxBody(template string) int64 {
+	if n, ok := s.bodyLimits[template]; ok {
+		return n
+	}
+	return s.maxBodyBytes
+}
+
+// remoteAddr returns the network address of the client that sent the request,
+// and its parsed IP address (nil if it can't be parsed). The "X-Forwarded-For"
+// and "X-Real-IP" headers are honored only if the request's peer is a trusted
+// proxy, because otherwise any client can spoof them.
+//
+// Proxies append the address of their own peer to "X-Forwarded-For", but they
+// don't remove addresses which the client sent, so the client is the rightmost
+// address which isn't a trusted proxy, not necessarily the leftmost one.
+func remoteAddr(r *http.Request, proxies trustedProxies) (string, net.IP) {
+	addr, ip := r.RemoteAddr, parseHostIP(r.RemoteAddr)
+	if !proxies.contains(ip) {
+		return addr, ip
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr = strings.TrimSpace(hops[i])
+			ip = parseHostIP(addr)
+			if !proxies.contains(ip) {
+				break
+			}
+		}
+		return addr, ip
+	}
+
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		return xri, parseHostIP(xri)
+	}
+
+	return addr, ip
+}
+
+// parseHostIP parses the IP address in the given network
+// address, with or without a port, or returns nil if it can't.
+func parseHostIP(addr string) net.IP {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	return net.ParseIP(host)
+}
+
 // parseURL extracts the Thrippy link ID from the request's URL path.
 // The path may contain an opaque suffix after the ID, separated by a slash,
 // for third-party services that support/require multiple webhooks per connection.
@@ -259,7 +781,7 @@ func parseURL(r *http.Request, l zerolog.Logger) (string, string, int) {
 		suffix = parts[1]
 	}
 
-	if _, err := shortuuid.DefaultEncoder.Decode(id); err != nil {
+	if _, err := shortuuid.DefaultEncoder.Decode(id); err != nil && id != echo.LinkID {
 		l.Warn().Err(err).Msg("bad request: ID is an invalid short UUID")
 		return "", "", http.StatusNotFound
 	}
@@ -268,28 +790,156 @@ func parseURL(r *http.Request, l zerolog.Logger) (string, string, int) {
 }
 
 // parseBody tries to parse the given HTTP request body as JSON.
-// It also returns the raw payload to support authenticity checks.
-// If the request is not a POST with a JSON content type, it returns nil.
-func parseBody(w http.ResponseWriter, r *http.Request) ([]byte, map[string]any, error) {
+// It also returns the raw payload, exactly as received, to support authenticity
+// checks, and its decompressed form (identical to the raw payload if the request
+// doesn't specify a content encoding). If the request is not a POST with a JSON
+// content type (see [isJSONContent]), the decoded JSON is nil. Bodies which are
+// larger than maxBytes, before or after decompression, result in an [http.MaxBytesError].
+//
+// The body is read in a single pass, into a buffer which is pre-allocated based on
+// the request's content length, while decompressing it (if needed) into a second
+// buffer. JSON is decoded in place from the (decompressed) buffer, rather than with
+// a [json.Decoder] which streams the request body, because the latter buffers entire
+// top-level values internally, i.e. it would increase the memory usage instead of
+// reducing it. Numbers in the decoded JSON are [json.Number], not float64.
+func parseBody(w http.ResponseWriter, r *http.Request, maxBytes int64, jsonTypes []string) ([]byte, []byte, map[string]any, error) {
 	if r.Method != http.MethodPost {
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	}
 
-	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	raw := bytes.NewBuffer(make([]byte, 0, bufferSize(r.ContentLength, maxBytes)))
+	var body io.Reader = io.TeeReader(http.MaxBytesReader(w, r.Body, maxBytes), raw)
+
+	plain := raw
+	zr, err := decompressBody(r.Header.Get("Content-Encoding"), body)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	if zr != nil {
+		defer zr.Close()
+		// The decompressed size is subject to the same limit as the
+		// received body, to protect against decompression bombs.
+		plain = new(bytes.Buffer)
+		body = io.TeeReader(io.LimitReader(zr, maxBytes+1), plain)
 	}
 
-	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
-		return raw, nil, nil
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		if zr != nil && !isMaxBytesError(err) {
+			err = fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return nil, nil, nil, err
+	}
+	if int64(plain.Len()) > maxBytes {
+		return nil, nil, nil, &http.MaxBytesError{Limit: maxBytes}
+	}
+
+	isJSON, sniffed := isJSONContent(r.Header.Get("Content-Type"), jsonTypes, plain.Bytes())
+	if !isJSON {
+		return raw.Bytes(), plain.Bytes(), nil, nil
 	}
 
+	decoded, err := decodeJSON(plain.Bytes())
+	if err != nil {
+		if sniffed {
+			return raw.Bytes(), plain.Bytes(), nil, nil // Best effort.
+		}
+		return nil, nil, nil, err
+	}
+
+	return raw.Bytes(), plain.Bytes(), decoded, nil
+}
+
+// isJSONContent reports whether a request body should be decoded as JSON: if its
+// media type is one of the given types, or has a "+json" suffix (RFC 6839). Bodies
+// with other media types, except web forms, are sniffed: if they look like a JSON
+// object or array, this function reports them as JSON, but also as sniffed,
+// so decoding errors are not fatal.
+func isJSONContent(contentType string, jsonTypes []string, body []byte) (isJSON, sniffed bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		isType := func(t string) bool { return strings.EqualFold(t, mt) }
+		if slices.ContainsFunc(jsonTypes, isType) || strings.HasSuffix(mt, "+json") {
+			return true, false
+		}
+		if mt == "application/x-www-form-urlencoded" || mt == "multipart/form-data" {
+			return false, false
+		}
+	}
+
+	body = bytes.TrimLeft(body, " \t\r\n")
+	if len(body) > 0 && (body[0] == '{' || body[0] == '[') {
+		return true, true
+	}
+	return false, false
+}
+
+// decodeJSON decodes a JSON object like [json.Unmarshal], except that numbers are
+// decoded as [json.Number] instead of float64, to preserve the exact values of large
+// integers, such as 64-bit IDs, which exceed float64's 53-bit precision.
+func decodeJSON(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
 	var decoded map[string]any
-	if err := json.Unmarshal(raw, &decoded); err != nil {
-		return nil, nil, err
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	// Like [json.Unmarshal], reject anything but whitespace after the object.
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("invalid data after top-level JSON value")
+		}
+		return nil, err
 	}
 
-	return raw, decoded, nil
+	return decoded, nil
+}
+
+// bufferSize returns the initial capacity of the raw body buffer: the request's
+// declared content length, if known, but never more than the size limit.
+func bufferSize(contentLength, maxBytes int64) int64 {
+	const defaultSize = 512
+	if contentLength <= 0 {
+		return min(defaultSize, maxBytes)
+	}
+	return min(contentLength, maxBytes)
+}
+
+// decompressBody returns a reader of the decompressed form of a request body,
+// based on its "Content-Encoding" header, or nil if the body isn't compressed.
+func decompressBody(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return nil, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			if isMaxBytesError(err) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return zr, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnsupportedEncoding, encoding)
+	}
+}
+
+func isMaxBytesError(err error) bool {
+	mbe := new(http.MaxBytesError)
+	return errors.As(err, &mbe)
+}
+
+// parseBodyErrorStatus converts an error from [parseBody] into an HTTP status code.
+func parseBodyErrorStatus(err error) int {
+	if isMaxBytesError(err) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, errUnsupportedEncoding) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
 }
 
 func checkLinkData(l zerolog.Logger, template string, secrets map[string]string, err error) int {
@@ -323,7 +973,7 @@ func (s *httpServer) thrippyHandler(w http.ResponseWriter, r *http.Request) {
 	r.URL.Host = s.thrippyURL.Host
 
 	// Construct the proxy request.
-	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	ctx, cancel := context.WithTimeout(r.Context(), proxyTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, r.Method, r.URL.String(), r.Body)
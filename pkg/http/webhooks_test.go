@@ -1,15 +1,40 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
+	"maps"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/lithammer/shortuuid/v4"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	intlinks "github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/internal/tracing"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/links"
+	"github.com/tzrikka/omdient/pkg/links/echo"
+	"github.com/tzrikka/omdient/pkg/links/slack"
 )
 
 func TestBaseURL(t *testing.T) {
@@ -47,87 +72,1027 @@ func TestBaseURL(t *testing.T) {
 		},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := baseURL(tt.addr); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("baseURL() = %v, want %v", got, tt.want)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := baseURL(tt.addr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("baseURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func string2URL(rawURL string) *url.URL {
+	u, _ := url.Parse(rawURL)
+	return u
+}
+
+func TestHTTPServerReadTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		readTimeout time.Duration
+		wantErr     bool
+	}{
+		{
+			name:        "slow_body_within_timeout",
+			readTimeout: time.Second,
+		},
+		{
+			name:        "slow_body_cut_off",
+			readTimeout: 50 * time.Millisecond,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			h := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				_, err := io.ReadAll(r.Body)
+				errs <- err
+			})
+
+			s := &httpServer{readTimeout: tt.readTimeout, writeTimeout: time.Second, idleTimeout: time.Second}
+			server := s.newServer(h)
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				_ = server.Serve(lis)
+			}()
+			defer server.Close()
+
+			// Send the request body slowly.
+			conn, err := net.Dial("tcp", lis.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\n")
+			fmt.Fprint(conn, "a")
+			time.Sleep(200 * time.Millisecond)
+			fmt.Fprint(conn, "b")
+
+			if err := <-errs; (err != nil) != tt.wantErr {
+				t.Errorf("request body reading error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		noContent  bool
+		statuses   map[string]int
+		handler    func(w http.ResponseWriter) int
+		wantCode   int
+		wantBody   string
+		wantWarned bool
+	}{
+		{
+			name:     "handler_returns_status",
+			handler:  func(http.ResponseWriter) int { return http.StatusAccepted },
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name: "handler_writes_response",
+			handler: func(w http.ResponseWriter) int {
+				_, _ = w.Write([]byte("challenge"))
+				return 0
+			},
+			wantCode: http.StatusOK,
+			wantBody: "challenge",
+		},
+		{
+			name:     "configured_success_status",
+			statuses: map[string]int{"template": http.StatusNoContent},
+			handler:  func(http.ResponseWriter) int { return http.StatusOK },
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "success_status_of_other_template",
+			statuses: map[string]int{"other": http.StatusNoContent},
+			handler:  func(http.ResponseWriter) int { return http.StatusOK },
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "configured_success_status_with_failure",
+			statuses: map[string]int{"template": http.StatusNoContent},
+			handler:  func(http.ResponseWriter) int { return http.StatusForbidden },
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:       "handler_writes_nothing",
+			handler:    func(http.ResponseWriter) int { return 0 },
+			wantCode:   http.StatusOK,
+			wantWarned: true,
+		},
+		{
+			name:       "handler_writes_nothing_with_no_content",
+			noContent:  true,
+			handler:    func(http.ResponseWriter) int { return 0 },
+			wantCode:   http.StatusNoContent,
+			wantWarned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			l := zerolog.New(buf)
+
+			w := httptest.NewRecorder()
+			sr := &statusRecorder{ResponseWriter: w}
+			s := &httpServer{noContentOnEmpty: tt.noContent, successStatuses: tt.statuses}
+			s.writeStatus(l, sr, "template", tt.handler(sr))
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code: got %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q, want %q", got, tt.wantBody)
+			}
+			if warned := strings.Contains(buf.String(), `"level":"warn"`); warned != tt.wantWarned {
+				t.Errorf("warning logged = %v, want %v", warned, tt.wantWarned)
+			}
+		})
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantID     string
+		wantSuffix string
+		wantStatus int
+	}{
+		{
+			name:       "missing_id",
+			path:       "/webhook/",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid_id",
+			path:       "/webhook/111",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid_id_with_suffix",
+			path:       "/webhook/111/foo",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "valid_id",
+			path:       "/webhook/KE9jTT8u6FZW6qYKgpYoEA",
+			wantID:     "KE9jTT8u6FZW6qYKgpYoEA",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "valid_id_with_suffix",
+			path:       "/webhook/KE9jTT8u6FZW6qYKgpYoEA/foo/bar",
+			wantID:     "KE9jTT8u6FZW6qYKgpYoEA",
+			wantSuffix: "foo/bar",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", func(_ http.ResponseWriter, r *http.Request) {
+				id, suffix, status := parseURL(r, zerolog.Nop())
+				if id != tt.wantID {
+					t.Errorf("parseURL() ID: got = %q, want %q", id, tt.wantID)
+				}
+				if suffix != tt.wantSuffix {
+					t.Errorf("parseURL() suffix: got = %q, want %q", id, tt.wantID)
+				}
+				if status != tt.wantStatus {
+					t.Errorf("parseURL() status: got = %v, want %v", status, tt.wantStatus)
+				}
+			})
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.path, http.NoBody)
+			mux.ServeHTTP(httptest.NewRecorder(), r)
+		})
+	}
+}
+
+func TestWebhookHandlerResponseHeaders(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+	s.respHeaders = map[string]http.Header{id: {"Cache-Control": {"no-store"}}}
+
+	links.WebhookHandlers[testTemplate] = func(_ context.Context, w http.ResponseWriter, _ intlinks.RequestData) int {
+		w.Header().Set("X-Handler", "1")
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{
+			name: "configured_link",
+			id:   id,
+			want: "no-store",
+		},
+		{
+			name: "other_link",
+			id:   shortuuid.New(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+tt.id, strings.NewReader("{}"))
+			r.Header.Set("Content-Type", "application/json")
+			mux.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRouteMethodNotAllowed(t *testing.T) {
+	s := &httpServer{}
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), method, "/webhook/"+shortuuid.New(), http.NoBody)
+			mux.ServeHTTP(w, r)
+
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("response status code = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+			}
+			if got := w.Header().Get("Allow"); got != "GET, POST" {
+				t.Errorf("Allow header = %q, want %q", got, "GET, POST")
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerRemoteAddr(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+
+	var got intlinks.RequestData
+	links.WebhookHandlers[testTemplate] = func(_ context.Context, _ http.ResponseWriter, r intlinks.RequestData) int {
+		got = r
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	tests := []struct {
+		name     string
+		proxies  []string
+		wantAddr string
+		wantIP   string
+	}{
+		{
+			name:     "spoofed_header_ignored",
+			wantAddr: "192.0.2.1:1234",
+			wantIP:   "192.0.2.1",
+		},
+		{
+			name:     "trusted_proxy",
+			proxies:  []string{"192.0.2.0/24"},
+			wantAddr: "198.51.100.2",
+			wantIP:   "198.51.100.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := parseTrustedProxies(tt.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.trustedProxies = proxies
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id, strings.NewReader("{}"))
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("X-Forwarded-For", "203.0.113.7, 198.51.100.2")
+			mux.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got.RemoteAddr != tt.wantAddr {
+				t.Errorf("RequestData.RemoteAddr = %q, want %q", got.RemoteAddr, tt.wantAddr)
+			}
+			if got.RemoteIP.String() != tt.wantIP {
+				t.Errorf("RequestData.RemoteIP = %v, want %s", got.RemoteIP, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerAllowlist(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+
+	links.WebhookHandlers[testTemplate] = func(context.Context, http.ResponseWriter, intlinks.RequestData) int {
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	tests := []struct {
+		name     string
+		cidrs    map[string]string
+		wantCode int
+	}{
+		{
+			name:     "allowed_ip",
+			cidrs:    map[string]string{id: "198.51.100.0/24 192.0.2.0/24"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "denied_ip",
+			cidrs:    map[string]string{id: "198.51.100.0/24"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "empty_allowlist",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parseAllowlist(tt.cidrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.allowlist.Store(&a)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id, strings.NewReader("{}"))
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerEcho(t *testing.T) {
+	tests := []struct {
+		name     string
+		devMode  bool
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "production",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "dev_mode",
+			devMode:  true,
+			wantCode: http.StatusOK,
+			wantBody: `{"key":"value"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &httpServer{maxBodyBytes: DefaultMaxBodyBytes, jsonTypes: DefaultJSONContentTypes, devMode: tt.devMode}
+			if tt.devMode {
+				links.EnableDevTemplates()
+				t.Cleanup(func() { delete(links.WebhookHandlers, echo.Template) })
+			}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/echo/suffix", strings.NewReader(`{"key": "value"}`))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if body := w.Body.String(); body != tt.wantBody {
+				t.Errorf("response body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRemoteAddr(t *testing.T) {
+	proxies := []string{"192.0.2.0/24", "10.0.0.0/8"}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		proxies    []string
+		wantAddr   string
+		wantIP     net.IP
+	}{
+		{
+			name:       "ipv4",
+			remoteAddr: "192.0.2.1:1234",
+			wantAddr:   "192.0.2.1:1234",
+			wantIP:     net.ParseIP("192.0.2.1"),
+		},
+		{
+			name:       "ipv6",
+			remoteAddr: "[2001:db8::1]:1234",
+			wantAddr:   "[2001:db8::1]:1234",
+			wantIP:     net.ParseIP("2001:db8::1"),
+		},
+		{
+			name:       "invalid",
+			remoteAddr: "invalid",
+			wantAddr:   "invalid",
+		},
+		{
+			name:       "no_trusted_proxies",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"},
+			wantAddr:   "192.0.2.1:1234",
+			wantIP:     net.ParseIP("192.0.2.1"),
+		},
+		{
+			name:       "untrusted_peer",
+			remoteAddr: "198.51.100.9:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"},
+			proxies:    proxies,
+			wantAddr:   "198.51.100.9:1234",
+			wantIP:     net.ParseIP("198.51.100.9"),
+		},
+		{
+			name:       "trusted_x_forwarded_for",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": " 203.0.113.7 ", "X-Real-IP": "203.0.113.8"},
+			proxies:    proxies,
+			wantAddr:   "203.0.113.7",
+			wantIP:     net.ParseIP("203.0.113.7"),
+		},
+		{
+			name:       "multiple_trusted_proxies",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7, 10.1.2.3"},
+			proxies:    proxies,
+			wantAddr:   "203.0.113.7",
+			wantIP:     net.ParseIP("203.0.113.7"),
+		},
+		{
+			name:       "spoofed_x_forwarded_for_prefix",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1, 203.0.113.7"},
+			proxies:    proxies,
+			wantAddr:   "203.0.113.7",
+			wantIP:     net.ParseIP("203.0.113.7"),
+		},
+		{
+			name:       "spoofed_invalid_address",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1, bogus"},
+			proxies:    proxies,
+			wantAddr:   "bogus",
+		},
+		{
+			name:       "only_trusted_proxies",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1, 10.0.0.2"},
+			proxies:    proxies,
+			wantAddr:   "10.0.0.1",
+			wantIP:     net.ParseIP("10.0.0.1"),
+		},
+		{
+			name:       "trusted_x_real_ip",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.8"},
+			proxies:    proxies,
+			wantAddr:   "203.0.113.8",
+			wantIP:     net.ParseIP("203.0.113.8"),
+		},
+		{
+			name:       "trusted_without_headers",
+			remoteAddr: "192.0.2.1:1234",
+			proxies:    proxies,
+			wantAddr:   "192.0.2.1:1234",
+			wantIP:     net.ParseIP("192.0.2.1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := parseTrustedProxies(tt.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/id", http.NoBody)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			addr, ip := remoteAddr(r, ps)
+			if addr != tt.wantAddr {
+				t.Errorf("remoteAddr() address = %q, want %q", addr, tt.wantAddr)
+			}
+			if !ip.Equal(tt.wantIP) {
+				t.Errorf("remoteAddr() IP = %v, want %v", ip, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerGzipSlackEvent(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+
+	links.WebhookSuffixRouters[testTemplate] = slack.WebhookRouter()
+	links.WebhookVerifiers[testTemplate] = slack.WebhookVerifier
+	t.Cleanup(func() {
+		delete(links.WebhookSuffixRouters, testTemplate)
+		delete(links.WebhookVerifiers, testTemplate)
+	})
+
+	plain := `{"type":"event_callback","event":{"type":"app_mention","text":"hi"}}`
+	compressed := gzipString(t, plain)
+
+	tests := []struct {
+		name     string
+		signed   string
+		wantCode int
+	}{
+		{
+			name:     "signed_by_sender_before_proxy_compression",
+			signed:   plain,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "signed_by_sender_after_compression",
+			signed:   compressed,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "signed_different_body",
+			signed:   `{"type":"event_callback"}`,
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte("v0:" + ts + ":" + tt.signed))
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id+"/event", strings.NewReader(compressed))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Content-Encoding", "gzip")
+			r.Header.Set("X-Slack-Request-Timestamp", ts)
+			r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerVerifier(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+
+	var calls int
+	links.WebhookHandlers[testTemplate] = func(_ context.Context, _ http.ResponseWriter, _ intlinks.RequestData) int {
+		calls++
+		return http.StatusOK
+	}
+	links.WebhookVerifiers[testTemplate] = slack.WebhookVerifier
+	t.Cleanup(func() {
+		delete(links.WebhookHandlers, testTemplate)
+		delete(links.WebhookVerifiers, testTemplate)
+	})
+
+	body := `{"type":"event_callback"}`
+
+	tests := []struct {
+		name      string
+		secret    string
+		wantCode  int
+		wantCalls int
+	}{
+		{
+			name:      "valid_signature",
+			secret:    "secret",
+			wantCode:  http.StatusOK,
+			wantCalls: 1,
+		},
+		{
+			name:     "bad_signature",
+			secret:   "other",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write([]byte("v0:" + ts + ":" + body))
+
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id+"/event", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("X-Slack-Request-Timestamp", ts)
+			r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("webhook handler calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerTemplateBodyLimit(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+	s.bodyLimits = map[string]int64{testTemplate: 16}
+
+	links.WebhookHandlers[testTemplate] = func(_ context.Context, _ http.ResponseWriter, _ intlinks.RequestData) int {
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "within_template_limit",
+			body:     `{"a":"b"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "exceeds_template_limit",
+			body:     `{"a":"` + strings.Repeat("b", 16) + `"}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHTTPServerMaxBody(t *testing.T) {
+	s := &httpServer{maxBodyBytes: DefaultMaxBodyBytes, bodyLimits: map[string]int64{"github": 1 << 30}}
+
+	if got := s.maxBody("github"); got != 1<<30 {
+		t.Errorf("maxBody(\"github\") = %d, want %d", got, 1<<30)
+	}
+	if got := s.maxBody("slack"); got != DefaultMaxBodyBytes {
+		t.Errorf("maxBody(\"slack\") = %d, want %d", got, DefaultMaxBodyBytes)
+	}
+}
+
+func TestWebhookHandlerSuffixRouter(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+
+	handler := func(code int) intlinks.WebhookHandlerFunc {
+		return func(_ context.Context, _ http.ResponseWriter, _ intlinks.RequestData) int {
+			return code
+		}
+	}
+	links.WebhookSuffixRouters[testTemplate] = intlinks.SuffixRouter{
+		"":             handler(http.StatusOK),
+		"events":       handler(http.StatusAccepted),
+		"interactions": handler(http.StatusNoContent),
+	}
+	t.Cleanup(func() {
+		delete(links.WebhookSuffixRouters, testTemplate)
+	})
+
+	tests := []struct {
+		name     string
+		suffix   string
+		wantCode int
+	}{
+		{
+			name:     "no_suffix",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "events",
+			suffix:   "/events",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "interactions",
+			suffix:   "/interactions",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "unregistered_suffix",
+			suffix:   "/commands",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id+tt.suffix, strings.NewReader("{}"))
+			r.Header.Set("Content-Type", "application/json")
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerWarmup(t *testing.T) {
+	links.WebhookHandlers[testTemplate] = func(_ context.Context, _ http.ResponseWriter, _ intlinks.RequestData) int {
+		return http.StatusOK
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	tests := []struct {
+		name           string
+		warmupEnd      time.Duration
+		unavailable    int32
+		wantCode       int
+		wantRetryAfter string
+	}{
+		{
+			name:           "warming_up",
+			warmupEnd:      3 * time.Second,
+			wantCode:       http.StatusServiceUnavailable,
+			wantRetryAfter: "3",
+		},
+		{
+			name:      "warmed_up",
+			warmupEnd: -time.Second,
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:           "thrippy_unavailable",
+			unavailable:    1,
+			wantCode:       http.StatusServiceUnavailable,
+			wantRetryAfter: "5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := shortuuid.New()
+			m := &mockThrippy{links: map[string]bool{id: true}}
+			m.unavailable.Store(tt.unavailable)
+			s, _, _ := newTestServerWithMock(t, m, map[string]string{})
+			s.maxBodyBytes = DefaultMaxBodyBytes
+			s.warmupEnd = time.Now().Add(tt.warmupEnd)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id, strings.NewReader("{}"))
+			r.Header.Set("Content-Type", "application/json")
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After header = %q, want %q", got, tt.wantRetryAfter)
 			}
 		})
 	}
 }
 
-func string2URL(rawURL string) *url.URL {
-	u, _ := url.Parse(rawURL)
-	return u
+// trackingReader records whether a request body was read.
+type trackingReader struct {
+	io.Reader
+	read bool
 }
 
-func TestParseURL(t *testing.T) {
+func (r *trackingReader) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func TestWebhookHandlerUnsupportedTemplateSkipsBody(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+
 	tests := []struct {
-		name       string
-		path       string
-		wantID     string
-		wantSuffix string
-		wantStatus int
+		name     string
+		router   intlinks.SuffixRouter
+		wantCode int
 	}{
 		{
-			name:       "missing_id",
-			path:       "/webhook/",
-			wantStatus: http.StatusBadRequest,
-		},
-		{
-			name:       "invalid_id",
-			path:       "/webhook/111",
-			wantStatus: http.StatusNotFound,
-		},
-		{
-			name:       "invalid_id_with_suffix",
-			path:       "/webhook/111/foo",
-			wantStatus: http.StatusNotFound,
-		},
-		{
-			name:       "valid_id",
-			path:       "/webhook/KE9jTT8u6FZW6qYKgpYoEA",
-			wantID:     "KE9jTT8u6FZW6qYKgpYoEA",
-			wantStatus: http.StatusOK,
+			name:     "unsupported_template",
+			wantCode: http.StatusNotImplemented,
 		},
 		{
-			name:       "valid_id_with_suffix",
-			path:       "/webhook/KE9jTT8u6FZW6qYKgpYoEA/foo/bar",
-			wantID:     "KE9jTT8u6FZW6qYKgpYoEA",
-			wantSuffix: "foo/bar",
-			wantStatus: http.StatusOK,
+			name:     "unregistered_suffix",
+			router:   intlinks.SuffixRouter{"events": nil},
+			wantCode: http.StatusNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			if tt.router != nil {
+				links.WebhookSuffixRouters[testTemplate] = tt.router
+				t.Cleanup(func() { delete(links.WebhookSuffixRouters, testTemplate) })
+			}
+
+			body := &trackingReader{Reader: strings.NewReader("{}")}
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id+"/commands", body)
+			r.Header.Set("Content-Type", "application/json")
+
 			mux := http.NewServeMux()
-			mux.HandleFunc("/webhook/{id...}", func(_ http.ResponseWriter, r *http.Request) {
-				id, suffix, status := parseURL(r, zerolog.Nop())
-				if id != tt.wantID {
-					t.Errorf("parseURL() ID: got = %q, want %q", id, tt.wantID)
-				}
-				if suffix != tt.wantSuffix {
-					t.Errorf("parseURL() suffix: got = %q, want %q", id, tt.wantID)
-				}
-				if status != tt.wantStatus {
-					t.Errorf("parseURL() status: got = %v, want %v", status, tt.wantStatus)
-				}
-			})
+			mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
 
-			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.path, http.NoBody)
-			mux.ServeHTTP(httptest.NewRecorder(), r)
+			if w.Code != tt.wantCode {
+				t.Errorf("response status code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if body.read {
+				t.Error("request body was read")
+			}
 		})
 	}
 }
 
+func TestWebhookHandlerTracing(t *testing.T) {
+	id := shortuuid.New()
+	s, _, _ := newTestServerWithStore(t, []string{id}, nil)
+	s.maxBodyBytes = DefaultMaxBodyBytes
+	s.queue = dispatch.NewQueue(dispatch.LogDispatcher{}, 1, nil)
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	if _, err := tracing.Init(t.Context(), ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	links.WebhookHandlers[testTemplate] = func(ctx context.Context, _ http.ResponseWriter, r intlinks.RequestData) int {
+		if err := dispatch.Enqueue(ctx, dispatch.Event{LinkID: r.LinkID, LinkType: testTemplate, Type: "test"}); err != nil {
+			t.Errorf("dispatch.Enqueue() error = %v", err)
+		}
+		return http.StatusAccepted
+	}
+	t.Cleanup(func() { delete(links.WebhookHandlers, testTemplate) })
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID := "00f067aa0ba902b7"
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/webhook/"+id, strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Traceparent", "00-"+traceID+"-"+parentID+"-01")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/{id...}", s.webhookHandler)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("response status code = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if err := s.queue.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exp.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	webhook, ok := spans["webhook"]
+	if !ok {
+		t.Fatalf("webhook span not found, got %v", slices.Collect(maps.Keys(spans)))
+	}
+	if got := webhook.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("webhook span trace ID = %s, want %s", got, traceID)
+	}
+	if got := webhook.Parent.SpanID().String(); got != parentID {
+		t.Errorf("webhook span parent ID = %s, want %s", got, parentID)
+	}
+
+	wantAttrs := map[attribute.Key]attribute.Value{
+		tracing.TemplateKey:   attribute.StringValue(testTemplate),
+		tracing.LinkIDKey:     tracing.LinkID(id).Value,
+		tracing.StatusCodeKey: attribute.IntValue(http.StatusAccepted),
+	}
+	for _, kv := range webhook.Attributes {
+		if kv.Value.Emit() == id {
+			t.Errorf("webhook span attribute %q exposes the link ID", kv.Key)
+		}
+		if want, ok := wantAttrs[kv.Key]; ok {
+			if kv.Value != want {
+				t.Errorf("webhook span attribute %q = %v, want %v", kv.Key, kv.Value.Emit(), want.Emit())
+			}
+			delete(wantAttrs, kv.Key)
+		}
+	}
+	for k := range wantAttrs {
+		t.Errorf("webhook span attribute %q not found", k)
+	}
+
+	for _, name := range []string{"thrippy.LinkData", "dispatch"} {
+		child, ok := spans[name]
+		if !ok {
+			t.Errorf("%s span not found", name)
+			continue
+		}
+		if child.Parent.SpanID() != webhook.SpanContext.SpanID() {
+			t.Errorf("%s span parent ID = %s, want %s", name, child.Parent.SpanID(), webhook.SpanContext.SpanID())
+		}
+		if child.SpanContext.TraceID() != webhook.SpanContext.TraceID() {
+			t.Errorf("%s span trace ID = %s, want %s", name, child.SpanContext.TraceID(), webhook.SpanContext.TraceID())
+		}
+	}
+}
+
 func TestParseBody(t *testing.T) {
 	tests := []struct {
 		name        string
 		method      string
 		contentType string
+		encoding    string
 		body        string
+		maxBytes    int64
 		wantRaw     []byte
+		wantPlain   []byte
 		wantDecoded map[string]any
 		wantErr     bool
 	}{
@@ -140,6 +1105,7 @@ func TestParseBody(t *testing.T) {
 			method:      http.MethodPost,
 			contentType: "application/x-www-form-urlencoded",
 			body:        "key1=value1&key2=value2",
+			wantRaw:     []byte("key1=value1&key2=value2"),
 		},
 		{
 			name:        "post_json",
@@ -164,6 +1130,147 @@ func TestParseBody(t *testing.T) {
 			body:        "{invalid json}",
 			wantErr:     true,
 		},
+		{
+			name:        "post_text_json",
+			method:      http.MethodPost,
+			contentType: "text/json",
+			body:        `{"key": "value"}`,
+			wantRaw:     []byte(`{"key": "value"}`),
+			wantDecoded: map[string]any{"key": "value"},
+		},
+		{
+			name:        "post_structured_syntax_json",
+			method:      http.MethodPost,
+			contentType: "application/vnd.github+json",
+			body:        `{"key": "value"}`,
+			wantRaw:     []byte(`{"key": "value"}`),
+			wantDecoded: map[string]any{"key": "value"},
+		},
+		{
+			name:        "post_missing_content_type_with_json",
+			method:      http.MethodPost,
+			body:        ` {"key": "value"}`,
+			wantRaw:     []byte(` {"key": "value"}`),
+			wantDecoded: map[string]any{"key": "value"},
+		},
+		{
+			name:        "post_text_plain_with_json",
+			method:      http.MethodPost,
+			contentType: "text/plain; charset=utf-8",
+			body:        `{"key": "value"}`,
+			wantRaw:     []byte(`{"key": "value"}`),
+			wantDecoded: map[string]any{"key": "value"},
+		},
+		{
+			name:    "post_missing_content_type_with_json_array",
+			method:  http.MethodPost,
+			body:    `[1, 2]`,
+			wantRaw: []byte(`[1, 2]`),
+		},
+		{
+			name:    "post_missing_content_type_with_invalid_json",
+			method:  http.MethodPost,
+			body:    `{invalid json}`,
+			wantRaw: []byte(`{invalid json}`),
+		},
+		{
+			name:        "post_web_form_with_json_like_body",
+			method:      http.MethodPost,
+			contentType: "application/x-www-form-urlencoded",
+			body:        `{"key": "value"}`,
+			wantRaw:     []byte(`{"key": "value"}`),
+		},
+		{
+			name:        "post_json_with_64_bit_integer",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        `{"id": 9007199254740993, "ts": 1.5}`,
+			wantRaw:     []byte(`{"id": 9007199254740993, "ts": 1.5}`),
+			wantDecoded: map[string]any{"id": json.Number("9007199254740993"), "ts": json.Number("1.5")},
+		},
+		{
+			name:        "post_json_with_trailing_whitespace",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        "{\"key\": \"value\"}\n",
+			wantRaw:     []byte("{\"key\": \"value\"}\n"),
+			wantDecoded: map[string]any{"key": "value"},
+		},
+		{
+			name:        "post_json_with_trailing_data",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        `{"key": "value"} {}`,
+			wantErr:     true,
+		},
+		{
+			name:        "post_json_with_trailing_garbage",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        `{"key": "value"} garbage`,
+			wantErr:     true,
+		},
+		{
+			name:        "post_json_just_under_limit",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        `{"key": "value"}`,
+			maxBytes:    17,
+			wantRaw:     []byte(`{"key": "value"}`),
+			wantDecoded: map[string]any{"key": "value"},
+		},
+		{
+			name:        "post_json_over_limit",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        `{"key": "value"}`,
+			maxBytes:    15,
+			wantErr:     true,
+		},
+		{
+			name:        "post_gzip_json",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        gzipString(t, `{"key": "value"}`),
+			wantRaw:     []byte(gzipString(t, `{"key": "value"}`)),
+			wantPlain:   []byte(`{"key": "value"}`),
+			wantDecoded: map[string]any{"key": "value"},
+		},
+		{
+			name:        "post_gzip_web_form",
+			method:      http.MethodPost,
+			contentType: "application/x-www-form-urlencoded",
+			encoding:    "gzip",
+			body:        gzipString(t, "key=value"),
+			wantRaw:     []byte(gzipString(t, "key=value")),
+			wantPlain:   []byte("key=value"),
+		},
+		{
+			name:        "post_invalid_gzip",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        `{"key": "value"}`,
+			wantErr:     true,
+		},
+		{
+			name:        "post_gzip_over_limit_after_decompression",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        gzipString(t, `{"key": "`+strings.Repeat("a", 1000)+`"}`),
+			maxBytes:    100,
+			wantErr:     true,
+		},
+		{
+			name:        "post_unsupported_encoding",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			encoding:    "br",
+			body:        `{"key": "value"}`,
+			wantErr:     true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -171,9 +1278,18 @@ func TestParseBody(t *testing.T) {
 			body := io.NopCloser(strings.NewReader(tt.body))
 			r := httptest.NewRequestWithContext(t.Context(), tt.method, "/", body)
 			r.Header.Set("Content-Type", tt.contentType)
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
 			w := httptest.NewRecorder()
 
-			raw, decoded, err := parseBody(w, r)
+			if tt.maxBytes == 0 {
+				tt.maxBytes = DefaultMaxBodyBytes
+			}
+			if tt.wantPlain == nil {
+				tt.wantPlain = tt.wantRaw
+			}
+			raw, plain, decoded, err := parseBody(w, r, tt.maxBytes, DefaultJSONContentTypes)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseBody() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -181,6 +1297,9 @@ func TestParseBody(t *testing.T) {
 			if !reflect.DeepEqual(raw, tt.wantRaw) {
 				t.Errorf("parseBody() raw = %q, want %q", raw, tt.wantRaw)
 			}
+			if !reflect.DeepEqual(plain, tt.wantPlain) {
+				t.Errorf("parseBody() plain = %q, want %q", plain, tt.wantPlain)
+			}
 			if !reflect.DeepEqual(decoded, tt.wantDecoded) {
 				t.Errorf("parseBody() decoded = %v, want %v", decoded, tt.wantDecoded)
 			}
@@ -188,6 +1307,138 @@ func TestParseBody(t *testing.T) {
 	}
 }
 
+// BenchmarkParseBody measures the single-pass reading and decoding of large
+// JSON bodies, compare with [BenchmarkParseBodyBuffered] (-benchmem).
+func BenchmarkParseBody(b *testing.B) {
+	body := largeJSONBody(b)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if _, _, _, err := parseBody(httptest.NewRecorder(), r, DefaultMaxBodyBytes, DefaultJSONContentTypes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseBodyBuffered is the baseline for [BenchmarkParseBody]:
+// reading the entire body into a buffer, and then decoding it.
+func BenchmarkParseBodyBuffered(b *testing.B) {
+	body := largeJSONBody(b)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		raw, err := io.ReadAll(http.MaxBytesReader(httptest.NewRecorder(), r.Body, DefaultMaxBodyBytes))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var decoded map[string]any
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// largeJSONBody returns a JSON body which resembles a big GitHub push event.
+func largeJSONBody(b *testing.B) []byte {
+	b.Helper()
+
+	commits := make([]map[string]any, 200)
+	for i := range commits {
+		commits[i] = map[string]any{
+			"id":       fmt.Sprintf("%040d", i),
+			"message":  strings.Repeat("commit message ", 20),
+			"added":    []string{"a.go", "b.go"},
+			"modified": []string{"c.go"},
+		}
+	}
+
+	body, err := json.Marshal(map[string]any{"ref": "refs/heads/main", "commits": commits})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return body
+}
+
+func TestParseBodyErrorStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		maxBytes int64
+		want     int
+	}{
+		{
+			name:     "oversized_body",
+			body:     `{"key": "value"}`,
+			maxBytes: 10,
+			want:     http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "invalid_json",
+			body:     "{invalid json}",
+			maxBytes: DefaultMaxBodyBytes,
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:     "oversized_gzip_body",
+			body:     gzipString(t, `{"key": "`+strings.Repeat("a", 1000)+`"}`),
+			encoding: "gzip",
+			maxBytes: 100,
+			want:     http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "invalid_gzip_body",
+			body:     "{invalid gzip}",
+			encoding: "gzip",
+			maxBytes: DefaultMaxBodyBytes,
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:     "unsupported_encoding",
+			body:     `{"key": "value"}`,
+			encoding: "br",
+			maxBytes: DefaultMaxBodyBytes,
+			want:     http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := io.NopCloser(strings.NewReader(tt.body))
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", body)
+			r.Header.Set("Content-Type", "application/json")
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			_, _, _, err := parseBody(httptest.NewRecorder(), r, tt.maxBytes, DefaultJSONContentTypes)
+			if err == nil {
+				t.Fatal("parseBody() error = nil")
+			}
+			if got := parseBodyErrorStatus(err); got != tt.want {
+				t.Errorf("parseBodyErrorStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
 func TestHTTPServerThrippyHandler(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -324,3 +1575,64 @@ func mockThrippyServer(t *testing.T, wantQuery url.Values, resp *http.Response)
 		w.WriteHeader(resp.StatusCode)
 	})
 }
+
+func TestHTTPServerMetrics(t *testing.T) {
+	s := &httpServer{metrics: true}
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	metric := `omdient_webhook_requests_total{status_code="400",template=""}`
+	before := scrapeMetric(t, mux, metric)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/webhook/111", http.NoBody)
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("webhook response status code: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	if after := scrapeMetric(t, mux, metric); after != before+1 {
+		t.Errorf("%s: got %v, want %v", metric, after, before+1)
+	}
+}
+
+func TestHTTPServerWithoutMetrics(t *testing.T) {
+	s := &httpServer{}
+	mux, err := s.routes()
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", http.NoBody)
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("metrics response status code: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// scrapeMetric returns the current value of a specific metric, or 0 if it isn't reported yet.
+func scrapeMetric(t *testing.T, h http.Handler, metric string) float64 {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", http.NoBody)
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics response status code: got %d, want %d", w.Code, http.StatusOK)
+	}
+
+	for line := range strings.Lines(w.Body.String()) {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), metric+" "); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatalf("failed to parse metric value %q: %v", v, err)
+			}
+			return f
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,50 @@
+// Package echo implements a link template for local end-to-end testing of the
+// HTTP webhook pipeline, without a real Thrippy link or third-party service.
+// It doesn't verify requests, so it's available only in dev mode.
+package echo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/internal/links"
+)
+
+const (
+	// Template is the name of the echo link template.
+	Template = "echo"
+	// LinkID is a pseudo link ID which uses the echo template,
+	// instead of a real Thrippy link: "/webhook/echo[/suffix]".
+	LinkID = "echo"
+)
+
+// WebhookHandler logs all the details of the request, and echoes its decoded
+// JSON payload (or an empty JSON object) back in the response body.
+func WebhookHandler(ctx context.Context, w http.ResponseWriter, r links.RequestData) int {
+	l := zerolog.Ctx(ctx).With().Str("link_type", "echo").Str("link_medium", "webhook").Logger()
+
+	l.Info().
+		Str("path_suffix", r.PathSuffix).
+		Str("remote_addr", r.RemoteAddr).
+		Any("headers", r.Headers).
+		Any("query_or_form", r.QueryOrForm).
+		Str("raw_payload", string(r.RawPayload)).
+		Any("json_payload", r.JSONPayload).
+		Msg("echo webhook request")
+
+	payload := r.JSONPayload
+	if payload == nil {
+		payload = map[string]any{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		l.Err(err).Msg("failed to write echo response")
+	}
+
+	return 0 // Response already written.
+}
@@ -0,0 +1,44 @@
+package echo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tzrikka/omdient/internal/links"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  map[string]any
+		wantBody string
+	}{
+		{
+			name:     "json_payload",
+			payload:  map[string]any{"key": "value"},
+			wantBody: `{"key":"value"}` + "\n",
+		},
+		{
+			name:     "no_payload",
+			wantBody: "{}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			got := WebhookHandler(t.Context(), w, links.RequestData{JSONPayload: tt.payload})
+
+			if got != 0 {
+				t.Errorf("WebhookHandler() = %d, want 0", got)
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("response status code = %d, want %d", w.Code, http.StatusOK)
+			}
+			if body := w.Body.String(); body != tt.wantBody {
+				t.Errorf("response body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
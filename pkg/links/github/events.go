@@ -0,0 +1,97 @@
+package github
+
+import (
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// PushEvent is the gist of a GitHub "push" event, based on
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#push.
+type PushEvent struct {
+	Ref        string     `json:"ref"`
+	Before     string     `json:"before"`
+	After      string     `json:"after"`
+	Created    bool       `json:"created"`
+	Deleted    bool       `json:"deleted"`
+	Forced     bool       `json:"forced"`
+	Commits    []Commit   `json:"commits"`
+	Pusher     CommitUser `json:"pusher"`
+	Repository Repository `json:"repository"`
+	Sender     account    `json:"sender"`
+}
+
+type Commit struct {
+	ID        string     `json:"id"`
+	Message   string     `json:"message"`
+	Timestamp string     `json:"timestamp"`
+	URL       string     `json:"url"`
+	Author    CommitUser `json:"author"`
+}
+
+type CommitUser struct {
+	Name     string `json:"name"`
+	Email    string `json:"email,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// PullRequestEvent is the gist of a GitHub "pull_request" event, based on
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#pull_request.
+type PullRequestEvent struct {
+	Action      string      `json:"action"`
+	Number      int         `json:"number"`
+	PullRequest PullRequest `json:"pull_request"`
+	Repository  Repository  `json:"repository"`
+	Sender      account     `json:"sender"`
+}
+
+type PullRequest struct {
+	ID      int64   `json:"id"`
+	Number  int     `json:"number"`
+	State   string  `json:"state"`
+	Title   string  `json:"title"`
+	Body    string  `json:"body"`
+	HTMLURL string  `json:"html_url"`
+	Draft   bool    `json:"draft"`
+	Merged  bool    `json:"merged"`
+	User    account `json:"user"`
+	Head    Branch  `json:"head"`
+	Base    Branch  `json:"base"`
+}
+
+type Branch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+type Repository struct {
+	ID       int64   `json:"id"`
+	Name     string  `json:"name"`
+	FullName string  `json:"full_name"`
+	Private  bool    `json:"private"`
+	HTMLURL  string  `json:"html_url"`
+	Owner    account `json:"owner"`
+}
+
+// typedEvents maps well-known GitHub event types to constructors of their structs.
+var typedEvents = map[string]func() any{
+	"push":         func() any { return &PushEvent{} },
+	"pull_request": func() any { return &PullRequestEvent{} },
+}
+
+// newEvent constructs a [dispatch.Event] with a GitHub payload. If the event
+// type (from the "X-GitHub-Event" header) is well-known, the event also contains
+// its typed representation. Otherwise, only the raw payload is set.
+func newEvent(e dispatch.Event, eventType string) dispatch.Event {
+	e.LinkType = "github"
+	f, ok := typedEvents[eventType]
+	if !ok {
+		return e
+	}
+
+	typed := f()
+	if err := dispatch.Decode(e.Payload, typed); err != nil {
+		return e // Fall back to the raw payload.
+	}
+
+	e.Type, e.Typed = eventType, typed
+	return e
+}
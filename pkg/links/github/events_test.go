@@ -0,0 +1,98 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+func TestNewEvent(t *testing.T) {
+	repo := map[string]any{"id": 1, "name": "repo", "full_name": "owner/repo", "owner": map[string]any{"login": "owner"}}
+	wantRepo := Repository{ID: 1, Name: "repo", FullName: "owner/repo", Owner: account{Login: "owner"}}
+
+	tests := []struct {
+		name      string
+		eventType string
+		payload   map[string]any
+		want      any
+	}{
+		{
+			name:      "push",
+			eventType: "push",
+			payload: map[string]any{
+				"ref": "refs/heads/main", "before": "a", "after": "b",
+				"commits": []any{
+					map[string]any{"id": "b", "message": "fix", "author": map[string]any{"name": "n", "email": "e"}},
+				},
+				"pusher":     map[string]any{"name": "n", "email": "e"},
+				"repository": repo,
+				"sender":     map[string]any{"login": "user", "type": "User"},
+			},
+			want: &PushEvent{
+				Ref: "refs/heads/main", Before: "a", After: "b",
+				Commits:    []Commit{{ID: "b", Message: "fix", Author: CommitUser{Name: "n", Email: "e"}}},
+				Pusher:     CommitUser{Name: "n", Email: "e"},
+				Repository: wantRepo,
+				Sender:     account{Login: "user", Type: "User"},
+			},
+		},
+		{
+			name:      "pull_request",
+			eventType: "pull_request",
+			payload: map[string]any{
+				"action": "opened", "number": 7,
+				"pull_request": map[string]any{
+					"id": 70, "number": 7, "state": "open", "title": "t",
+					"user": map[string]any{"login": "user"},
+					"head": map[string]any{"ref": "feature", "sha": "b"},
+					"base": map[string]any{"ref": "main", "sha": "a"},
+				},
+				"repository": repo,
+			},
+			want: &PullRequestEvent{
+				Action: "opened", Number: 7,
+				PullRequest: PullRequest{
+					ID: 70, Number: 7, State: "open", Title: "t", User: account{Login: "user"},
+					Head: Branch{Ref: "feature", SHA: "b"}, Base: Branch{Ref: "main", SHA: "a"},
+				},
+				Repository: wantRepo,
+			},
+		},
+		{
+			name:      "unknown_event_type",
+			eventType: "issues",
+			payload:   map[string]any{"action": "opened"},
+		},
+		{
+			name:      "invalid_typed_event",
+			eventType: "push",
+			payload:   map[string]any{"ref": 123},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newEvent(dispatch.Event{LinkID: "link", Payload: tt.payload}, tt.eventType)
+
+			if got.LinkType != "github" {
+				t.Errorf("newEvent().LinkType = %q, want %q", got.LinkType, "github")
+			}
+			if !reflect.DeepEqual(got.Payload, tt.payload) {
+				t.Errorf("newEvent().Payload = %v, want %v", got.Payload, tt.payload)
+			}
+			if tt.want == nil {
+				if got.Type != "" || got.Typed != nil {
+					t.Errorf("newEvent() = (%q, %v), want raw payload only", got.Type, got.Typed)
+				}
+				return
+			}
+			if got.Type != tt.eventType {
+				t.Errorf("newEvent().Type = %q, want %q", got.Type, tt.eventType)
+			}
+			if !reflect.DeepEqual(got.Typed, tt.want) {
+				t.Errorf("newEvent().Typed = %+v, want %+v", got.Typed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package github
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// installationEvent is the gist of a GitHub App "installation" event, which
+// GitHub sends when a GitHub App is installed or uninstalled. See
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#installation.
+type installationEvent struct {
+	Action       string       `json:"action"`
+	Installation installation `json:"installation"`
+}
+
+type installation struct {
+	ID      int64   `json:"id"`
+	AppID   int64   `json:"app_id"`
+	Account account `json:"account"`
+}
+
+type account struct {
+	Login string `json:"login"`
+	Type  string `json:"type"`
+}
+
+// installationHandlerFunc manages the stateful connection of the link which
+// received a GitHub App "installation" event, according to the event's action.
+type installationHandlerFunc func(m links.ConnectionManager, ctx context.Context, linkID string) int
+
+// installationHandlers are the lifecycle actions which Omdient performs when
+// it receives GitHub App "installation" events, keyed by the event's action.
+var installationHandlers = map[string]installationHandlerFunc{
+	"created": links.ConnectionManager.Connect,
+	"deleted": links.ConnectionManager.Disconnect,
+}
+
+// handleInstallationEvent parses a GitHub App "installation" event, and starts
+// or stops the link's connection (where applicable) according to its action.
+// Lifecycle failures are logged, but they don't prevent event dispatching.
+func handleInstallationEvent(ctx context.Context, r links.RequestData) int {
+	l := zerolog.Ctx(ctx)
+
+	e := installationEvent{}
+	if err := dispatch.Decode(r.JSONPayload, &e); err != nil {
+		l.Warn().Err(err).Msg("bad request: invalid GitHub installation event")
+		return http.StatusBadRequest
+	}
+
+	l.Info().Str("action", e.Action).Int64("installation_id", e.Installation.ID).
+		Int64("app_id", e.Installation.AppID).Str("account", e.Installation.Account.Login).
+		Msg("GitHub App installation event")
+
+	f, ok := installationHandlers[e.Action]
+	if !ok {
+		return http.StatusOK
+	}
+
+	m := links.ConnectionManagerFromContext(ctx)
+	if m == nil {
+		l.Warn().Str("action", e.Action).Msg("can't manage link connection: no connection manager")
+		return http.StatusOK
+	}
+
+	switch statusCode := f(m, ctx, r.LinkID); statusCode {
+	case http.StatusOK:
+		l.Info().Str("action", e.Action).Msg("managed link connection after GitHub installation event")
+	case http.StatusNotImplemented:
+		l.Debug().Str("action", e.Action).Msg("link template doesn't support connections")
+	default:
+		l.Warn().Str("action", e.Action).Int("status_code", statusCode).
+			Msg("failed to manage link connection after GitHub installation event")
+	}
+
+	return http.StatusOK
+}
@@ -11,17 +11,26 @@ import (
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/dispatch"
 )
 
 const (
 	contentTypeHeader = "Content-Type"
+	eventHeader       = "X-GitHub-Event"
 	signatureHeader   = "X-Hub-Signature-256"
 )
 
+// WebhookVerifier checks the HMAC signature of GitHub webhook deliveries.
+func WebhookVerifier(ctx context.Context, r links.RequestData) int {
+	l := zerolog.Ctx(ctx).With().Str("link_type", "github").Str("link_medium", "webhook").Logger()
+	return checkSignatureHeader(l, r)
+}
+
 func WebhookHandler(ctx context.Context, w http.ResponseWriter, r links.RequestData) int {
 	l := zerolog.Ctx(ctx).With().Str("link_type", "github").Str("link_medium", "webhook").Logger()
 
@@ -30,21 +39,24 @@ func WebhookHandler(ctx context.Context, w http.ResponseWriter, r links.RequestD
 		return statusCode
 	}
 
-	statusCode = checkSignatureHeader(l, r)
-	if statusCode != http.StatusOK {
-		return statusCode
-	}
-
 	// If the payload is a web form, convert it to JSON.
 	if r.Headers.Get(contentTypeHeader) == "application/x-www-form-urlencoded" {
 		reader := strings.NewReader(r.QueryOrForm.Get("payload"))
-		if err := json.NewDecoder(reader).Decode(&r.JSONPayload); err != nil {
+		dec := json.NewDecoder(reader)
+		dec.UseNumber()
+		if err := dec.Decode(&r.JSONPayload); err != nil {
 			l.Err(err).Msg("failed to extract and decode JSON payload from form data")
 			return http.StatusInternalServerError
 		}
 	}
 
-	// TBD: Dispatch the event notification data to...?
+	// https://docs.github.com/en/webhooks/webhook-events-and-payloads#installation
+	if r.Headers.Get(eventHeader) == "installation" {
+		if statusCode := handleInstallationEvent(l.WithContext(ctx), r); statusCode != http.StatusOK {
+			return statusCode
+		}
+	}
+
 	l.Debug().
 		Any("path_suffix", r.PathSuffix).
 		Any("headers", r.Headers).
@@ -52,6 +64,12 @@ func WebhookHandler(ctx context.Context, w http.ResponseWriter, r links.RequestD
 		Any("json_payload", r.JSONPayload).
 		Send()
 
+	e := newEvent(dispatch.Event{LinkID: r.LinkID, ReceivedAt: time.Now(), Payload: r.JSONPayload}, r.Headers.Get(eventHeader))
+	if err := dispatch.Enqueue(ctx, e); err != nil {
+		l.Err(err).Msg("failed to enqueue event for dispatching")
+		return http.StatusServiceUnavailable
+	}
+
 	return http.StatusOK
 }
 
@@ -81,7 +99,8 @@ func checkSignatureHeader(l zerolog.Logger, r links.RequestData) int {
 		return http.StatusInternalServerError
 	}
 
-	if !verifySignature(l, secret, sig, r.RawPayload) {
+	if !verifySignature(l, secret, sig, r.RawPayload) &&
+		(r.EncodedPayload == nil || !verifySignature(l, secret, sig, r.EncodedPayload)) {
 		l.Warn().Str("signature", sig).Bool("has_signing_secret", secret != "").
 			Msg("signature verification failed")
 		return http.StatusForbidden
@@ -0,0 +1,143 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/tzrikka/omdient/internal/links"
+)
+
+// fakeConnectionManager records the lifecycle actions of link connections.
+type fakeConnectionManager struct {
+	actions []string
+}
+
+func (f *fakeConnectionManager) Connect(_ context.Context, linkID string) int {
+	f.actions = append(f.actions, "connect "+linkID)
+	return http.StatusOK
+}
+
+func (f *fakeConnectionManager) Disconnect(_ context.Context, linkID string) int {
+	f.actions = append(f.actions, "disconnect "+linkID)
+	return http.StatusOK
+}
+
+func TestWebhookHandlerInstallationEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantStatus  int
+		wantActions []string
+	}{
+		{
+			name:        "installation_created",
+			payload:     `{"action": "created", "installation": {"id": 123, "app_id": 456, "account": {"login": "octocat"}}}`,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{"connect link"},
+		},
+		{
+			name:        "installation_deleted",
+			payload:     `{"action": "deleted", "installation": {"id": 123, "app_id": 456, "account": {"login": "octocat"}}}`,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{"disconnect link"},
+		},
+		{
+			name:       "installation_suspended",
+			payload:    `{"action": "suspend", "installation": {"id": 123, "app_id": 456, "account": {"login": "octocat"}}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid_installation",
+			payload:    `{"action": "created", "installation": {"id": "123"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &fakeConnectionManager{}
+			ctx := links.ContextWithConnectionManager(t.Context(), m)
+
+			r := signedRequest(t, "installation", tt.payload)
+			r.LinkID = "link"
+			if status := WebhookHandler(ctx, httptest.NewRecorder(), r); status != tt.wantStatus {
+				t.Fatalf("WebhookHandler() = %d, want %d", status, tt.wantStatus)
+			}
+
+			if !reflect.DeepEqual(m.actions, tt.wantActions) {
+				t.Errorf("connection actions = %v, want %v", m.actions, tt.wantActions)
+			}
+		})
+	}
+}
+
+func TestWebhookVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(r *links.RequestData)
+		wantCode int
+	}{
+		{
+			name:     "valid_signature",
+			modify:   func(*links.RequestData) {},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "missing_signature",
+			modify:   func(r *links.RequestData) { r.Headers.Del(signatureHeader) },
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "wrong_secret",
+			modify:   func(r *links.RequestData) { r.LinkSecrets["webhook_secret"] = "other" },
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "missing_secret",
+			modify:   func(r *links.RequestData) { delete(r.LinkSecrets, "webhook_secret") },
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signedRequest(t, "push", `{"ref": "refs/heads/main"}`)
+			tt.modify(&r)
+			if got := WebhookVerifier(t.Context(), r); got != tt.wantCode {
+				t.Errorf("WebhookVerifier() = %d, want %d", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func signedRequest(t *testing.T, event, payload string) links.RequestData {
+	t.Helper()
+
+	secret := "secret"
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	decoded := map[string]any{}
+	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := http.Header{}
+	hs.Set(contentTypeHeader, "application/json")
+	hs.Set(eventHeader, event)
+	hs.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	return links.RequestData{
+		Headers:     hs,
+		RawPayload:  []byte(payload),
+		JSONPayload: decoded,
+		LinkSecrets: map[string]string{"webhook_secret": secret},
+	}
+}
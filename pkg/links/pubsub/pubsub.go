@@ -0,0 +1,208 @@
+// Package pubsub implements a stateful connection which receives asynchronous
+// event notifications from a [Google Cloud Pub/Sub] subscription.
+//
+// Thrippy links of this type must have a "project_id" and a "subscription_id",
+// and credentials which can be refreshed: either a "service_account_key" (JSON),
+// or an OAuth "refresh_token" with its "client_id" and "client_secret" (and
+// optionally the current "access_token" and its "expiry" in RFC 3339 format).
+// Credentials aren't required if the "PUBSUB_EMULATOR_HOST" environment
+// variable is set (https://cloud.google.com/pubsub/docs/emulator).
+//
+// [Google Cloud Pub/Sub]: https://cloud.google.com/pubsub/docs/pull
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/rs/zerolog"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+
+	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+)
+
+const (
+	// LinkType identifies this package's events (see [dispatch.Event.LinkType]).
+	LinkType = "gcp-pubsub"
+
+	emulatorHostEnvVar = "PUBSUB_EMULATOR_HOST"
+
+	// maxOutstanding limits the number of received messages which aren't (n)acked
+	// yet, i.e. waiting in the dispatch queue. The client library extends their
+	// ack deadlines while they wait, so they aren't redelivered prematurely.
+	maxOutstanding = 100
+
+	// Delay before nacking a message which can't be enqueued for dispatching,
+	// i.e. before its redelivery, to avoid a busy loop while the queue is full.
+	enqueueBackoff = time.Second
+)
+
+// ConnectionHandler starts receiving messages from the link's Pub/Sub subscription,
+// and dispatches them as events. Messages are acknowledged after their events are
+// dispatched successfully, and negatively acknowledged (for immediate redelivery)
+// if they fail to be dispatched, so they're never lost.
+func ConnectionHandler(ctx context.Context, data links.LinkData) int {
+	l := zerolog.Ctx(ctx).With().Str("link_type", LinkType).Str("link_medium", "pubsub").
+		Str("subscription", data.Secrets["subscription_id"]).Logger()
+
+	// The subscriber outlives the caller, e.g. an HTTP request, but keeps its context's values.
+	runCtx, cancel := context.WithCancel(l.WithContext(context.WithoutCancel(ctx)))
+
+	opts, err := clientOptions(runCtx, data.Secrets, os.Getenv(emulatorHostEnvVar))
+	if err != nil {
+		cancel()
+		l.Warn().Err(err).Msg("Thrippy link missing required credentials")
+		return http.StatusForbidden
+	}
+
+	c, err := pubsub.NewClient(runCtx, data.Secrets["project_id"], opts...)
+	if err != nil {
+		cancel()
+		l.Err(err).Msg("failed to initialize Pub/Sub client")
+		return http.StatusInternalServerError
+	}
+
+	sub := c.Subscriber(data.Secrets["subscription_id"])
+	sub.ReceiveSettings.MaxOutstandingMessages = maxOutstanding
+	s := &subscriber{sub: sub, linkID: data.ID, q: dispatch.FromContext(ctx)}
+
+	receivers.RegisterStop(ctx, receivers.StopFunc(cancel))
+	go func() {
+		s.run(runCtx)
+		_ = c.Close()
+	}()
+
+	return http.StatusOK
+}
+
+// clientOptions returns the options of a Pub/Sub client, based on the link's
+// secrets. The client library connects to the emulator without credentials.
+func clientOptions(ctx context.Context, secrets map[string]string, emulatorHost string) ([]option.ClientOption, error) {
+	if secrets["project_id"] == "" || secrets["subscription_id"] == "" {
+		return nil, errors.New("missing project ID or subscription ID")
+	}
+	if emulatorHost != "" {
+		return nil, nil
+	}
+
+	ts, err := tokenSource(ctx, secrets)
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithTokenSource(ts)}, nil
+}
+
+// tokenSource returns an OAuth token source which refreshes access tokens
+// before they expire, based on a service account key or a refresh token.
+func tokenSource(ctx context.Context, secrets map[string]string) (oauth2.TokenSource, error) {
+	if key := secrets["service_account_key"]; key != "" {
+		cfg, err := google.JWTConfigFromJSON([]byte(key), pubsub.ScopePubSub)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account key: %w", err)
+		}
+		return cfg.TokenSource(ctx), nil
+	}
+
+	id, secret, refresh := secrets["client_id"], secrets["client_secret"], secrets["refresh_token"]
+	if id == "" || secret == "" || refresh == "" {
+		return nil, errors.New("missing service account key or OAuth refresh token")
+	}
+
+	cfg := &oauth2.Config{
+		ClientID:     id,
+		ClientSecret: secret,
+		Endpoint:     google.Endpoint,
+		Scopes:       []string{pubsub.ScopePubSub},
+	}
+
+	// If the access token's expiry is unknown, it's refreshed before its first use.
+	t := &oauth2.Token{AccessToken: secrets["access_token"], RefreshToken: refresh, Expiry: time.Now()}
+	if expiry, err := time.Parse(time.RFC3339, secrets["expiry"]); err == nil {
+		t.Expiry = expiry
+	}
+
+	return cfg.TokenSource(ctx, t), nil
+}
+
+// subscriber receives messages from a Pub/Sub subscription, and dispatches them.
+type subscriber struct {
+	sub    *pubsub.Subscriber
+	linkID string
+	q      *dispatch.Queue
+}
+
+// run receives and dispatches messages until the context is canceled, i.e. until
+// the connection is stopped. The client library retries transient errors, so
+// it returns early only after non-retryable ones, e.g. a deleted subscription.
+func (s *subscriber) run(ctx context.Context) {
+	l := zerolog.Ctx(ctx)
+	l.Info().Msg("receiving messages from Pub/Sub subscription")
+
+	if err := s.sub.Receive(ctx, s.receive); err != nil {
+		l.Err(err).Msg("failed to receive Pub/Sub messages")
+		return
+	}
+	l.Info().Msg("Pub/Sub subscription stopped")
+}
+
+// receive enqueues a single message for dispatching. It's acknowledged or nacked
+// asynchronously, after the result of its dispatching is known. Messages which
+// can't be enqueued are nacked after a short delay.
+func (s *subscriber) receive(ctx context.Context, m *pubsub.Message) {
+	err := s.q.EnqueueFunc(newEvent(s.linkID, m), func(err error) {
+		if err != nil {
+			m.Nack()
+			return
+		}
+		m.Ack()
+	})
+	if err == nil {
+		return
+	}
+
+	zerolog.Ctx(ctx).Err(err).Str("message_id", m.ID).Msg("failed to enqueue Pub/Sub message for dispatching")
+	select {
+	case <-ctx.Done():
+	case <-time.After(enqueueBackoff):
+	}
+	m.Nack()
+}
+
+// newEvent converts a Pub/Sub message into an event. If the message's data
+// is valid JSON, it's decoded in the payload, otherwise it's a string.
+func newEvent(linkID string, m *pubsub.Message) dispatch.Event {
+	attrs := make(map[string]any, len(m.Attributes))
+	for k, v := range m.Attributes {
+		attrs[k] = v
+	}
+
+	var data any = string(m.Data)
+	if json.Valid(m.Data) {
+		dec := json.NewDecoder(bytes.NewReader(m.Data))
+		dec.UseNumber()
+		_ = dec.Decode(&data)
+	}
+
+	payload := map[string]any{
+		"message_id":   m.ID,
+		"publish_time": m.PublishTime.Format(time.RFC3339Nano),
+		"attributes":   attrs,
+		"data":         data,
+	}
+	if m.OrderingKey != "" {
+		payload["ordering_key"] = m.OrderingKey
+	}
+
+	return dispatch.Event{LinkID: linkID, LinkType: LinkType, ReceivedAt: time.Now(), Payload: payload}
+}
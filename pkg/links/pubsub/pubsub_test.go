@@ -0,0 +1,274 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	pb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/v2/pstest"
+
+	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+)
+
+// recordingDispatcher records delivered events, and fails
+// to deliver events whose data is the string "fail".
+type recordingDispatcher struct {
+	mu     sync.Mutex
+	events []dispatch.Event
+}
+
+func (r *recordingDispatcher) Dispatch(_ context.Context, e dispatch.Event) error {
+	if e.Payload["data"] == "fail" {
+		return errors.New("delivery error")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestClientOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		secrets      map[string]string
+		emulatorHost string
+		wantOpts     int
+		wantErr      bool
+	}{
+		{
+			name: "oauth_refresh_token",
+			secrets: map[string]string{
+				"project_id": "p", "subscription_id": "s",
+				"client_id": "id", "client_secret": "secret", "refresh_token": "r",
+			},
+			wantOpts: 1,
+		},
+		{
+			name:         "emulator",
+			secrets:      map[string]string{"project_id": "p", "subscription_id": "s"},
+			emulatorHost: "localhost:8085",
+		},
+		{
+			name:    "static_access_token",
+			secrets: map[string]string{"project_id": "p", "subscription_id": "s", "access_token": "t"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_service_account_key",
+			secrets: map[string]string{"project_id": "p", "subscription_id": "s", "service_account_key": "{}"},
+			wantErr: true,
+		},
+		{
+			name:    "missing_subscription_id",
+			secrets: map[string]string{"project_id": "p", "refresh_token": "r"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clientOptions(t.Context(), tt.secrets, tt.emulatorHost)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.wantOpts {
+				t.Errorf("clientOptions() = %d options, want %d", len(got), tt.wantOpts)
+			}
+		})
+	}
+}
+
+func TestTokenSourceRefresh(t *testing.T) {
+	var n atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Tokens which expire within the refresh window are refreshed before each use.
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("token-%d", n.Add(1)),
+			"token_type":   "Bearer",
+			"expires_in":   1,
+		})
+	}))
+	defer ts.Close()
+
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "omdient@p.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})),
+		"token_uri":    ts.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := tokenSource(t.Context(), map[string]string{"service_account_key": string(key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"token-1", "token-2"} {
+		tok, err := src.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.AccessToken != want {
+			t.Errorf("Token() = %q, want %q", tok.AccessToken, want)
+		}
+	}
+}
+
+func TestConnectionHandlerMissingSecrets(t *testing.T) {
+	t.Setenv(emulatorHostEnvVar, "")
+	data := links.LinkData{ID: "id", Template: LinkType, Secrets: map[string]string{}}
+	if got := ConnectionHandler(t.Context(), data); got != http.StatusForbidden {
+		t.Errorf("ConnectionHandler() = %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+// TestConnectionHandler uses a fake Pub/Sub server, as a local emulator.
+func TestConnectionHandler(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+	t.Setenv(emulatorHostEnvVar, srv.Addr)
+
+	topic := "projects/p/topics/t"
+	if _, err := srv.GServer.CreateTopic(t.Context(), &pb.Topic{Name: topic}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := srv.GServer.CreateSubscription(t.Context(), &pb.Subscription{
+		Name: "projects/p/subscriptions/s", Topic: topic, AckDeadlineSeconds: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := srv.Publish(topic, []byte(`{"n":1}`), map[string]string{"k": "v"})
+	fail := srv.Publish(topic, []byte("fail"), nil)
+
+	d := &recordingDispatcher{}
+	q := dispatch.NewQueue(d, 10, func(dispatch.Event, error) {})
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+
+	var stop receivers.StopFunc
+	ctx := receivers.ContextWithStopper(dispatch.WithQueue(t.Context(), q), func(f receivers.StopFunc) {
+		stop = f
+	})
+
+	data := links.LinkData{ID: "link", Template: LinkType, Secrets: map[string]string{"project_id": "p", "subscription_id": "s"}}
+	if got := ConnectionHandler(ctx, data); got != http.StatusOK {
+		t.Fatalf("ConnectionHandler() = %d, want %d", got, http.StatusOK)
+	}
+	if stop == nil {
+		t.Fatal("ConnectionHandler() didn't register a stop function")
+	}
+
+	// The successful message is acknowledged, the failing one is nacked (and redelivered).
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if srv.Message(ok).Acks > 0 && nacked(srv.Message(fail)) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	if got := srv.Message(ok).Acks; got != 1 {
+		t.Errorf("acks of successful message = %d, want 1", got)
+	}
+	if m := srv.Message(fail); m.Acks != 0 || !nacked(m) {
+		t.Errorf("failing message: acks = %d, modacks = %v, want a nack", m.Acks, m.Modacks)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.events) != 1 {
+		t.Fatalf("dispatched events = %d, want 1", len(d.events))
+	}
+	if e := d.events[0]; e.LinkID != "link" || e.LinkType != LinkType {
+		t.Errorf("dispatched event = %+v", e)
+	}
+}
+
+// nacked reports whether a message's ack deadline was reset
+// to 0 by the client library, i.e. whether it was nacked.
+func nacked(m *pstest.Message) bool {
+	for _, ma := range m.Modacks {
+		if ma.AckDeadline == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewEvent(t *testing.T) {
+	publishTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		msg  *pubsub.Message
+		want map[string]any
+	}{
+		{
+			name: "json_data",
+			msg: &pubsub.Message{
+				ID:          "1",
+				PublishTime: publishTime,
+				Attributes:  map[string]string{"k": "v"},
+				Data:        []byte(`{"id":9007199254740993}`),
+			},
+			want: map[string]any{
+				"message_id":   "1",
+				"publish_time": "2025-01-02T03:04:05Z",
+				"attributes":   map[string]any{"k": "v"},
+				"data":         map[string]any{"id": json.Number("9007199254740993")},
+			},
+		},
+		{
+			name: "text_data",
+			msg: &pubsub.Message{
+				ID:          "2",
+				PublishTime: publishTime,
+				Data:        []byte("hello"),
+				OrderingKey: "key",
+			},
+			want: map[string]any{
+				"message_id":   "2",
+				"publish_time": "2025-01-02T03:04:05Z",
+				"attributes":   map[string]any{},
+				"data":         "hello",
+				"ordering_key": "key",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newEvent("link", tt.msg)
+			if got.LinkID != "link" || got.LinkType != LinkType {
+				t.Errorf("newEvent() = %+v", got)
+			}
+			if !reflect.DeepEqual(got.Payload, tt.want) {
+				t.Errorf("newEvent() payload = %#v, want %#v", got.Payload, tt.want)
+			}
+		})
+	}
+}
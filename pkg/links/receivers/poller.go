@@ -0,0 +1,193 @@
+package receivers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+const (
+	minPollBackoff = time.Second
+	maxPollBackoff = time.Minute
+	ackTimeout     = 10 * time.Second
+
+	// Buffer size of dispatching results, so dispatching
+	// doesn't wait for each message to be acknowledged.
+	pollResultsSize = 100
+)
+
+// Poller describes a stateful connection of a single Thrippy link, in which
+// Omdient long-polls batches of messages from a queue-like service (e.g.
+// Amazon SQS), instead of receiving them over a WebSocket connection.
+type Poller[M any] struct {
+	// Receive long-polls the next batch of messages, which may be empty.
+	Receive func(ctx context.Context) ([]M, error)
+	// Event converts a received message into an event for dispatching.
+	Event func(m M) dispatch.Event
+	// Ack acknowledges (e.g. deletes) a message after its event is dispatched
+	// successfully, or schedules its redelivery if the error isn't nil.
+	Ack func(ctx context.Context, m M, err error)
+
+	// Extend is called every ExtendEvery with the messages which are still
+	// waiting in the dispatch queue, to postpone their redelivery (e.g. with
+	// SQS visibility timeouts) until they're acknowledged. Optional.
+	Extend      func(ctx context.Context, msgs []M)
+	ExtendEvery time.Duration
+}
+
+// StartPoller runs the poller's receive loop in a goroutine, which stops when the
+// connection is stopped (see [RegisterStop]). Events are dispatched with the
+// [dispatch.Queue] in the given context. Messages are acknowledged asynchronously,
+// in a separate goroutine, after the results of their dispatching are known.
+func StartPoller[M any](ctx context.Context, p Poller[M]) error {
+	if p.Receive == nil || p.Event == nil || p.Ack == nil {
+		return errors.New("missing receive, event, or ack function")
+	}
+
+	// The loop outlives the caller, e.g. an HTTP request, but keeps its context's values.
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	RegisterStop(ctx, StopFunc(cancel))
+
+	go newPoller(p, dispatch.FromContext(ctx)).run(runCtx)
+	return nil
+}
+
+type poller[M any] struct {
+	Poller[M]
+	q       *dispatch.Queue
+	results chan pollResult[M]
+
+	// pending messages, which were received but not acknowledged yet.
+	mu      sync.Mutex
+	pending map[uint64]M
+	seq     uint64
+}
+
+type pollResult[M any] struct {
+	msg M
+	err error
+}
+
+func newPoller[M any](p Poller[M], q *dispatch.Queue) *poller[M] {
+	return &poller[M]{Poller: p, q: q, results: make(chan pollResult[M], pollResultsSize), pending: map[uint64]M{}}
+}
+
+// run receives and dispatches messages until the context is canceled. It backs
+// off exponentially after receive errors, and when the dispatch queue rejects events.
+func (p *poller[M]) run(ctx context.Context) {
+	l := zerolog.Ctx(ctx)
+	l.Info().Msg("polling messages")
+	go p.ackLoop(ctx)
+
+	backoff := minPollBackoff
+	for ctx.Err() == nil {
+		msgs, err := p.Receive(ctx)
+		if err == nil {
+			err = p.dispatch(ctx, msgs)
+		}
+
+		if err == nil {
+			backoff = minPollBackoff
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		l.Err(err).Dur("backoff", backoff).Msg("failed to receive or dispatch messages")
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+			backoff = min(backoff*2, maxPollBackoff)
+		}
+	}
+
+	l.Info().Msg("polling stopped")
+}
+
+// dispatch enqueues received messages for dispatching. Messages which can't
+// be enqueued are reported as failures, and the first such error is returned.
+func (p *poller[M]) dispatch(ctx context.Context, msgs []M) error {
+	var errs error
+	for _, m := range msgs {
+		id := p.track(m)
+		err := p.q.EnqueueFunc(p.Event(m), func(err error) {
+			p.report(ctx, id, err)
+		})
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("failed to enqueue message for dispatching")
+			p.report(ctx, id, err)
+			if errs == nil {
+				errs = err
+			}
+		}
+	}
+	return errs
+}
+
+// track adds a message to the pending ones, until the result of its dispatching is reported.
+func (p *poller[M]) track(m M) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	p.pending[p.seq] = m
+	return p.seq
+}
+
+// report passes the result of a dispatched message to [poller.ackLoop].
+func (p *poller[M]) report(ctx context.Context, id uint64, err error) {
+	p.mu.Lock()
+	m := p.pending[id]
+	delete(p.pending, id)
+	p.mu.Unlock()
+
+	select {
+	case p.results <- pollResult[M]{msg: m, err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// ackLoop acknowledges dispatched messages, and periodically extends the pending
+// ones, until the context is canceled. Both are done in the same goroutine, so
+// extensions never override the acknowledgements of messages.
+func (p *poller[M]) ackLoop(ctx context.Context) {
+	var tick <-chan time.Time
+	if p.Extend != nil && p.ExtendEvery > 0 {
+		t := time.NewTicker(p.ExtendEvery)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-p.results:
+			ackCtx, cancel := context.WithTimeout(ctx, ackTimeout)
+			p.Ack(ackCtx, r.msg, r.err)
+			cancel()
+		case <-tick:
+			if msgs := p.waiting(); len(msgs) > 0 {
+				p.Extend(ctx, msgs)
+			}
+		}
+	}
+}
+
+// waiting returns a snapshot of the pending messages.
+func (p *poller[M]) waiting() []M {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	msgs := make([]M, 0, len(p.pending))
+	for _, m := range p.pending {
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
@@ -0,0 +1,198 @@
+package receivers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// fakeQueue is a queue-like service which returns each message once, and
+// records the results of dispatching them, and extensions of pending messages.
+type fakeQueue struct {
+	mu       sync.Mutex
+	pending  []string
+	acked    []string
+	failed   []string
+	extended []string
+	polls    int
+}
+
+func (f *fakeQueue) receive(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	msgs := f.pending
+	f.pending = nil
+	f.polls++
+	f.mu.Unlock()
+
+	if len(msgs) == 0 {
+		// Simulate a short long-poll.
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return msgs, nil
+}
+
+func (f *fakeQueue) ack(_ context.Context, m string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err != nil {
+		f.failed = append(f.failed, m)
+	} else {
+		f.acked = append(f.acked, m)
+	}
+}
+
+func (f *fakeQueue) extend(_ context.Context, msgs []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.extended = append(f.extended, msgs...)
+}
+
+func (f *fakeQueue) poller() Poller[string] {
+	return Poller[string]{
+		Receive: f.receive,
+		Event: func(m string) dispatch.Event {
+			return dispatch.Event{LinkID: "link", LinkType: "test", Payload: map[string]any{"msg": m}}
+		},
+		Ack:         f.ack,
+		Extend:      f.extend,
+		ExtendEvery: 10 * time.Millisecond,
+	}
+}
+
+// waitFor polls a condition of the fake queue, with a timeout.
+func (f *fakeQueue) waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		f.mu.Lock()
+		done := cond()
+		f.mu.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
+
+// failingDispatcher fails to deliver events whose message is "fail".
+type failingDispatcher struct{}
+
+func (failingDispatcher) Dispatch(_ context.Context, e dispatch.Event) error {
+	if e.Payload["msg"] == "fail" {
+		return errors.New("delivery error")
+	}
+	return nil
+}
+
+// startPoller starts a poller with the given dispatch queue, and returns its stop function.
+func startPoller(t *testing.T, p Poller[string], q *dispatch.Queue) StopFunc {
+	t.Helper()
+
+	var stop StopFunc
+	ctx := ContextWithStopper(dispatch.WithQueue(t.Context(), q), func(f StopFunc) {
+		stop = f
+	})
+
+	if err := StartPoller(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if stop == nil {
+		t.Fatal("StartPoller() didn't register a stop function")
+	}
+
+	t.Cleanup(stop)
+	return stop
+}
+
+func TestStartPollerMissingFuncs(t *testing.T) {
+	if err := StartPoller(t.Context(), Poller[string]{}); err == nil {
+		t.Error("StartPoller() error = nil")
+	}
+}
+
+func TestPoller(t *testing.T) {
+	f := &fakeQueue{pending: []string{"a", "fail", "b"}}
+	q := dispatch.NewQueue(failingDispatcher{}, 10, func(dispatch.Event, error) {})
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+
+	stop := startPoller(t, f.poller(), q)
+	f.waitFor(t, func() bool { return len(f.acked)+len(f.failed) == 3 })
+	stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if want := []string{"a", "b"}; !reflect.DeepEqual(slices.Sorted(slices.Values(f.acked)), want) {
+		t.Errorf("acked messages = %v, want %v", f.acked, want)
+	}
+	if want := []string{"fail"}; !reflect.DeepEqual(f.failed, want) {
+		t.Errorf("failed messages = %v, want %v", f.failed, want)
+	}
+}
+
+func TestPollerEnqueueError(t *testing.T) {
+	f := &fakeQueue{pending: []string{"a"}}
+	q := dispatch.NewQueue(failingDispatcher{}, 0, nil)
+	_ = q.Shutdown(t.Context()) // Closed queues reject all events.
+
+	startPoller(t, f.poller(), q)
+	f.waitFor(t, func() bool { return len(f.failed) == 1 })
+}
+
+func TestPollerExtend(t *testing.T) {
+	f := &fakeQueue{pending: []string{"a"}}
+	d := make(blockingDispatcher)
+	q := dispatch.NewQueue(d, 10, func(dispatch.Event, error) {})
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+	t.Cleanup(func() { close(d) })
+
+	startPoller(t, f.poller(), q)
+
+	// The message is extended while it waits to be dispatched, and only then.
+	f.waitFor(t, func() bool { return len(f.extended) > 1 })
+	d <- struct{}{}
+	f.waitFor(t, func() bool { return len(f.acked) == 1 })
+
+	f.mu.Lock()
+	n := len(f.extended)
+	f.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.extended) != n {
+		t.Errorf("extensions after ack = %v", f.extended[n:])
+	}
+}
+
+func TestPollerStop(t *testing.T) {
+	f := &fakeQueue{}
+	q := dispatch.NewQueue(failingDispatcher{}, 10, func(dispatch.Event, error) {})
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+
+	stop := startPoller(t, f.poller(), q)
+	f.waitFor(t, func() bool { return f.polls > 0 })
+	stop()
+	time.Sleep(50 * time.Millisecond)
+
+	f.mu.Lock()
+	n := f.polls
+	f.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.polls != n {
+		t.Errorf("polls after stop = %d, want 0", f.polls-n)
+	}
+}
@@ -0,0 +1,176 @@
+// Package receivers is a reusable framework for stateful connections, in which
+// Omdient pulls asynchronous event notifications from third-party services
+// over long-lived WebSocket connections (e.g. Slack's Socket Mode), instead of
+// receiving them as HTTP webhooks. Link-specific code provides the connection
+// URLs, and parses and acknowledges incoming messages. The framework manages
+// the WebSocket client, runs the message loop, and dispatches the events.
+//
+// It also supports connections which long-poll queue-like services
+// (e.g. Amazon SQS) with a [Poller], instead of WebSocket connections.
+package receivers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/websocket"
+)
+
+// URLProvider returns the URL of a WebSocket server to connect to. It's called
+// before each new connection, so it may generate temporary URLs.
+type URLProvider = func(ctx context.Context) (string, error)
+
+// PayloadExtractor parses an incoming WebSocket data message. It returns nil
+// (without an error) for messages which don't contain an event, e.g. control
+// messages, after handling them (e.g. with [Conn.RefreshConnectionIn]).
+type PayloadExtractor func(ctx context.Context, c Conn, msg websocket.Message) (*Envelope, error)
+
+// AckFunc acknowledges the receipt of an event, for services which require it
+// (typically within a few seconds). It's called only after the event is queued
+// for dispatching, so events which can't be queued are redelivered by the service.
+type AckFunc func(ctx context.Context, c Conn, e *Envelope) error
+
+// EventFunc adds link-specific details to dispatched events,
+// e.g. their types (see [dispatch.Event.Type]).
+type EventFunc func(e dispatch.Event) dispatch.Event
+
+// Conn is the subset of [websocket.Client] which link-specific
+// functions may use, to control the connection and send messages.
+type Conn interface {
+	IncomingMessages() <-chan websocket.Message
+	RefreshConnectionIn(d time.Duration)
+	SendJSONMessage(v any) error
+}
+
+// Envelope is a single event which was extracted from a WebSocket message.
+type Envelope struct {
+	ID      string         // Service-specific, optional.
+	Payload map[string]any // Dispatched as [dispatch.Event.Payload].
+	Message any            // Service-specific decoded message, optional.
+}
+
+// Connection describes a stateful connection of a single Thrippy link.
+type Connection struct {
+	LinkID   string
+	LinkType string // E.g. "slack", in logs and dispatched events.
+
+	// ClientID identifies the connection's [websocket.Client], to reuse
+	// existing clients (see [websocket.NewOrCachedClientWithOpts]).
+	// It's typically a secret token.
+	ClientID string
+
+	URL     URLProvider
+	Extract PayloadExtractor
+	Ack     AckFunc   // Optional.
+	Event   EventFunc // Optional.
+
+	ClientOpts []websocket.ClientOpt // Optional.
+}
+
+// StopFunc stops a connection which was started by link-specific code.
+// It's idempotent, and safe to call from any goroutine.
+type StopFunc func()
+
+type stopperKey struct{}
+
+// ContextWithStopper returns a copy of the given context which carries a function
+// that receives the [StopFunc]s of connections that are started with this context
+// (see [RegisterStop]), so a connection manager can stop them later, e.g. when
+// their links are deleted.
+func ContextWithStopper(ctx context.Context, f func(StopFunc)) context.Context {
+	return context.WithValue(ctx, stopperKey{}, f)
+}
+
+// RegisterStop passes a connection's [StopFunc] to the function which was attached
+// to the given context with [ContextWithStopper], if there is one. Link-specific
+// code which doesn't use [Start] may call it directly.
+func RegisterStop(ctx context.Context, stop StopFunc) {
+	if f, ok := ctx.Value(stopperKey{}).(func(StopFunc)); ok && f != nil {
+		f(stop)
+	}
+}
+
+// Start opens (or reuses) the connection's WebSocket client, and runs its message
+// loop in a goroutine, which stops when the client is closed, or when the connection
+// is stopped (see [RegisterStop]). Events are dispatched with the [dispatch.Queue]
+// in the given context, and the client's lifecycle events are reported to it and
+// to the [websocket.LifecycleFunc] in the context, if any.
+func Start(ctx context.Context, conn Connection) error {
+	if conn.URL == nil || conn.Extract == nil {
+		return errors.New("missing URL provider or payload extractor")
+	}
+
+	q := dispatch.FromContext(ctx)
+	opts := append([]websocket.ClientOpt{
+		websocket.WithLifecycleFunc(dispatch.LifecycleFunc(q, conn.LinkID, conn.LinkType)),
+		websocket.WithLifecycleFunc(websocket.LifecycleFromContext(ctx)),
+	}, conn.ClientOpts...)
+
+	c, err := websocket.NewOrCachedClientWithOpts(ctx, conn.URL, conn.ClientID, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Stopping unsubscribes from the client, which may be shared with other links.
+	done := make(chan struct{})
+	RegisterStop(ctx, sync.OnceFunc(func() {
+		close(done)
+		c.Close()
+	}))
+
+	// The loop outlives the caller, e.g. an HTTP request, but keeps its context's values.
+	go messageLoop(context.WithoutCancel(ctx), c, conn, q, done)
+	return nil
+}
+
+// messageLoop extracts, dispatches, and acknowledges events from incoming
+// messages, until the WebSocket client is closed or the connection is stopped.
+func messageLoop(ctx context.Context, c Conn, conn Connection, q *dispatch.Queue, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			zerolog.Ctx(ctx).Info().Msg("WebSocket connection stopped")
+			return
+		case msg, ok := <-c.IncomingMessages():
+			if !ok {
+				zerolog.Ctx(ctx).Error().Msg("WebSocket client is closed")
+				return
+			}
+			handleMessage(ctx, c, conn, q, msg)
+		}
+	}
+}
+
+// handleMessage handles a single incoming WebSocket data message.
+func handleMessage(ctx context.Context, c Conn, conn Connection, q *dispatch.Queue, msg websocket.Message) {
+	l := zerolog.Ctx(ctx)
+	env, err := conn.Extract(ctx, c, msg)
+	if err != nil {
+		l.Err(err).Str("opcode", msg.Opcode.String()).Msg("failed to extract event from incoming WebSocket message")
+		return
+	}
+	if env == nil {
+		return
+	}
+
+	e := dispatch.Event{LinkID: conn.LinkID, LinkType: conn.LinkType, ReceivedAt: msg.ReceivedAt, Payload: env.Payload}
+	if conn.Event != nil {
+		e = conn.Event(e)
+	}
+	if err := q.Enqueue(e); err != nil {
+		// Don't ack the event, so the service redelivers it later.
+		l.Err(err).Str("envelope_id", env.ID).Msg("failed to enqueue event for dispatching")
+		return
+	}
+
+	if conn.Ack != nil {
+		if err := conn.Ack(ctx, c, env); err != nil {
+			l.Err(err).Str("envelope_id", env.ID).Msg("failed to ack event")
+		}
+	}
+}
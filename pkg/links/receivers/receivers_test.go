@@ -0,0 +1,281 @@
+package receivers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/websocket"
+)
+
+// fakeConn records the effects of incoming messages on a [websocket.Client].
+type fakeConn struct {
+	msgs    chan websocket.Message
+	refresh []time.Duration
+	sent    []any
+}
+
+func (f *fakeConn) IncomingMessages() <-chan websocket.Message {
+	return f.msgs
+}
+
+func (f *fakeConn) RefreshConnectionIn(d time.Duration) {
+	f.refresh = append(f.refresh, d)
+}
+
+func (f *fakeConn) SendJSONMessage(v any) error {
+	f.sent = append(f.sent, v)
+	return nil
+}
+
+// chanDispatcher sends dispatched events to a channel.
+type chanDispatcher chan dispatch.Event
+
+func (d chanDispatcher) Dispatch(_ context.Context, e dispatch.Event) error {
+	d <- e
+	return nil
+}
+
+// blockingDispatcher blocks dispatching until the channel is closed.
+type blockingDispatcher chan struct{}
+
+func (d blockingDispatcher) Dispatch(context.Context, dispatch.Event) error {
+	<-d
+	return nil
+}
+
+// fakeMessage is the JSON message format of a fake service:
+// "ping" messages refresh the connection, "event" messages
+// contain a payload, and must be acknowledged by their ID.
+type fakeMessage struct {
+	Type    string         `json:"type"`
+	ID      string         `json:"id"`
+	Payload map[string]any `json:"payload"`
+}
+
+func fakeExtract(_ context.Context, c Conn, raw websocket.Message) (*Envelope, error) {
+	var msg fakeMessage
+	if err := json.Unmarshal(raw.Data, &msg); err != nil {
+		return nil, err
+	}
+
+	if msg.Type == "ping" {
+		c.RefreshConnectionIn(time.Minute)
+		return nil, nil
+	}
+
+	return &Envelope{ID: msg.ID, Payload: msg.Payload, Message: msg}, nil
+}
+
+func fakeAck(_ context.Context, c Conn, e *Envelope) error {
+	return c.SendJSONMessage(map[string]string{"ack": e.ID})
+}
+
+func fakeConnection() Connection {
+	return Connection{
+		LinkID:   "link",
+		LinkType: "fake",
+		ClientID: "token",
+		URL:      func(context.Context) (string, error) { return "", errors.New("unused") },
+		Extract:  fakeExtract,
+		Ack:      fakeAck,
+		Event: func(e dispatch.Event) dispatch.Event {
+			e.Type = "fake_event"
+			return e
+		},
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantRefresh  bool
+		wantAck      bool
+		wantDispatch bool
+	}{
+		{
+			name:        "control_message",
+			data:        `{"type":"ping"}`,
+			wantRefresh: true,
+		},
+		{
+			name:         "event",
+			data:         `{"type":"event","id":"E1","payload":{"key":"value"}}`,
+			wantAck:      true,
+			wantDispatch: true,
+		},
+		{
+			name: "extraction_error",
+			data: `{"type":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := make(chanDispatcher, 1)
+			q := dispatch.NewQueue(d, 1, nil)
+			t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+
+			ctx := zerolog.Nop().WithContext(t.Context())
+			c := &fakeConn{}
+			now := time.Now()
+			msg := websocket.Message{Opcode: websocket.OpcodeText, Data: []byte(tt.data), ReceivedAt: now}
+			handleMessage(ctx, c, fakeConnection(), q, msg)
+
+			if got := len(c.refresh) > 0; got != tt.wantRefresh {
+				t.Errorf("connection refreshed = %v, want %v", got, tt.wantRefresh)
+			}
+			if got := len(c.sent) > 0; got != tt.wantAck {
+				t.Errorf("event acked = %v, want %v", got, tt.wantAck)
+			}
+
+			select {
+			case e := <-d:
+				if !tt.wantDispatch {
+					t.Fatalf("unexpected dispatched event: %v", e)
+				}
+				if e.LinkID != "link" || e.LinkType != "fake" || e.Type != "fake_event" {
+					t.Errorf("dispatched event = %+v", e)
+				}
+				if !e.ReceivedAt.Equal(now) || e.Payload["key"] != "value" {
+					t.Errorf("dispatched event = %+v, want received at %v with payload", e, now)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.wantDispatch {
+					t.Error("event wasn't dispatched")
+				}
+			}
+		})
+	}
+}
+
+func TestHandleMessageQueueFull(t *testing.T) {
+	d := make(blockingDispatcher)
+	q := dispatch.NewQueue(d, 1, nil)
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+	t.Cleanup(func() { close(d) })
+
+	// Fill the queue: the first event is being dispatched, the second one is buffered.
+	c := &fakeConn{}
+	for _, id := range []string{"E1", "E2", "E3"} {
+		msg := websocket.Message{Opcode: websocket.OpcodeText, Data: []byte(`{"type":"event","id":"` + id + `"}`)}
+		handleMessage(t.Context(), c, fakeConnection(), q, msg)
+		if id == "E1" {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	want := []string{"E1", "E2"}
+	if len(c.sent) != len(want) {
+		t.Fatalf("acked events = %v, want %v", c.sent, want)
+	}
+	for i, id := range want {
+		if got := c.sent[i].(map[string]string)["ack"]; got != id {
+			t.Errorf("acked event %d = %q, want %q", i, got, id)
+		}
+	}
+}
+
+func TestHandleMessageWithoutAck(t *testing.T) {
+	conn := fakeConnection()
+	conn.Ack = nil
+	conn.Event = nil
+
+	d := make(chanDispatcher, 1)
+	q := dispatch.NewQueue(d, 1, nil)
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+
+	c := &fakeConn{}
+	msg := websocket.Message{Opcode: websocket.OpcodeText, Data: []byte(`{"type":"event","payload":{}}`)}
+	handleMessage(t.Context(), c, conn, q, msg)
+
+	if len(c.sent) > 0 {
+		t.Errorf("sent messages = %v, want none", c.sent)
+	}
+	select {
+	case e := <-d:
+		if e.Type != "" {
+			t.Errorf("dispatched event type = %q, want none", e.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("event wasn't dispatched")
+	}
+}
+
+func TestMessageLoopClosed(t *testing.T) {
+	c := &fakeConn{msgs: make(chan websocket.Message, 1)}
+	c.msgs <- websocket.Message{Opcode: websocket.OpcodeText, Data: []byte(`{"type":"ping"}`)}
+	close(c.msgs)
+
+	messageLoop(t.Context(), c, fakeConnection(), nil, nil) // Returns when the channel is closed.
+
+	if len(c.refresh) != 1 {
+		t.Errorf("connection refreshes = %v, want 1", c.refresh)
+	}
+}
+
+func TestMessageLoopStopped(t *testing.T) {
+	c := &fakeConn{msgs: make(chan websocket.Message)}
+	done := make(chan struct{})
+	close(done)
+
+	messageLoop(t.Context(), c, fakeConnection(), nil, done) // Returns when the connection is stopped.
+}
+
+func TestRegisterStop(t *testing.T) {
+	RegisterStop(t.Context(), func() {}) // No-op without a stopper.
+
+	var stops []StopFunc
+	ctx := ContextWithStopper(t.Context(), func(f StopFunc) {
+		stops = append(stops, f)
+	})
+
+	stopped := false
+	RegisterStop(ctx, func() { stopped = true })
+	if len(stops) != 1 {
+		t.Fatalf("registered stop functions = %d, want 1", len(stops))
+	}
+
+	stops[0]()
+	if !stopped {
+		t.Error("registered stop function wasn't called")
+	}
+}
+
+func TestStartErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Connection)
+	}{
+		{
+			name:   "missing_url_provider",
+			modify: func(c *Connection) { c.URL = nil },
+		},
+		{
+			name:   "missing_payload_extractor",
+			modify: func(c *Connection) { c.Extract = nil },
+		},
+		{
+			name:   "url_provider_error",
+			modify: func(*Connection) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := fakeConnection()
+			conn.ClientID = tt.name // Don't reuse cached clients across test cases.
+			tt.modify(&conn)
+
+			if err := Start(t.Context(), conn); err == nil {
+				t.Error("Start() error = nil")
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package links
 
 import (
+	"maps"
+
 	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/links/echo"
 	"github.com/tzrikka/omdient/pkg/links/github"
+	"github.com/tzrikka/omdient/pkg/links/pubsub"
 	"github.com/tzrikka/omdient/pkg/links/slack"
+	"github.com/tzrikka/omdient/pkg/links/sqs"
 )
 
 // WebhookHandlers is a map of all the link-specific
@@ -12,13 +17,47 @@ var WebhookHandlers = map[string]links.WebhookHandlerFunc{
 	"github-app-jwt":  github.WebhookHandler,
 	"github-user-pat": github.WebhookHandler,
 	"github-webhook":  github.WebhookHandler,
-	"slack-bot-token": slack.WebhookHandler,
-	"slack-oauth":     slack.WebhookHandler,
-	"slack-oauth-gov": slack.WebhookHandler,
+}
+
+// WebhookSuffixRouters is a map of link templates which route webhook requests
+// to different handlers based on their URL path suffixes. They take precedence
+// over [WebhookHandlers], and requests with unregistered suffixes are rejected.
+var WebhookSuffixRouters = map[string]links.SuffixRouter{
+	"slack-bot-token": slack.WebhookRouter(),
+	"slack-oauth":     slack.WebhookRouter(),
+	"slack-oauth-gov": slack.WebhookRouter(),
+}
+
+// WebhookVerifiers is a map of the link-specific authenticity checks which run
+// before the corresponding [WebhookHandlers] (or [WebhookSuffixRouters]), so
+// unauthenticated requests are rejected uniformly, and handlers receive only
+// verified requests.
+var WebhookVerifiers = map[string]links.VerifierFunc{
+	"github-app-jwt":  github.WebhookVerifier,
+	"github-user-pat": github.WebhookVerifier,
+	"github-webhook":  github.WebhookVerifier,
+	"slack-bot-token": slack.WebhookVerifier,
+	"slack-oauth":     slack.WebhookVerifier,
+	"slack-oauth-gov": slack.WebhookVerifier,
 }
 
 // ConnectionHandlers is a map of all the link-specific
 // stateful connection handlers that Omdient supports.
 var ConnectionHandlers = map[string]links.ConnectionHandlerFunc{
+	"gcp-pubsub":        pubsub.ConnectionHandler,
 	"slack-socket-mode": slack.ConnectionHandler,
+	"sqs":               sqs.ConnectionHandler,
+}
+
+// devWebhookHandlers are link-specific stateless webhook handlers for
+// local testing, which are unsafe for production, because they don't
+// verify the authenticity of requests (see [EnableDevTemplates]).
+var devWebhookHandlers = map[string]links.WebhookHandlerFunc{
+	echo.Template: echo.WebhookHandler,
+}
+
+// EnableDevTemplates adds link templates for local testing to [WebhookHandlers].
+// Call it only in dev mode.
+func EnableDevTemplates() {
+	maps.Copy(WebhookHandlers, devWebhookHandlers)
 }
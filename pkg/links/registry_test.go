@@ -0,0 +1,23 @@
+package links
+
+import (
+	"testing"
+
+	"github.com/tzrikka/omdient/pkg/links/echo"
+)
+
+func TestEnableDevTemplates(t *testing.T) {
+	if _, ok := WebhookHandlers[echo.Template]; ok {
+		t.Fatalf("%q template is registered without dev mode", echo.Template)
+	}
+
+	EnableDevTemplates()
+	t.Cleanup(func() { delete(WebhookHandlers, echo.Template) })
+
+	if _, ok := WebhookHandlers[echo.Template]; !ok {
+		t.Errorf("%q template isn't registered in dev mode", echo.Template)
+	}
+	if _, ok := WebhookVerifiers[echo.Template]; ok {
+		t.Errorf("%q template shouldn't have a verifier", echo.Template)
+	}
+}
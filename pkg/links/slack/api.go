@@ -0,0 +1,79 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	apiBaseURL     = "https://slack.com/api/"
+	maxAPIRespSize = 64 * 1024 // 64 KiB.
+)
+
+// APIClient calls [Slack Web API methods] on behalf of a Slack app, using
+// its bot token. This is used to respond to events and interactions that
+// require more than a Socket Mode acknowledgement, e.g. posting messages
+// and opening modal views.
+//
+// [Slack Web API methods]: https://docs.slack.dev/reference/methods
+type APIClient struct {
+	baseURL  string
+	botToken string
+}
+
+// NewAPIClient returns a Slack API client based on the "bot_token" secret of
+// a Thrippy link, or an error if the link doesn't have this secret.
+func NewAPIClient(secrets map[string]string) (*APIClient, error) {
+	t := secrets["bot_token"]
+	if t == "" {
+		return nil, errors.New("Thrippy link missing Slack bot token")
+	}
+
+	return &APIClient{baseURL: apiBaseURL, botToken: t}, nil
+}
+
+// Call sends a JSON request to the given Slack API method, checks the
+// standard "ok" and "error" fields in the response, and (optionally)
+// unmarshals the full response into the given pointer. It uses the
+// [http.Client] in the context, if there is one (see [WithHTTPClient]).
+func (c *APIClient) Call(ctx context.Context, method string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode Slack API request: %w", err)
+	}
+
+	body, err = postRequest(ctx, httpClient(ctx), c.baseURL+method, c.botToken, body, maxAPIRespSize)
+	if err != nil {
+		return err
+	}
+
+	decoded := &apiResponse{}
+	if err := json.Unmarshal(body, decoded); err != nil {
+		return fmt.Errorf("failed to parse JSON in HTTP response body: %w", err)
+	}
+	if !decoded.OK {
+		return fmt.Errorf("Slack API error in %s: %s", method, decoded.Error)
+	}
+
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("failed to parse JSON in HTTP response body: %w", err)
+	}
+	return nil
+}
+
+// PostMessage sends a message to a channel, based on
+// https://docs.slack.dev/reference/methods/chat.postMessage.
+func (c *APIClient) PostMessage(ctx context.Context, req map[string]any) error {
+	return c.Call(ctx, "chat.postMessage", req, nil)
+}
+
+// OpenView opens a modal view for a user, in response to an interaction
+// with the given trigger ID, based on https://docs.slack.dev/reference/methods/views.open.
+func (c *APIClient) OpenView(ctx context.Context, triggerID string, view map[string]any) error {
+	return c.Call(ctx, "views.open", map[string]any{"trigger_id": triggerID, "view": view}, nil)
+}
@@ -0,0 +1,118 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewAPIClient(t *testing.T) {
+	if _, err := NewAPIClient(map[string]string{"app_token": "xapp"}); err == nil {
+		t.Error("NewAPIClient() without bot token: error = nil")
+	}
+	if _, err := NewAPIClient(map[string]string{"bot_token": "xoxb"}); err != nil {
+		t.Errorf("NewAPIClient() error = %v", err)
+	}
+}
+
+func TestAPIClientCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		respBody string
+		wantErr  string
+		wantTS   string
+	}{
+		{
+			name:     "ok",
+			status:   http.StatusOK,
+			respBody: `{"ok":true,"ts":"123.456"}`,
+			wantTS:   "123.456",
+		},
+		{
+			name:     "slack_error",
+			status:   http.StatusOK,
+			respBody: `{"ok":false,"error":"channel_not_found"}`,
+			wantErr:  "Slack API error in chat.postMessage: channel_not_found",
+		},
+		{
+			name:     "http_error",
+			status:   http.StatusInternalServerError,
+			respBody: "oops",
+			wantErr:  "500 Internal Server Error: oops",
+		},
+		{
+			name:     "non_json",
+			status:   http.StatusOK,
+			respBody: "<html>",
+			wantErr:  "failed to parse JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotReq map[string]any
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/chat.postMessage" {
+					t.Errorf("request = %s %s, want POST /chat.postMessage", r.Method, r.URL.Path)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer xoxb-token" {
+					t.Errorf("Authorization header = %q, want %q", got, "Bearer xoxb-token")
+				}
+				if got := r.Header.Get(contentTypeHeader); !strings.HasPrefix(got, "application/json") {
+					t.Errorf("Content-Type header = %q, want JSON", got)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+					t.Errorf("failed to decode request body: %v", err)
+				}
+
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.respBody))
+			}))
+			defer s.Close()
+
+			c := &APIClient{baseURL: s.URL + "/", botToken: "xoxb-token"}
+			resp := struct {
+				TS string `json:"ts"`
+			}{}
+			err := c.Call(t.Context(), "chat.postMessage", map[string]any{"channel": "C1", "text": "hi"}, &resp)
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Call() error = %v, want %q", err, tt.wantErr)
+			}
+			if resp.TS != tt.wantTS {
+				t.Errorf("Call() response ts = %q, want %q", resp.TS, tt.wantTS)
+			}
+			if gotReq["channel"] != "C1" || gotReq["text"] != "hi" {
+				t.Errorf("request body = %v", gotReq)
+			}
+		})
+	}
+}
+
+func TestAPIClientOpenView(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/views.open" {
+			t.Errorf("request path = %q, want %q", r.URL.Path, "/views.open")
+		}
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		if req["trigger_id"] != "T1" || req["view"] == nil {
+			t.Errorf("request body = %v", req)
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer s.Close()
+
+	c := &APIClient{baseURL: s.URL + "/", botToken: "xoxb-token"}
+	if err := c.OpenView(t.Context(), "T1", map[string]any{"type": "modal"}); err != nil {
+		t.Errorf("OpenView() error = %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package slack
+
+import (
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// MessageEvent is the gist of a Slack "message" event, based on
+// https://docs.slack.dev/reference/events/message.
+type MessageEvent struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype,omitempty"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type,omitempty"`
+	User        string `json:"user,omitempty"`
+	BotID       string `json:"bot_id,omitempty"`
+	Text        string `json:"text"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts,omitempty"`
+	EventTS     string `json:"event_ts"`
+}
+
+// AppMentionEvent is the gist of a Slack "app_mention" event, based on
+// https://docs.slack.dev/reference/events/app_mention.
+type AppMentionEvent struct {
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	User     string `json:"user"`
+	Text     string `json:"text"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts,omitempty"`
+	EventTS  string `json:"event_ts"`
+}
+
+// ReactionAddedEvent is the gist of a Slack "reaction_added" event, based on
+// https://docs.slack.dev/reference/events/reaction_added.
+type ReactionAddedEvent struct {
+	Type     string       `json:"type"`
+	User     string       `json:"user"`
+	Reaction string       `json:"reaction"`
+	ItemUser string       `json:"item_user,omitempty"`
+	Item     ReactionItem `json:"item"`
+	EventTS  string       `json:"event_ts"`
+}
+
+type ReactionItem struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	TS      string `json:"ts,omitempty"`
+}
+
+// typedEvents maps well-known Slack event types to constructors of their structs.
+var typedEvents = map[string]func() any{
+	"message":        func() any { return &MessageEvent{} },
+	"app_mention":    func() any { return &AppMentionEvent{} },
+	"reaction_added": func() any { return &ReactionAddedEvent{} },
+}
+
+// CallbackContext is the team and app context in the envelope of a Slack Events API
+// callback, which isn't part of the inner event's typed representation.
+type CallbackContext struct {
+	TeamID   string
+	APIAppID string
+	EventID  string // Unique, also in retries, e.g. to deduplicate events.
+}
+
+// EventContext returns the [CallbackContext] of a dispatched Slack event, from its
+// raw payload. It returns false if the event isn't an Events API callback.
+func EventContext(e dispatch.Event) (CallbackContext, bool) {
+	ec, ok := unwrapEventCallback(e.Payload)
+	return ec.CallbackContext, ok
+}
+
+// eventCallback is the gist of the envelope of Slack Events API callbacks, based on
+// https://docs.slack.dev/apis/events-api/#callback-field. The inner event's type
+// and fields are specific to it, so they're kept as a raw map.
+type eventCallback struct {
+	CallbackContext
+
+	EventType string
+	Event     map[string]any
+}
+
+// unwrapEventCallback extracts the inner event of an Events API callback
+// payload, along with the team and app context in its envelope. It returns
+// false if the payload isn't a callback, or if it doesn't contain an event.
+func unwrapEventCallback(payload map[string]any) (eventCallback, bool) {
+	if payload["type"] != "event_callback" {
+		return eventCallback{}, false
+	}
+
+	inner, ok := payload["event"].(map[string]any)
+	if !ok {
+		return eventCallback{}, false
+	}
+
+	ec := eventCallback{Event: inner}
+	ec.TeamID, _ = payload["team_id"].(string)
+	ec.APIAppID, _ = payload["api_app_id"].(string)
+	ec.EventID, _ = payload["event_id"].(string)
+	ec.EventType, _ = inner["type"].(string)
+	return ec, true
+}
+
+// newEvent constructs a [dispatch.Event] with a Slack payload. If the payload is
+// an Events API callback, the event's type is the inner event's type, and if it's
+// well-known, the event also contains its typed representation. The raw payload
+// is always the entire callback, including its team and app context, which
+// consumers can read with [EventContext].
+func newEvent(e dispatch.Event) dispatch.Event {
+	e.LinkType = "slack"
+	ec, ok := unwrapEventCallback(e.Payload)
+	if !ok {
+		return e
+	}
+
+	e.Type = ec.EventType
+	f, ok := typedEvents[ec.EventType]
+	if !ok {
+		return e
+	}
+
+	typed := f()
+	if err := dispatch.Decode(ec.Event, typed); err != nil {
+		return e // Fall back to the raw payload.
+	}
+
+	e.Typed = typed
+	return e
+}
@@ -0,0 +1,177 @@
+package slack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+func TestNewEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  map[string]any
+		wantType string
+		want     any
+	}{
+		{
+			name: "message",
+			payload: callback(map[string]any{
+				"type": "message", "channel": "C1", "user": "U1", "text": "hi",
+				"ts": "1.2", "event_ts": "1.2", "channel_type": "channel",
+			}),
+			wantType: "message",
+			want: &MessageEvent{
+				Type: "message", Channel: "C1", ChannelType: "channel", User: "U1",
+				Text: "hi", TS: "1.2", EventTS: "1.2",
+			},
+		},
+		{
+			name: "app_mention",
+			payload: callback(map[string]any{
+				"type": "app_mention", "channel": "C1", "user": "U1",
+				"text": "<@U2> hi", "ts": "1.2", "event_ts": "1.2",
+			}),
+			wantType: "app_mention",
+			want: &AppMentionEvent{
+				Type: "app_mention", Channel: "C1", User: "U1",
+				Text: "<@U2> hi", TS: "1.2", EventTS: "1.2",
+			},
+		},
+		{
+			name: "reaction_added",
+			payload: callback(map[string]any{
+				"type": "reaction_added", "user": "U1", "reaction": "thumbsup", "item_user": "U2",
+				"item":     map[string]any{"type": "message", "channel": "C1", "ts": "1.2"},
+				"event_ts": "1.3",
+			}),
+			wantType: "reaction_added",
+			want: &ReactionAddedEvent{
+				Type: "reaction_added", User: "U1", Reaction: "thumbsup", ItemUser: "U2",
+				Item: ReactionItem{Type: "message", Channel: "C1", TS: "1.2"}, EventTS: "1.3",
+			},
+		},
+		{
+			name:     "unknown_event_type",
+			payload:  callback(map[string]any{"type": "team_join"}),
+			wantType: "team_join",
+		},
+		{
+			name:     "invalid_typed_event",
+			payload:  callback(map[string]any{"type": "message", "text": 123}),
+			wantType: "message",
+		},
+		{
+			name:    "not_event_callback",
+			payload: map[string]any{"type": "block_actions"},
+		},
+		{
+			name:    "event_callback_without_event",
+			payload: map[string]any{"type": "event_callback"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newEvent(dispatch.Event{LinkID: "link", Payload: tt.payload})
+
+			if got.LinkType != "slack" {
+				t.Errorf("newEvent().LinkType = %q, want %q", got.LinkType, "slack")
+			}
+			if !reflect.DeepEqual(got.Payload, tt.payload) {
+				t.Errorf("newEvent().Payload = %v, want %v", got.Payload, tt.payload)
+			}
+			if got.Type != tt.wantType {
+				t.Errorf("newEvent().Type = %q, want %q", got.Type, tt.wantType)
+			}
+			if tt.want == nil {
+				if got.Typed != nil {
+					t.Errorf("newEvent().Typed = %v, want nil", got.Typed)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Typed, tt.want) {
+				t.Errorf("newEvent().Typed = %+v, want %+v", got.Typed, tt.want)
+			}
+
+			// Round-trip through Event.As.
+			target := reflect.New(reflect.TypeOf(tt.want).Elem())
+			if err := got.As(target.Interface()); err != nil {
+				t.Fatalf("Event.As() error = %v", err)
+			}
+			if !reflect.DeepEqual(target.Interface(), tt.want) {
+				t.Errorf("Event.As() = %+v, want %+v", target.Interface(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrapEventCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload map[string]any
+		want    eventCallback
+		wantOK  bool
+	}{
+		{
+			name: "event_callback",
+			payload: map[string]any{
+				"type": "event_callback", "team_id": "T1", "api_app_id": "A1", "event_id": "Ev1",
+				"event": map[string]any{"type": "app_mention", "text": "hi"},
+			},
+			want: eventCallback{
+				CallbackContext: CallbackContext{TeamID: "T1", APIAppID: "A1", EventID: "Ev1"},
+				EventType:       "app_mention",
+				Event:           map[string]any{"type": "app_mention", "text": "hi"},
+			},
+			wantOK: true,
+		},
+		{
+			name:    "event_callback_without_event",
+			payload: map[string]any{"type": "event_callback", "team_id": "T1"},
+		},
+		{
+			name:    "app_rate_limited",
+			payload: map[string]any{"type": "app_rate_limited", "team_id": "T1", "minute_rate_limited": 1518467820},
+		},
+		{
+			name:    "url_verification",
+			payload: map[string]any{"type": "url_verification", "challenge": "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := unwrapEventCallback(tt.payload)
+			if ok != tt.wantOK {
+				t.Fatalf("unwrapEventCallback() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unwrapEventCallback() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventContext(t *testing.T) {
+	payload := callback(map[string]any{"type": "message", "text": "hi"})
+	payload["api_app_id"] = "A1"
+	payload["event_id"] = "Ev1"
+	e := newEvent(dispatch.Event{LinkID: "link", Payload: payload})
+
+	got, ok := EventContext(e)
+	if !ok {
+		t.Fatal("EventContext() ok = false, want true")
+	}
+	if want := (CallbackContext{TeamID: "T1", APIAppID: "A1", EventID: "Ev1"}); got != want {
+		t.Errorf("EventContext() = %+v, want %+v", got, want)
+	}
+
+	if _, ok := EventContext(dispatch.Event{Payload: map[string]any{"type": "block_actions"}}); ok {
+		t.Error("EventContext() of non-callback ok = true, want false")
+	}
+}
+
+func callback(event map[string]any) map[string]any {
+	return map[string]any{"type": "event_callback", "team_id": "T1", "event": event}
+}
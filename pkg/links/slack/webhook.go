@@ -5,14 +5,21 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/internal/metrics"
+	"github.com/tzrikka/omdient/pkg/dispatch"
 )
 
 const (
@@ -20,44 +27,139 @@ const (
 	timestampHeader   = "X-Slack-Request-Timestamp"
 	signatureHeader   = "X-Slack-Signature"
 
-	// The maximum shift/delay that we allow between an inbound request's
+	// The default maximum shift/delay that we allow between an inbound request's
 	// timestamp, and our current timestamp, to defend against replay attacks.
 	// See https://docs.slack.dev/authentication/verifying-requests-from-slack.
-	maxDifference = 5 * time.Minute
+	//
+	// Links may override it with the [replayWindowKey] secret: a shorter window
+	// narrows the opportunity to replay captured requests, but rejects legitimate
+	// ones if the clocks of Slack and Omdient drift apart, or if requests are
+	// delayed in transit; a longer window tolerates clock skew, at the cost of
+	// a longer replay opportunity.
+	defaultMaxDifference = 5 * time.Minute
+
+	// Optional link secret which overrides [defaultMaxDifference],
+	// as a Go duration string (e.g. "90s", "10m").
+	replayWindowKey = "replay_window"
 
 	// Slack API implementation detail.
 	// See https://docs.slack.dev/authentication/verifying-requests-from-slack.
-	slackSigVersion = "v0"
+	defaultSigVersion = "v0"
+
+	// Optional link secret which overrides [defaultSigVersion], as a comma-separated
+	// list of accepted signature versions (e.g. "v0,v1"), for Slack-compatible tools.
+	sigVersionsKey = "signature_versions"
 )
 
-func WebhookHandler(ctx context.Context, w http.ResponseWriter, r links.RequestData) int {
+// baseStringFunc constructs the base string of a Slack request signature,
+// based on the signature version, the request's timestamp, and its body.
+type baseStringFunc func(version, ts string, body []byte) []byte
+
+// sigVersion returns the [baseStringFunc] of a supported signature
+// version (i.e. the prefix of the [signatureHeader] value).
+func sigVersion(version string) (baseStringFunc, bool) {
+	switch version {
+	case "v0":
+		return baseStringV0, true
+	case "v1":
+		return baseStringV1, true
+	default:
+		return nil, false
+	}
+}
+
+// WebhookVerifier checks the timestamp and signature of Slack requests
+// (https://docs.slack.dev/authentication/verifying-requests-from-slack).
+func WebhookVerifier(ctx context.Context, r links.RequestData) int {
 	l := zerolog.Ctx(ctx).With().Str("link_type", "slack").Str("link_medium", "webhook").Logger()
 
-	statusCode := checkContentTypeHeader(l, r)
-	if statusCode != http.StatusOK {
+	if statusCode := checkTimestampHeader(l, r); statusCode != http.StatusOK {
 		return statusCode
 	}
 
-	statusCode = checkTimestampHeader(l, r)
-	if statusCode != http.StatusOK {
-		return statusCode
+	return checkSignatureHeader(l, r)
+}
+
+// WebhookRouter returns the routes of Slack webhooks, by their URL path suffix:
+// Events API requests ("/webhook/{id}/event"), interactivity payloads
+// ("/webhook/{id}/interactions"), and slash commands ("/webhook/{id}/commands").
+// Requests with other suffixes are rejected (see [links.SuffixRouter]).
+func WebhookRouter() links.SuffixRouter {
+	return links.SuffixRouter{
+		"event":        eventsHandler,
+		"interactions": formHandler,
+		"commands":     formHandler,
 	}
+}
 
-	statusCode = checkSignatureHeader(l, r)
+// eventsHandler handles JSON requests from Slack's Events API.
+func eventsHandler(ctx context.Context, w http.ResponseWriter, r links.RequestData) int {
+	l := zerolog.Ctx(ctx).With().Str("link_type", "slack").Str("link_medium", "webhook").Logger()
+
+	statusCode := checkContentTypeHeader(l, r, "application/json")
 	if statusCode != http.StatusOK {
 		return statusCode
 	}
 
 	// https://docs.slack.dev/reference/events/url_verification
-	if r.PathSuffix == "event" && r.JSONPayload["type"] == "url_verification" {
+	if r.JSONPayload["type"] == "url_verification" {
+		if statusCode := checkAppID(l, r); statusCode != http.StatusOK {
+			return statusCode
+		}
+
+		challenge, ok := r.JSONPayload["challenge"].(string)
+		if !ok || challenge == "" {
+			l.Warn().Str("event_type", "url_verification").
+				Msg("bad request: missing or invalid challenge in Slack URL verification event")
+			return http.StatusBadRequest
+		}
+
 		l.Debug().Str("event_type", "url_verification").
 			Msg("replied to Slack URL verification event")
 		w.Header().Add(contentTypeHeader, "text/plain")
-		_, _ = w.Write(fmt.Append(nil, r.JSONPayload["challenge"]))
+		_, _ = w.Write([]byte(challenge))
 		return 0 // [http.StatusOK] already written by "w.Write".
 	}
 
-	// TBD: Dispatch the event notification data to...?
+	// https://docs.slack.dev/apis/events-api/#rate-limiting
+	if r.JSONPayload["type"] == "app_rate_limited" {
+		metrics.SlackAppRateLimited.Inc()
+		l.Warn().Str("event_type", "app_rate_limited").Any("team_id", r.JSONPayload["team_id"]).
+			Any("api_app_id", r.JSONPayload["api_app_id"]).
+			Any("minute_rate_limited", r.JSONPayload["minute_rate_limited"]).
+			Msg("Slack app exceeded the Events API rate limit, events are being dropped")
+		return http.StatusOK
+	}
+
+	// https://docs.slack.dev/apis/events-api/#callback-field
+	if ec, ok := unwrapEventCallback(r.JSONPayload); ok {
+		l = l.With().Str("event_type", ec.EventType).Str("event_id", ec.EventID).
+			Str("team_id", ec.TeamID).Str("api_app_id", ec.APIAppID).Logger()
+	}
+
+	return enqueue(ctx, l, r, r.JSONPayload)
+}
+
+// formHandler handles web form requests of Slack's interactivity payloads and slash commands.
+func formHandler(ctx context.Context, _ http.ResponseWriter, r links.RequestData) int {
+	l := zerolog.Ctx(ctx).With().Str("link_type", "slack").Str("link_medium", "webhook").Logger()
+
+	statusCode := checkContentTypeHeader(l, r, "application/x-www-form-urlencoded")
+	if statusCode != http.StatusOK {
+		return statusCode
+	}
+
+	// https://docs.slack.dev/interactivity/implementing-slash-commands
+	if r.QueryOrForm.Get("ssl_check") == "1" {
+		l.Debug().Msg("replied to Slack SSL check request")
+		return http.StatusOK
+	}
+
+	return enqueue(ctx, l, r, formPayload(r.QueryOrForm))
+}
+
+// enqueue queues a Slack event for dispatching, with the given payload.
+func enqueue(ctx context.Context, l zerolog.Logger, r links.RequestData, payload map[string]any) int {
 	l.Debug().
 		Any("path_suffix", r.PathSuffix).
 		Any("headers", r.Headers).
@@ -65,17 +167,41 @@ func WebhookHandler(ctx context.Context, w http.ResponseWriter, r links.RequestD
 		Any("json_payload", r.JSONPayload).
 		Send()
 
+	e := newEvent(dispatch.Event{LinkID: r.LinkID, ReceivedAt: time.Now(), Payload: payload})
+	if err := dispatch.Enqueue(ctx, e); err != nil {
+		l.Err(err).Msg("failed to enqueue event for dispatching")
+		return http.StatusServiceUnavailable
+	}
+
 	return http.StatusOK
 }
 
-func checkContentTypeHeader(l zerolog.Logger, r links.RequestData) int {
-	expected := "application/x-www-form-urlencoded"
-	if r.PathSuffix == "event" {
-		expected = "application/json"
+// formPayload converts the web form data of slash commands and interactivity
+// payloads into a JSON-like map. Interactivity payloads are JSON strings in a
+// single form field called "payload", slash commands are regular form fields.
+// See https://docs.slack.dev/interactivity/handling-user-interaction#payloads.
+func formPayload(form url.Values) map[string]any {
+	if p := form.Get("payload"); p != "" {
+		m := map[string]any{}
+		dec := json.NewDecoder(strings.NewReader(p))
+		dec.UseNumber()
+		if err := dec.Decode(&m); err == nil {
+			return m
+		}
+	}
+
+	m := make(map[string]any, len(form))
+	for k := range form {
+		m[k] = form.Get(k)
 	}
+	return m
+}
 
+// checkContentTypeHeader checks the request's media type,
+// ignoring parameters such as "charset".
+func checkContentTypeHeader(l zerolog.Logger, r links.RequestData, expected string) int {
 	v := r.Headers.Get(contentTypeHeader)
-	if v != expected {
+	if mt, _, err := mime.ParseMediaType(v); err != nil || mt != expected {
 		l.Warn().Str("header", contentTypeHeader).Str("got", v).Str("want", expected).
 			Msg("bad request: unexpected header value")
 		return http.StatusBadRequest
@@ -98,9 +224,15 @@ func checkTimestampHeader(l zerolog.Logger, r links.RequestData) int {
 		return http.StatusBadRequest
 	}
 
+	maxDiff, err := maxDifference(r.LinkSecrets)
+	if err != nil {
+		l.Warn().Err(err).Msg("invalid replay window configuration")
+		return http.StatusInternalServerError
+	}
+
 	d := time.Since(time.Unix(secs, 0))
-	if d.Abs() > maxDifference {
-		l.Warn().Str("header", timestampHeader).Dur("difference", d).
+	if d.Abs() > maxDiff {
+		l.Warn().Str("header", timestampHeader).Dur("difference", d).Dur("max_difference", maxDiff).
 			Msg("bad request: stale header value")
 		return http.StatusBadRequest
 	}
@@ -108,6 +240,25 @@ func checkTimestampHeader(l zerolog.Logger, r links.RequestData) int {
 	return http.StatusOK
 }
 
+// maxDifference returns the link's replay-protection window, or
+// [defaultMaxDifference] if the link doesn't override it.
+func maxDifference(linkSecrets map[string]string) (time.Duration, error) {
+	v := linkSecrets[replayWindowKey]
+	if v == "" {
+		return defaultMaxDifference, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %q link secret: %w", replayWindowKey, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %q link secret: must be positive", replayWindowKey)
+	}
+
+	return d, nil
+}
+
 func checkSignatureHeader(l zerolog.Logger, r links.RequestData) int {
 	sig := r.Headers.Get(signatureHeader)
 	if sig == "" {
@@ -115,15 +266,25 @@ func checkSignatureHeader(l zerolog.Logger, r links.RequestData) int {
 		return http.StatusForbidden
 	}
 
-	secret := r.LinkSecrets["signing_secret"]
-	if secret == "" {
+	secrets := signingSecrets(r.LinkSecrets)
+	if len(secrets) == 0 {
 		l.Warn().Msg("signing secret is not configured")
 		return http.StatusInternalServerError
 	}
 
+	versions, err := sigVersions(r.LinkSecrets)
+	if err != nil {
+		l.Warn().Err(err).Msg("invalid signature versions configuration")
+		return http.StatusInternalServerError
+	}
+
+	// The signature is normally computed over the decompressed body, because
+	// Slack itself doesn't compress it, but a proxy in front of us might.
+	// If the sender compressed the body, the signature covers those bytes.
 	ts := r.Headers.Get(timestampHeader)
-	if !verifySignature(l, secret, ts, sig, r.RawPayload) {
-		l.Warn().Str("signature", sig).Bool("has_signing_secret", secret != "").
+	if !verifySignature(l, secrets, versions, ts, sig, r.RawPayload) &&
+		(r.EncodedPayload == nil || !verifySignature(l, secrets, versions, ts, sig, r.EncodedPayload)) {
+		l.Warn().Str("signature", sig).Int("signing_secrets", len(secrets)).
 			Msg("signature verification failed")
 		return http.StatusForbidden
 	}
@@ -131,24 +292,103 @@ func checkSignatureHeader(l zerolog.Logger, r links.RequestData) int {
 	return http.StatusOK
 }
 
-// verifySignature implements
-// https://docs.slack.dev/authentication/verifying-requests-from-slack.
-func verifySignature(l zerolog.Logger, signingSecret, ts, want string, body []byte) bool {
-	mac := hmac.New(sha256.New, []byte(signingSecret))
+// sigVersions returns the signature versions which the link accepts,
+// or only [defaultSigVersion] if the link doesn't override it.
+func sigVersions(linkSecrets map[string]string) ([]string, error) {
+	v := linkSecrets[sigVersionsKey]
+	if v == "" {
+		return []string{defaultSigVersion}, nil
+	}
 
-	n, err := mac.Write(fmt.Appendf(nil, "%s:%s:", slackSigVersion, ts))
-	if err != nil {
-		l.Err(err).Msg("HMAC write error")
-		return false
+	var versions []string
+	for version := range strings.SplitSeq(v, ",") {
+		version = strings.TrimSpace(version)
+		if _, ok := sigVersion(version); !ok {
+			return nil, fmt.Errorf("invalid %q link secret: unsupported version %q", sigVersionsKey, version)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// signingSecretKeys are the names of the link secrets which may contain Slack
+// signing secrets: the current one, and optionally the previous one, to allow
+// zero-downtime rotation - requests signed with either of them are accepted.
+var signingSecretKeys = []string{"signing_secret", "signing_secret_previous"}
+
+// signingSecrets returns the non-empty Slack signing secrets of a link.
+func signingSecrets(linkSecrets map[string]string) []string {
+	var secrets []string
+	for _, k := range signingSecretKeys {
+		if s := linkSecrets[k]; s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+// checkAppID prevents a misconfigured link from verifying the URL of a different
+// Slack app, if the link's secrets specify the expected app ID. Otherwise, this
+// check is skipped, because Slack doesn't require it.
+func checkAppID(l zerolog.Logger, r links.RequestData) int {
+	want := r.LinkSecrets["app_id"]
+	if want == "" {
+		return http.StatusOK
 	}
-	if n != len(ts)+4 {
+
+	got, _ := r.JSONPayload["api_app_id"].(string)
+	if got != want {
+		l.Warn().Str("got", got).Str("want", want).Msg("URL verification for unexpected Slack app ID")
+		return http.StatusForbidden
+	}
+
+	return http.StatusOK
+}
+
+// verifySignature implements
+// https://docs.slack.dev/authentication/verifying-requests-from-slack,
+// with any of the given accepted signature versions (see [sigVersions]).
+// It succeeds if any of the given signing secrets matches the signature.
+func verifySignature(l zerolog.Logger, signingSecrets, versions []string, ts, want string, body []byte) bool {
+	version, _, found := strings.Cut(want, "=")
+	if !found {
 		return false
 	}
 
-	if n, err := mac.Write(body); err != nil || n != len(body) {
+	f, ok := sigVersion(version)
+	if !ok || !slices.Contains(versions, version) {
+		l.Warn().Str("version", version).Strs("accepted", versions).Msg("unaccepted signature version")
 		return false
 	}
 
-	got := fmt.Sprintf("%s=%s", slackSigVersion, hex.EncodeToString(mac.Sum(nil)))
-	return hmac.Equal([]byte(got), []byte(want))
+	base := f(version, ts, body)
+	for _, secret := range signingSecrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		if _, err := mac.Write(base); err != nil {
+			l.Err(err).Msg("HMAC write error")
+			return false
+		}
+
+		got := fmt.Sprintf("%s=%s", version, hex.EncodeToString(mac.Sum(nil)))
+		if hmac.Equal([]byte(got), []byte(want)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// baseStringV0 is the [baseStringFunc] of Slack's "v0" signature version:
+// the version, timestamp, and raw request body, joined by colons.
+func baseStringV0(version, ts string, body []byte) []byte {
+	return append(fmt.Appendf(nil, "%s:%s:", version, ts), body...)
+}
+
+// baseStringV1 is the [baseStringFunc] of the "v1" signature version, which
+// Slack doesn't use, but Slack-compatible tools may: the version, timestamp, and
+// hex-encoded SHA-256 hash of the raw request body, joined by vertical bars.
+func baseStringV1(version, ts string, body []byte) []byte {
+	h := sha256.Sum256(body)
+	return fmt.Appendf(nil, "%s|%s|%s", version, ts, hex.EncodeToString(h[:]))
 }
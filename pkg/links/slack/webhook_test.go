@@ -0,0 +1,693 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/internal/metrics"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+)
+
+// From https://docs.slack.dev/authentication/verifying-requests-from-slack.
+const (
+	testSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+	testTS     = "1531420618"
+	testBody   = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&" +
+		"channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&" +
+		"response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&" +
+		"trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+)
+
+func TestCheckSignatureHeaderVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions string
+		sig      string
+		want     int
+	}{
+		{
+			name: "v0",
+			sig:  "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503",
+			want: http.StatusOK,
+		},
+		{
+			name: "v0_mismatch",
+			sig:  "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b504",
+			want: http.StatusForbidden,
+		},
+		{
+			name: "v1_not_accepted_by_default",
+			sig:  "v1=d6d0cd599f68550b08d65dcd9a5171da87816ec3458ec07d71b9dd931cfd64f7",
+			want: http.StatusForbidden,
+		},
+		{
+			name:     "v1",
+			versions: "v0,v1",
+			sig:      "v1=d6d0cd599f68550b08d65dcd9a5171da87816ec3458ec07d71b9dd931cfd64f7",
+			want:     http.StatusOK,
+		},
+		{
+			name:     "v0_with_multiple_versions",
+			versions: "v0, v1",
+			sig:      "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503",
+			want:     http.StatusOK,
+		},
+		{
+			name:     "v0_not_accepted",
+			versions: "v1",
+			sig:      "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503",
+			want:     http.StatusForbidden,
+		},
+		{
+			name:     "unsupported_version",
+			versions: "v0,v2",
+			sig:      "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503",
+			want:     http.StatusInternalServerError,
+		},
+		{
+			name: "missing_version",
+			sig:  "a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503",
+			want: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := links.RequestData{
+				Headers: http.Header{
+					timestampHeader: []string{testTS},
+					signatureHeader: []string{tt.sig},
+				},
+				RawPayload:  []byte(testBody),
+				LinkSecrets: map[string]string{"signing_secret": testSecret},
+			}
+			if tt.versions != "" {
+				r.LinkSecrets[sigVersionsKey] = tt.versions
+			}
+
+			if got := checkSignatureHeader(zerolog.Nop(), r); got != tt.want {
+				t.Errorf("checkSignatureHeader() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureRotation(t *testing.T) {
+	const sig = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+	const other = "00000000000000000000000000000000"
+
+	tests := []struct {
+		name    string
+		secrets map[string]string
+		want    bool
+	}{
+		{
+			name:    "new_secret_matches",
+			secrets: map[string]string{"signing_secret": testSecret, "signing_secret_previous": other},
+			want:    true,
+		},
+		{
+			name:    "old_secret_matches",
+			secrets: map[string]string{"signing_secret": other, "signing_secret_previous": testSecret},
+			want:    true,
+		},
+		{
+			name:    "neither_matches",
+			secrets: map[string]string{"signing_secret": other, "signing_secret_previous": other + "1"},
+		},
+		{
+			name:    "only_old_secret",
+			secrets: map[string]string{"signing_secret_previous": testSecret},
+			want:    true,
+		},
+		{
+			name: "no_secrets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets := signingSecrets(tt.secrets)
+			if got := verifySignature(zerolog.Nop(), secrets, []string{defaultSigVersion}, testTS, sig, []byte(testBody)); got != tt.want {
+				t.Errorf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventsHandlerURLVerification(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantAppID string
+		gotAppID  string
+		challenge any
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:      "no_expected_app_id",
+			gotAppID:  "A1",
+			challenge: "challenge",
+			wantBody:  "challenge",
+		},
+		{
+			name:      "matching_app_id",
+			wantAppID: "A1",
+			gotAppID:  "A1",
+			challenge: "challenge",
+			wantBody:  "challenge",
+		},
+		{
+			name:      "mismatching_app_id",
+			wantAppID: "A1",
+			gotAppID:  "A2",
+			challenge: "challenge",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:      "missing_app_id",
+			wantAppID: "A1",
+			challenge: "challenge",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:     "missing_challenge",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "empty_challenge",
+			challenge: "",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "numeric_challenge",
+			challenge: 123.0,
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "object_challenge",
+			challenge: map[string]any{"a": "b"},
+			wantCode:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := map[string]any{"type": "url_verification"}
+			if tt.challenge != nil {
+				payload["challenge"] = tt.challenge
+			}
+			if tt.gotAppID != "" {
+				payload["api_app_id"] = tt.gotAppID
+			}
+			secrets := map[string]string{"signing_secret": testSecret}
+			if tt.wantAppID != "" {
+				secrets["app_id"] = tt.wantAppID
+			}
+
+			w := httptest.NewRecorder()
+			got := eventsHandler(t.Context(), w, signedRequest(t, payload, secrets))
+			if got != tt.wantCode {
+				t.Errorf("eventsHandler() = %d, want %d", got, tt.wantCode)
+			}
+			if body := w.Body.String(); body != tt.wantBody {
+				t.Errorf("eventsHandler() response body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// chanDispatcher is a [dispatch.Dispatcher] which publishes events to a channel.
+type chanDispatcher chan dispatch.Event
+
+func (d chanDispatcher) Dispatch(_ context.Context, e dispatch.Event) error {
+	d <- e
+	return nil
+}
+
+// withTestQueue returns a context with a [dispatch.Queue] and a logger,
+// and the channel and buffer which capture dispatched events and logs.
+func withTestQueue(t *testing.T) (context.Context, chanDispatcher, *bytes.Buffer) {
+	t.Helper()
+
+	d := make(chanDispatcher, 1)
+	q := dispatch.NewQueue(d, 1, nil)
+	t.Cleanup(func() { _ = q.Shutdown(context.Background()) })
+
+	buf := new(bytes.Buffer)
+	l := zerolog.New(buf)
+	return dispatch.WithQueue(l.WithContext(t.Context()), q), d, buf
+}
+
+func TestEventsHandlerEventCallback(t *testing.T) {
+	ctx, d, logs := withTestQueue(t)
+	payload := map[string]any{
+		"type": "event_callback", "team_id": "T1", "api_app_id": "A1", "event_id": "Ev1",
+		"event": map[string]any{"type": "app_mention", "channel": "C1", "user": "U1", "text": "hi"},
+	}
+	secrets := map[string]string{"signing_secret": testSecret}
+
+	if got := eventsHandler(ctx, httptest.NewRecorder(), signedRequest(t, payload, secrets)); got != http.StatusOK {
+		t.Fatalf("eventsHandler() = %d, want %d", got, http.StatusOK)
+	}
+
+	select {
+	case e := <-d:
+		if e.Type != "app_mention" {
+			t.Errorf("dispatched event type = %q, want %q", e.Type, "app_mention")
+		}
+		want := &AppMentionEvent{Type: "app_mention", Channel: "C1", User: "U1", Text: "hi"}
+		if !reflect.DeepEqual(e.Typed, want) {
+			t.Errorf("dispatched typed event = %+v, want %+v", e.Typed, want)
+		}
+		if e.Payload["team_id"] != "T1" || e.Payload["api_app_id"] != "A1" {
+			t.Errorf("dispatched event payload = %v, want team and app context", e.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event wasn't dispatched")
+	}
+
+	for _, want := range []string{`"event_type":"app_mention"`, `"event_id":"Ev1"`, `"team_id":"T1"`, `"api_app_id":"A1"`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("eventsHandler() logs = %s, want %s", logs.String(), want)
+		}
+	}
+}
+
+func TestEventsHandlerAppRateLimited(t *testing.T) {
+	ctx, d, logs := withTestQueue(t)
+	before := counterValue(t, metrics.SlackAppRateLimited)
+	payload := map[string]any{
+		"type": "app_rate_limited", "token": "Jhj5dZrVaK7ZwHHjRyZWjbDl", "team_id": "T1",
+		"minute_rate_limited": 1518467820, "api_app_id": "A1",
+	}
+	secrets := map[string]string{"signing_secret": testSecret}
+
+	w := httptest.NewRecorder()
+	if got := eventsHandler(ctx, w, signedRequest(t, payload, secrets)); got != http.StatusOK {
+		t.Errorf("eventsHandler() = %d, want %d", got, http.StatusOK)
+	}
+	if body := w.Body.String(); body != "" {
+		t.Errorf("eventsHandler() response body = %q, want empty", body)
+	}
+
+	for _, want := range []string{`"level":"warn"`, `"minute_rate_limited":1518467820`, `"team_id":"T1"`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("eventsHandler() logs = %s, want %s", logs.String(), want)
+		}
+	}
+	if got := counterValue(t, metrics.SlackAppRateLimited); got != before+1 {
+		t.Errorf("SlackAppRateLimited metric = %v, want %v", got, before+1)
+	}
+
+	select {
+	case e := <-d:
+		t.Errorf("rate limiting notification was dispatched: %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+// signedRequest constructs a valid Slack event request with the given JSON payload.
+func signedRequest(t *testing.T, payload map[string]any, secrets map[string]string) links.RequestData {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := sign(raw, secrets)
+	r.PathSuffix = "event"
+	r.Headers.Set(contentTypeHeader, "application/json")
+	r.JSONPayload = payload
+	return r
+}
+
+func signedFormRequest(t *testing.T, suffix string, form url.Values, secrets map[string]string) links.RequestData {
+	t.Helper()
+
+	r := sign([]byte(form.Encode()), secrets)
+	r.PathSuffix = suffix
+	r.Headers.Set(contentTypeHeader, "application/x-www-form-urlencoded")
+	r.QueryOrForm = form
+	return r
+}
+
+func sign(raw []byte, secrets map[string]string) links.RequestData {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secrets["signing_secret"]))
+	mac.Write(baseStringV0("v0", ts, raw))
+
+	return links.RequestData{
+		Headers: http.Header{
+			timestampHeader: []string{ts},
+			signatureHeader: []string{"v0=" + hex.EncodeToString(mac.Sum(nil))},
+		},
+		RawPayload:  raw,
+		LinkSecrets: secrets,
+	}
+}
+
+func TestFormHandlerSSLCheck(t *testing.T) {
+	secrets := map[string]string{"signing_secret": testSecret}
+	form := url.Values{"ssl_check": {"1"}, "token": {"xyzz0WbapA4vBCDEFasx0q6G"}}
+
+	for _, suffix := range []string{"commands", "interactions"} {
+		t.Run(suffix, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if got := formHandler(t.Context(), w, signedFormRequest(t, suffix, form, secrets)); got != http.StatusOK {
+				t.Errorf("formHandler() = %d, want %d", got, http.StatusOK)
+			}
+			if body := w.Body.String(); body != "" {
+				t.Errorf("formHandler() response body = %q, want empty", body)
+			}
+		})
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		r := signedFormRequest(t, "commands", form, secrets)
+		r.LinkSecrets = map[string]string{"signing_secret": "other"}
+		if got := WebhookVerifier(t.Context(), r); got != http.StatusForbidden {
+			t.Errorf("WebhookVerifier() = %d, want %d", got, http.StatusForbidden)
+		}
+	})
+}
+
+func TestFormPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		form url.Values
+		want map[string]any
+	}{
+		{
+			name: "slash_command",
+			form: url.Values{"command": {"/weather"}, "text": {"94070"}},
+			want: map[string]any{"command": "/weather", "text": "94070"},
+		},
+		{
+			name: "interactivity",
+			form: url.Values{"payload": {`{"type":"block_actions"}`}},
+			want: map[string]any{"type": "block_actions"},
+		},
+		{
+			name: "invalid_json_payload",
+			form: url.Values{"payload": {"{"}},
+			want: map[string]any{"payload": "{"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formPayload(tt.form); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("formPayload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRouter(t *testing.T) {
+	tests := []struct {
+		name        string
+		pathSuffix  string
+		contentType string
+		wantRoute   bool
+		want        int
+	}{
+		{
+			name:        "event_json",
+			pathSuffix:  "event",
+			contentType: "application/json",
+			wantRoute:   true,
+			want:        http.StatusOK,
+		},
+		{
+			name:        "event_form",
+			pathSuffix:  "event",
+			contentType: "application/x-www-form-urlencoded",
+			wantRoute:   true,
+			want:        http.StatusBadRequest,
+		},
+		{
+			name:        "interactions_form",
+			pathSuffix:  "interactions",
+			contentType: "application/x-www-form-urlencoded",
+			wantRoute:   true,
+			want:        http.StatusOK,
+		},
+		{
+			name:        "interactions_json",
+			pathSuffix:  "interactions",
+			contentType: "application/json",
+			wantRoute:   true,
+			want:        http.StatusBadRequest,
+		},
+		{
+			name:        "commands_form",
+			pathSuffix:  "commands",
+			contentType: "application/x-www-form-urlencoded",
+			wantRoute:   true,
+			want:        http.StatusOK,
+		},
+		{
+			name:        "commands_json",
+			pathSuffix:  "commands",
+			contentType: "application/json",
+			wantRoute:   true,
+			want:        http.StatusBadRequest,
+		},
+		{
+			name:        "no_suffix",
+			contentType: "application/x-www-form-urlencoded",
+		},
+		{
+			name:        "unregistered_suffix",
+			pathSuffix:  "options",
+			contentType: "application/x-www-form-urlencoded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := WebhookRouter()[tt.pathSuffix]
+			if ok != tt.wantRoute {
+				t.Fatalf("WebhookRouter()[%q] found = %v, want %v", tt.pathSuffix, ok, tt.wantRoute)
+			}
+			if !ok {
+				return
+			}
+
+			ctx, _, _ := withTestQueue(t)
+			r := signedFormRequest(t, tt.pathSuffix, url.Values{"command": {"/weather"}}, map[string]string{"signing_secret": testSecret})
+			r.Headers.Set(contentTypeHeader, tt.contentType)
+			r.JSONPayload = map[string]any{"type": "event_callback"}
+			if got := f(ctx, httptest.NewRecorder(), r); got != tt.want {
+				t.Errorf("handler() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckContentTypeHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    string
+		contentType string
+		want        int
+	}{
+		{
+			name:        "json",
+			expected:    "application/json",
+			contentType: "application/json",
+			want:        http.StatusOK,
+		},
+		{
+			name:        "json_with_charset",
+			expected:    "application/json",
+			contentType: "application/json; charset=utf-8",
+			want:        http.StatusOK,
+		},
+		{
+			name:        "form_with_charset",
+			expected:    "application/x-www-form-urlencoded",
+			contentType: "application/x-www-form-urlencoded; charset=UTF-8",
+			want:        http.StatusOK,
+		},
+		{
+			name:        "unexpected_type",
+			expected:    "application/json",
+			contentType: "application/x-www-form-urlencoded",
+			want:        http.StatusBadRequest,
+		},
+		{
+			name:     "missing_header",
+			expected: "application/json",
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:        "malformed_header",
+			expected:    "application/json",
+			contentType: "application/json; charset",
+			want:        http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := links.RequestData{Headers: http.Header{}}
+			if tt.contentType != "" {
+				r.Headers.Set(contentTypeHeader, tt.contentType)
+			}
+			if got := checkContentTypeHeader(zerolog.Nop(), r, tt.expected); got != tt.want {
+				t.Errorf("checkContentTypeHeader() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTimestampHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		replayWindow string
+		age          time.Duration
+		want         int
+	}{
+		{
+			name: "default_window_inside",
+			age:  defaultMaxDifference - 5*time.Second,
+			want: http.StatusOK,
+		},
+		{
+			name: "default_window_outside",
+			age:  defaultMaxDifference + 5*time.Second,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "default_window_future_outside",
+			age:  -defaultMaxDifference - 5*time.Second,
+			want: http.StatusBadRequest,
+		},
+		{
+			name:         "custom_window_inside",
+			replayWindow: "1m",
+			age:          55 * time.Second,
+			want:         http.StatusOK,
+		},
+		{
+			name:         "custom_window_outside",
+			replayWindow: "1m",
+			age:          65 * time.Second,
+			want:         http.StatusBadRequest,
+		},
+		{
+			name:         "longer_window_inside",
+			replayWindow: "10m",
+			age:          defaultMaxDifference + 5*time.Second,
+			want:         http.StatusOK,
+		},
+		{
+			name:         "zero_window",
+			replayWindow: "0s",
+			want:         http.StatusInternalServerError,
+		},
+		{
+			name:         "negative_window",
+			replayWindow: "-1m",
+			want:         http.StatusInternalServerError,
+		},
+		{
+			name:         "invalid_window",
+			replayWindow: "soon",
+			want:         http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := strconv.FormatInt(time.Now().Add(-tt.age).Unix(), 10)
+			r := links.RequestData{
+				Headers:     http.Header{timestampHeader: []string{ts}},
+				LinkSecrets: map[string]string{replayWindowKey: tt.replayWindow},
+			}
+
+			if got := checkTimestampHeader(zerolog.Nop(), r); got != tt.want {
+				t.Errorf("checkTimestampHeader() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSignatureHeaderEncodedPayload(t *testing.T) {
+	secrets := map[string]string{"signing_secret": testSecret}
+	plain := []byte(`{"type":"event_callback"}`)
+	encoded := []byte("compressed bytes")
+
+	tests := []struct {
+		name     string
+		signed   []byte
+		encoded  []byte
+		wantCode int
+	}{
+		{
+			name:     "signed_decoded_body",
+			signed:   plain,
+			encoded:  encoded,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "signed_encoded_body",
+			signed:   encoded,
+			encoded:  encoded,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "signed_other_body",
+			signed:   []byte("other"),
+			encoded:  encoded,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "signed_encoded_body_but_not_encoded",
+			signed:   encoded,
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := sign(tt.signed, secrets)
+			r.RawPayload = plain
+			r.EncodedPayload = tt.encoded
+
+			if got := checkSignatureHeader(zerolog.Nop(), r); got != tt.wantCode {
+				t.Errorf("checkSignatureHeader() = %d, want %d", got, tt.wantCode)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package slack
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,20 +9,59 @@ import (
 	"io"
 	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
 
 	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
 	"github.com/tzrikka/omdient/pkg/websocket"
 )
 
 const (
-	connOpenURL = "https://slack.com/api/apps.connections.open"
-	timeout     = 3 * time.Second
-	maxSize     = 1024 // 1 KiB.
+	timeout = 3 * time.Second
+	maxSize = 1024 // 1 KiB.
+
+	maxRateLimitRetries = 3
+	maxRateLimitWait    = 10 * time.Second
 )
 
+const connOpenURL = "https://slack.com/api/apps.connections.open"
+
+var defaultHTTPClient = &http.Client{Timeout: timeout}
+
+type httpClientKey struct{}
+
+// WithHTTPClient returns a copy of the given context with a custom [http.Client]
+// for Slack API calls, e.g. to configure proxy and TLS settings. Socket Mode
+// connections also use it for their WebSocket handshakes (without its timeout).
+// The default is a client with a 3-second timeout.
+func WithHTTPClient(ctx context.Context, hc *http.Client) context.Context {
+	return context.WithValue(ctx, httpClientKey{}, hc)
+}
+
+// httpClient returns the [http.Client] from the given context,
+// which was stored by [WithHTTPClient], or a default client.
+func httpClient(ctx context.Context) *http.Client {
+	if hc, ok := ctx.Value(httpClientKey{}).(*http.Client); ok && hc != nil {
+		return hc
+	}
+	return defaultHTTPClient
+}
+
+// RateLimitedError indicates that a Slack API call was rejected with a 429 status.
+// RetryAfter is based on the response's "Retry-After" header, and callers
+// should wait at least this long before retrying the same API method.
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("Slack API rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
 func ConnectionHandler(ctx context.Context, data links.LinkData) int {
 	l := zerolog.Ctx(ctx)
 	t := data.Secrets["app_token"]
@@ -30,47 +70,113 @@ func ConnectionHandler(ctx context.Context, data links.LinkData) int {
 		return http.StatusForbidden
 	}
 
-	c, err := websocket.NewOrCachedClient(ctx, urlFunc(t), t)
+	hc := httpClient(ctx)
+	var opts []websocket.ClientOpt
+	if hc != defaultHTTPClient {
+		wsc := *hc
+		wsc.Timeout = 0 // Would interfere with the long-lived WebSocket connection.
+		opts = append(opts, websocket.WithDialOpts(websocket.WithHTTPClient(&wsc)))
+	}
+
+	err := receivers.Start(ctx, receivers.Connection{
+		LinkID:     data.ID,
+		LinkType:   "slack",
+		ClientID:   t,
+		URL:        urlFunc(hc, t),
+		Extract:    extractPayload,
+		Ack:        ackEnvelope,
+		Event:      newEvent,
+		ClientOpts: opts,
+	})
 	if err != nil {
 		l.Err(err).Msg("Slack Socket Mode connection error")
 		return http.StatusInternalServerError
 	}
 
-	go clientEventLoop(l, c)
 	return http.StatusOK
 }
 
-func urlFunc(appToken string) func(ctx context.Context) (string, error) {
+func urlFunc(hc *http.Client, appToken string) func(ctx context.Context) (string, error) {
 	return func(ctx context.Context) (string, error) {
-		return generateWebSocketURL(ctx, appToken)
+		return generateWebSocketURL(ctx, hc, appToken)
 	}
 }
 
 // generateWebSocketURL generates a temporary Socket Mode WebSocket URL ("wss://...")
 // that an unpublished Slack app can connect to, to receive events and interactive
 // payloads. Based on https://docs.slack.dev/reference/methods/apps.connections.open.
-func generateWebSocketURL(ctx context.Context, appToken string) (string, error) {
+//
+// If Slack rate-limits this call, it waits and retries a few times (as long as the
+// delays are short), and then returns a [RateLimitedError] for the caller to handle.
+func generateWebSocketURL(ctx context.Context, hc *http.Client, appToken string) (string, error) {
+	var body []byte
+	var err error
+	for i := 0; ; i++ {
+		body, err = postRequest(ctx, hc, connOpenURL, appToken, nil, maxSize)
+		rle := &RateLimitedError{}
+		if !errors.As(err, &rle) || i >= maxRateLimitRetries || rle.RetryAfter > maxRateLimitWait {
+			break
+		}
+
+		zerolog.Ctx(ctx).Warn().Dur("retry_after", rle.RetryAfter).Int("retry", i+1).
+			Msg("Slack API rate limit exceeded, waiting to retry")
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(rle.RetryAfter):
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	decoded := &apiResponse{}
+	if err := json.Unmarshal(body, decoded); err != nil {
+		return "", fmt.Errorf("failed to parse JSON in HTTP response body: %w", err)
+	}
+	if !decoded.OK {
+		return "", fmt.Errorf("Slack API error: %s", decoded.Error)
+	}
+
+	return decoded.URL, nil
+}
+
+// postRequest sends an authenticated POST request to a Slack API method, with an optional
+// JSON body, and returns the response body (up to the given size limit) if it's a 200 (OK).
+func postRequest(ctx context.Context, hc *http.Client, url, token string, reqBody []byte, limit int64) ([]byte, error) {
 	// Construct and send the request.
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, connOpenURL, http.NoBody)
+	var r io.Reader = http.NoBody
+	if reqBody != nil {
+		r = bytes.NewReader(reqBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, r)
 	if err != nil {
-		return "", fmt.Errorf("failed to construct HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to construct HTTP request: %w", err)
 	}
 
-	req.Header.Add("Authorization", "Bearer "+appToken)
+	req.Header.Add("Authorization", "Bearer "+token)
+	if reqBody != nil {
+		req.Header.Add(contentTypeHeader, "application/json; charset=utf-8")
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := hc.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Read and parse the response.
-	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	// Read the response.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
 	if err != nil {
-		return "", fmt.Errorf("failed to read HTTP response body: %w", err)
+		return nil, fmt.Errorf("failed to read HTTP response body: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &RateLimitedError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -78,18 +184,23 @@ func generateWebSocketURL(ctx context.Context, appToken string) (string, error)
 		if len(body) > 0 {
 			msg = fmt.Sprintf("%s: %s", msg, string(body))
 		}
-		return "", errors.New(msg)
+		return nil, errors.New(msg)
 	}
 
-	decoded := &apiResponse{}
-	if err := json.Unmarshal(body, decoded); err != nil {
-		return "", fmt.Errorf("failed to parse JSON in HTTP response body: %w", err)
+	return body, nil
+}
+
+// parseRetryAfter parses the value of an HTTP "Retry-After" header, which is
+// either a number of seconds or an HTTP date. If it's missing or invalid,
+// this function returns a default of 1 second.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
 	}
-	if !decoded.OK {
-		return "", fmt.Errorf("Slack API error: %s", decoded.Error)
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
 	}
-
-	return decoded.URL, nil
+	return time.Second
 }
 
 type apiResponse struct {
@@ -98,65 +209,100 @@ type apiResponse struct {
 	URL   string `json:"url,omitempty"`
 }
 
-// clientEventLoop runs as a goroutine to parse, acknowledge, and dispatch
-// all types of asynchronous Slack events which were received as WebSocket
-// data messages. It also prevents downtime by informing the client when
-// to refresh its underlying WebSocket connection, before it times out.
-func clientEventLoop(l *zerolog.Logger, c *websocket.Client) {
-	for {
-		raw, ok := <-c.IncomingMessages()
-		if !ok {
-			l.Error().Msg("WebSocket client is closed")
-			return
-		}
+// extractPayload is the [receivers.PayloadExtractor] of Socket Mode envelopes:
+// control envelopes affect the WebSocket client's connection, and payload
+// envelopes are returned, to be acknowledged and dispatched.
+func extractPayload(ctx context.Context, c receivers.Conn, raw websocket.Message) (*receivers.Envelope, error) {
+	l := zerolog.Ctx(ctx)
+	msg, ok := decodeMessage(l, raw)
+	if !ok {
+		return nil, nil // Already logged.
+	}
 
-		msg := socketModeMessage{}
-		if err := json.Unmarshal(raw.Data, &msg); err != nil {
-			l.Err(err).Msg("JSON decoding error in incoming WebSocket message")
-			continue
+	switch msg.Type {
+	// https://docs.slack.dev/apis/events-api/using-socket-mode#connect
+	case "hello":
+		l.Info().Int("num_connections", msg.NumConnections).Str("app_id", msg.ConnectionInfo.AppID).
+			Int("approximate_connection_time", msg.DebugInfo.ApproximateConnectionTime).
+			Msg("Slack Socket Mode connection established")
+		t := msg.DebugInfo.ApproximateConnectionTime
+		t -= 63 + rand.IntN(10) // 63-72 seconds before the actual timeout.
+		c.RefreshConnectionIn(time.Duration(t) * time.Second)
+		return nil, nil
+
+	// https://docs.slack.dev/apis/events-api/using-socket-mode#disconnect
+	case "disconnect":
+		if msg.Reason == "link_disabled" {
+			l.Error().Str("reason", msg.Reason).Msg("Slack Socket Mode disabled for this app")
+			return nil, nil
 		}
+		// Reconnect with a fresh URL now, instead of waiting for Slack to drop the connection.
+		l.Info().Str("reason", msg.Reason).Msg("Slack Socket Mode disconnection requested, refreshing connection")
+		c.RefreshConnectionIn(0)
+		return nil, nil
+	}
+
+	if msg.Payload == nil {
+		l.Warn().Str("type", msg.Type).Str("envelope_id", msg.EnvelopeID).
+			Msg("ignoring Slack Socket Mode envelope without payload")
+		return nil, nil
+	}
+
+	l.Debug().
+		Str("type", msg.Type).
+		Str("envelope_id", msg.EnvelopeID).
+		Bool("accepts_response_payload", msg.AcceptsResponsePayload).
+		Any("payload", msg.Payload).
+		Send()
+
+	return &receivers.Envelope{ID: msg.EnvelopeID, Payload: msg.Payload, Message: msg}, nil
+}
 
-		resp := eventResponse{EnvelopeID: msg.EnvelopeID}
-		switch msg.Type {
-		// https://docs.slack.dev/apis/events-api/using-socket-mode#connect
-		case "hello":
-			t := msg.DebugInfo.ApproximateConnectionTime
-			t -= 63 + rand.IntN(10) // 63-72 seconds before the actual timeout.
-			c.RefreshConnectionIn(time.Duration(t) * time.Second)
-			continue
-
-		// https://docs.slack.dev/apis/events-api/using-socket-mode#disconnect
-		case "disconnect":
-			continue
-
-		// https://docs.slack.dev/apis/events-api/using-socket-mode#command
-		case "slash_commands":
-			resp.Payload = map[string]any{
-				"blocks": []map[string]any{
-					{
-						"type": "section",
-						"text": map[string]string{
-							"type": "mrkdwn",
-							"text": fmt.Sprintf("Your command: `%s %s`", msg.Payload["command"], msg.Payload["text"]),
-						},
+// ackEnvelope is the [receivers.AckFunc] of Socket Mode envelopes.
+// See https://docs.slack.dev/apis/events-api/using-socket-mode#acknowledge.
+func ackEnvelope(_ context.Context, c receivers.Conn, e *receivers.Envelope) error {
+	resp := eventResponse{EnvelopeID: e.ID}
+
+	// https://docs.slack.dev/apis/events-api/using-socket-mode#command
+	if msg, ok := e.Message.(socketModeMessage); ok && msg.Type == "slash_commands" {
+		resp.Payload = map[string]any{
+			"blocks": []map[string]any{
+				{
+					"type": "section",
+					"text": map[string]string{
+						"type": "mrkdwn",
+						"text": fmt.Sprintf("Your command: `%s %s`", msg.Payload["command"], msg.Payload["text"]),
 					},
 				},
-			}
+			},
 		}
+	}
 
-		// https://docs.slack.dev/apis/events-api/using-socket-mode#acknowledge
-		if err := c.SendJSONMessage(resp); err != nil {
-			l.Err(err).Msg("failed to ack Slack Socket Mode event")
-		}
+	if err := c.SendJSONMessage(resp); err != nil {
+		return fmt.Errorf("failed to ack Slack Socket Mode event: %w", err)
+	}
+	return nil
+}
 
-		// TBD: Dispatch the event notification data to...?
-		l.Debug().
-			Str("type", msg.Type).
-			Str("envelope_id", msg.EnvelopeID).
-			Bool("accepts_response_payload", msg.AcceptsResponsePayload).
-			Any("payload", msg.Payload).
-			Send()
+// decodeMessage parses a WebSocket data message as a Socket Mode JSON envelope.
+// Slack sends only text messages, but binary ones are also accepted if they
+// contain valid UTF-8 JSON. Anything else is logged and ignored, instead
+// of breaking the stream.
+func decodeMessage(l *zerolog.Logger, raw websocket.Message) (socketModeMessage, bool) {
+	msg := socketModeMessage{}
+	if raw.Opcode == websocket.OpcodeBinary && (!utf8.Valid(raw.Data) || !json.Valid(raw.Data)) {
+		l.Warn().Int("length", len(raw.Data)).Msg("ignoring non-JSON binary WebSocket message")
+		return msg, false
 	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw.Data))
+	dec.UseNumber()
+	if err := dec.Decode(&msg); err != nil {
+		l.Err(err).Str("opcode", raw.Opcode.String()).Msg("JSON decoding error in incoming WebSocket message")
+		return msg, false
+	}
+
+	return msg, true
 }
 
 // https://docs.slack.dev/apis/events-api/using-socket-mode
@@ -0,0 +1,387 @@
+package slack
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+	"github.com/tzrikka/omdient/pkg/websocket"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      websocket.Message
+		wantOK   bool
+		wantType string
+	}{
+		{
+			name:     "text_json",
+			msg:      websocket.Message{Opcode: websocket.OpcodeText, Data: []byte(`{"type":"hello"}`)},
+			wantOK:   true,
+			wantType: "hello",
+		},
+		{
+			name: "text_non_json",
+			msg:  websocket.Message{Opcode: websocket.OpcodeText, Data: []byte("hello")},
+		},
+		{
+			name:     "binary_json",
+			msg:      websocket.Message{Opcode: websocket.OpcodeBinary, Data: []byte(`{"type":"events_api"}`)},
+			wantOK:   true,
+			wantType: "events_api",
+		},
+		{
+			name: "binary_non_json",
+			msg:  websocket.Message{Opcode: websocket.OpcodeBinary, Data: []byte{0x00, 0x01, 0x02}},
+		},
+		{
+			name: "binary_invalid_utf8",
+			msg:  websocket.Message{Opcode: websocket.OpcodeBinary, Data: []byte{'"', 0xff, '"'}},
+		},
+		{
+			name: "binary_empty",
+			msg:  websocket.Message{Opcode: websocket.OpcodeBinary, Data: []byte{}},
+		},
+	}
+
+	l := zerolog.Nop()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := decodeMessage(&l, tt.msg)
+			if ok != tt.wantOK {
+				t.Fatalf("decodeMessage() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if msg.Type != tt.wantType {
+				t.Errorf("decodeMessage() type = %q, want %q", msg.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestDecodeMessageNumbers(t *testing.T) {
+	l := zerolog.Nop()
+	data := []byte(`{"type":"events_api","payload":{"event_time":9007199254740993}}`)
+	msg, ok := decodeMessage(&l, websocket.Message{Opcode: websocket.OpcodeText, Data: data})
+	if !ok {
+		t.Fatal("decodeMessage() ok = false, want true")
+	}
+
+	got, ok := msg.Payload["event_time"].(json.Number)
+	if !ok {
+		t.Fatalf("decodeMessage() event_time type = %T, want json.Number", msg.Payload["event_time"])
+	}
+	if want := json.Number("9007199254740993"); got != want {
+		t.Errorf("decodeMessage() event_time = %q, want %q", got, want)
+	}
+}
+
+// testHTTPClient returns an HTTP client which sends all requests to the given test server.
+func testHTTPClient(s *httptest.Server) *http.Client {
+	return &http.Client{Transport: redirectTransport{url: s.URL}}
+}
+
+type redirectTransport struct {
+	url string
+}
+
+func (rt redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	u, err := url.Parse(rt.url)
+	if err != nil {
+		return nil, err
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Scheme = u.Scheme
+	r.URL.Host = u.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestGenerateWebSocketURL(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/apps.connections.open" {
+			t.Errorf("request = %s %s, want POST /api/apps.connections.open", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer xapp-token" {
+			t.Errorf("Authorization header = %q, want %q", got, "Bearer xapp-token")
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"url":"wss://example.com"}`))
+	}))
+	defer s.Close()
+
+	got, err := generateWebSocketURL(t.Context(), testHTTPClient(s), "xapp-token")
+	if err != nil {
+		t.Fatalf("generateWebSocketURL() error = %v", err)
+	}
+	if want := "wss://example.com"; got != want {
+		t.Errorf("generateWebSocketURL() = %q, want %q", got, want)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	if got := httpClient(t.Context()); got != defaultHTTPClient {
+		t.Errorf("httpClient() without custom client = %v, want default", got)
+	}
+
+	hc := &http.Client{}
+	if got := httpClient(WithHTTPClient(t.Context(), hc)); got != hc {
+		t.Errorf("httpClient() with custom client = %v, want %v", got, hc)
+	}
+}
+
+func TestGenerateWebSocketURLRateLimited(t *testing.T) {
+	tests := []struct {
+		name           string
+		rateLimited    int32
+		retryAfter     string
+		wantAttempts   int32
+		wantURL        string
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:         "429_then_200",
+			rateLimited:  2,
+			retryAfter:   "0",
+			wantAttempts: 3,
+			wantURL:      "wss://example.com",
+		},
+		{
+			name:         "persistent_429",
+			rateLimited:  100,
+			retryAfter:   "0",
+			wantAttempts: maxRateLimitRetries + 1,
+		},
+		{
+			name:           "long_retry_after",
+			rateLimited:    100,
+			retryAfter:     "60",
+			wantAttempts:   1,
+			wantRetryAfter: time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if attempts.Add(1) <= tt.rateLimited {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				_, _ = w.Write([]byte(`{"ok":true,"url":"wss://example.com"}`))
+			}))
+			defer s.Close()
+
+			got, err := generateWebSocketURL(t.Context(), testHTTPClient(s), "xapp-token")
+			if n := attempts.Load(); n != tt.wantAttempts {
+				t.Errorf("generateWebSocketURL() attempts = %d, want %d", n, tt.wantAttempts)
+			}
+			if got != tt.wantURL {
+				t.Errorf("generateWebSocketURL() = %q, want %q", got, tt.wantURL)
+			}
+
+			if tt.wantURL != "" {
+				if err != nil {
+					t.Fatalf("generateWebSocketURL() error = %v", err)
+				}
+				return
+			}
+			rle := &RateLimitedError{}
+			if !errors.As(err, &rle) {
+				t.Fatalf("generateWebSocketURL() error = %v, want RateLimitedError", err)
+			}
+			if rle.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("RateLimitedError.RetryAfter = %v, want %v", rle.RetryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		v    string
+		want time.Duration
+	}{
+		{
+			name: "missing",
+			want: time.Second,
+		},
+		{
+			name: "seconds",
+			v:    "30",
+			want: 30 * time.Second,
+		},
+		{
+			name: "zero",
+			v:    "0",
+		},
+		{
+			name: "negative",
+			v:    "-5",
+			want: time.Second,
+		},
+		{
+			name: "http_date",
+			v:    now.Add(time.Minute).Format(http.TimeFormat),
+			want: time.Minute,
+		},
+		{
+			name: "past_http_date",
+			v:    now.Add(-time.Minute).Format(http.TimeFormat),
+		},
+		{
+			name: "invalid",
+			v:    "soon",
+			want: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.v, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeClient records the effects of Socket Mode envelopes on a [websocket.Client].
+type fakeClient struct {
+	msgs    chan websocket.Message
+	refresh []time.Duration
+	sent    []eventResponse
+	sendErr error
+}
+
+func (f *fakeClient) IncomingMessages() <-chan websocket.Message {
+	return f.msgs
+}
+
+func (f *fakeClient) RefreshConnectionIn(d time.Duration) {
+	f.refresh = append(f.refresh, d)
+}
+
+func (f *fakeClient) SendJSONMessage(v any) error {
+	f.sent = append(f.sent, v.(eventResponse))
+	return nil
+}
+
+func TestExtractPayloadAndAck(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantRefresh  bool
+		wantMaxDelay time.Duration
+		wantAck      bool
+		wantEnvelope bool
+	}{
+		{
+			name:         "hello",
+			data:         `{"type":"hello","num_connections":1,"debug_info":{"approximate_connection_time":3600}}`,
+			wantRefresh:  true,
+			wantMaxDelay: time.Hour,
+		},
+		{
+			name:        "disconnect_warning",
+			data:        `{"type":"disconnect","reason":"warning","debug_info":{"host":"h"}}`,
+			wantRefresh: true,
+		},
+		{
+			name:        "disconnect_refresh_requested",
+			data:        `{"type":"disconnect","reason":"refresh_requested"}`,
+			wantRefresh: true,
+		},
+		{
+			name: "disconnect_link_disabled",
+			data: `{"type":"disconnect","reason":"link_disabled"}`,
+		},
+		{
+			name:         "events_api",
+			data:         `{"type":"events_api","envelope_id":"E1","payload":{"type":"event_callback"}}`,
+			wantAck:      true,
+			wantEnvelope: true,
+		},
+		{
+			name:         "interactive",
+			data:         `{"type":"interactive","envelope_id":"E2","payload":{"type":"block_actions"}}`,
+			wantAck:      true,
+			wantEnvelope: true,
+		},
+		{
+			name:         "slash_commands",
+			data:         `{"type":"slash_commands","envelope_id":"E3","payload":{"command":"/foo","text":"bar"}}`,
+			wantAck:      true,
+			wantEnvelope: true,
+		},
+		{
+			name: "events_api_without_payload",
+			data: `{"type":"events_api","envelope_id":"E4"}`,
+		},
+		{
+			name: "unknown_without_payload",
+			data: `{"type":"foo"}`,
+		},
+		{
+			name: "invalid_json",
+			data: `{"type":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zerolog.Nop().WithContext(t.Context())
+			c := &fakeClient{}
+			raw := websocket.Message{Opcode: websocket.OpcodeText, Data: []byte(tt.data)}
+
+			env, err := extractPayload(ctx, c, raw)
+			if err != nil {
+				t.Fatalf("extractPayload() error = %v", err)
+			}
+			if env != nil {
+				if err := ackEnvelope(ctx, c, env); err != nil {
+					t.Fatalf("ackEnvelope() error = %v", err)
+				}
+			}
+
+			if got := len(c.refresh) > 0; got != tt.wantRefresh {
+				t.Errorf("connection refreshed = %v, want %v", got, tt.wantRefresh)
+			}
+			if tt.wantRefresh && c.refresh[0] > tt.wantMaxDelay {
+				t.Errorf("connection refresh delay = %v, want at most %v", c.refresh[0], tt.wantMaxDelay)
+			}
+			if got := env != nil; got != tt.wantEnvelope {
+				t.Errorf("extracted envelope = %v, want %v", env, tt.wantEnvelope)
+			}
+			if got := len(c.sent) > 0; got != tt.wantAck {
+				t.Errorf("envelope acked = %v, want %v", got, tt.wantAck)
+			}
+			if tt.wantAck && c.sent[0].EnvelopeID != env.ID {
+				t.Errorf("ack envelope ID = %q, want %q", c.sent[0].EnvelopeID, env.ID)
+			}
+		})
+	}
+}
+
+func TestAckEnvelopeSlashCommand(t *testing.T) {
+	c := &fakeClient{}
+	msg := socketModeMessage{Type: "slash_commands", EnvelopeID: "E1", Payload: map[string]any{"command": "/foo", "text": "bar"}}
+	env := &receivers.Envelope{ID: msg.EnvelopeID, Payload: msg.Payload, Message: msg}
+
+	if err := ackEnvelope(t.Context(), c, env); err != nil {
+		t.Fatalf("ackEnvelope() error = %v", err)
+	}
+	if len(c.sent) != 1 || c.sent[0].Payload == nil {
+		t.Fatalf("ack = %+v, want a response payload", c.sent)
+	}
+}
@@ -0,0 +1,253 @@
+// Package sqs implements a stateful connection which long-polls asynchronous
+// event notifications from an [Amazon SQS] queue.
+//
+// Thrippy links of this type must have a "queue_url", a "region", and static
+// credentials: an "access_key_id" and a "secret_access_key", and optionally
+// a "session_token". They may also have an "endpoint_url", e.g. for testing
+// with a local SQS-compatible server.
+//
+// [Amazon SQS]: https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/welcome.html
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+)
+
+const (
+	// LinkType identifies this package's events (see [dispatch.Event.LinkType]).
+	LinkType = "sqs"
+
+	maxMessages    = 10 // Maximum allowed by SQS, also in batch requests.
+	waitTime       = 20 // Seconds, maximum allowed by SQS for long-polling.
+	receiveTimeout = 30 * time.Second
+
+	// Received messages are hidden from other consumers for this long, and
+	// their visibility timeouts are extended periodically while they wait in
+	// the dispatch queue, so SQS doesn't redeliver them before they're deleted.
+	visibilityTimeout = 60 // Seconds.
+	extendInterval    = 20 * time.Second
+
+	// Visibility timeouts of messages which failed to be dispatched,
+	// i.e. delays before their redelivery, which grow exponentially
+	// with their receive counts, up to the maximum allowed by SQS.
+	minRetryDelay = 10 * time.Second
+	maxRetryDelay = 12 * time.Hour
+)
+
+// api is the subset of the SQS client which this package uses.
+type api interface {
+	ReceiveMessage(ctx context.Context, in *awssqs.ReceiveMessageInput, opts ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, in *awssqs.DeleteMessageInput, opts ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, in *awssqs.ChangeMessageVisibilityInput, opts ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error)
+	ChangeMessageVisibilityBatch(ctx context.Context, in *awssqs.ChangeMessageVisibilityBatchInput, opts ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityBatchOutput, error)
+}
+
+// ConnectionHandler starts long-polling messages from the link's SQS queue, and
+// dispatches them as events. Messages are deleted after their events are dispatched
+// successfully. Messages which fail to be dispatched are left in the queue, and
+// become visible again for redelivery after an exponentially growing delay.
+func ConnectionHandler(ctx context.Context, data links.LinkData) int {
+	l := zerolog.Ctx(ctx).With().Str("link_type", LinkType).Str("link_medium", "sqs").Logger()
+
+	c, err := newClient(data.Secrets)
+	if err != nil {
+		l.Warn().Err(err).Msg("Thrippy link missing required credentials")
+		return http.StatusForbidden
+	}
+
+	r := &receiver{c: c, queueURL: data.Secrets["queue_url"], linkID: data.ID}
+	l = l.With().Str("queue_url", r.queueURL).Logger()
+
+	if err := r.start(l.WithContext(ctx)); err != nil {
+		l.Err(err).Msg("failed to start SQS receiver")
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+func newClient(secrets map[string]string) (*awssqs.Client, error) {
+	if secrets["queue_url"] == "" || secrets["region"] == "" {
+		return nil, errors.New("missing queue URL or region")
+	}
+
+	key, secret := secrets["access_key_id"], secrets["secret_access_key"]
+	if key == "" || secret == "" {
+		return nil, errors.New("missing access key ID or secret access key")
+	}
+
+	opts := awssqs.Options{
+		Region:      secrets["region"],
+		Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(key, secret, secrets["session_token"])),
+	}
+	if u := secrets["endpoint_url"]; u != "" {
+		opts.BaseEndpoint = aws.String(u)
+	}
+
+	return awssqs.New(opts), nil
+}
+
+// receiver long-polls messages from an SQS queue, and dispatches them.
+type receiver struct {
+	c        api
+	queueURL string
+	linkID   string
+}
+
+// start polls and dispatches messages with the [dispatch.Queue] in the
+// given context, until the connection is stopped (see [receivers.RegisterStop]).
+func (r *receiver) start(ctx context.Context) error {
+	return receivers.StartPoller(ctx, receivers.Poller[types.Message]{
+		Receive: r.receive,
+		Event: func(m types.Message) dispatch.Event {
+			return newEvent(r.linkID, m)
+		},
+		Ack:         r.ack,
+		Extend:      r.extend,
+		ExtendEvery: extendInterval,
+	})
+}
+
+func (r *receiver) receive(ctx context.Context) ([]types.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, receiveTimeout)
+	defer cancel()
+
+	out, err := r.c.ReceiveMessage(ctx, &awssqs.ReceiveMessageInput{
+		QueueUrl:                    aws.String(r.queueURL),
+		MaxNumberOfMessages:         maxMessages,
+		WaitTimeSeconds:             waitTime,
+		VisibilityTimeout:           visibilityTimeout,
+		MessageAttributeNames:       []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Messages, nil
+}
+
+// ack deletes a dispatched message from the queue, or delays the redelivery of a message
+// which failed to be dispatched. Errors are only logged: SQS redelivers messages which
+// aren't deleted before their visibility timeouts expire.
+func (r *receiver) ack(ctx context.Context, m types.Message, dispatchErr error) {
+	l := zerolog.Ctx(ctx).With().Str("message_id", aws.ToString(m.MessageId)).Logger()
+
+	if dispatchErr == nil {
+		_, err := r.c.DeleteMessage(ctx, &awssqs.DeleteMessageInput{
+			QueueUrl:      aws.String(r.queueURL),
+			ReceiptHandle: m.ReceiptHandle,
+		})
+		if err != nil {
+			l.Err(err).Msg("failed to delete dispatched SQS message")
+		}
+		return
+	}
+
+	delay := retryDelay(m)
+	_, err := r.c.ChangeMessageVisibility(ctx, &awssqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(r.queueURL),
+		ReceiptHandle:     m.ReceiptHandle,
+		VisibilityTimeout: int32(delay.Seconds()),
+	})
+	if err != nil {
+		l.Err(err).Msg("failed to delay the redelivery of SQS message")
+		return
+	}
+	l.Warn().AnErr("dispatch_error", dispatchErr).Dur("retry_in", delay).Msg("SQS message will be redelivered")
+}
+
+// extend resets the visibility timeouts of messages which are still waiting
+// in the dispatch queue, in batches. Errors are only logged: the worst case is
+// that SQS redelivers these messages, and they're dispatched more than once.
+func (r *receiver) extend(ctx context.Context, msgs []types.Message) {
+	l := zerolog.Ctx(ctx)
+	for batch := range slices.Chunk(msgs, maxMessages) {
+		entries := make([]types.ChangeMessageVisibilityBatchRequestEntry, len(batch))
+		for i, m := range batch {
+			entries[i] = types.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     m.ReceiptHandle,
+				VisibilityTimeout: visibilityTimeout,
+			}
+		}
+
+		batchCtx, cancel := context.WithTimeout(ctx, receiveTimeout)
+		out, err := r.c.ChangeMessageVisibilityBatch(batchCtx, &awssqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(r.queueURL),
+			Entries:  entries,
+		})
+		cancel()
+
+		if err != nil {
+			l.Err(err).Int("count", len(batch)).Msg("failed to extend the visibility of pending SQS messages")
+			continue
+		}
+		for _, f := range out.Failed {
+			l.Warn().Str("code", aws.ToString(f.Code)).Str("error_message", aws.ToString(f.Message)).
+				Msg("failed to extend the visibility of pending SQS message")
+		}
+	}
+}
+
+// retryDelay returns the visibility timeout of a message which failed to be
+// dispatched, based on the number of times it was received (starting from 1).
+func retryDelay(m types.Message) time.Duration {
+	n, err := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	if err != nil || n < 1 {
+		n = 1
+	}
+
+	d := minRetryDelay
+	for i := 1; i < n && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryDelay)
+}
+
+// newEvent converts an SQS message into an event. If the message's body
+// is valid JSON, it's decoded in the payload, otherwise it's a string.
+func newEvent(linkID string, m types.Message) dispatch.Event {
+	attrs := make(map[string]any, len(m.MessageAttributes))
+	for k, v := range m.MessageAttributes {
+		if v.StringValue != nil {
+			attrs[k] = *v.StringValue
+		} else if v.BinaryValue != nil {
+			attrs[k] = v.BinaryValue // Base64-encoded in JSON.
+		}
+	}
+
+	b := []byte(aws.ToString(m.Body))
+	var body any = string(b)
+	if json.Valid(b) {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		_ = dec.Decode(&body)
+	}
+
+	payload := map[string]any{
+		"message_id": aws.ToString(m.MessageId),
+		"attributes": attrs,
+		"body":       body,
+	}
+	if n := m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]; n != "" {
+		payload["receive_count"] = json.Number(n)
+	}
+
+	return dispatch.Event{LinkID: linkID, LinkType: LinkType, ReceivedAt: time.Now(), Payload: payload}
+}
@@ -0,0 +1,335 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/tzrikka/omdient/internal/links"
+	"github.com/tzrikka/omdient/pkg/dispatch"
+	"github.com/tzrikka/omdient/pkg/links/receivers"
+)
+
+const testQueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/queue"
+
+// mockSQS returns each message once, and records deleted messages,
+// visibility changes, and visibility extension batches, by receipt handle.
+type mockSQS struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	pending    []types.Message
+	deleted    []string
+	visibility map[string]int32
+	extended   [][]string
+}
+
+func (m *mockSQS) ReceiveMessage(ctx context.Context, in *awssqs.ReceiveMessageInput, _ ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
+	if aws.ToString(in.QueueUrl) != testQueueURL {
+		m.t.Errorf("ReceiveMessage() queue URL = %q, want %q", aws.ToString(in.QueueUrl), testQueueURL)
+	}
+	if in.WaitTimeSeconds != waitTime || in.VisibilityTimeout != visibilityTimeout {
+		m.t.Errorf("ReceiveMessage() wait time = %d, visibility timeout = %d", in.WaitTimeSeconds, in.VisibilityTimeout)
+	}
+
+	m.mu.Lock()
+	msgs := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	if len(msgs) == 0 {
+		// Simulate a short long-poll.
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return &awssqs.ReceiveMessageOutput{Messages: msgs}, nil
+}
+
+func (m *mockSQS) DeleteMessage(_ context.Context, in *awssqs.DeleteMessageInput, _ ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, aws.ToString(in.ReceiptHandle))
+	return &awssqs.DeleteMessageOutput{}, nil
+}
+
+func (m *mockSQS) ChangeMessageVisibility(_ context.Context, in *awssqs.ChangeMessageVisibilityInput, _ ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visibility[aws.ToString(in.ReceiptHandle)] = in.VisibilityTimeout
+	return &awssqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (m *mockSQS) ChangeMessageVisibilityBatch(_ context.Context, in *awssqs.ChangeMessageVisibilityBatchInput, _ ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityBatchOutput, error) {
+	var handles []string
+	for _, e := range in.Entries {
+		if e.VisibilityTimeout != visibilityTimeout {
+			m.t.Errorf("ChangeMessageVisibilityBatch() visibility timeout = %d, want %d", e.VisibilityTimeout, visibilityTimeout)
+		}
+		handles = append(handles, aws.ToString(e.ReceiptHandle))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.extended = append(m.extended, handles)
+	return &awssqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+// recordingDispatcher records delivered events, and fails
+// to deliver events whose body is the string "fail".
+type recordingDispatcher struct {
+	mu     sync.Mutex
+	events []dispatch.Event
+}
+
+func (r *recordingDispatcher) Dispatch(_ context.Context, e dispatch.Event) error {
+	if e.Payload["body"] == "fail" {
+		return errors.New("delivery error")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func message(id, body, receiveCount string) types.Message {
+	return types.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String("handle-" + id),
+		Body:          aws.String(body),
+		Attributes:    map[string]string{"ApproximateReceiveCount": receiveCount},
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets map[string]string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			secrets: map[string]string{
+				"queue_url": testQueueURL, "region": "us-east-1",
+				"access_key_id": "key", "secret_access_key": "secret",
+			},
+		},
+		{
+			name: "custom_endpoint",
+			secrets: map[string]string{
+				"queue_url": "http://localhost:4566/000000000000/queue", "region": "us-east-1",
+				"access_key_id": "key", "secret_access_key": "secret", "endpoint_url": "http://localhost:4566",
+			},
+		},
+		{
+			name:    "missing_queue_url",
+			secrets: map[string]string{"region": "us-east-1", "access_key_id": "key", "secret_access_key": "secret"},
+			wantErr: true,
+		},
+		{
+			name:    "missing_credentials",
+			secrets: map[string]string{"queue_url": testQueueURL, "region": "us-east-1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newClient(tt.secrets); (err != nil) != tt.wantErr {
+				t.Errorf("newClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnectionHandlerMissingSecrets(t *testing.T) {
+	data := links.LinkData{ID: "id", Template: LinkType, Secrets: map[string]string{}}
+	if got := ConnectionHandler(t.Context(), data); got != http.StatusForbidden {
+		t.Errorf("ConnectionHandler() = %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+// start starts a receiver with the given dispatch queue, and returns its stop function.
+func start(t *testing.T, c api, q *dispatch.Queue) receivers.StopFunc {
+	t.Helper()
+
+	var stop receivers.StopFunc
+	ctx := receivers.ContextWithStopper(dispatch.WithQueue(t.Context(), q), func(f receivers.StopFunc) {
+		stop = f
+	})
+
+	r := &receiver{c: c, queueURL: testQueueURL, linkID: "link"}
+	if err := r.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stop == nil {
+		t.Fatal("receiver didn't register a stop function")
+	}
+
+	t.Cleanup(stop)
+	return stop
+}
+
+func TestReceiver(t *testing.T) {
+	m := &mockSQS{t: t, visibility: map[string]int32{}, pending: []types.Message{
+		message("1", `{"n":1}`, "1"),
+		message("2", "fail", "3"),
+		message("3", "text", "1"),
+	}}
+
+	d := &recordingDispatcher{}
+	q := dispatch.NewQueue(d, 10, func(dispatch.Event, error) {})
+
+	stop := start(t, m, q)
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		m.mu.Lock()
+		done := len(m.deleted)+len(m.visibility) == 3
+		m.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if want := []string{"handle-1", "handle-3"}; !reflect.DeepEqual(m.deleted, want) {
+		t.Errorf("deleted messages = %v, want %v", m.deleted, want)
+	}
+	// The failed message was received 3 times, so its redelivery is delayed by 10s * 2^2.
+	if want := map[string]int32{"handle-2": 40}; !reflect.DeepEqual(m.visibility, want) {
+		t.Errorf("visibility changes = %v, want %v", m.visibility, want)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.events) != 2 {
+		t.Fatalf("dispatched events = %d, want 2", len(d.events))
+	}
+	if e := d.events[0]; e.LinkID != "link" || e.LinkType != LinkType {
+		t.Errorf("dispatched event = %+v", e)
+	}
+}
+
+func TestReceiverEnqueueError(t *testing.T) {
+	m := &mockSQS{t: t, visibility: map[string]int32{}, pending: []types.Message{message("1", "a", "1")}}
+
+	q := dispatch.NewQueue(&recordingDispatcher{}, 0, nil)
+	_ = q.Shutdown(t.Context()) // Closed queues reject all events.
+
+	stop := start(t, m, q)
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		m.mu.Lock()
+		done := len(m.visibility) > 0
+		m.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.deleted) > 0 {
+		t.Errorf("deleted messages = %v, want none", m.deleted)
+	}
+	if want := map[string]int32{"handle-1": 10}; !reflect.DeepEqual(m.visibility, want) {
+		t.Errorf("visibility changes = %v, want %v", m.visibility, want)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	var msgs []types.Message
+	for i := range maxMessages + 2 {
+		msgs = append(msgs, message(strconv.Itoa(i), "", "1"))
+	}
+
+	m := &mockSQS{t: t}
+	r := &receiver{c: m, queueURL: testQueueURL, linkID: "link"}
+	r.extend(t.Context(), msgs)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.extended) != 2 || len(m.extended[0]) != maxMessages || len(m.extended[1]) != 2 {
+		t.Fatalf("visibility extension batches = %v", m.extended)
+	}
+	if got := m.extended[1][1]; got != "handle-11" {
+		t.Errorf("last extended message = %q, want %q", got, "handle-11")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name         string
+		receiveCount string
+		want         time.Duration
+	}{
+		{
+			name: "missing",
+			want: minRetryDelay,
+		},
+		{
+			name:         "first",
+			receiveCount: "1",
+			want:         minRetryDelay,
+		},
+		{
+			name:         "fourth",
+			receiveCount: "4",
+			want:         8 * minRetryDelay,
+		},
+		{
+			name:         "capped",
+			receiveCount: "100",
+			want:         maxRetryDelay,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(message("1", "", tt.receiveCount)); got != tt.want {
+				t.Errorf("retryDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	m := message("1", `{"id":9007199254740993}`, "2")
+	m.MessageAttributes = map[string]types.MessageAttributeValue{
+		"type": {DataType: aws.String("String"), StringValue: aws.String("created")},
+	}
+
+	got := newEvent("link", m)
+	want := map[string]any{
+		"message_id":    "1",
+		"attributes":    map[string]any{"type": "created"},
+		"body":          map[string]any{"id": json.Number("9007199254740993")},
+		"receive_count": json.Number("2"),
+	}
+
+	if got.LinkID != "link" || got.LinkType != LinkType {
+		t.Errorf("newEvent() = %+v", got)
+	}
+	if !reflect.DeepEqual(got.Payload, want) {
+		t.Errorf("newEvent() payload = %#v, want %#v", got.Payload, want)
+	}
+}
@@ -5,43 +5,211 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"math/rand/v2"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
+
+	"github.com/tzrikka/omdient/internal/metrics"
 )
 
 var clients = sync.Map{}
 
+const (
+	defaultMaxReconnects     = 5
+	defaultReconnectWindow   = time.Minute
+	defaultReconnectCooldown = time.Minute
+
+	defaultReconnectBackoff    = 250 * time.Millisecond
+	defaultMaxReconnectBackoff = 30 * time.Second
+
+	defaultRelayTimeout = 10 * time.Second
+)
+
+// DefaultMaxConcurrentReconnects is the default of [SetMaxConcurrentReconnects].
+const DefaultMaxConcurrentReconnects = 10
+
+// reconnectSlots limits the number of simultaneous reconnection dials
+// across all [Client]s (see [SetMaxConcurrentReconnects]). Nil = unlimited.
+var (
+	reconnectSlots   = make(chan struct{}, DefaultMaxConcurrentReconnects)
+	reconnectSlotsMu sync.RWMutex
+)
+
 // Client is a long-running wrapper of connections to the same WebSocket
 // server with the same credentials. It usually manages a single [Conn],
 // except when it gets disconnected, or is about to be, in which case the
 // client automatically opens another [Conn] and switches to it seamlessly,
 // to prevent or at least minimize downtime during reconnections.
 type Client struct {
-	logger *zerolog.Logger
-	url    urlFunc
-	opts   []DialOpt
+	logger   *zerolog.Logger
+	url      urlFunc
+	opts     []DialOpt
+	hashedID string
 
 	conns   [2]*Conn
+	connsMu sync.RWMutex // Protects only the array, not the connections.
 	inMsgs  <-chan Message
 	outMsgs chan Message
 
-	refresh *time.Timer
+	refresh   *time.Timer
+	refreshMu sync.Mutex // Protects only the timer pointer.
+	lifecycle []LifecycleFunc
+
+	// Closed by [Client.Close], to stop relaying messages and reconnecting.
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCtx  context.Context // See [WithCloseContext].
+	stopCtx   func() bool     // Unregisters the client from closeCtx.
+
+	// Protection against missing or stuck subscribers.
+	relayTimeout time.Duration
+	dropped      int
+
+	// Reconnection rate limiting.
+	maxReconnects     int
+	reconnectWindow   time.Duration
+	reconnectCooldown time.Duration
+	reconnects        []time.Time
+
+	// Reconnection backoff with full jitter.
+	reconnectBackoff    time.Duration
+	maxReconnectBackoff time.Duration
+
+	// Consecutive failed reconnection attempts before giving up (0 = never).
+	maxFailedReconnects int
+
+	// Introspection (see [ListClients] and [Client.Stats]).
+	statsMu      sync.Mutex
+	pastStats    ConnStats // Of replaced connections.
+	subscribers  int
+	lastActivity time.Time
+	lastErr      error
+	lastErrAt    time.Time
 }
 
 type urlFunc func(ctx context.Context) (string, error)
 
+// ClientOpt lets callers of [NewOrCachedClientWithOpts] customize a new [Client].
+type ClientOpt func(*Client)
+
+// WithDialOpts lets callers of [NewOrCachedClientWithOpts] specify [DialOpt]s
+// which are applied to every [Conn] that the [Client] opens.
+func WithDialOpts(opts ...DialOpt) ClientOpt {
+	return func(c *Client) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+// WithReconnectRate lets callers of [NewOrCachedClientWithOpts] limit the rate of
+// reconnections to the WebSocket server, to avoid self-inflicted rate-limit
+// bans by service providers when the server keeps closing new connections.
+//
+// The client opens at most n new connections within the given duration of
+// time. Once this limit is exceeded, the client logs a warning and waits for
+// the given cool-down duration before trying to reconnect again.
+//
+// The default is 5 reconnections per minute, with a 1-minute cool-down.
+func WithReconnectRate(n int, per, cooldown time.Duration) ClientOpt {
+	return func(c *Client) {
+		c.maxReconnects = n
+		c.reconnectWindow = per
+		c.reconnectCooldown = cooldown
+	}
+}
+
+// WithMaxReconnects lets callers of [NewOrCachedClientWithOpts] limit the number of
+// consecutive failed attempts to reconnect to the WebSocket server. After n
+// such failures, the client gives up: it closes itself as if the last subscriber
+// called [Client.Close], and emits a [ClientGaveUp] event (see [WithLifecycleFunc]),
+// so operators get alerted about persistent errors instead of endless retries.
+//
+// The default is 0, which means unlimited retries (but see [WithReconnectRate]).
+func WithMaxReconnects(n int) ClientOpt {
+	return func(c *Client) {
+		c.maxFailedReconnects = n
+	}
+}
+
+// WithReconnectBackoff lets callers of [NewOrCachedClientWithOpts] customize the delay
+// before each attempt to reconnect to the WebSocket server. The delay is random
+// ("full jitter"), up to the given base duration, which doubles after each failed
+// attempt, up to the given maximum. This prevents a thundering herd of clients
+// from reconnecting at once when the server drops many connections simultaneously.
+//
+// The default is a base of 250 milliseconds, and a maximum of 30 seconds.
+func WithReconnectBackoff(base, maximum time.Duration) ClientOpt {
+	return func(c *Client) {
+		c.reconnectBackoff = base
+		c.maxReconnectBackoff = maximum
+	}
+}
+
+// SetMaxConcurrentReconnects limits the number of simultaneous attempts to
+// reconnect to WebSocket servers, across all the [Client]s in this process,
+// to avoid overwhelming servers (and their connection APIs) when they drop
+// many connections simultaneously. Zero or a negative number means no limit.
+//
+// The default is [DefaultMaxConcurrentReconnects]. Changes don't affect
+// attempts which are already waiting or in progress.
+func SetMaxConcurrentReconnects(n int) {
+	var slots chan struct{}
+	if n > 0 {
+		slots = make(chan struct{}, n)
+	}
+
+	reconnectSlotsMu.Lock()
+	defer reconnectSlotsMu.Unlock()
+	reconnectSlots = slots
+}
+
+// WithCloseContext lets callers of [NewOrCachedClientWithOpts] bind the lifetime of a
+// new [Client] to the given context: when it's canceled, the client is closed
+// regardless of its subscribers, as if the last one called [Client.Close].
+//
+// This is ignored if [NewOrCachedClientWithOpts] returns an existing client.
+func WithCloseContext(ctx context.Context) ClientOpt {
+	return func(c *Client) {
+		c.closeCtx = ctx
+	}
+}
+
+// WithRelayTimeout lets callers of [NewOrCachedClientWithOpts] limit the time that the
+// client waits for a subscriber to receive each data [Message] from the channel
+// returned by [Client.IncomingMessages]. Unreceived messages are dropped with a
+// warning, so that a client without subscribers doesn't stall forever (which
+// would also block its underlying [Conn] and prevent reconnections).
+//
+// The default is 10 seconds.
+func WithRelayTimeout(d time.Duration) ClientOpt {
+	return func(c *Client) {
+		c.relayTimeout = d
+	}
+}
+
+// NewOrCachedClient returns the existing [Client] with the given ID, if there is
+// one, or opens a new one, whose connections are customized by the given [DialOpt]s.
 func NewOrCachedClient(ctx context.Context, url urlFunc, id string, opts ...DialOpt) (*Client, error) {
+	return NewOrCachedClientWithOpts(ctx, url, id, WithDialOpts(opts...))
+}
+
+// NewOrCachedClientWithOpts is like [NewOrCachedClient], but a new
+// client is customized by the given [ClientOpt]s (e.g. [WithReconnectRate]).
+func NewOrCachedClientWithOpts(ctx context.Context, url urlFunc, id string, opts ...ClientOpt) (*Client, error) {
 	hashedID := hash(id)
 	if client, ok := clients.Load(hashedID); ok {
-		return client.(*Client), nil
+		c := client.(*Client)
+		c.addSubscriber()
+		return c, nil
 	}
 
 	c, err := newClient(ctx, url, opts...)
 	if err != nil {
 		return nil, err
 	}
+	c.hashedID = hashedID
 
 	actual, loaded := clients.LoadOrStore(hashedID, c)
 	if loaded { // Stored by a different goroutine since clients.Load() above.
@@ -50,7 +218,9 @@ func NewOrCachedClient(ctx context.Context, url urlFunc, id string, opts ...Dial
 		go c.relayMessages()
 	}
 
-	return actual.(*Client), nil
+	c = actual.(*Client)
+	c.addSubscriber()
+	return c, nil
 }
 
 // hash generates a stable-but-irreversible SHA-256 hash of a [Client] ID.
@@ -60,20 +230,41 @@ func hash(id string) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-func newClient(ctx context.Context, f urlFunc, opts ...DialOpt) (*Client, error) {
-	conn, err := newConn(ctx, f, opts...)
+func newClient(ctx context.Context, f urlFunc, opts ...ClientOpt) (*Client, error) {
+	c := &Client{
+		logger: zerolog.Ctx(ctx),
+		url:    f,
+
+		maxReconnects:     defaultMaxReconnects,
+		reconnectWindow:   defaultReconnectWindow,
+		reconnectCooldown: defaultReconnectCooldown,
+
+		reconnectBackoff:    defaultReconnectBackoff,
+		maxReconnectBackoff: defaultMaxReconnectBackoff,
+
+		relayTimeout: defaultRelayTimeout,
+
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	conn, err := newConn(ctx, f, c.opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		logger:  zerolog.Ctx(ctx),
-		url:     f,
-		opts:    opts,
-		conns:   [2]*Conn{conn},
-		inMsgs:  conn.IncomingMessages(),
-		outMsgs: make(chan Message),
-	}, nil
+	c.conns = [2]*Conn{conn}
+	c.inMsgs = conn.IncomingMessages()
+	c.outMsgs = make(chan Message)
+
+	if c.closeCtx != nil {
+		c.stopCtx = context.AfterFunc(c.closeCtx, c.close)
+	}
+
+	c.emit(LifecycleEvent{Type: ConnEstablished})
+	return c, nil
 }
 
 func newConn(ctx context.Context, f urlFunc, opts ...DialOpt) (*Conn, error) {
@@ -93,56 +284,301 @@ func (c *Client) newConn(f urlFunc, opts ...DialOpt) (*Conn, error) {
 // deleteClient deletes a newly-created [Client] which is not needed anymore,
 // because a different one was already activated with the same ID.
 func deleteClient(c *Client) {
-	c.conns[0].Close(StatusGoingAway)
+	c.primaryConn().Close(StatusGoingAway)
+	c.close() // Not cached, and its message relay was never activated.
 
 	c.logger = nil
 	c.url = nil
 	c.opts = nil
 
+	c.connsMu.Lock()
 	c.conns = [2]*Conn{}
+	c.connsMu.Unlock()
 	c.inMsgs = nil
 	c.outMsgs = nil
 }
 
+// Close unsubscribes a caller of [NewOrCachedClient] from the client. When the
+// last subscriber unsubscribes, the client is removed from the cache, closes its
+// underlying connections without replacing them, and then closes the channel
+// returned by [Client.IncomingMessages]. Subsequent calls to [NewOrCachedClient]
+// with the same ID create a new client.
+//
+// The client also closes itself, instead of reconnecting endlessly, if the server
+// rejects its credentials during a reconnection (see [HandshakeError]), or after
+// too many failed reconnection attempts (see [WithMaxReconnects]).
+func (c *Client) Close() {
+	c.statsMu.Lock()
+	c.subscribers--
+	last := c.subscribers <= 0
+	c.statsMu.Unlock()
+
+	if last {
+		c.close()
+	}
+}
+
+// close closes the client regardless of its subscribers (see [Client.Close]).
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		clients.CompareAndDelete(c.hashedID, c)
+		close(c.done)
+		if c.stopCtx != nil {
+			c.stopCtx()
+		}
+		c.refreshMu.Lock()
+		if c.refresh != nil {
+			c.refresh.Stop()
+		}
+		c.refreshMu.Unlock()
+
+		c.connsMu.RLock()
+		conns := c.conns
+		c.connsMu.RUnlock()
+
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close(StatusNormalClosure)
+			}
+		}
+		c.logger.Debug().Msg("WebSocket client closed")
+	})
+}
+
+// isClosed reports whether the client was closed (see [Client.Close]).
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
 // relayMessages runs as a [Client] goroutine, to route data [Message]s
-// from the client's underlying [Conn] to the client's subscribers.
+// from the client's underlying [Conn] to the client's subscribers, until
+// the client is closed (see [Client.Close] and [WithCloseContext]).
 func (c *Client) relayMessages() {
 	for {
-		if msg, ok := <-c.inMsgs; ok {
-			c.outMsgs <- msg
-			continue
+		select {
+		case msg, ok := <-c.inMsgs:
+			if ok {
+				c.relay(msg)
+				continue
+			}
+		case <-c.done:
+			c.stopRelay()
+			return
 		}
 
+		// Connections that the client closes itself, when it's closed (e.g. after
+		// giving up), aren't reported, only unexpected closures are (once each).
+		if c.isClosed() {
+			c.stopRelay()
+			return
+		}
+
+		status := c.primaryConn().CloseStatus()
+		c.logger.Debug().Str("close_status", status.String()).Msg("WebSocket connection closed")
+		c.emit(LifecycleEvent{Type: ConnClosed, CloseStatus: status})
 		c.replaceConn()
 	}
 }
 
+// stopRelay closes the channel returned by [Client.IncomingMessages], and then
+// discards unrelayed messages from the client's closing connections, so that
+// their goroutines don't block forever, until the connections are closed.
+func (c *Client) stopRelay() {
+	close(c.outMsgs)
+
+	c.connsMu.RLock()
+	conns := c.conns
+	c.connsMu.RUnlock()
+
+	for _, conn := range conns {
+		if conn != nil {
+			for range conn.IncomingMessages() {
+			}
+		}
+	}
+}
+
+// relay publishes a data [Message] to the client's subscribers, or drops it
+// if none of them receives it before the client's relay timeout expires.
+func (c *Client) relay(msg Message) {
+	c.statsMu.Lock()
+	c.lastActivity = msg.ReceivedAt
+	c.statsMu.Unlock()
+
+	t := time.NewTimer(c.relayTimeout)
+	defer t.Stop()
+
+	select {
+	case c.outMsgs <- msg:
+		c.dropped = 0
+	case <-c.done:
+	case <-t.C:
+		c.dropped++
+		c.logger.Warn().Str("opcode", msg.Opcode.String()).Int("consecutive_drops", c.dropped).
+			Dur("timeout", c.relayTimeout).Msg("dropped unconsumed WebSocket message")
+	}
+}
+
 // replaceConn either creates a new [Conn] (if the existing one is
 // closing/closed), or switches seamlessly to a secondary one which
 // was created by the timer-based goroutine in [RefreshConnectionIn].
 func (c *Client) replaceConn() {
 	defer func() {
-		c.inMsgs = c.conns[0].IncomingMessages()
+		c.inMsgs = c.primaryConn().IncomingMessages()
+		if !c.isClosed() {
+			metrics.WebSocketReconnections.Inc()
+			c.emit(LifecycleEvent{Type: ConnReconnected})
+		}
 	}()
 
 	// Switch to a fresh secondary connection.
+	c.connsMu.Lock()
 	if c.conns[1] != nil {
+		c.retireStats(c.conns[0])
 		c.conns[0] = c.conns[1]
 		c.conns[1] = nil
+		c.connsMu.Unlock()
 		return
 	}
+	c.connsMu.Unlock()
 
-	// Create a new connection, with endless retries.
+	// Create a new connection, with endless (but rate-limited and jittered) retries.
 	i := 0
-	for {
+	for !c.isClosed() {
+		if !c.throttleReconnect() || !c.sleep(c.backoff(i)) {
+			return
+		}
+
+		release, ok := acquireReconnectSlot(c.done)
+		if !ok {
+			return
+		}
 		conn, err := c.newConn(c.url, c.opts...)
+		release()
+
 		if err == nil {
+			c.connsMu.Lock()
+			c.retireStats(c.conns[0])
 			c.conns[0] = conn
+			c.connsMu.Unlock()
+
+			// Don't leak a connection that was opened while the client was closing.
+			if c.isClosed() {
+				conn.Close(StatusNormalClosure)
+			}
 			break
 		}
 
+		c.setErr(err)
+		c.emit(LifecycleEvent{Type: ConnError, Err: err})
+		if isUnauthorized(err) {
+			c.logger.Err(err).Int("retry", i).Msg("WebSocket server rejected the client, giving up")
+			c.giveUp(err)
+			return
+		}
+
 		c.logger.Err(err).Int("retry", i).Msg("failed to replace WebSocket connection")
 		i++
+
+		if c.maxFailedReconnects > 0 && i >= c.maxFailedReconnects {
+			c.logger.Error().Int("attempts", i).Msg("too many failed WebSocket reconnection attempts, giving up")
+			c.giveUp(err)
+			return
+		}
+	}
+}
+
+// giveUp closes the client due to a terminal error (see [ClientGaveUp]).
+func (c *Client) giveUp(err error) {
+	c.emit(LifecycleEvent{Type: ClientGaveUp, Err: err})
+	c.close()
+}
+
+// throttleReconnect enforces the client's maximum reconnection rate (see
+// [WithReconnectRate]), by blocking for a cool-down period when needed. It
+// reports whether the client may reconnect, i.e. it wasn't closed meanwhile.
+func (c *Client) throttleReconnect() bool {
+	now := time.Now()
+	c.reconnects = slices.DeleteFunc(c.reconnects, func(t time.Time) bool {
+		return now.Sub(t) >= c.reconnectWindow
+	})
+
+	if len(c.reconnects) >= c.maxReconnects {
+		c.logger.Warn().Int("reconnections", len(c.reconnects)).Dur("window", c.reconnectWindow).
+			Dur("cooldown", c.reconnectCooldown).Msg("WebSocket reconnection rate exceeded, cooling down")
+		if !c.sleep(c.reconnectCooldown) {
+			return false
+		}
+		c.reconnects = c.reconnects[:0]
+	}
+
+	c.reconnects = append(c.reconnects, time.Now())
+	return true
+}
+
+// backoff returns a random delay before the i-th consecutive attempt to
+// reconnect (see [WithReconnectBackoff]), or 0 if there's no base delay.
+func (c *Client) backoff(i int) time.Duration {
+	if c.reconnectBackoff <= 0 {
+		return 0
+	}
+
+	d := c.reconnectBackoff
+	for range i {
+		if d >= c.maxReconnectBackoff/2 {
+			break
+		}
+		d *= 2
+	}
+	d = min(d, c.maxReconnectBackoff)
+	if d <= 0 {
+		return 0
+	}
+
+	return rand.N(d) //gosec:disable G404 -- jitter doesn't need a secure random source
+}
+
+// sleep waits for the given duration, unless the client is closed
+// before that (see [Client.Close]). It reports whether it waited.
+func (c *Client) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return !c.isClosed()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// acquireReconnectSlot waits until the number of simultaneous reconnection
+// dials is below the limit (see [SetMaxConcurrentReconnects]), unless the
+// given channel is closed before that. It returns a function to release the
+// acquired slot, and reports whether a slot was acquired.
+func acquireReconnectSlot(done <-chan struct{}) (release func(), ok bool) {
+	reconnectSlotsMu.RLock()
+	slots := reconnectSlots
+	reconnectSlotsMu.RUnlock()
+
+	if slots == nil {
+		return func() {}, true
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	case <-done:
+		return nil, false
 	}
 }
 
@@ -157,6 +593,9 @@ func (c *Client) IncomingMessages() <-chan Message {
 // downtime during normal reconnections, which is useful in connections
 // where the disconnection time is known or coordinated in advance.
 func (c *Client) RefreshConnectionIn(d time.Duration) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
 	m := "starting timer to refresh WebSocket connection"
 	if c.refresh != nil {
 		c.refresh.Stop()
@@ -166,16 +605,27 @@ func (c *Client) RefreshConnectionIn(d time.Duration) {
 
 	c.refresh = time.AfterFunc(d, func() {
 		c.logger.Trace().Msg("refreshing WebSocket connection")
+		c.refreshMu.Lock()
 		c.refresh = nil
+		c.refreshMu.Unlock()
 
 		conn, err := c.newConn(c.url, c.opts...)
 		if err != nil {
+			c.setErr(err)
+			c.emit(LifecycleEvent{Type: ConnError, Err: err})
 			c.logger.Err(err).Msg("failed to refresh WebSocket connection")
 			return
 		}
 
+		c.connsMu.Lock()
 		c.conns[1] = conn
-		c.conns[0].Close(StatusGoingAway)
+		primary := c.conns[0]
+		c.connsMu.Unlock()
+		if c.isClosed() {
+			conn.Close(StatusNormalClosure)
+			return
+		}
+		primary.Close(StatusGoingAway)
 	})
 }
 
@@ -186,5 +636,14 @@ func (c *Client) SendJSONMessage(v any) error {
 		return err
 	}
 
-	return <-c.conns[0].SendTextMessage(b)
+	return <-c.primaryConn().SendTextMessage(b)
+}
+
+// primaryConn returns the client's current underlying [Conn]. The caller
+// must not hold connsMu, and must not assume that the result stays current,
+// because [Client.replaceConn] may switch to another one at any time.
+func (c *Client) primaryConn() *Conn {
+	c.connsMu.RLock()
+	defer c.connsMu.RUnlock()
+	return c.conns[0]
 }
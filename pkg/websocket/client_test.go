@@ -1,10 +1,20 @@
 package websocket
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"go.uber.org/goleak"
 )
 
 func TestNewOrCachedClient(t *testing.T) {
@@ -55,6 +65,504 @@ func TestNewOrCachedClient(t *testing.T) {
 	}
 }
 
+func TestClientReconnectRate(t *testing.T) {
+	handshakes := make(chan time.Time, 10)
+	s := newHijackingServer(t, func(conn net.Conn, _ *bufio.ReadWriter) {
+		select {
+		case handshakes <- time.Now():
+		default:
+		}
+		_ = conn.Close() // Immediately close every connection.
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	cooldown := 200 * time.Millisecond
+	c, err := newClient(t.Context(), url, WithReconnectRate(2, time.Minute, cooldown), WithReconnectBackoff(0, 0))
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+	defer c.close()
+
+	// Initial connection + 2 reconnections, then a cool-down before the next one.
+	var times []time.Time
+	for len(times) < 4 {
+		select {
+		case ts := <-handshakes:
+			times = append(times, ts)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("handshakes = %d, want 4", len(times))
+		}
+	}
+
+	if d := times[3].Sub(times[2]); d < cooldown {
+		t.Errorf("delay between 3rd and 4th handshakes = %s, want at least %s", d, cooldown)
+	}
+}
+
+func TestClientCloseDuringReconnectCooldown(t *testing.T) {
+	var handshakes atomic.Int32
+	s := newHijackingServer(t, func(conn net.Conn, _ *bufio.ReadWriter) {
+		handshakes.Add(1)
+		_ = conn.Close() // Immediately close every connection.
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	c, err := newClient(t.Context(), url, WithReconnectRate(1, time.Minute, time.Hour), WithReconnectBackoff(0, 0))
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+
+	// Initial connection + 1 reconnection, then an hour-long cool-down.
+	for handshakes.Load() < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.close()
+	select {
+	case _, ok := <-c.IncomingMessages():
+		if ok {
+			t.Error("IncomingMessages() received a message, want it to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client didn't stop during reconnection cool-down")
+	}
+}
+
+func TestClientMaxReconnects(t *testing.T) {
+	var handshakes atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handshakes.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		// Accept the first connection, and then drop it immediately.
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Sec-WebSocket-Accept", expectedServerAcceptValue(r.Header.Get("Sec-WebSocket-Key")))
+		w.WriteHeader(http.StatusSwitchingProtocols)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	id := "max-reconnects"
+	t.Cleanup(func() { clients.Delete(hash(id)) })
+
+	var mu sync.Mutex
+	var events []LifecycleEvent
+	c, err := NewOrCachedClientWithOpts(t.Context(), url, id, WithMaxReconnects(3), WithReconnectBackoff(0, 0),
+		WithLifecycleFunc(func(e LifecycleEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}))
+	if err != nil {
+		t.Fatalf("NewOrCachedClientWithOpts() error = %v", err)
+	}
+
+	select {
+	case _, ok := <-c.IncomingMessages():
+		if ok {
+			t.Error("IncomingMessages() received a message, want it to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client didn't give up after too many failed reconnections")
+	}
+
+	if got := handshakes.Load(); got != 4 {
+		t.Errorf("handshakes = %d, want 4 (1 + 3 failed reconnections)", got)
+	}
+	if _, ok := clients.Load(hash(id)); ok {
+		t.Error("client is still cached after it gave up")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The dropped connection is reported once, not again when the client gives up.
+	want := []LifecycleEventType{ConnEstablished, ConnClosed, ConnError, ConnError, ConnError, ClientGaveUp}
+	got := make([]LifecycleEventType, len(events))
+	for i, e := range events {
+		got[i] = e.Type
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("lifecycle events = %v, want %v", got, want)
+	}
+
+	var he *HandshakeError
+	if err := events[len(events)-1].Err; !errors.As(err, &he) || he.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("ClientGaveUp error = %v, want HandshakeError with status 503", err)
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    time.Duration
+		maximum time.Duration
+		i       int
+		want    time.Duration // Exclusive upper bound.
+	}{
+		{
+			name: "disabled",
+			i:    3,
+		},
+		{
+			name:    "first_attempt",
+			base:    time.Second,
+			maximum: time.Minute,
+			want:    time.Second,
+		},
+		{
+			name:    "exponential",
+			base:    time.Second,
+			maximum: time.Minute,
+			i:       3,
+			want:    8 * time.Second,
+		},
+		{
+			name:    "capped",
+			base:    time.Second,
+			maximum: time.Minute,
+			i:       10,
+			want:    time.Minute,
+		},
+		{
+			name:    "no_overflow",
+			base:    time.Second,
+			maximum: time.Minute,
+			i:       100,
+			want:    time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{reconnectBackoff: tt.base, maxReconnectBackoff: tt.maximum}
+			for range 100 {
+				got := c.backoff(tt.i)
+				if got < 0 || (got > 0 && got >= tt.want) || (tt.want == 0 && got != 0) {
+					t.Fatalf("Client.backoff(%d) = %v, want [0, %v)", tt.i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentReconnects(t *testing.T) {
+	const clients, limit = 10, 2
+
+	SetMaxConcurrentReconnects(limit)
+	t.Cleanup(func() { SetMaxConcurrentReconnects(DefaultMaxConcurrentReconnects) })
+
+	// Drop all the initial connections at once, but keep reconnections open.
+	var reconnecting atomic.Bool
+	drop, stop := make(chan struct{}), make(chan struct{})
+	s := newHijackingServer(t, func(conn net.Conn, _ *bufio.ReadWriter) {
+		if reconnecting.Load() {
+			<-stop
+		} else {
+			<-drop
+		}
+		_ = conn.Close()
+	})
+	defer s.Close()
+	defer close(stop)
+
+	var dials, inFlight, maxInFlight atomic.Int32
+	url := func(_ context.Context) (string, error) {
+		if reconnecting.Load() {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for m := maxInFlight.Load(); n > m && !maxInFlight.CompareAndSwap(m, n); m = maxInFlight.Load() {
+			}
+			dials.Add(1)
+			time.Sleep(20 * time.Millisecond) // Simulate a slow connection API.
+		}
+		return s.URL, nil
+	}
+
+	for range clients {
+		c, err := newClient(t.Context(), url, WithReconnectBackoff(time.Millisecond, time.Millisecond))
+		if err != nil {
+			t.Fatalf("newClient() error = %v", err)
+		}
+		go c.relayMessages()
+		defer c.close()
+	}
+
+	reconnecting.Store(true)
+	close(drop)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for dials.Load() < clients && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := dials.Load(); got != clients {
+		t.Errorf("reconnection dials = %d, want %d", got, clients)
+	}
+	if got := maxInFlight.Load(); got > limit {
+		t.Errorf("maximum concurrent reconnection dials = %d, want at most %d", got, limit)
+	}
+}
+
+func TestAcquireReconnectSlot(t *testing.T) {
+	SetMaxConcurrentReconnects(1)
+	t.Cleanup(func() { SetMaxConcurrentReconnects(DefaultMaxConcurrentReconnects) })
+
+	release, ok := acquireReconnectSlot(nil)
+	if !ok {
+		t.Fatal("acquireReconnectSlot() = false, want true")
+	}
+
+	// The only slot is taken, so this must wait until the done channel is closed.
+	done := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(done) })
+	if _, ok := acquireReconnectSlot(done); ok {
+		t.Error("acquireReconnectSlot() = true while the limit was reached, want false")
+	}
+
+	release()
+	if release, ok = acquireReconnectSlot(nil); !ok {
+		t.Error("acquireReconnectSlot() = false after release, want true")
+	}
+	release()
+
+	// No limit.
+	SetMaxConcurrentReconnects(0)
+	for range 3 {
+		if _, ok := acquireReconnectSlot(nil); !ok {
+			t.Error("acquireReconnectSlot() = false without a limit, want true")
+		}
+	}
+}
+
+func TestClientSwitchToSecondaryConn(t *testing.T) {
+	var handshakes atomic.Int32
+	stop := make(chan struct{})
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		if handshakes.Add(1) == 1 {
+			// Primary connection: wait for the client to close it.
+			readClientFrame(t, brw)
+			_, _ = brw.Write([]byte{0x88, 0x00})
+			_ = brw.Flush()
+		} else {
+			// Secondary connection: stays open.
+			_, _ = brw.Write([]byte{0x81, 0x02, 'h', 'i'})
+			_ = brw.Flush()
+			<-stop
+		}
+		_ = conn.Close()
+	})
+	defer s.Close()
+	defer close(stop)
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	c, err := newClient(t.Context(), url)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+	defer c.close()
+
+	// Open a secondary connection, and then close the primary one.
+	c.RefreshConnectionIn(0)
+
+	select {
+	case msg := <-c.IncomingMessages():
+		if string(msg.Data) != "hi" {
+			t.Errorf("IncomingMessages() = %q, want %q", msg.Data, "hi")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client didn't switch to the secondary connection")
+	}
+
+	// The client switched without dialing again, and it doesn't keep replacing the open connection.
+	time.Sleep(50 * time.Millisecond)
+	if got := handshakes.Load(); got != 2 {
+		t.Errorf("handshakes = %d, want 2", got)
+	}
+
+	c.connsMu.RLock()
+	defer c.connsMu.RUnlock()
+	if c.conns[0] == nil || c.conns[0].IsClosing() || c.conns[1] != nil {
+		t.Errorf("client connections after switch: primary = %v, secondary = %v", c.conns[0], c.conns[1])
+	}
+}
+
+func TestClientWithoutSubscribers(t *testing.T) {
+	var handshakes atomic.Int32
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		handshakes.Add(1)
+		for range 3 {
+			_, _ = brw.Write([]byte{0x81, 0x02, 'h', 'i'})
+		}
+		_ = brw.Flush()
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	c, err := newClient(t.Context(), url, WithRelayTimeout(10*time.Millisecond), WithReconnectBackoff(0, 0))
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+
+	// Nobody reads c.IncomingMessages(), but the relay isn't stuck:
+	// it drops unreceived messages, and then reconnects to the server.
+	time.Sleep(200 * time.Millisecond)
+	if got := handshakes.Load(); got < 2 {
+		t.Errorf("handshakes = %d, want at least 2", got)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	var handshakes atomic.Int32
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		handshakes.Add(1)
+		// Wait for the client's masked close frame, and complete the closing handshake.
+		_, _ = io.ReadFull(brw, make([]byte, 8))
+		_, _ = brw.Write([]byte{0x88, 0x00})
+		_ = brw.Flush()
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	c1, err := NewOrCachedClient(t.Context(), url, "close", withTestNonceGen())
+	if err != nil {
+		t.Fatalf("NewOrCachedClient() error = %v", err)
+	}
+	c2, err := NewOrCachedClient(t.Context(), url, "close", withTestNonceGen())
+	if err != nil {
+		t.Fatalf("NewOrCachedClient() error = %v", err)
+	}
+	if c1 != c2 {
+		t.Fatal("NewOrCachedClient() returned different clients for the same ID")
+	}
+
+	// Closing by one of two subscribers doesn't affect the other one.
+	c1.Close()
+	if _, ok := clients.Load(hash("close")); !ok {
+		t.Fatal("client was removed from the cache while it still has a subscriber")
+	}
+
+	// Closing by the last subscriber closes and forgets the client.
+	c2.Close()
+	if _, ok := clients.Load(hash("close")); ok {
+		t.Error("client is still cached after it was closed")
+	}
+
+	select {
+	case _, ok := <-c2.IncomingMessages():
+		if ok {
+			t.Error("IncomingMessages() received a message, want it to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("IncomingMessages() wasn't closed")
+	}
+
+	if got := handshakes.Load(); got != 1 {
+		t.Errorf("handshakes = %d, want 1 (no reconnections)", got)
+	}
+}
+
+func TestClientCloseContext(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		// Keep sending messages until the client closes the connection.
+		for {
+			if _, err := brw.Write([]byte{0x81, 0x02, 'h', 'i'}); err != nil || brw.Flush() != nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		_ = conn.Close()
+	})
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	c, err := newClient(t.Context(), url, WithCloseContext(ctx), WithDialOpts(WithCloseTimeout(10*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+
+	<-c.IncomingMessages()
+	cancel()
+
+	// The relay stops even though the connection keeps receiving messages.
+	timeout := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-c.IncomingMessages():
+		case <-timeout:
+			t.Fatal("IncomingMessages() wasn't closed after the context was canceled")
+		}
+	}
+
+	s.Close()
+	goleak.VerifyNone(t, ignore)
+}
+
+func TestDeleteClient(t *testing.T) {
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		_, _ = io.Copy(io.Discard, brw)
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	c, err := newClient(t.Context(), url, WithCloseContext(ctx))
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	deleteClient(c)
+	if !c.isClosed() {
+		t.Error("deleted client isn't closed")
+	}
+
+	cancel() // Must not panic, even though the client's fields were cleared.
+	c.close()
+}
+
 func lenClients() int {
 	count := 0
 	clients.Range(func(_, _ any) bool {
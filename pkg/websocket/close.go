@@ -164,11 +164,21 @@ func checkClosePayload(status StatusCode, reason string) (StatusCode, string) {
 		status = StatusProtocolError
 	}
 
-	if len(reason) > maxCloseReason {
-		reason = reason[:maxCloseReason] // TODO: Keep valid UTF-8 (i.e. runes not bytes).
+	return status, truncateReason(reason)
+}
+
+// truncateReason shortens a closing reason to at most [maxCloseReason]
+// bytes, without splitting multi-byte UTF-8 characters.
+func truncateReason(reason string) string {
+	if len(reason) <= maxCloseReason {
+		return reason
 	}
 
-	return status, reason
+	n := maxCloseReason
+	for n > 0 && !utf8.RuneStart(reason[n]) {
+		n--
+	}
+	return reason[:n]
 }
 
 // sendCloseControlFrame either initiates or responds to a
@@ -196,6 +206,9 @@ func (c *Conn) sendCloseControlFrame(status StatusCode, reason string) {
 	time.Sleep(time.Millisecond)
 
 	status, reason = checkClosePayload(status, reason)
+	if c.closeStatus == 0 {
+		c.closeStatus = status
+	}
 
 	binary.BigEndian.PutUint16(c.closeBuf[:2], uint16(status))
 	if len(reason) > 0 {
@@ -204,7 +217,7 @@ func (c *Conn) sendCloseControlFrame(status StatusCode, reason string) {
 
 	n := 2 + len(reason)
 	l := c.logger.With().Str("close_status", status.String()).Str("close_reason", reason).Logger()
-	if err := <-c.sendControlFrame(opcodeClose, c.closeBuf[:n]); err != nil {
+	if err := <-c.sendControlFrame(OpcodeClose, c.closeBuf[:n]); err != nil {
 		l.Err(err).Msg("failed to send WebSocket close control frame")
 	} else {
 		l.Trace().Msg("sent WebSocket close control frame")
@@ -214,12 +227,68 @@ func (c *Conn) sendCloseControlFrame(status StatusCode, reason string) {
 	// WebSocket closing handshake, if relevant.
 	c.closeSent = true
 
-	if c.closeReceived {
-		_ = c.closer.Close()
+	if c.closeReceived.Load() {
+		c.closeNetConn()
 		return
 	}
 
-	// TODO: Start a timer to force-close if the server doesn't respond.
+	// "The underlying TCP connection, in most normal cases, SHOULD be closed
+	// first by the server", but don't wait for the server's close frame forever.
+	if c.closeTimeout > 0 {
+		time.AfterFunc(c.closeTimeout, c.closeTimedOut)
+	}
+}
+
+// closeTimedOut releases the underlying network connection if the
+// server didn't respond to the client's close control frame in time.
+func (c *Conn) closeTimedOut() {
+	if c.closeReceived.Load() {
+		return
+	}
+
+	c.logger.Warn().Dur("timeout", c.closeTimeout).
+		Msg("WebSocket closing handshake timed out, closing the connection")
+	c.closeNetConn()
+}
+
+// closeAbnormally marks the connection as closed without a closing
+// handshake (e.g. when the server drops the TCP connection without
+// sending a close control frame), so there is no point in trying to
+// send anything, and releases the underlying network connection.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6455#section-7.1.5.
+func (c *Conn) closeAbnormally() {
+	c.closeReceived.Store(true)
+
+	c.closeSentMu.Lock()
+	c.closeSent = true
+	c.closeStatus = StatusClosedAbnormally
+	c.closeSentMu.Unlock()
+
+	c.closeNetConn()
+}
+
+// setCloseStatus records the status code of a close control frame which
+// was received from the server, unless the client already initiated the
+// WebSocket closing handshake with its own status code.
+func (c *Conn) setCloseStatus(s StatusCode) {
+	c.closeSentMu.Lock()
+	defer c.closeSentMu.Unlock()
+
+	if c.closeStatus == 0 {
+		c.closeStatus = s
+	}
+}
+
+// CloseStatus returns the [StatusCode] of the connection's closure,
+// or 0 if the connection is still open. Specifically, it returns
+// [StatusClosedAbnormally] if the server dropped the connection
+// without a WebSocket closing handshake.
+func (c *Conn) CloseStatus() StatusCode {
+	c.closeSentMu.RLock()
+	defer c.closeSentMu.RUnlock()
+
+	return c.closeStatus
 }
 
 func (c *Conn) isCloseSent() bool {
@@ -234,13 +303,20 @@ func (c *Conn) isCloseSent() bool {
 //
 // [WebSocket closing handshake]: https://datatracker.ietf.org/doc/html/rfc6455#section-7.1.2
 func (c *Conn) Close(s StatusCode) {
-	c.sendCloseControlFrame(s, "")
+	c.CloseWithReason(s, "")
+}
+
+// CloseWithReason is like [Conn.Close], but also sends a human-readable
+// UTF-8 reason to the server, e.g. for debugging. Reasons longer than
+// 123 bytes are truncated, without splitting multi-byte characters.
+func (c *Conn) CloseWithReason(s StatusCode, reason string) {
+	c.sendCloseControlFrame(s, truncateReason(reason))
 }
 
 func (c *Conn) IsClosed() bool {
-	return c.closeReceived && c.isCloseSent()
+	return c.closeReceived.Load() && c.isCloseSent()
 }
 
 func (c *Conn) IsClosing() bool {
-	return c.closeReceived || c.isCloseSent()
+	return c.closeReceived.Load() || c.isCloseSent()
 }
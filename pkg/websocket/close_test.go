@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCloseWithReason(t *testing.T) {
+	frames := make(chan []byte, 1)
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		frames <- readClientFrame(t, brw)
+		_, _ = brw.Write([]byte{0x88, 0x00})
+		_ = brw.Flush()
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	c, err := Dial(t.Context(), s.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	c.CloseWithReason(StatusGoingAway, "config reloaded")
+
+	f := <-frames
+	if got := Opcode(f[0] & 0x0f); got != OpcodeClose {
+		t.Fatalf("client frame opcode = %v, want %v", got, OpcodeClose)
+	}
+	if got := StatusCode(binary.BigEndian.Uint16(f[1:3])); got != StatusGoingAway {
+		t.Errorf("close frame status = %v, want %v", got, StatusGoingAway)
+	}
+	if got := string(f[3:]); got != "config reloaded" {
+		t.Errorf("close frame reason = %q, want %q", got, "config reloaded")
+	}
+}
+
+func TestTruncateReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "short",
+			reason: "config reloaded",
+			want:   "config reloaded",
+		},
+		{
+			name:   "max_length",
+			reason: strings.Repeat("a", maxCloseReason),
+			want:   strings.Repeat("a", maxCloseReason),
+		},
+		{
+			name:   "too_long",
+			reason: strings.Repeat("a", maxCloseReason+1),
+			want:   strings.Repeat("a", maxCloseReason),
+		},
+		{
+			name:   "multi_byte_boundary",
+			reason: strings.Repeat("a", maxCloseReason-1) + "é", // 2 bytes.
+			want:   strings.Repeat("a", maxCloseReason-1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateReason(tt.reason); got != tt.want {
+				t.Errorf("truncateReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
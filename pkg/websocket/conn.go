@@ -2,34 +2,68 @@ package websocket
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
 )
 
+// ErrConnClosed is reported when sending a message or a control
+// frame after the [Conn] was closed (or started closing).
+var ErrConnClosed = errors.New("WebSocket connection is closed")
+
+// ErrInvalidUTF8 is reported when sending a text message whose payload is not
+// valid UTF-8. Use [Conn.SendBinaryMessage] to send arbitrary bytes instead.
+var ErrInvalidUTF8 = errors.New("WebSocket text message is not valid UTF-8")
+
 // Conn respresents the configuration and state of
 // an open client connection to a WebSocket server.
 type Conn struct {
 	// Initialized before the actual handshake.
-	logger  *zerolog.Logger
-	client  *http.Client
-	headers http.Header
+	logger         *zerolog.Logger
+	client         *http.Client
+	headers        http.Header
+	origin         string
+	connectTimeout time.Duration
+	closeTimeout   time.Duration
+	readBufSize    int
+	writeBufSize   int
+	noMasking      bool // Non-conformant, see [WithMasking].
 
 	// Initialized after the actual handshake.
-	bufio  *bufio.ReadWriter
-	reader chan Message
-	writer chan internalMessage
-	closer io.ReadWriteCloser
+	server     bool // Accepted with [Upgrade], instead of [Dial].
+	respHeader http.Header
+	bufio      *bufio.ReadWriter
+	reader     chan Message
+	writer     chan internalMessage
+	closer     io.ReadWriteCloser
+
+	// Closed after [Conn.readMessages] and [Conn.writeMessages] start running.
+	ready   chan struct{}
+	started sync.WaitGroup
 
-	// No need for synchronization: value changes are possible only in
-	// one direction (false to true), and are always done by a single
-	// function, which is guaranteed to run in a single goroutine.
-	closeReceived bool
+	// Closed after the underlying network connection is closed,
+	// to stop [Conn.writeMessages] and fail subsequent sends.
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// Value changes are possible only in one direction (false to true),
+	// and are always done by a single goroutine, but it's also read
+	// by other goroutines (e.g. [Conn.IsClosed] in [ListClients]).
+	closeReceived atomic.Bool
 
 	closeSent   bool
-	closeSentMu sync.RWMutex
+	closeStatus StatusCode
+	closeSentMu sync.RWMutex // Guards both closeSent and closeStatus.
+
+	// Traffic counters (see [Conn.Stats]).
+	stats connStats
 
 	// Only for the purpose of minimizing memory allocations (safely),
 	// not for state management or memory sharing of any kind.
@@ -39,6 +73,7 @@ type Conn struct {
 
 	// For unit-testing only.
 	nonceGen io.Reader
+	maskGen  io.Reader
 }
 
 // WebSocket data message, from one or more (defragmented) data frames,
@@ -47,6 +82,11 @@ type Conn struct {
 type Message struct {
 	Opcode Opcode
 	Data   []byte
+
+	// ReceivedAt is the time when the message's last frame was read
+	// from the connection, i.e. just before it's published to subscribers.
+	// Useful for measuring ack latency and downstream processing delays.
+	ReceivedAt time.Time
 }
 
 // internalMessage is used to synchronize concurrent calls to [Conn.writeFrame].
@@ -56,19 +96,34 @@ type internalMessage struct {
 	err    chan<- error
 }
 
+// ResponseHeader returns the HTTP headers of the server's WebSocket handshake
+// response, e.g. session IDs or negotiated extensions. Callers must not modify it.
+func (c *Conn) ResponseHeader() http.Header {
+	return c.respHeader
+}
+
 // IncomingMessages returns the connection's channel that publishes
 // data [Message]s as they are received from the server.
 func (c *Conn) IncomingMessages() <-chan Message {
 	return c.reader
 }
 
+// Ready returns a channel that is closed when the connection's goroutines,
+// which read and write frames, are running. Callers may wait on it before
+// sending messages, instead of relying on arbitrary sleeps.
+func (c *Conn) Ready() <-chan struct{} {
+	return c.ready
+}
+
 // readMessages runs as a [Conn] goroutine, to call [Conn.readMessage]
 // continuously, in order to process control and data frames, and
 // publish data [Message]s to the connection's subscribers.
 func (c *Conn) readMessages() {
+	c.started.Done()
+
 	msg := c.readMessage()
 	for msg != nil {
-		c.reader <- Message{Opcode: msg.Opcode, Data: msg.Data}
+		c.reader <- Message{Opcode: msg.Opcode, Data: msg.Data, ReceivedAt: time.Now()}
 		msg = c.readMessage()
 	}
 	close(c.reader)
@@ -78,9 +133,70 @@ func (c *Conn) readMessages() {
 // calls to [Conn.writeFrame]. For the time being, this package doesn't
 // need to implement frame fragmentation in outbound messages.
 func (c *Conn) writeMessages() {
-	for msg := range c.writer {
-		msg.err <- c.writeFrame(msg.Opcode, msg.Data)
-		// The message's error channel can be used at most once.
-		close(msg.err)
+	c.started.Done()
+
+	for {
+		select {
+		case msg := <-c.writer:
+			msg.err <- c.writeFrame(msg.Opcode, msg.Data)
+			// The message's error channel can be used at most once.
+			close(msg.err)
+		case <-c.done:
+			return
+		}
 	}
 }
+
+// send passes a frame to [Conn.writeMessages], unless the connection is
+// already closed, in which case the returned channel reports [ErrConnClosed]
+// immediately, instead of blocking forever.
+func (c *Conn) send(op Opcode, data []byte) <-chan error {
+	return c.sendContext(context.Background(), op, data)
+}
+
+// sendContext is like [Conn.send], but it also stops waiting for
+// [Conn.writeMessages] if the given context is canceled.
+func (c *Conn) sendContext(ctx context.Context, op Opcode, data []byte) <-chan error {
+	// Buffered, so [Conn.writeMessages] never waits for the caller.
+	err := make(chan error, 1)
+
+	// "After sending a Close frame, the endpoint MUST NOT send any more data frames."
+	if (op == OpcodeText || op == OpcodeBinary) && c.isCloseSent() {
+		err <- ErrConnClosed
+		close(err)
+		return err
+	}
+
+	// "When an endpoint is to interpret a byte stream as UTF-8 but finds that
+	// the byte stream is not, in fact, a valid UTF-8 stream, that endpoint
+	// MUST _Fail the WebSocket Connection_." Don't make the server do that.
+	if op == OpcodeText && !utf8.Valid(data) {
+		err <- ErrInvalidUTF8
+		close(err)
+		return err
+	}
+
+	select {
+	case c.writer <- internalMessage{Opcode: op, Data: data, err: err}:
+	case <-c.done:
+		err <- ErrConnClosed
+		close(err)
+	case <-ctx.Done():
+		err <- ctx.Err()
+		close(err)
+	}
+	return err
+}
+
+// closeNetConn releases the underlying network connection, and makes
+// all subsequent sends fail fast with [ErrConnClosed]. It's idempotent.
+func (c *Conn) closeNetConn() {
+	c.doneOnce.Do(func() {
+		if c.closer != nil {
+			_ = c.closer.Close()
+		}
+		if c.done != nil {
+			close(c.done)
+		}
+	})
+}
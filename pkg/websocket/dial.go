@@ -6,12 +6,13 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -20,6 +21,9 @@ type DialOpt func(*Conn)
 
 var defaultClient = adjustHTTPClient(*http.DefaultClient)
 
+// DefaultCloseTimeout is the default of [WithCloseTimeout].
+const DefaultCloseTimeout = 5 * time.Second
+
 // WithHTTPClient lets callers of [Dial] specify a custom [http.Client]
 // to use for the WebSocket handshake, instead of [http.DefaultClient].
 //
@@ -32,6 +36,31 @@ func WithHTTPClient(hc *http.Client) DialOpt {
 	}
 }
 
+// WithCloseTimeout lets callers of [Dial] limit the time that the connection
+// waits for the server's close control frame, after sending its own, before
+// forcibly closing the underlying network connection. This prevents both
+// abrupt connection resets and indefinite hangs during teardowns.
+//
+// The default is [DefaultCloseTimeout].
+func WithCloseTimeout(d time.Duration) DialOpt {
+	return func(c *Conn) {
+		c.closeTimeout = d
+	}
+}
+
+// WithConnectTimeout lets callers of [Dial] limit the time it takes to establish
+// the underlying TCP connection, and then the TLS handshake, independently of the
+// [context.Context] passed to [Dial], which bounds the entire WebSocket handshake.
+// This prevents hangs on stalled connection attempts even without a context deadline.
+//
+// It applies only to the default HTTP client, and to custom ones (see [WithHTTPClient])
+// whose transport is an [http.Transport]. The default is no timeout.
+func WithConnectTimeout(d time.Duration) DialOpt {
+	return func(c *Conn) {
+		c.connectTimeout = d
+	}
+}
+
 // WithHTTPHeader lets callers of [Dial] add a single HTTP header to the WebSocket
 // handshake's HTTP request. Use [WithHTTPHeaders] to specify multiple ones.
 func WithHTTPHeader(key, value string) DialOpt {
@@ -48,25 +77,69 @@ func WithHTTPHeaders(hs http.Header) DialOpt {
 	}
 }
 
+// WithOrigin lets callers of [Dial] set the "Origin" header in the WebSocket
+// handshake's HTTP request, for servers which reject handshakes without a
+// matching origin. It must be an absolute URL with a scheme and a host,
+// e.g. "https://example.com", otherwise [Dial] fails.
+func WithOrigin(origin string) DialOpt {
+	return func(c *Conn) {
+		c.origin = origin
+	}
+}
+
+// WithLogger lets callers of [Dial] specify the logger of the connection, instead
+// of the one in the [context.Context] passed to [Dial] (see [zerolog.Ctx]), which is
+// the default. This makes the routing of each connection's logs explicit, without
+// relying on the global logger. Nil loggers are ignored.
+func WithLogger(l *zerolog.Logger) DialOpt {
+	return func(c *Conn) {
+		if l != nil {
+			c.logger = l
+		}
+	}
+}
+
+// WithBufioSizes lets callers of [Dial] set the sizes of the read and write buffers
+// of the underlying network connection. Larger read buffers reduce the number of
+// system calls when receiving large or bursty messages, at the cost of memory per
+// connection. Non-positive values mean the default size of the [bufio] package.
+func WithBufioSizes(read, write int) DialOpt {
+	return func(c *Conn) {
+		c.readBufSize = read
+		c.writeBufSize = write
+	}
+}
+
+// WithMasking lets callers of [Dial] disable the masking of client frames,
+// which is enabled by default. This is for development only: unmasked client
+// frames are easier to read in packet captures, and some lenient servers accept
+// them, but they violate https://datatracker.ietf.org/doc/html/rfc6455#section-5.3,
+// so conformant servers close the connection with [StatusProtocolError].
+func WithMasking(enabled bool) DialOpt {
+	return func(c *Conn) {
+		c.noMasking = !enabled
+	}
+}
+
 // Dial performs a [WebSocket handshake] to establish
 // a connection to the given URL ("ws://..." or "wss://").
 //
 // [WebSocket handshake]: https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
 func Dial(ctx context.Context, wsURL string, opts ...DialOpt) (*Conn, error) {
 	// Initialize optional configuration details and internal helpers.
-	c := &Conn{
-		logger:   zerolog.Ctx(ctx),
-		headers:  http.Header{},
-		nonceGen: rand.Reader,
-	}
-	for _, opt := range opts {
-		opt(c)
-	}
+	c := initConn(ctx, opts)
 	if c.client == nil {
 		c.client = defaultClient
 	} else {
 		c.client = adjustHTTPClient(*c.client)
 	}
+	if c.connectTimeout > 0 {
+		c.client = withConnectTimeout(*c.client, c.connectTimeout)
+	}
+
+	if err := checkOrigin(c.origin); err != nil {
+		return nil, err
+	}
 
 	// Send handshake request & check response.
 	nonce, err := generateNonce(c.nonceGen)
@@ -80,7 +153,7 @@ func Dial(ctx context.Context, wsURL string, opts ...DialOpt) (*Conn, error) {
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send WebSocket handshake request: %w", err)
+		return nil, &DialError{Err: err}
 	}
 	if err = checkHandshakeResponse(resp, nonce); err != nil {
 		_ = resp.Body.Close()
@@ -93,16 +166,121 @@ func Dial(ctx context.Context, wsURL string, opts ...DialOpt) (*Conn, error) {
 		return nil, fmt.Errorf("WebSocket handshake response body type: got %T, want io.ReadWriteCloser", resp.Body)
 	}
 
-	c.bufio = bufio.NewReadWriter(bufio.NewReader(rwc), bufio.NewWriter(rwc))
+	c.start(resp.Header, newBufio(rwc, c.readBufSize, c.writeBufSize), rwc)
+	return c, nil
+}
+
+// DialConn is similar to [Dial], but it performs the WebSocket handshake over
+// an already-established network connection, instead of dialing a new one.
+// This is useful for non-TCP transports (e.g. Unix domain sockets) and for
+// pre-established tunnels. The URL's scheme is not used to secure the connection:
+// for "wss://" URLs, the given connection must already be a TLS connection.
+//
+// HTTP client options ([WithHTTPClient] and [WithConnectTimeout]) are ignored.
+// The returned connection owns the given one, even if the handshake fails.
+func DialConn(ctx context.Context, rawConn net.Conn, wsURL string, opts ...DialOpt) (*Conn, error) {
+	c := initConn(ctx, opts)
+	if err := checkOrigin(c.origin); err != nil {
+		_ = rawConn.Close()
+		return nil, err
+	}
+
+	resp, br, err := c.handshakeOverConn(ctx, rawConn, wsURL)
+	if err != nil {
+		_ = rawConn.Close()
+		return nil, err
+	}
+
+	// Don't lose data frames which were buffered along with the handshake response.
+	c.start(resp.Header, bufio.NewReadWriter(br, newBufio(rawConn, 0, c.writeBufSize).Writer), rawConn)
+	return c, nil
+}
+
+// initConn initializes the optional configuration details
+// and internal helpers of a connection, before its handshake.
+func initConn(ctx context.Context, opts []DialOpt) *Conn {
+	c := &Conn{
+		logger:   zerolog.Ctx(ctx),
+		headers:  http.Header{},
+		nonceGen: rand.Reader,
+		maskGen:  rand.Reader,
+
+		closeTimeout: DefaultCloseTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// handshakeOverConn sends a handshake request over the given network connection,
+// and checks its response. The [context.Context] bounds only the handshake.
+// It returns the buffered reader of the response, which may contain data frames.
+func (c *Conn) handshakeOverConn(ctx context.Context, rawConn net.Conn, wsURL string) (*http.Response, *bufio.Reader, error) {
+	stop := context.AfterFunc(ctx, func() {
+		_ = rawConn.SetDeadline(time.Now()) // Unblock pending reads and writes.
+	})
+	defer stop()
+
+	nonce, err := generateNonce(c.nonceGen)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce for WebSocket handshake: %w", err)
+	}
+	req, err := c.handshakeRequest(ctx, wsURL, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := req.Write(rawConn); err != nil {
+		return nil, nil, &DialError{Err: contextError(ctx, err)}
+	}
+	br := newBufio(rawConn, c.readBufSize, 0).Reader
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, &DialError{Err: contextError(ctx, err)}
+	}
+	if err := checkHandshakeResponse(resp, nonce); err != nil {
+		return nil, nil, err
+	}
+
+	// If the context is done by now, the connection's deadline is unusable.
+	if !stop() {
+		return nil, nil, &DialError{Err: ctx.Err()}
+	}
+	_ = rawConn.SetDeadline(time.Time{})
+
+	return resp, br, nil
+}
+
+// contextError prefers the error of the given [context.Context], if it's
+// done, over network errors which are caused by its cancellation or deadline.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// start initializes the state of the connection after a
+// successful handshake, and starts its read and write loops.
+func (c *Conn) start(respHeader http.Header, brw *bufio.ReadWriter, closer io.ReadWriteCloser) {
+	c.respHeader = respHeader
+	c.bufio = brw
 	c.reader = make(chan Message)
 	c.writer = make(chan internalMessage)
-	c.closer = rwc
+	c.closer = closer
+	c.done = make(chan struct{})
+	c.ready = make(chan struct{})
 
+	c.started.Add(2)
 	go c.readMessages()
 	go c.writeMessages()
+	go func() {
+		c.started.Wait()
+		close(c.ready)
+	}()
 
 	c.logger.Debug().Msg("WebSocket connectionn initialized")
-	return c, nil
 }
 
 // adjustHTTPClient returns a modified shallow copy of the given [http.Client].
@@ -126,6 +304,41 @@ func adjustHTTPClient(c http.Client) *http.Client {
 	return &c
 }
 
+// withConnectTimeout returns a shallow copy of the given [http.Client], with a copy
+// of its transport which limits the duration of TCP connections and TLS handshakes.
+// Clients with transports of other types are returned as-is (but still copied).
+func withConnectTimeout(c http.Client, d time.Duration) *http.Client {
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	if t, ok := rt.(*http.Transport); ok {
+		t = t.Clone()
+		t.DialContext = (&net.Dialer{Timeout: d}).DialContext
+		t.TLSHandshakeTimeout = d
+		c.Transport = t
+	}
+
+	return &c
+}
+
+// newBufio wraps the given network connection with buffered I/O, using
+// the given sizes, or the default size of the [bufio] package if not positive.
+func newBufio(rwc io.ReadWriter, readSize, writeSize int) *bufio.ReadWriter {
+	r := bufio.NewReader(rwc)
+	if readSize > 0 {
+		r = bufio.NewReaderSize(rwc, readSize)
+	}
+
+	w := bufio.NewWriter(rwc)
+	if writeSize > 0 {
+		w = bufio.NewWriterSize(rwc, writeSize)
+	}
+
+	return bufio.NewReadWriter(r, w)
+}
+
 // generateNonce generates a nonce consisting of a randomly
 // selected 16-byte value that has been Base64-encoded. The
 // nonce MUST be selected randomly for each connection.
@@ -166,38 +379,51 @@ func (c *Conn) handshakeRequest(ctx context.Context, wsURL, nonce string) (*http
 	req.Header.Set("Connection", "Upgrade")
 	req.Header.Set("Sec-WebSocket-Key", nonce)
 	req.Header.Set("Sec-WebSocket-Version", "13")
+	if c.origin != "" {
+		req.Header.Set("Origin", c.origin)
+	}
 	// Sec-WebSocket-Extensions, Sec-WebSocket-Protocol.
 
 	return req, nil
 }
 
+// checkOrigin rejects obviously malformed values of [WithOrigin]: an origin
+// must be an absolute URL with a scheme and a host, and without credentials.
+// See https://datatracker.ietf.org/doc/html/rfc6454#section-7.
+func checkOrigin(origin string) error {
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid WebSocket origin: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" || u.User != nil {
+		return fmt.Errorf("invalid WebSocket origin: %q", origin)
+	}
+
+	return nil
+}
+
 // checkHandshakeResponse checks the server response details in
 // https://datatracker.ietf.org/doc/html/rfc6455#section-4.2.2.
+// Failures are reported as [HandshakeError]s.
 func checkHandshakeResponse(resp *http.Response, nonce string) error {
 	if resp.StatusCode != http.StatusSwitchingProtocols {
-		msg := "WebSocket handshake response status: got %d, want %d"
-		msg = fmt.Sprintf(msg, resp.StatusCode, http.StatusSwitchingProtocols)
-
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		if len(body) > 0 {
-			msg = fmt.Sprintf("%s (%s)", msg, string(body))
-		}
-
-		return errors.New(msg)
-
+		return &HandshakeError{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(body)}
 	}
 
-	if err := checkHTTPHeader(resp.Header, "Upgrade", "websocket"); err != nil {
-		return err
+	err := checkHTTPHeader(resp.Header, "Upgrade", "websocket")
+	if err == nil {
+		err = checkHTTPHeader(resp.Header, "Connection", "Upgrade")
 	}
-
-	if err := checkHTTPHeader(resp.Header, "Connection", "Upgrade"); err != nil {
-		return err
+	if err == nil {
+		err = checkHTTPHeader(resp.Header, "Sec-WebSocket-Accept", expectedServerAcceptValue(nonce))
 	}
-
-	want := expectedServerAcceptValue(nonce)
-	if err := checkHTTPHeader(resp.Header, "Sec-WebSocket-Accept", want); err != nil {
-		return err
+	if err != nil {
+		return &HandshakeError{StatusCode: resp.StatusCode, Header: resp.Header, Err: err}
 	}
 
 	// Sec-WebSocket-Protocol, Sec-WebSocket-Extensions.
@@ -1,5 +1,7 @@
-// Package websocket is a lightweight yet robust client-only
-// implementation of the WebSocket protocol (RFC 6455).
+// Package websocket is a lightweight yet robust client-side
+// implementation of the WebSocket protocol (RFC 6455). It also
+// supports accepting connections on the server side, with [Upgrade],
+// mainly for local integration testing.
 //
 // It focuses on continuous asynchronous reading of text/binary
 // messages, and enables occasional writing.
@@ -24,6 +26,7 @@
 // of messages while a client temporarily has an extra connection.
 //
 // Note C: WebSocket [extensions] and [subprotocols] are not supported yet.
+// See [SupportsCompression] and the other capability flags of this package.
 //
 // [extensions]: https://www.iana.org/assignments/websocket/websocket.xhtml#extension-name
 // [subprotocols]: https://www.iana.org/assignments/websocket/websocket.xhtml#subprotocol-name
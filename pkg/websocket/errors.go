@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HandshakeError is returned by [Dial] when the server responds to the WebSocket
+// handshake request, but rejects the upgrade or responds with an invalid upgrade.
+// Retrying is unlikely to help if the server rejected the client's credentials.
+type HandshakeError struct {
+	StatusCode int
+	Header     http.Header
+	Body       string // Truncated, only if the server rejected the upgrade.
+
+	// Err describes what's wrong with an invalid upgrade response,
+	// i.e. when the status code is [http.StatusSwitchingProtocols].
+	Err error
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
+	msg := fmt.Sprintf("WebSocket handshake response status: got %d, want %d",
+		e.StatusCode, http.StatusSwitchingProtocols)
+	if e.Body != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Body)
+	}
+	return msg
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// DialError is returned by [Dial] when it fails to send the WebSocket handshake
+// request, or to receive its response, e.g. due to network or TLS errors.
+// These errors are usually transient, so retrying may help.
+type DialError struct {
+	Err error
+}
+
+func (e *DialError) Error() string {
+	return "failed to send WebSocket handshake request: " + e.Err.Error()
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// isUnauthorized reports whether the given error is a [HandshakeError] in which
+// the server rejected the client's credentials, so reconnecting won't help.
+func isUnauthorized(err error) bool {
+	var he *HandshakeError
+	if !errors.As(err, &he) {
+		return false
+	}
+	return he.StatusCode == http.StatusUnauthorized || he.StatusCode == http.StatusForbidden
+}
@@ -0,0 +1,174 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDialHandshakeError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		accept     string
+		wantStatus int
+		wantErr    bool // Whether [HandshakeError.Err] is set.
+	}{
+		{
+			name:       "rejected",
+			status:     http.StatusUnauthorized,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid_upgrade",
+			status:     http.StatusSwitchingProtocols,
+			accept:     "wrong",
+			wantStatus: http.StatusSwitchingProtocols,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test", "value")
+				w.Header().Set("Upgrade", "websocket")
+				w.Header().Set("Connection", "upgrade")
+				w.Header().Set("Sec-WebSocket-Accept", tt.accept)
+				w.WriteHeader(tt.status)
+			}))
+			defer s.Close()
+
+			_, err := Dial(t.Context(), s.URL, withTestNonceGen())
+
+			var he *HandshakeError
+			if !errors.As(err, &he) {
+				t.Fatalf("Dial() error = %v, want HandshakeError", err)
+			}
+			if he.StatusCode != tt.wantStatus {
+				t.Errorf("HandshakeError.StatusCode = %d, want %d", he.StatusCode, tt.wantStatus)
+			}
+			if got := he.Header.Get("X-Test"); got != "value" {
+				t.Errorf("HandshakeError.Header[X-Test] = %q, want %q", got, "value")
+			}
+			if (he.Err != nil) != tt.wantErr {
+				t.Errorf("HandshakeError.Err = %v, want %v", he.Err, tt.wantErr)
+			}
+
+			var de *DialError
+			if errors.As(err, &de) {
+				t.Errorf("Dial() error = %v, don't want DialError", err)
+			}
+		})
+	}
+}
+
+func TestDialDialError(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	_ = lis.Close() // Nothing listens on this address anymore.
+
+	_, err = Dial(t.Context(), "ws://"+addr, withTestNonceGen())
+
+	var de *DialError
+	if !errors.As(err, &de) {
+		t.Fatalf("Dial() error = %v, want DialError", err)
+	}
+	var oe *net.OpError
+	if !errors.As(err, &oe) {
+		t.Errorf("Dial() error = %v, want it to wrap a net.OpError", err)
+	}
+
+	var he *HandshakeError
+	if errors.As(err, &he) {
+		t.Errorf("Dial() error = %v, don't want HandshakeError", err)
+	}
+}
+
+func TestIsUnauthorized(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "unauthorized",
+			err:  &HandshakeError{StatusCode: http.StatusUnauthorized},
+			want: true,
+		},
+		{
+			name: "wrapped_forbidden",
+			err:  fmt.Errorf("wrapped: %w", &HandshakeError{StatusCode: http.StatusForbidden}),
+			want: true,
+		},
+		{
+			name: "server_error",
+			err:  &HandshakeError{StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			name: "dial_error",
+			err:  &DialError{Err: errors.New("connection refused")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnauthorized(tt.err); got != tt.want {
+				t.Errorf("isUnauthorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientGivesUpWhenUnauthorized(t *testing.T) {
+	var handshakes atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handshakes.Add(1) > 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// Accept the first connection, and then drop it immediately.
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Sec-WebSocket-Accept", expectedServerAcceptValue(r.Header.Get("Sec-WebSocket-Key")))
+		w.WriteHeader(http.StatusSwitchingProtocols)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	c, err := newClient(t.Context(), url)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+
+	select {
+	case _, ok := <-c.IncomingMessages():
+		if ok {
+			t.Error("IncomingMessages() received a message, want it to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client didn't give up after its credentials were rejected")
+	}
+
+	if got := handshakes.Load(); got != 2 {
+		t.Errorf("handshakes = %d, want 2", got)
+	}
+}
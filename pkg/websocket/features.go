@@ -0,0 +1,18 @@
+package websocket
+
+// Capability flags of this package, which external conformance test runners
+// (e.g. Autobahn's) can use to decide which test cases are applicable.
+const (
+	// SupportsUTF8Validation indicates that text messages with invalid UTF-8
+	// data fail the connection, when the complete message is received.
+	SupportsUTF8Validation = true
+
+	// SupportsFailFastUTF8 indicates that invalid UTF-8 data in fragmented
+	// text messages fails the connection as soon as it is received, without
+	// waiting for the rest of the message (Autobahn test cases 6.4.*).
+	SupportsFailFastUTF8 = false
+
+	// SupportsCompression indicates support for the "permessage-deflate"
+	// extension (RFC 7692, Autobahn test cases 12.* and 13.*).
+	SupportsCompression = false
+)
@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSupportsCompression(t *testing.T) {
+	c := &Conn{headers: http.Header{}}
+	req, err := c.handshakeRequest(t.Context(), "ws://example.com", "nonce")
+	if err != nil {
+		t.Fatalf("Conn.handshakeRequest() error = %v", err)
+	}
+
+	offered := req.Header.Get("Sec-WebSocket-Extensions") != ""
+	if offered != SupportsCompression {
+		t.Errorf("compression offered in handshake = %v, but SupportsCompression = %v", offered, SupportsCompression)
+	}
+}
+
+func TestSupportsUTF8Validation(t *testing.T) {
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		_, _ = brw.Write([]byte{0x81, 0x02, 0xff, 0xfe}) // Invalid UTF-8 text.
+		_ = brw.Flush()
+		_, _ = io.Copy(io.Discard, brw) // Until the client closes the connection.
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	c, err := Dial(t.Context(), s.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	select {
+	case <-c.IncomingMessages():
+	case <-time.After(time.Second):
+		c.Close(StatusNormalClosure)
+	}
+
+	validated := c.CloseStatus() == StatusInvalidData
+	if validated != SupportsUTF8Validation {
+		t.Errorf("invalid UTF-8 text failed the connection = %v, but SupportsUTF8Validation = %v",
+			validated, SupportsUTF8Validation)
+	}
+	if SupportsFailFastUTF8 && !SupportsUTF8Validation {
+		t.Error("SupportsFailFastUTF8 requires SupportsUTF8Validation")
+	}
+}
@@ -25,9 +25,9 @@ const (
 	_
 	_
 	_
-	opcodeClose
-	opcodePing
-	opcodePong
+	OpcodeClose
+	OpcodePing
+	OpcodePong
 	// 11-16 are reserved for further control frames.
 )
 
@@ -40,17 +40,29 @@ func (o Opcode) String() string {
 		return "text"
 	case OpcodeBinary:
 		return "binary"
-	case opcodeClose:
+	case OpcodeClose:
 		return "close"
-	case opcodePing:
+	case OpcodePing:
 		return "ping"
-	case opcodePong:
+	case OpcodePong:
 		return "pong"
 	default:
 		return strconv.Itoa(int(o))
 	}
 }
 
+// isReserved reports whether the opcode is reserved for further
+// non-control frames (3-7) or further control frames (11-15).
+func (o Opcode) isReserved() bool {
+	return (o > OpcodeBinary && o < OpcodeClose) || o > OpcodePong
+}
+
+// isControl reports whether the opcode denotes a control frame, as
+// defined in https://datatracker.ietf.org/doc/html/rfc6455#section-5.5.
+func (o Opcode) isControl() bool {
+	return o >= OpcodeClose
+}
+
 // Frame parsing/construction constants, as defined in
 // https://datatracker.ietf.org/doc/html/rfc6455#section-5.2.
 const (
@@ -93,10 +105,14 @@ type frameHeader struct {
 	// + the length of the "Application data". The length of the "Extension data" may be
 	// zero, in which case the payload length is the length of the "Application data".
 	payloadLength uint64
+	// 0 or 4 bytes: All frames sent from the client to the server are masked by a
+	// 32-bit value that is contained within the frame. This field is present if the
+	// mask bit is set to 1 and is absent if the mask bit is set to 0.
+	maskingKey [4]byte
 }
 
-// readFrameHeader reads a frame received from the server,
-// except for the payload. It blocks until such a frame exists.
+// readFrameHeader reads a frame received from the server (or from the client,
+// see [Upgrade]), except for the payload. It blocks until such a frame exists.
 //
 // It is based on:
 //   - Base framing protocol: https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
@@ -139,6 +155,12 @@ func (c *Conn) readFrameHeader() (frameHeader, error) {
 		return h, fmt.Errorf("failed to read payload length of incoming WebSocket frame: %w", err)
 	}
 
+	if h.mask {
+		if _, err := io.ReadFull(c.bufio, h.maskingKey[:]); err != nil {
+			return h, fmt.Errorf("failed to read masking key of incoming WebSocket frame: %w", err)
+		}
+	}
+
 	return h, nil
 }
 
@@ -150,24 +172,35 @@ const (
 
 // checkFrameHeader checks if the connection needs to be closed, in case the
 // server sent an invalid frame. If so, it also returns a human-readable reason.
+// The inProgress flag indicates whether a fragmented data message was started
+// by a previous frame (with the FIN bit clear) and hasn't been terminated yet.
 //
 // It is based on:
 //   - Overview: https://datatracker.ietf.org/doc/html/rfc6455#section-5.1
 //   - Base framing protocol: https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
 //   - Control frames: https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
-func (c *Conn) checkFrameHeader(h frameHeader, msgType Opcode) (string, error) {
+func (c *Conn) checkFrameHeader(h frameHeader, inProgress bool) (string, error) {
 	// "Reserved bits MUST be 0 unless an extension is negotiated that defines
 	// meanings for non-zero values. If a nonzero value is received and none of
 	// the negotiated extensions defines the meaning of such a nonzero value,
 	// the receiving endpoint MUST _Fail the WebSocket Connection_."
-	if h.rsv[0] || h.rsv[1] || h.rsv[2] {
+	//
+	// RSV1 marks compressed messages in the "permessage-deflate" extension
+	// (https://datatracker.ietf.org/doc/html/rfc7692#section-6), which this
+	// client doesn't negotiate, so it's reported separately: a server that
+	// sets it anyway has mis-negotiated, and its payloads would be garbage.
+	if h.rsv[0] {
+		reason := "compressed frame without negotiated compression"
+		return reason, fmt.Errorf("WebSocket server sent %s", reason)
+	}
+	if h.rsv[1] || h.rsv[2] {
 		reason := "invalid reserved bits"
 		return reason, fmt.Errorf("WebSocket server sent %s", reason)
 	}
 
 	// "If an unknown opcode is received, the receiving
 	// endpoint MUST _Fail the WebSocket Connection_."
-	if (h.opcode > 2 && h.opcode < 8) || h.opcode > 10 {
+	if h.opcode.isReserved() {
 		reason := fmt.Sprintf("unknown opcode %d", h.opcode)
 		return reason, fmt.Errorf("WebSocket server sent %s", reason)
 	}
@@ -176,18 +209,18 @@ func (c *Conn) checkFrameHeader(h frameHeader, msgType Opcode) (string, error) {
 	// clear and an opcode other than 0, followed by zero or more frames
 	// with the FIN bit clear and the opcode set to 0, and terminated by
 	// a single frame with the FIN bit set and an opcode of 0."
-	if h.opcode == opcodeContinuation && msgType == opcodeContinuation {
+	if h.opcode == opcodeContinuation && !inProgress {
 		reason := "continuation frame with nothing to continue"
 		return reason, fmt.Errorf("WebSocket server sent %s", reason)
 	}
-	if (h.opcode == OpcodeText || h.opcode == OpcodeBinary) && msgType != opcodeContinuation {
-		reason := "continuation frame with non-continuation opcode"
+	if (h.opcode == OpcodeText || h.opcode == OpcodeBinary) && inProgress {
+		reason := "new data frame in the middle of a fragmented message"
 		return reason, fmt.Errorf("WebSocket server sent %s", reason)
 	}
 
 	// "All control frames MUST have a payload length of
 	// 125 bytes or less and MUST NOT be fragmented."
-	if h.opcode > 7 {
+	if h.opcode.isControl() {
 		if h.payloadLength > maxControlPayload {
 			reason := "payload length too big"
 			return reason, fmt.Errorf("WebSocket control frame (opcode %d) too large: %d bytes", h.opcode, h.payloadLength)
@@ -200,15 +233,23 @@ func (c *Conn) checkFrameHeader(h frameHeader, msgType Opcode) (string, error) {
 
 	// "A server MUST NOT mask any frames that it sends to the client.
 	// A client MUST close a connection if it detects a masked frame."
-	if h.mask {
+	if h.mask && !c.server {
 		reason := "server payloads must not be masked"
 		return reason, errors.New("WebSocket server masked the payload data")
 	}
 
+	// "The server MUST close the connection upon
+	// receiving a frame that is not masked."
+	if !h.mask && c.server {
+		reason := "client payloads must be masked"
+		return reason, errors.New("WebSocket client didn't mask the payload data")
+	}
+
 	return "", nil
 }
 
-// writeFrame is optimized to send a single, unfragmented, masked frame.
+// writeFrame is optimized to send a single, unfragmented, masked frame
+// (or an unmasked one, when the connection was accepted with [Upgrade]).
 //
 // Do not call this function directly, call [sendControlFrame] instead,
 // to ensure we always send one frame at a time!
@@ -227,20 +268,29 @@ func (c *Conn) writeFrame(op Opcode, payload []byte) error {
 		return fmt.Errorf("failed to write WebSocket control frame header: %w", err)
 	}
 
-	// Generate a random client masking key.
-	if _, err := io.ReadFull(rand.Reader, c.writeBuf[:4]); err != nil {
-		return fmt.Errorf("failed to generate masking key for WebSocket client frame: %w", err)
-	}
+	if c.masksFrames() {
+		// Generate a random client masking key.
+		r := c.maskGen
+		if r == nil {
+			r = rand.Reader
+		}
+		if _, err := io.ReadFull(r, c.writeBuf[:4]); err != nil {
+			return fmt.Errorf("failed to generate masking key for WebSocket client frame: %w", err)
+		}
 
-	if _, err := c.bufio.Write(c.writeBuf[:4]); err != nil {
-		return fmt.Errorf("failed to write WebSocket control frame masking key: %w", err)
+		if _, err := c.bufio.Write(c.writeBuf[:4]); err != nil {
+			return fmt.Errorf("failed to write WebSocket control frame masking key: %w", err)
+		}
+
+		// Mask the payload.
+		if len(payload) > 0 {
+			c.mask(payload)
+			defer c.mask(payload) // Undo the masking before returning.
+		}
 	}
 
-	// Mask and copy the payload.
+	// Copy the payload.
 	if len(payload) > 0 {
-		c.mask(payload)
-		defer c.mask(payload) // Undo the masking before returning.
-
 		if _, err := c.bufio.Write(payload); err != nil {
 			return fmt.Errorf("failed to write WebSocket control frame payload: %w", err)
 		}
@@ -251,20 +301,27 @@ func (c *Conn) writeFrame(op Opcode, payload []byte) error {
 		return fmt.Errorf("failed to flush after writing WebSocket control frame: %w", err)
 	}
 
+	c.stats.sent(op, len(payload))
 	return nil
 }
 
 // writePayloadLength implements the payload length formatting which is
-// defined in https://datatracker.ietf.org/doc/html/rfc6455#section-5.2.
+// defined in https://datatracker.ietf.org/doc/html/rfc6455#section-5.2,
+// along with the mask bit (which is set only in client frames).
 func (c *Conn) writePayloadLength(n int) error {
+	var maskBit byte
+	if c.masksFrames() {
+		maskBit = bit0
+	}
+
 	switch {
 	// Up to 125 bytes (0 extra bytes).
 	case n <= maxControlPayload:
-		return c.bufio.WriteByte(bit0 | byte(n))
+		return c.bufio.WriteByte(maskBit | byte(n))
 
 	// Up to 64 KiB (2 extra bytes).
 	case n <= math.MaxUint16:
-		if err := c.bufio.WriteByte(bit0 | len16bits); err != nil {
+		if err := c.bufio.WriteByte(maskBit | len16bits); err != nil {
 			return err
 		}
 		binary.BigEndian.PutUint16(c.writeBuf[:2], uint16(n))
@@ -273,7 +330,7 @@ func (c *Conn) writePayloadLength(n int) error {
 
 	// Up to 16 EiB (8 extra bytes).
 	default:
-		if err := c.bufio.WriteByte(bit0 | len64bits); err != nil {
+		if err := c.bufio.WriteByte(maskBit | len64bits); err != nil {
 			return err
 		}
 		binary.BigEndian.PutUint64(c.writeBuf[:8], uint64(n))
@@ -282,12 +339,25 @@ func (c *Conn) writePayloadLength(n int) error {
 	}
 }
 
+// masksFrames reports whether outbound frames are masked: always in
+// client connections, unless disabled with [WithMasking], and never in
+// server connections (see [Upgrade]).
+func (c *Conn) masksFrames() bool {
+	return !c.server && !c.noMasking
+}
+
 // mask implements https://datatracker.ietf.org/doc/html/rfc6455#section-5.3.
 // Notice that it changes the input slice in-place! However,
 // this function is its own inverse: applying it twice on the
 // same payload results in the original unmasked payload.
 func (c *Conn) mask(payload []byte) {
+	unmask(payload, c.writeBuf[:4])
+}
+
+// unmask implements https://datatracker.ietf.org/doc/html/rfc6455#section-5.3
+// with the given masking key, for frames received from clients (see [Upgrade]).
+func unmask(payload, key []byte) {
 	for i := range len(payload) {
-		payload[i] ^= c.writeBuf[i&3]
+		payload[i] ^= key[i&3]
 	}
 }
@@ -23,7 +23,7 @@ func TestConnReadFrameHeader(t *testing.T) {
 		{
 			name:   "masked_text_hello",
 			reader: []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58},
-			want:   frameHeader{fin: true, opcode: OpcodeText, mask: true, payloadLength: 5},
+			want:   frameHeader{fin: true, opcode: OpcodeText, mask: true, payloadLength: 5, maskingKey: [4]byte{0x37, 0xfa, 0x21, 0x3d}},
 		},
 		{
 			name:   "first_fragment_unmasked_text_hel",
@@ -33,12 +33,12 @@ func TestConnReadFrameHeader(t *testing.T) {
 		{
 			name:   "unmasked_ping",
 			reader: []byte{0x89, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f},
-			want:   frameHeader{fin: true, opcode: opcodePing, payloadLength: 5},
+			want:   frameHeader{fin: true, opcode: OpcodePing, payloadLength: 5},
 		},
 		{
 			name:   "masked_pong",
 			reader: []byte{0x8a, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58},
-			want:   frameHeader{fin: true, opcode: opcodePong, mask: true, payloadLength: 5},
+			want:   frameHeader{fin: true, opcode: OpcodePong, mask: true, payloadLength: 5, maskingKey: [4]byte{0x37, 0xfa, 0x21, 0x3d}},
 		},
 		{
 			name:   "256b_unmasked_binary",
@@ -98,6 +98,58 @@ func TestConnWriteFrame(t *testing.T) {
 	}
 }
 
+func TestConnWriteFrameFixedMaskingKey(t *testing.T) {
+	c := &Conn{maskGen: bytes.NewReader([]byte{0x37, 0xfa, 0x21, 0x3d})}
+	b := new(bytes.Buffer)
+	c.bufio = bufio.NewReadWriter(nil, bufio.NewWriter(b))
+
+	if err := c.writeFrame(OpcodeText, []byte("Hello")); err != nil {
+		t.Fatalf("Conn.writeFrame() error = %v", err)
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-5.7
+	want := []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}
+	if got := b.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Conn.writeFrame() output = %v, want %v", got, want)
+	}
+}
+
+func TestConnWriteFrameServer(t *testing.T) {
+	c := &Conn{server: true}
+	b := new(bytes.Buffer)
+	c.bufio = bufio.NewReadWriter(nil, bufio.NewWriter(b))
+
+	if err := c.writeFrame(OpcodeText, []byte("hello")); err != nil {
+		t.Fatalf("Conn.writeFrame() error = %v", err)
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-5.7
+	want := []byte{0x81, 0x05, 'h', 'e', 'l', 'l', 'o'}
+	if got := b.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Conn.writeFrame() output = %v, want %v", got, want)
+	}
+}
+
+func TestConnWriteFrameWithoutMasking(t *testing.T) {
+	c := &Conn{}
+	WithMasking(false)(c)
+	b := new(bytes.Buffer)
+	c.bufio = bufio.NewReadWriter(nil, bufio.NewWriter(b))
+
+	if err := c.writeFrame(OpcodeText, []byte("hello")); err != nil {
+		t.Fatalf("Conn.writeFrame() error = %v", err)
+	}
+
+	got := b.Bytes()
+	if got[1]&bit0 != 0 {
+		t.Errorf("Conn.writeFrame() mask bit is set: %#x", got[1])
+	}
+	want := []byte{0x81, 0x05, 'h', 'e', 'l', 'l', 'o'}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Conn.writeFrame() output = %v, want %v", got, want)
+	}
+}
+
 func TestConnWritePayloadLength(t *testing.T) {
 	tests := []struct {
 		name string
@@ -213,3 +265,37 @@ func TestConnMask(t *testing.T) {
 		})
 	}
 }
+
+func TestOpcodeString(t *testing.T) {
+	tests := []struct {
+		o    Opcode
+		want string
+	}{
+		{o: opcodeContinuation, want: "continuation"},
+		{o: OpcodeText, want: "text"},
+		{o: OpcodeBinary, want: "binary"},
+		{o: OpcodeClose, want: "close"},
+		{o: OpcodePing, want: "ping"},
+		{o: OpcodePong, want: "pong"},
+		{o: 3, want: "3"},
+		{o: 11, want: "11"},
+		{o: 15, want: "15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.o.String(); got != tt.want {
+				t.Errorf("Opcode(%d).String() = %q, want %q", int(tt.o), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpcodeIsReserved(t *testing.T) {
+	for o := range Opcode(16) {
+		want := (o >= 3 && o <= 7) || o >= 11
+		if got := o.isReserved(); got != want {
+			t.Errorf("Opcode(%d).isReserved() = %v, want %v", o, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// ClientInfo is a snapshot of the state of a cached [Client], for debugging.
+// It doesn't contain any secrets or URLs, only the client's hashed ID.
+type ClientInfo struct {
+	HashedID string `json:"hashed_id"`
+
+	// Connections is the number of open underlying [Conn]s:
+	// usually 1, 2 while refreshing, and 0 while reconnecting.
+	Connections int `json:"connections"`
+
+	// Subscribers is the number of callers of [NewOrCachedClient]
+	// which received this client, i.e. share its incoming messages.
+	Subscribers int `json:"subscribers"`
+
+	// LastActivity is when the last data [Message] was received, if any.
+	LastActivity time.Time `json:"last_activity,omitzero"`
+
+	// LastError is the last reconnection error, if any.
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+}
+
+// ListClients returns a snapshot of all the cached [Client]s,
+// sorted by their hashed IDs (see [NewOrCachedClient]).
+func ListClients() []ClientInfo {
+	var infos []ClientInfo
+	clients.Range(func(k, v any) bool {
+		infos = append(infos, v.(*Client).info(k.(string)))
+		return true
+	})
+
+	slices.SortFunc(infos, func(a, b ClientInfo) int {
+		return cmp.Compare(a.HashedID, b.HashedID)
+	})
+	return infos
+}
+
+func (c *Client) info(hashedID string) ClientInfo {
+	i := ClientInfo{HashedID: hashedID}
+
+	c.connsMu.RLock()
+	for _, conn := range c.conns {
+		if conn != nil && !conn.IsClosed() {
+			i.Connections++
+		}
+	}
+	c.connsMu.RUnlock()
+
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	i.Subscribers = c.subscribers
+	i.LastActivity = c.lastActivity
+	if c.lastErr != nil {
+		i.LastError = c.lastErr.Error()
+		i.LastErrorAt = c.lastErrAt
+	}
+
+	return i
+}
+
+func (c *Client) addSubscriber() {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.subscribers++
+}
+
+func (c *Client) setErr(err error) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.lastErr = err
+	c.lastErrAt = time.Now()
+}
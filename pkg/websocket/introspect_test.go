@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestListClients(t *testing.T) {
+	closeConn := make(chan struct{})
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		_, _ = brw.Write([]byte{0x81, 0x02, 'h', 'i'})
+		_ = brw.Flush()
+		<-closeConn
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	var calls atomic.Int32
+	url := func(_ context.Context) (string, error) {
+		if calls.Add(1) > 1 {
+			return "", errors.New("url unavailable")
+		}
+		return s.URL + "/secret-path", nil
+	}
+
+	id := "list-clients-secret-id"
+	t.Cleanup(func() { clients.Delete(hash(id)) })
+
+	opts := []ClientOpt{WithReconnectRate(1, time.Minute, time.Minute), WithReconnectBackoff(0, 0), WithRelayTimeout(time.Second)}
+	c, err := NewOrCachedClientWithOpts(t.Context(), url, id, opts...)
+	if err != nil {
+		t.Fatalf("NewOrCachedClientWithOpts() error = %v", err)
+	}
+	if _, err := NewOrCachedClientWithOpts(t.Context(), url, id, opts...); err != nil {
+		t.Fatalf("NewOrCachedClientWithOpts() error = %v", err)
+	}
+	<-c.IncomingMessages()
+
+	// Created client.
+	got := findClient(t, id)
+	if got.Connections != 1 {
+		t.Errorf("Connections = %d, want 1", got.Connections)
+	}
+	if got.Subscribers != 2 {
+		t.Errorf("Subscribers = %d, want 2", got.Subscribers)
+	}
+	if got.LastActivity.IsZero() {
+		t.Error("LastActivity is zero")
+	}
+	if got.LastError != "" {
+		t.Errorf("LastError = %q, want empty", got.LastError)
+	}
+
+	// Closed connection, failed reconnection.
+	close(closeConn)
+	time.Sleep(100 * time.Millisecond)
+
+	got = findClient(t, id)
+	if got.Connections != 0 {
+		t.Errorf("Connections = %d, want 0", got.Connections)
+	}
+	if !strings.Contains(got.LastError, "url unavailable") {
+		t.Errorf("LastError = %q, want it to contain %q", got.LastError, "url unavailable")
+	}
+	if got.LastErrorAt.IsZero() {
+		t.Error("LastErrorAt is zero")
+	}
+
+	for _, s := range []string{got.HashedID, got.LastError} {
+		if strings.Contains(s, id) || strings.Contains(s, "secret-path") {
+			t.Errorf("ClientInfo leaks secrets: %q", s)
+		}
+	}
+}
+
+func findClient(t *testing.T, id string) ClientInfo {
+	t.Helper()
+
+	for _, c := range ListClients() {
+		if c.HashedID == hash(id) {
+			return c
+		}
+	}
+
+	t.Fatalf("ListClients() doesn't contain client %q", id)
+	return ClientInfo{}
+}
+
+func TestListClientsDuringReconnections(t *testing.T) {
+	s := newHijackingServer(t, func(conn net.Conn, _ *bufio.ReadWriter) {
+		_ = conn.Close() // Immediately close every connection.
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	id := "list-clients-reconnections"
+	t.Cleanup(func() { clients.Delete(hash(id)) })
+
+	c, err := NewOrCachedClientWithOpts(t.Context(), url, id, WithReconnectRate(1000, time.Minute, 0), WithReconnectBackoff(0, 0))
+	if err != nil {
+		t.Fatalf("NewOrCachedClientWithOpts() error = %v", err)
+	}
+
+	// Run with "-race" to detect unsynchronized access to the client's connections.
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+		findClient(t, id)
+		_ = c.SendJSONMessage("ping")
+		_ = c.Stats()
+	}
+
+	// Stop reconnecting before closing the server.
+	c.Close()
+	for range c.IncomingMessages() {
+	}
+}
@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"context"
+	"time"
+)
+
+// LifecycleEventType identifies a change in the state of a [Client]'s connection.
+type LifecycleEventType string
+
+const (
+	// ConnEstablished is emitted when a [Client] opens its first connection.
+	ConnEstablished LifecycleEventType = "established"
+	// ConnClosed is emitted when a [Client]'s active connection is closed, with or
+	// without a closing handshake (see [LifecycleEvent.CloseStatus]), but not when
+	// the client closes it itself (see [Client.Close] and [ClientGaveUp]).
+	ConnClosed LifecycleEventType = "closed"
+	// ConnReconnected is emitted when a [Client] replaces a closed connection.
+	ConnReconnected LifecycleEventType = "reconnected"
+	// ConnError is emitted when a [Client] fails to open a replacement connection.
+	ConnError LifecycleEventType = "error"
+	// ClientGaveUp is emitted when a [Client] stops trying to reconnect and closes
+	// itself, because the server rejected its credentials, or after too many failed
+	// attempts (see [WithMaxReconnects]). This is a terminal error, which requires
+	// operator attention (e.g. a revoked token), and the last error is attached.
+	ClientGaveUp LifecycleEventType = "gave_up"
+)
+
+// LifecycleEvent describes a change in the state of a [Client]'s connection.
+// Alerting pipelines may use them to notice flapping or failing connections.
+type LifecycleEvent struct {
+	Type        LifecycleEventType
+	Time        time.Time
+	CloseStatus StatusCode // Only in [ConnClosed] events.
+	Err         error      // Only in [ConnError] and [ClientGaveUp] events.
+}
+
+// LifecycleFunc receives [LifecycleEvent]s synchronously,
+// so it must return quickly, and must not block.
+type LifecycleFunc func(LifecycleEvent)
+
+// WithLifecycleFunc lets callers of [NewOrCachedClientWithOpts] receive
+// [LifecycleEvent]s about the client's underlying connections. This option may
+// be used multiple times, to register multiple functions. Nil functions are ignored.
+func WithLifecycleFunc(f LifecycleFunc) ClientOpt {
+	return func(c *Client) {
+		if f != nil {
+			c.lifecycle = append(c.lifecycle, f)
+		}
+	}
+}
+
+type lifecycleKey struct{}
+
+// ContextWithLifecycle returns a copy of the given context which carries a
+// [LifecycleFunc], to pass it through layers which don't know about it, e.g.
+// from a connection manager to link-specific code that creates [Client]s.
+func ContextWithLifecycle(ctx context.Context, f LifecycleFunc) context.Context {
+	return context.WithValue(ctx, lifecycleKey{}, f)
+}
+
+// LifecycleFromContext returns the [LifecycleFunc] which was attached to the
+// given context with [ContextWithLifecycle], or nil if there isn't one.
+func LifecycleFromContext(ctx context.Context) LifecycleFunc {
+	f, _ := ctx.Value(lifecycleKey{}).(LifecycleFunc)
+	return f
+}
+
+// emit reports a [LifecycleEvent] to all the client's [LifecycleFunc]s.
+func (c *Client) emit(e LifecycleEvent) {
+	if len(c.lifecycle) == 0 {
+		return
+	}
+
+	e.Time = time.Now()
+	for _, f := range c.lifecycle {
+		f(e)
+	}
+}
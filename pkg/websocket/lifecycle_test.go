@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientLifecycleEvents(t *testing.T) {
+	var handshakes atomic.Int32
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		if handshakes.Add(1) == 1 {
+			_ = conn.Close() // Abnormal closure of the first connection.
+			return
+		}
+		_, _ = io.Copy(io.Discard, brw)
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	events := make(chan LifecycleEvent, 10)
+	c, err := newClient(t.Context(), url, WithLifecycleFunc(func(e LifecycleEvent) {
+		events <- e
+	}))
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+
+	want := []LifecycleEvent{
+		{Type: ConnEstablished},
+		{Type: ConnClosed, CloseStatus: StatusClosedAbnormally},
+		{Type: ConnReconnected},
+	}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got.Type != w.Type || got.CloseStatus != w.CloseStatus {
+				t.Errorf("lifecycle event = %+v, want %+v", got, w)
+			}
+			if got.Time.IsZero() {
+				t.Errorf("lifecycle event %q time is zero", got.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("lifecycle event %q wasn't emitted", w.Type)
+		}
+	}
+}
+
+func TestClientEmitMultipleFuncs(t *testing.T) {
+	var got []string
+	record := func(name string) LifecycleFunc {
+		return func(e LifecycleEvent) { got = append(got, name+":"+string(e.Type)) }
+	}
+
+	c := &Client{}
+	for _, opt := range []ClientOpt{WithLifecycleFunc(record("a")), WithLifecycleFunc(nil), WithLifecycleFunc(record("b"))} {
+		opt(c)
+	}
+	c.emit(LifecycleEvent{Type: ConnError})
+
+	if want := []string{"a:error", "b:error"}; !slices.Equal(got, want) {
+		t.Errorf("emitted events = %v, want %v", got, want)
+	}
+}
+
+func TestLifecycleFromContext(t *testing.T) {
+	if f := LifecycleFromContext(t.Context()); f != nil {
+		t.Error("LifecycleFromContext() without a function != nil")
+	}
+
+	var called bool
+	ctx := ContextWithLifecycle(t.Context(), func(LifecycleEvent) { called = true })
+	f := LifecycleFromContext(ctx)
+	if f == nil {
+		t.Fatal("LifecycleFromContext() = nil")
+	}
+	f(LifecycleEvent{})
+	if !called {
+		t.Error("LifecycleFromContext() returned a different function")
+	}
+}
@@ -2,8 +2,15 @@ package websocket
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
 	"unicode/utf8"
 )
 
@@ -25,15 +32,15 @@ import (
 //   - Handling Errors in UTF-8-Encoded Data: https://datatracker.ietf.org/doc/html/rfc6455#section-8.1
 func (c *Conn) readMessage() *internalMessage {
 	var msg bytes.Buffer
-	var op Opcode
+	var op Opcode       // Of the data message, from its first frame.
+	var inProgress bool // Received a non-FIN data frame, waiting for more.
 
 	for {
 		h, err := c.readFrameHeader()
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				c.logger.Trace().Msg("WebSocket connection closed")
-				c.closeReceived = true
-				c.closeSent = true
+			if isConnDropped(err) {
+				c.logger.Debug().Err(err).Msg("WebSocket connection closed without a closing handshake")
+				c.closeAbnormally()
 				return nil
 			}
 			c.logger.Err(err).Msg("failed to read WebSocket frame header")
@@ -44,21 +51,33 @@ func (c *Conn) readMessage() *internalMessage {
 		c.logger.Trace().Bool("fin", h.fin).Str("opcode", h.opcode.String()).
 			Uint64("length", h.payloadLength).Msg("received WebSocket frame")
 
+		// Check the header before reading the payload, so an invalid
+		// length (e.g. of a control frame) isn't allocated or waited for.
+		if reason, err := c.checkFrameHeader(h, inProgress); err != nil {
+			c.logger.Err(err).Msg("protocol error due to invalid frame")
+			c.sendCloseControlFrame(StatusProtocolError, reason)
+			return nil
+		}
+
 		var data []byte
 		if h.payloadLength > 0 {
 			data = make([]byte, h.payloadLength)
 			if _, err := io.ReadFull(c.bufio, data); err != nil {
+				if isConnDropped(err) {
+					c.logger.Debug().Err(err).Msg("WebSocket connection closed without a closing handshake")
+					c.closeAbnormally()
+					return nil
+				}
 				c.logger.Err(err).Msg("failed to read WebSocket frame payload")
 				c.sendCloseControlFrame(StatusInternalError, "frame payload reading error")
 				return nil
 			}
+			if h.mask {
+				unmask(data, h.maskingKey[:])
+			}
 		}
 
-		if reason, err := c.checkFrameHeader(h, op); err != nil {
-			c.logger.Err(err).Msg("protocol error due to invalid frame")
-			c.sendCloseControlFrame(StatusProtocolError, reason)
-			return nil
-		}
+		c.stats.received(h.opcode, h.payloadLength)
 
 		switch h.opcode {
 		// "A fragmented message consists of a single frame with the FIN bit
@@ -69,6 +88,7 @@ func (c *Conn) readMessage() *internalMessage {
 			if h.opcode != opcodeContinuation {
 				op = h.opcode
 			}
+			inProgress = !h.fin
 			if h.payloadLength > 0 {
 				if _, err := msg.Write(data); err != nil {
 					c.logger.Err(err).Msg("failed to store WebSocket data frame payload")
@@ -79,20 +99,21 @@ func (c *Conn) readMessage() *internalMessage {
 
 		// "If an endpoint receives a Close frame and did not previously send
 		// a Close frame, the endpoint MUST send a Close frame in response."
-		case opcodeClose:
-			c.closeReceived = true
+		case OpcodeClose:
+			c.closeReceived.Store(true)
 			status, reason := c.parseClosePayload(data)
+			c.setCloseStatus(status)
 			c.sendCloseControlFrame(status, reason)
 			return nil // Not an error, but we no longer need to receive new frames.
 
 		// "An endpoint MUST be capable of handling control
 		// frames in the middle of a fragmented message."
-		case opcodePing:
-			if err := <-c.sendControlFrame(opcodePong, data); err != nil {
+		case OpcodePing:
+			if err := <-c.sendControlFrame(OpcodePong, data); err != nil {
 				c.logger.Err(err).Bytes("payload", data).Msg("failed to send WebSocket pong control frame")
 			}
 
-		case opcodePong:
+		case OpcodePong:
 			// No need to handle "Pong" control frames, since this
 			// client doesn't send unsolicited "Ping" control frames.
 		}
@@ -103,6 +124,14 @@ func (c *Conn) readMessage() *internalMessage {
 	}
 }
 
+// isConnDropped checks whether a read error indicates that the server (or
+// the network) dropped the underlying TCP connection without a closing
+// handshake, as opposed to a genuine internal error on the client's side.
+func isConnDropped(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
 func (c *Conn) finalizeMessage(op Opcode, data []byte) *internalMessage {
 	if data == nil {
 		data = []byte{}
@@ -129,14 +158,15 @@ func (c *Conn) finalizeMessage(op Opcode, data []byte) *internalMessage {
 // This is done asynchronously, to manage [isolation or safe multiplexing]
 // of multiple concurrent calls, including interleaved control frames.
 // Despite that, this function enables the caller to block and/or
-// handle errors, with the returned channel.
+// handle errors, with the returned channel. If the connection is
+// closed or closing, the channel reports [ErrConnClosed] immediately.
+// If the data is not valid UTF-8, the message is not sent, and
+// the channel reports [ErrInvalidUTF8] immediately.
 //
 // [UTF-8 text]: https://datatracker.ietf.org/doc/html/rfc6455#section-5.6
 // [isolation or safe multiplexing]: https://datatracker.ietf.org/doc/html/rfc6455#section-5.4
 func (c *Conn) SendTextMessage(data []byte) <-chan error {
-	err := make(chan error)
-	c.writer <- internalMessage{Opcode: OpcodeText, Data: data, err: err}
-	return err
+	return c.send(OpcodeText, data)
 }
 
 // SendBinaryMessage sends a [binary] message to the server.
@@ -144,14 +174,29 @@ func (c *Conn) SendTextMessage(data []byte) <-chan error {
 // This is done asynchronously, to manage [isolation or safe multiplexing]
 // of multiple concurrent calls, including interleaved control frames.
 // Despite that, this function enables the caller to block and/or
-// handle errors, with the returned channel.
+// handle errors, with the returned channel. If the connection is
+// closed or closing, the channel reports [ErrConnClosed] immediately.
 //
 // [binary]: https://datatracker.ietf.org/doc/html/rfc6455#section-5.6
 // [isolation or safe multiplexing]: https://datatracker.ietf.org/doc/html/rfc6455#section-5.4
 func (c *Conn) SendBinaryMessage(data []byte) <-chan error {
-	err := make(chan error)
-	c.writer <- internalMessage{Opcode: OpcodeBinary, Data: data, err: err}
-	return err
+	return c.send(OpcodeBinary, data)
+}
+
+// SendTextMessageContext is like [Conn.SendTextMessage], but it stops waiting
+// for the connection to accept the message if the given context is canceled,
+// in which case the returned channel reports the context's error. This prevents
+// goroutine leaks when the connection is stuck. Messages which were already
+// accepted before the cancellation are still sent.
+func (c *Conn) SendTextMessageContext(ctx context.Context, data []byte) <-chan error {
+	return c.sendContext(ctx, OpcodeText, data)
+}
+
+// SendBinaryMessageContext is like [Conn.SendBinaryMessage], but it stops
+// waiting for the connection to accept the message if the given context is
+// canceled (see [Conn.SendTextMessageContext]).
+func (c *Conn) SendBinaryMessageContext(ctx context.Context, data []byte) <-chan error {
+	return c.sendContext(ctx, OpcodeBinary, data)
 }
 
 // sendControlFrame sends a [WebSocket control frame] to the server.
@@ -165,7 +210,85 @@ func (c *Conn) SendBinaryMessage(data []byte) <-chan error {
 //
 // [WebSocket control frame]: https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
 func (c *Conn) sendControlFrame(op Opcode, payload []byte) <-chan error {
-	err := make(chan error)
-	c.writer <- internalMessage{Opcode: op, Data: payload, err: err}
-	return err
+	return c.send(op, payload)
+}
+
+// WriteControl sends a [WebSocket control frame] with an application-specific
+// payload (e.g. a ping with custom data, or a close with a custom reason), and
+// waits until it's written, or until the given deadline (if it's not zero).
+// The payload length is limited to 125 bytes, and close frames may be sent
+// only once - use [Conn.Close] for standard connection closures.
+//
+// Frames that are abandoned due to the deadline may still be written later.
+//
+// [WebSocket control frame]: https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
+func (c *Conn) WriteControl(op Opcode, payload []byte, deadline time.Time) error {
+	if op != OpcodeClose && op != OpcodePing && op != OpcodePong {
+		return fmt.Errorf("invalid WebSocket control frame opcode: %s", op)
+	}
+	if len(payload) > maxControlPayload {
+		return fmt.Errorf("WebSocket control frame payload too large: %d bytes", len(payload))
+	}
+
+	if op != OpcodeClose {
+		return c.writeControl(op, payload, deadline)
+	}
+
+	// "The Close frame MAY contain a body [...] If there is a body,
+	// the first two bytes of the body MUST be a 2-byte unsigned integer".
+	if len(payload) == 1 {
+		return errors.New("invalid WebSocket close control frame payload: missing status code")
+	}
+
+	c.closeSentMu.Lock()
+	defer c.closeSentMu.Unlock()
+
+	if c.closeSent {
+		return errors.New("WebSocket close control frame already sent")
+	}
+
+	if err := c.writeControl(op, payload, deadline); err != nil {
+		return err
+	}
+
+	c.closeSent = true
+	if c.closeStatus == 0 {
+		c.closeStatus = StatusNotReceived
+		if len(payload) >= 2 {
+			c.closeStatus = StatusCode(binary.BigEndian.Uint16(payload[:2]))
+		}
+	}
+	if c.closeReceived.Load() {
+		c.closeNetConn()
+	}
+
+	return nil
+}
+
+// writeControl is similar to [Conn.sendControlFrame], but
+// blocks until the frame is written, or the deadline expires.
+func (c *Conn) writeControl(op Opcode, payload []byte, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	// Buffered, in case the frame is abandoned and written later.
+	err := make(chan error, 1)
+	select {
+	case c.writer <- internalMessage{Opcode: op, Data: payload, err: err}:
+	case <-c.done:
+		return ErrConnClosed
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+
+	select {
+	case e := <-err:
+		return e
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
 }
@@ -3,14 +3,208 @@ package websocket
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
+func TestReadMessageAbnormalClosure(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{
+			name: "before_frame_header",
+		},
+		{
+			name:  "inside_frame_header",
+			frame: []byte{0x81},
+		},
+		{
+			name:  "inside_frame_payload",
+			frame: []byte{0x81, 0x05, 'H', 'e'},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+				_, _ = brw.Write(tt.frame)
+				_ = brw.Flush()
+				_ = conn.Close()
+			})
+			defer s.Close()
+
+			c, err := Dial(t.Context(), s.URL)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+
+			if msg, ok := <-c.IncomingMessages(); ok {
+				t.Fatalf("Conn.IncomingMessages() = %v, want closed channel", msg)
+			}
+			if got := c.CloseStatus(); got != StatusClosedAbnormally {
+				t.Errorf("Conn.CloseStatus() = %v, want %v", got, StatusClosedAbnormally)
+			}
+			if !c.IsClosed() {
+				t.Error("Conn.IsClosed() = false, want true")
+			}
+		})
+	}
+}
+
+func TestConnWriteControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      Opcode
+		payload []byte
+		wantErr bool
+	}{
+		{
+			name:    "ping",
+			op:      OpcodePing,
+			payload: []byte("app data"),
+		},
+		{
+			name: "empty_pong",
+			op:   OpcodePong,
+		},
+		{
+			name:    "close_with_reason",
+			op:      OpcodeClose,
+			payload: []byte{0x03, 0xe8, 'b', 'y', 'e'},
+		},
+		{
+			name:    "max_payload",
+			op:      OpcodePing,
+			payload: bytes.Repeat([]byte{'a'}, maxControlPayload),
+		},
+		{
+			name:    "oversized_payload",
+			op:      OpcodePing,
+			payload: bytes.Repeat([]byte{'a'}, maxControlPayload+1),
+			wantErr: true,
+		},
+		{
+			name:    "data_opcode",
+			op:      OpcodeText,
+			payload: []byte("text"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid_close_payload",
+			op:      OpcodeClose,
+			payload: []byte{0x03},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := make(chan []byte, 1)
+			s := newHijackingServer(t, func(_ net.Conn, brw *bufio.ReadWriter) {
+				frames <- readClientFrame(t, brw)
+			})
+			defer s.Close()
+
+			c, err := Dial(t.Context(), s.URL)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+
+			err = c.WriteControl(tt.op, tt.payload, time.Now().Add(time.Second))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Conn.WriteControl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := <-frames
+			if op := Opcode(got[0] & 0x0f); op != tt.op {
+				t.Errorf("server received opcode %s, want %s", op, tt.op)
+			}
+			if !bytes.Equal(got[1:], tt.payload) {
+				t.Errorf("server received payload %q, want %q", got[1:], tt.payload)
+			}
+
+			if tt.op == OpcodeClose {
+				if got := c.CloseStatus(); got != StatusNormalClosure {
+					t.Errorf("Conn.CloseStatus() = %v, want %v", got, StatusNormalClosure)
+				}
+				if err := c.WriteControl(OpcodeClose, nil, time.Time{}); err == nil {
+					t.Error("second Conn.WriteControl(OpcodeClose) error = nil, want error")
+				}
+			}
+		})
+	}
+}
+
+// readClientFrame reads a single short (up to 125 bytes) masked frame
+// from the client, and returns its first byte and unmasked payload.
+func readClientFrame(t *testing.T, brw *bufio.ReadWriter) []byte {
+	t.Helper()
+
+	h := make([]byte, 6)
+	if _, err := io.ReadFull(brw, h); err != nil {
+		t.Errorf("failed to read client frame header: %v", err)
+		return []byte{0}
+	}
+
+	payload := make([]byte, h[1]&0x7f)
+	if _, err := io.ReadFull(brw, payload); err != nil {
+		t.Errorf("failed to read client frame payload: %v", err)
+	}
+	for i := range payload {
+		payload[i] ^= h[2+i%4]
+	}
+
+	return append([]byte{h[0]}, payload...)
+}
+
+func TestReadMessagesReceivedAt(t *testing.T) {
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		for _, data := range []string{"one", "two", "three"} {
+			_, _ = brw.Write(append([]byte{0x81, byte(len(data))}, data...))
+			_ = brw.Flush()
+			time.Sleep(5 * time.Millisecond)
+		}
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	start := time.Now()
+	c, err := Dial(t.Context(), s.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	prev := start
+	n := 0
+	for msg := range c.IncomingMessages() {
+		n++
+		if msg.ReceivedAt.IsZero() {
+			t.Fatalf("message %d: Message.ReceivedAt is zero", n)
+		}
+		if msg.ReceivedAt.Before(prev) {
+			t.Errorf("message %d: Message.ReceivedAt = %v, want >= %v", n, msg.ReceivedAt, prev)
+		}
+		prev = msg.ReceivedAt
+	}
+
+	if n != 3 {
+		t.Errorf("got %d messages, want 3", n)
+	}
+}
+
 type benchmark struct {
 	name      string
 	msgLen    int
@@ -110,6 +304,53 @@ func BenchmarkReadMessage(b *testing.B) {
 	}
 }
 
+// countingReader counts the number of read calls, which
+// correspond to system calls when reading from a network connection.
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	cr.reads++
+	return cr.r.Read(p)
+}
+
+func BenchmarkReadMessageBufioSizes(b *testing.B) {
+	// A burst of many small messages, followed by a few large ones.
+	var stream []byte
+	for range 1000 {
+		stream = append(stream, 0x82, 100)
+		stream = append(stream, make([]byte, 100)...)
+	}
+	for range 10 {
+		stream = append(stream, 0x82, len64bits, 0, 0, 0, 0, 0, 1, 0, 0)
+		stream = append(stream, make([]byte, 65536)...)
+	}
+
+	l := zerolog.Nop()
+	for _, size := range []int{512, 4096, 65536} {
+		b.Run(fmt.Sprintf("read_buffer_%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(stream)))
+			reads := 0
+			for b.Loop() {
+				cr := &countingReader{r: bytes.NewReader(stream)}
+				c := &Conn{logger: &l, bufio: newBufio(struct {
+					io.Reader
+					io.Writer
+				}{cr, io.Discard}, size, 0)}
+				for range 1010 {
+					if msg := c.readMessage(); msg == nil {
+						b.Fatal("readMessage() = nil")
+					}
+				}
+				reads += cr.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
 func constructBenchmarkFrame(b *testing.B, bb benchmark) []byte {
 	b.Helper()
 
@@ -154,3 +395,333 @@ func constructBenchmarkFrame(b *testing.B, bb benchmark) []byte {
 
 	return frame
 }
+
+// checkProtocolError checks that the client fails the WebSocket connection
+// with [StatusProtocolError] and the given reason, after receiving the given
+// frames from the server.
+func checkProtocolError(t *testing.T, serverFrames []byte, wantReason string) {
+	t.Helper()
+
+	frames := make(chan []byte, 1)
+	s := newHijackingServer(t, func(_ net.Conn, brw *bufio.ReadWriter) {
+		_, _ = brw.Write(serverFrames)
+		_ = brw.Flush()
+		frames <- readClientFrame(t, brw)
+	})
+	defer s.Close()
+
+	c, err := Dial(t.Context(), s.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	if msg, ok := <-c.IncomingMessages(); ok {
+		t.Fatalf("Conn.IncomingMessages() = %v, want closed channel", msg)
+	}
+
+	f := <-frames
+	if got := Opcode(f[0] & 0x0f); got != OpcodeClose {
+		t.Fatalf("client frame opcode = %v, want %v", got, OpcodeClose)
+	}
+	if got := StatusCode(binary.BigEndian.Uint16(f[1:3])); got != StatusProtocolError {
+		t.Errorf("close frame status = %v, want %v", got, StatusProtocolError)
+	}
+	if got := string(f[3:]); got != wantReason {
+		t.Errorf("close frame reason = %q, want %q", got, wantReason)
+	}
+}
+
+func TestReadMessageReservedBits(t *testing.T) {
+	tests := []struct {
+		name       string
+		frames     []byte
+		wantReason string
+	}{
+		{
+			name:       "unnegotiated_compressed_frame",
+			frames:     []byte{0xc1, 0x02, 0xf2, 0x00}, // FIN + RSV1 + text.
+			wantReason: "compressed frame without negotiated compression",
+		},
+		{
+			name:       "unnegotiated_compressed_continuation",
+			frames:     []byte{0x01, 0x01, 'a', 0xc0, 0x01, 'b'}, // RSV1 + continuation.
+			wantReason: "compressed frame without negotiated compression",
+		},
+		{
+			name:       "rsv2",
+			frames:     []byte{0xa1, 0x01, 'a'}, // FIN + RSV2 + text.
+			wantReason: "invalid reserved bits",
+		},
+		{
+			name:       "rsv3",
+			frames:     []byte{0x92, 0x01, 'a'}, // FIN + RSV3 + binary.
+			wantReason: "invalid reserved bits",
+		},
+		{
+			name:       "rsv2_on_ping",
+			frames:     []byte{0xa9, 0x00}, // FIN + RSV2 + ping.
+			wantReason: "invalid reserved bits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkProtocolError(t, tt.frames, tt.wantReason)
+		})
+	}
+}
+
+func TestReadMessageReservedOpcodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		frames     []byte
+		wantReason string
+	}{
+		{
+			name:       "non_control_3",
+			frames:     []byte{0x83, 0x00}, // FIN + opcode 3.
+			wantReason: "unknown opcode 3",
+		},
+		{
+			name:       "non_control_4",
+			frames:     []byte{0x84, 0x00}, // FIN + opcode 4.
+			wantReason: "unknown opcode 4",
+		},
+		{
+			name:       "non_control_5",
+			frames:     []byte{0x85, 0x00}, // FIN + opcode 5.
+			wantReason: "unknown opcode 5",
+		},
+		{
+			name:       "non_control_6",
+			frames:     []byte{0x86, 0x00}, // FIN + opcode 6.
+			wantReason: "unknown opcode 6",
+		},
+		{
+			name:       "non_control_7",
+			frames:     []byte{0x87, 0x00}, // FIN + opcode 7.
+			wantReason: "unknown opcode 7",
+		},
+		{
+			name:       "control_11",
+			frames:     []byte{0x8b, 0x00}, // FIN + opcode 11.
+			wantReason: "unknown opcode 11",
+		},
+		{
+			name:       "control_12",
+			frames:     []byte{0x8c, 0x00}, // FIN + opcode 12.
+			wantReason: "unknown opcode 12",
+		},
+		{
+			name:       "control_13",
+			frames:     []byte{0x8d, 0x00}, // FIN + opcode 13.
+			wantReason: "unknown opcode 13",
+		},
+		{
+			name:       "control_14",
+			frames:     []byte{0x8e, 0x00}, // FIN + opcode 14.
+			wantReason: "unknown opcode 14",
+		},
+		{
+			name:       "control_15",
+			frames:     []byte{0x8f, 0x00}, // FIN + opcode 15.
+			wantReason: "unknown opcode 15",
+		},
+		{
+			name:       "inside_fragmented_message",
+			frames:     []byte{0x01, 0x01, 'a', 0x83, 0x00}, // Text without FIN, then opcode 3.
+			wantReason: "unknown opcode 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkProtocolError(t, tt.frames, tt.wantReason)
+		})
+	}
+}
+
+func TestReadMessageFragmentation(t *testing.T) {
+	tests := []struct {
+		name       string
+		frames     []byte
+		wantReason string
+	}{
+		{
+			name:       "orphan_continuation",
+			frames:     []byte{0x80, 0x01, 'a'}, // FIN + continuation.
+			wantReason: "continuation frame with nothing to continue",
+		},
+		{
+			name:       "text_in_the_middle_of_fragmentation",
+			frames:     []byte{0x01, 0x01, 'a', 0x81, 0x01, 'b'}, // Text without FIN, FIN + text.
+			wantReason: "new data frame in the middle of a fragmented message",
+		},
+		{
+			name:       "binary_after_continuation",
+			frames:     []byte{0x02, 0x01, 'a', 0x00, 0x01, 'b', 0x02, 0x01, 'c'}, // Binary, continuation, binary.
+			wantReason: "new data frame in the middle of a fragmented message",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkProtocolError(t, tt.frames, tt.wantReason)
+		})
+	}
+}
+
+func TestReadMessageInvalidControlFrames(t *testing.T) {
+	tests := []struct {
+		name       string
+		frames     []byte
+		wantReason string
+	}{
+		{
+			// The payload itself is never sent: the client must not wait for it.
+			name:       "over_length_ping",
+			frames:     []byte{0x89, 0x7e, 0x00, 0x7e}, // FIN + ping, 126 bytes.
+			wantReason: "payload length too big",
+		},
+		{
+			name:       "fragmented_close",
+			frames:     []byte{0x08, 0x02, 0x03, 0xe8}, // Close without FIN, status 1000.
+			wantReason: "control frame must not be fragmented",
+		},
+		{
+			name:       "fragmented_ping_inside_message",
+			frames:     []byte{0x01, 0x01, 'a', 0x09, 0x00}, // Text without FIN, ping without FIN.
+			wantReason: "control frame must not be fragmented",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkProtocolError(t, tt.frames, tt.wantReason)
+		})
+	}
+}
+
+func TestSendMessageContextCanceled(t *testing.T) {
+	// A connection whose writer is stuck: nothing receives from it.
+	c := &Conn{writer: make(chan internalMessage), done: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- <-c.SendTextMessageContext(ctx, []byte("text"))
+		errs <- <-c.SendBinaryMessageContext(ctx, []byte("binary"))
+	}()
+
+	for range 2 {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("send error = %v, want %v", err, context.Canceled)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("canceled send is still blocked")
+		}
+	}
+}
+
+func TestSendInvalidUTF8(t *testing.T) {
+	// Invalid text messages are rejected before they reach the (stuck) writer.
+	c := &Conn{writer: make(chan internalMessage), done: make(chan struct{})}
+
+	for _, ch := range []<-chan error{
+		c.SendTextMessage([]byte{'a', 0xff, 'b'}),
+		c.SendTextMessageContext(t.Context(), []byte{0xc3, 0x28}),
+	} {
+		if err := <-ch; !errors.Is(err, ErrInvalidUTF8) {
+			t.Errorf("send error = %v, want %v", err, ErrInvalidUTF8)
+		}
+	}
+}
+
+func TestSendAfterClose(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverClose bool
+	}{
+		{
+			name:        "closed_by_server",
+			serverClose: true,
+		},
+		{
+			name: "closing_by_client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+				if tt.serverClose {
+					_, _ = brw.Write([]byte{0x88, 0x02, 0x03, 0xe8}) // Normal closure.
+					_ = brw.Flush()
+				}
+				_, _ = io.Copy(io.Discard, brw) // Until the client closes the connection.
+				_ = conn.Close()
+			})
+			defer s.Close()
+
+			c, err := Dial(t.Context(), s.URL)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+
+			if tt.serverClose {
+				if msg, ok := <-c.IncomingMessages(); ok {
+					t.Fatalf("Conn.IncomingMessages() = %v, want closed channel", msg)
+				}
+			} else {
+				c.Close(StatusNormalClosure)
+			}
+
+			for _, ch := range []<-chan error{c.SendTextMessage([]byte("text")), c.SendBinaryMessage([]byte("binary"))} {
+				select {
+				case err := <-ch:
+					if !errors.Is(err, ErrConnClosed) {
+						t.Errorf("send error = %v, want %v", err, ErrConnClosed)
+					}
+				case <-time.After(100 * time.Millisecond):
+					t.Fatal("send after close is blocked")
+				}
+			}
+		})
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		_, _ = io.Copy(io.Discard, brw) // Never echo the close frame.
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	c, err := Dial(t.Context(), s.URL, WithCloseTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	start := time.Now()
+	c.Close(StatusNormalClosure)
+
+	select {
+	case msg, ok := <-c.IncomingMessages():
+		if ok {
+			t.Fatalf("Conn.IncomingMessages() = %v, want closed channel", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("teardown is blocked after close timeout")
+	}
+
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("teardown duration = %v, want at least the close timeout", d)
+	}
+	if !c.IsClosed() {
+		t.Error("Conn.IsClosed() = false, want true")
+	}
+}
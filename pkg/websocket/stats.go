@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"maps"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats is a snapshot of the traffic counters of a [Conn] (see [Conn.Stats]),
+// or of all the connections of a [Client] over time (see [Client.Stats]).
+type ConnStats struct {
+	// Number of frames, by opcode. Unused opcodes are omitted.
+	FramesReceived map[Opcode]uint64
+	FramesSent     map[Opcode]uint64
+
+	// Number of payload bytes, excluding frame headers.
+	BytesReceived uint64
+	BytesSent     uint64
+
+	// LastReceivedAt is when the last frame (of any type) was received, if any.
+	LastReceivedAt time.Time
+}
+
+// connStats maintains the traffic counters of a [Conn] with minimal overhead.
+type connStats struct {
+	framesIn  [16]atomic.Uint64 // Indexed by opcode.
+	framesOut [16]atomic.Uint64 // Indexed by opcode.
+	bytesIn   atomic.Uint64
+	bytesOut  atomic.Uint64
+	lastIn    atomic.Int64 // Unix time in nanoseconds.
+}
+
+func (s *connStats) received(op Opcode, n uint64) {
+	s.framesIn[op&bits4to7].Add(1)
+	s.bytesIn.Add(n)
+	s.lastIn.Store(time.Now().UnixNano())
+}
+
+func (s *connStats) sent(op Opcode, n int) {
+	s.framesOut[op&bits4to7].Add(1)
+	s.bytesOut.Add(uint64(n)) //gosec:disable G115 -- lengths are never negative
+}
+
+// Stats returns a snapshot of the connection's traffic counters.
+func (c *Conn) Stats() ConnStats {
+	s := ConnStats{
+		FramesReceived: map[Opcode]uint64{},
+		FramesSent:     map[Opcode]uint64{},
+		BytesReceived:  c.stats.bytesIn.Load(),
+		BytesSent:      c.stats.bytesOut.Load(),
+	}
+
+	for i := range c.stats.framesIn {
+		if n := c.stats.framesIn[i].Load(); n > 0 {
+			s.FramesReceived[Opcode(i)] = n
+		}
+		if n := c.stats.framesOut[i].Load(); n > 0 {
+			s.FramesSent[Opcode(i)] = n
+		}
+	}
+
+	if ns := c.stats.lastIn.Load(); ns > 0 {
+		s.LastReceivedAt = time.Unix(0, ns)
+	}
+
+	return s
+}
+
+// add returns the sum of two [ConnStats] snapshots, and the later of their
+// last frame times. It doesn't modify the maps of the original snapshots.
+func (s ConnStats) add(other ConnStats) ConnStats {
+	sum := ConnStats{
+		FramesReceived: maps.Clone(s.FramesReceived),
+		FramesSent:     maps.Clone(s.FramesSent),
+		BytesReceived:  s.BytesReceived + other.BytesReceived,
+		BytesSent:      s.BytesSent + other.BytesSent,
+		LastReceivedAt: s.LastReceivedAt,
+	}
+	if sum.FramesReceived == nil {
+		sum.FramesReceived = map[Opcode]uint64{}
+	}
+	if sum.FramesSent == nil {
+		sum.FramesSent = map[Opcode]uint64{}
+	}
+
+	for op, n := range other.FramesReceived {
+		sum.FramesReceived[op] += n
+	}
+	for op, n := range other.FramesSent {
+		sum.FramesSent[op] += n
+	}
+	if other.LastReceivedAt.After(sum.LastReceivedAt) {
+		sum.LastReceivedAt = other.LastReceivedAt
+	}
+
+	return sum
+}
+
+// Stats returns the sum of the traffic counters of all the
+// connections that the client opened, including closed ones.
+func (c *Client) Stats() ConnStats {
+	c.connsMu.RLock()
+	defer c.connsMu.RUnlock()
+
+	c.statsMu.Lock()
+	s := c.pastStats.add(ConnStats{})
+	c.statsMu.Unlock()
+
+	for _, conn := range c.conns {
+		if conn != nil {
+			s = s.add(conn.Stats())
+		}
+	}
+	return s
+}
+
+// retireStats adds the traffic counters of a connection which is being
+// replaced to the client's past counters. The caller must hold connsMu.
+func (c *Client) retireStats(conn *Conn) {
+	s := conn.Stats()
+
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.pastStats = c.pastStats.add(s)
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConnStats(t *testing.T) {
+	done := make(chan struct{})
+	s := newHijackingServer(t, func(_ net.Conn, brw *bufio.ReadWriter) {
+		// Echo the client's text message, then ping it.
+		f := readClientFrame(t, brw)
+		_, _ = brw.Write(append([]byte{0x81, byte(len(f) - 1)}, f[1:]...))
+		_, _ = brw.Write([]byte{0x89, 0x02, 'h', 'i'})
+		_ = brw.Flush()
+
+		readClientFrame(t, brw) // Pong.
+		close(done)
+	})
+	defer s.Close()
+
+	c, err := Dial(t.Context(), s.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	start := time.Now()
+	if err := <-c.SendTextMessage([]byte("hello")); err != nil {
+		t.Fatalf("SendTextMessage() error = %v", err)
+	}
+	if msg := <-c.IncomingMessages(); string(msg.Data) != "hello" {
+		t.Fatalf("IncomingMessages() = %q, want %q", msg.Data, "hello")
+	}
+	<-done
+
+	got := c.Stats()
+	want := ConnStats{
+		FramesReceived: map[Opcode]uint64{OpcodeText: 1, OpcodePing: 1},
+		FramesSent:     map[Opcode]uint64{OpcodeText: 1, OpcodePong: 1},
+		BytesReceived:  7,
+		BytesSent:      7,
+	}
+	if got.LastReceivedAt.Before(start) {
+		t.Errorf("Conn.Stats().LastReceivedAt = %v, want after %v", got.LastReceivedAt, start)
+	}
+	got.LastReceivedAt = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Conn.Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestConnStatsAdd(t *testing.T) {
+	t1 := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	s1 := ConnStats{
+		FramesReceived: map[Opcode]uint64{OpcodeText: 1},
+		FramesSent:     map[Opcode]uint64{},
+		BytesReceived:  10,
+		LastReceivedAt: t2,
+	}
+	s2 := ConnStats{
+		FramesReceived: map[Opcode]uint64{OpcodeText: 2, OpcodeClose: 1},
+		FramesSent:     map[Opcode]uint64{OpcodePong: 3},
+		BytesReceived:  5,
+		BytesSent:      4,
+		LastReceivedAt: t1,
+	}
+
+	got := s1.add(s2)
+	want := ConnStats{
+		FramesReceived: map[Opcode]uint64{OpcodeText: 3, OpcodeClose: 1},
+		FramesSent:     map[Opcode]uint64{OpcodePong: 3},
+		BytesReceived:  15,
+		BytesSent:      4,
+		LastReceivedAt: t2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConnStats.add() = %+v, want %+v", got, want)
+	}
+	if s1.FramesReceived[OpcodeText] != 1 {
+		t.Errorf("ConnStats.add() modified the original snapshot: %+v", s1)
+	}
+}
+
+func TestClientStatsAcrossReconnections(t *testing.T) {
+	s := newHijackingServer(t, func(conn net.Conn, brw *bufio.ReadWriter) {
+		_, _ = brw.Write([]byte{0x81, 0x02, 'h', 'i'})
+		_ = brw.Flush()
+		_ = conn.Close()
+	})
+	defer s.Close()
+
+	url := func(_ context.Context) (string, error) {
+		return s.URL, nil
+	}
+
+	c, err := newClient(t.Context(), url)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	go c.relayMessages()
+	defer c.close()
+
+	for range 3 {
+		select {
+		case <-c.IncomingMessages():
+		case <-time.After(time.Second):
+			t.Fatal("client didn't receive a message after reconnecting")
+		}
+	}
+
+	if got := c.Stats().FramesReceived[OpcodeText]; got < 3 {
+		t.Errorf("Client.Stats().FramesReceived[text] = %d, want at least 3", got)
+	}
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Upgrade performs the server side of a [WebSocket handshake], to accept a
+// connection from a WebSocket client. The returned [Conn] supports the same
+// read and write API as connections which are established with [Dial].
+//
+// If the client's handshake request is invalid, Upgrade responds with an
+// HTTP error and returns an error. Otherwise, it hijacks the underlying
+// network connection, so callers must not use the [http.ResponseWriter]
+// afterwards, but they may return from the HTTP handler.
+//
+// [WebSocket handshake]: https://datatracker.ietf.org/doc/html/rfc6455#section-4.2
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if status, err := checkHandshakeRequest(r); err != nil {
+		if status == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		http.Error(w, err.Error(), status)
+		return nil, err
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("failed to hijack HTTP connection for WebSocket upgrade: %w", err)
+	}
+	// Clear deadlines of the HTTP server (e.g. its read timeout), if any.
+	_ = conn.SetDeadline(time.Time{})
+
+	h := http.Header{}
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", expectedServerAcceptValue(r.Header.Get("Sec-WebSocket-Key")))
+	// Sec-WebSocket-Protocol, Sec-WebSocket-Extensions.
+
+	_, err = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	if err == nil {
+		err = h.Write(brw)
+	}
+	if err == nil {
+		_, err = brw.WriteString("\r\n")
+	}
+	if err == nil {
+		err = brw.Flush()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to send WebSocket handshake response: %w", err)
+	}
+
+	c := initConn(r.Context(), nil)
+	c.server = true
+	c.start(h, brw, conn)
+	return c, nil
+}
+
+// checkHandshakeRequest checks the client request details in
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.2.1.
+// Failures are reported with an HTTP status code for the response.
+func checkHandshakeRequest(r *http.Request) (int, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, fmt.Errorf("WebSocket handshake request method: got %q, want %q", r.Method, http.MethodGet)
+	}
+	if !r.ProtoAtLeast(1, 1) {
+		return http.StatusBadRequest, fmt.Errorf("WebSocket handshake request protocol: got %q, want HTTP/1.1 or higher", r.Proto)
+	}
+
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return http.StatusBadRequest, errors.New(`WebSocket handshake request header "Upgrade" doesn't contain "websocket"`)
+	}
+	if !headerContainsToken(r.Header, "Connection", "Upgrade") {
+		return http.StatusBadRequest, errors.New(`WebSocket handshake request header "Connection" doesn't contain "Upgrade"`)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key"))
+	if err != nil || len(key) != 16 {
+		return http.StatusBadRequest, errors.New(`WebSocket handshake request header "Sec-WebSocket-Key" isn't a base64-encoded 16-byte value`)
+	}
+
+	if got := r.Header.Get("Sec-WebSocket-Version"); got != "13" {
+		return http.StatusUpgradeRequired, fmt.Errorf(`WebSocket handshake request header "Sec-WebSocket-Version": got %q, want "13"`, got)
+	}
+
+	return 0, nil
+}
+
+// headerContainsToken reports whether any of the comma-separated
+// values of the given HTTP header is the given case-insensitive token.
+func headerContainsToken(headers http.Header, key, token string) bool {
+	for _, v := range headers.Values(key) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpgrade(t *testing.T) {
+	closed := make(chan StatusCode, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("Upgrade() error = %v", err)
+			return
+		}
+
+		// Echo every message back to the client.
+		for msg := range c.IncomingMessages() {
+			var err error
+			if msg.Opcode == OpcodeText {
+				err = <-c.SendTextMessage(msg.Data)
+			} else {
+				err = <-c.SendBinaryMessage(msg.Data)
+			}
+			if err != nil {
+				t.Errorf("server failed to echo message: %v", err)
+			}
+		}
+		closed <- c.CloseStatus()
+	}))
+	defer s.Close()
+
+	c, err := Dial(t.Context(), s.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	want := []Message{
+		{Opcode: OpcodeText, Data: []byte("hello")},
+		{Opcode: OpcodeBinary, Data: bytes.Repeat([]byte{1, 2, 3}, 300)},   // 16-bit length.
+		{Opcode: OpcodeBinary, Data: bytes.Repeat([]byte{4, 5, 6}, 30000)}, // 64-bit length.
+	}
+	for _, w := range want {
+		var err error
+		if w.Opcode == OpcodeText {
+			err = <-c.SendTextMessage(w.Data)
+		} else {
+			err = <-c.SendBinaryMessage(w.Data)
+		}
+		if err != nil {
+			t.Fatalf("client failed to send message: %v", err)
+		}
+
+		got := <-c.IncomingMessages()
+		if got.Opcode != w.Opcode || !bytes.Equal(got.Data, w.Data) {
+			t.Errorf("echoed message = %v (%d bytes), want %v (%d bytes)", got.Opcode, len(got.Data), w.Opcode, len(w.Data))
+		}
+	}
+
+	c.Close(StatusNormalClosure)
+	select {
+	case status := <-closed:
+		if status != StatusNormalClosure {
+			t.Errorf("server Conn.CloseStatus() = %v, want %v", status, StatusNormalClosure)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server connection wasn't closed")
+	}
+}
+
+func TestUpgradeInvalidHandshake(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		headers     map[string]string
+		wantStatus  int
+		wantVersion string
+	}{
+		{
+			name:       "wrong_method",
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "missing_upgrade",
+			headers:    map[string]string{"Upgrade": ""},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing_connection",
+			headers:    map[string]string{"Connection": "keep-alive"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid_key",
+			headers:    map[string]string{"Sec-WebSocket-Key": "short"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported_version",
+			headers:     map[string]string{"Sec-WebSocket-Version": "8"},
+			wantStatus:  http.StatusUpgradeRequired,
+			wantVersion: "13",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodGet
+			if tt.method != "" {
+				method = tt.method
+			}
+
+			r := httptest.NewRequest(method, "/", nil)
+			r.Header.Set("Upgrade", "websocket")
+			r.Header.Set("Connection", "keep-alive, Upgrade")
+			r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			r.Header.Set("Sec-WebSocket-Version", "13")
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			if _, err := Upgrade(w, r); err == nil {
+				t.Fatal("Upgrade() error = nil")
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("Upgrade() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Sec-WebSocket-Version"); got != tt.wantVersion {
+				t.Errorf("Upgrade() Sec-WebSocket-Version = %q, want %q", got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestUpgradeUnmaskedClientFrame(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("Upgrade() error = %v", err)
+			return
+		}
+		for range c.IncomingMessages() {
+			t.Error("server received a message from an unmasked frame")
+		}
+	}))
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(s.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	fmt.Fprintf(conn, "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("failed to read handshake response: %v", err)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q, want %q", got, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	}
+
+	_, _ = conn.Write([]byte{0x81, 0x02, 'h', 'i'}) // Unmasked text frame.
+
+	// The server's close frame must not be masked.
+	f := make([]byte, 4)
+	if _, err := io.ReadFull(br, f); err != nil {
+		t.Fatalf("failed to read server close frame: %v", err)
+	}
+	if f[0] != 0x88 || f[1]&0x80 != 0 {
+		t.Fatalf("server frame header = %#x %#x, want unmasked close frame", f[0], f[1])
+	}
+	if got := StatusCode(binary.BigEndian.Uint16(f[2:4])); got != StatusProtocolError {
+		t.Errorf("server close status = %v, want %v", got, StatusProtocolError)
+	}
+}
+
+func TestHeaderContainsToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   bool
+	}{
+		{
+			name: "missing",
+		},
+		{
+			name:   "exact",
+			values: []string{"Upgrade"},
+			want:   true,
+		},
+		{
+			name:   "case_insensitive_list",
+			values: []string{"keep-alive, upgrade"},
+			want:   true,
+		},
+		{
+			name:   "multiple_values",
+			values: []string{"keep-alive", "Upgrade"},
+			want:   true,
+		},
+		{
+			name:   "substring",
+			values: []string{"upgraded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{"Connection": tt.values}
+			if got := headerContainsToken(h, "Connection", "Upgrade"); got != tt.want {
+				t.Errorf("headerContainsToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}